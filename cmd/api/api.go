@@ -1,22 +1,40 @@
 package api
+
 import (
 	"context"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/videodownloader"
 	"github.com/kingmariano/omnicron/utils"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
 
-// starts the python fastAPI server
-func startFastAPIServer() *exec.Cmd {
+// starts the python fastAPI server on baseURL, accepting only the internal apiKey
+func startFastAPIServer(baseURL, apiKey string) *exec.Cmd {
+	env, err := sidecar.Environ(baseURL, apiKey)
+	if err != nil {
+		log.Fatalf("Failed to configure FastAPI server: %v", err)
+	}
+	if socketPath, ok := strings.CutPrefix(baseURL, "unix://"); ok {
+		// remove the socket left behind by a previous run, uvicorn can't bind to an existing file
+		if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Failed to remove stale FastAPI socket: %v", err)
+		}
+	}
 	cmd := exec.Command("python", "./python/main.py")
+	cmd.Env = env
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -37,8 +55,14 @@ func StartServer() {
 		log.Fatalf("error opening .env %v ", err)
 	}
 
+	// The python server gets its own per-boot key so the public API key never leaves this process
+	sidecarAPIKey, err := sidecar.NewSecret()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Start the FastAPI server
-	cmd := startFastAPIServer()
+	cmd := startFastAPIServer(fastAPIBaseURL, sidecarAPIKey)
 	defer func() {
 		if err := cmd.Process.Kill(); err != nil {
 			log.Printf("Failed to kill process: %v", err)
@@ -51,17 +75,60 @@ func StartServer() {
 		ReplicateAPIKey: replicateAPIKey,
 		CloudinaryURL:   cloudinaryURL,
 		FASTAPIBaseURL:  fastAPIBaseURL,
+		SidecarAPIKey:   sidecarAPIKey,
+		AdminAPIKey:     os.Getenv("ADMIN_API_KEY"),
 		Port:            port,
 	}
 
+	svc, err := newServices(cfg)
+	if err != nil {
+		log.Fatalf("error creating services %v ", err)
+	}
+	llmRouter, err := newLLMRouter(svc)
+	if err != nil {
+		log.Fatalf("error creating chat router %v ", err)
+	}
+	transcription, err := newTranscription(svc)
+	if err != nil {
+		log.Fatalf("error configuring transcription %v ", err)
+	}
+
+	// Threads and other per API key data persist in DATA_DIR
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+	db, err := store.Open(filepath.Join(dataDir, "omnicron.db"))
+	if err != nil {
+		log.Fatalf("error opening store %v ", err)
+	}
+	defer db.Close()
+
+	// Videos streamed before a restart can't be resumed from the cache anymore
+	if err := videodownloader.SweepStreams(); err != nil {
+		log.Printf("error removing streamed videos %v ", err)
+	}
+
+	// The built-in prompt templates can be overridden or versioned by the files in PROMPTS_DIR
+	registry := prompts.New()
+	if dir := os.Getenv("PROMPTS_DIR"); dir != "" {
+		if err := registry.LoadDir(dir); err != nil {
+			log.Fatalf("error loading prompt templates %v ", err)
+		}
+	}
+
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
 	v1Router := chi.NewRouter()
-	callEndpoints(v1Router, cfg)
+	callEndpoints(v1Router, cfg, svc, llmRouter, db, registry, transcription)
 	router.Mount("/api/v1", v1Router)
 
+	openaiRouter := chi.NewRouter()
+	callOpenAIEndpoints(openaiRouter, cfg, llmRouter)
+	router.Mount("/v1", openaiRouter)
+
 	server := &http.Server{
 		Addr:              ":" + port,
 		Handler:           router,
@@ -3,14 +3,22 @@ package api
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/internal/vectorstore"
 	ware "github.com/kingmariano/omnicron/middleware"
+	"github.com/kingmariano/omnicron/packages/admin"
+	"github.com/kingmariano/omnicron/packages/agent"
 	"github.com/kingmariano/omnicron/packages/convert2mp3"
 	"github.com/kingmariano/omnicron/packages/docgpt"
+	"github.com/kingmariano/omnicron/packages/embeddings"
 	"github.com/kingmariano/omnicron/packages/gpt"
 	"github.com/kingmariano/omnicron/packages/grok"
 	"github.com/kingmariano/omnicron/packages/image2text"
+	"github.com/kingmariano/omnicron/packages/llm"
 	"github.com/kingmariano/omnicron/packages/musicdownloader"
 	"github.com/kingmariano/omnicron/packages/musicsearch"
+	"github.com/kingmariano/omnicron/packages/openai"
 	"github.com/kingmariano/omnicron/packages/replicate/generateimages"
 	"github.com/kingmariano/omnicron/packages/replicate/generatemusic"
 	"github.com/kingmariano/omnicron/packages/replicate/generatevideos"
@@ -18,28 +26,85 @@ import (
 	"github.com/kingmariano/omnicron/packages/replicate/stt"
 	"github.com/kingmariano/omnicron/packages/replicate/tts"
 	"github.com/kingmariano/omnicron/packages/shazam"
+	"github.com/kingmariano/omnicron/packages/threads"
 	"github.com/kingmariano/omnicron/packages/videodownloader"
 	"github.com/kingmariano/omnicron/packages/youtubesummarize"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 )
 
-func callEndpoints(v1Router *chi.Mux, cfg *config.APIConfig){
+func callEndpoints(v1Router *chi.Mux, cfg *config.APIConfig, svc *services.Services, llmRouter *llm.Router, db *store.Store, registry *prompts.Registry, transcription youtubesummarize.Transcription) {
+	grokHandler := grok.NewHandler(svc.Chat, svc.Transcription, llmRouter)
+	threadsHandler := threads.NewHandler(db, llmRouter)
+	embeddingsHandler := embeddings.NewHandler(svc.Embeddings, vectorstore.New(db))
+	docgptHandler := docgpt.NewHandler(llmRouter, svc.Sidecar, db, embeddingsHandler, registry)
+	imageHandler := generateimages.NewHandler(svc.Predictions)
+	videoHandler := videodownloader.NewHandler(svc.Downloader, svc.Videos, svc.Playlists, svc.Transcoder, svc.Storage, db)
+	youtubeHandler := youtubesummarize.NewHandler(transcription, svc.Playlists, db, llmRouter, registry)
+	adminHandler := admin.NewHandler(registry)
+	agentHandler := agent.NewHandler(llmRouter, agent.BuiltinTools(agent.Capabilities{
+		Images:  imageHandler,
+		Videos:  videoHandler,
+		Youtube: youtubeHandler,
+		Sidecar: svc.Sidecar,
+	}))
+
 	v1Router.Get("/readiness", utils.HandleReadiness())
-	v1Router.Post("/groq/chatcompletion", ware.MiddleWareAuth(grok.ChatCompletion, cfg))
-	v1Router.Post("/groq/transcription", ware.MiddleWareAuth(grok.Transcription, cfg)) // deprecated
-	v1Router.Post("/replicate/imagegeneration", ware.MiddleWareAuth(generateimages.ImageGeneration, cfg))
-	v1Router.Post("/replicate/imageupscale", ware.MiddleWareAuth(imageupscale.ImageUpscale, cfg))
-	v1Router.Post("/replicate/videogeneration", ware.MiddleWareAuth(generatevideos.VideoGeneration, cfg))
-	v1Router.Post("/replicate/tts", ware.MiddleWareAuth(tts.TTS, cfg))
-	v1Router.Post("/replicate/stt", ware.MiddleWareAuth(stt.STT, cfg))
-	v1Router.Post("/replicate/musicgeneration", ware.MiddleWareAuth(generatemusic.MusicGen, cfg))
-	v1Router.Post("/downloadvideo", ware.MiddleWareAuth(videodownloader.DownloadVideo, cfg))
-	v1Router.Post("/convert2mp3", ware.MiddleWareAuth(convert2mp3.ConvertToMp3, cfg))
-	v1Router.Post("/downloadmusic", ware.MiddleWareAuth(musicdownloader.DownloadMusic, cfg))
-	v1Router.Post("/gpt4free", ware.MiddleWareAuth(gpt.ChatCompletion, cfg))
-	v1Router.Post("/shazam", ware.MiddleWareAuth(shazam.Shazam, cfg))
-	v1Router.Post("/musicsearch", ware.MiddleWareAuth(musicsearch.MusicSearch, cfg))
-	v1Router.Post("/youtubesummarization", ware.MiddleWareAuth(youtubesummarize.YoutubeSummarization, cfg))
-	v1Router.Post("/image2text", ware.MiddleWareAuth(image2text.Image2text, cfg))
-	v1Router.Post("/docgpt", ware.MiddleWareAuth(docgpt.DocGPT, cfg))
-}
\ No newline at end of file
+	v1Router.Post("/groq/chatcompletion", ware.MiddleWareAuth(grokHandler.ChatCompletion, cfg))
+	v1Router.Post("/groq/transcription", ware.MiddleWareAuth(grokHandler.Transcription, cfg)) // deprecated
+	v1Router.Post("/replicate/imagegeneration", ware.MiddleWareAuth(imageHandler.ImageGeneration, cfg))
+	v1Router.Post("/replicate/imageupscale", ware.MiddleWareAuth(imageupscale.NewHandler(svc.Predictions).ImageUpscale, cfg))
+	v1Router.Post("/replicate/videogeneration", ware.MiddleWareAuth(generatevideos.NewHandler(svc.Predictions).VideoGeneration, cfg))
+	v1Router.Post("/replicate/tts", ware.MiddleWareAuth(tts.NewHandler(svc.Predictions).TTS, cfg))
+	v1Router.Post("/replicate/stt", ware.MiddleWareAuth(stt.NewHandler(svc.Predictions).STT, cfg))
+	v1Router.Post("/replicate/musicgeneration", ware.MiddleWareAuth(generatemusic.NewHandler(svc.Predictions).MusicGen, cfg))
+	v1Router.Post("/downloadvideo", ware.MiddleWareAuth(videoHandler.DownloadVideo, cfg))
+	v1Router.Post("/video/info", ware.MiddleWareAuth(videoHandler.VideoInfo, cfg))
+	v1Router.Post("/downloadvideo/batch", ware.MiddleWareAuth(videoHandler.DownloadBatch, cfg))
+	v1Router.Get("/downloadvideo/jobs/{id}", ware.MiddleWareAuth(videoHandler.GetJob, cfg))
+	v1Router.Post("/convert2mp3", ware.MiddleWareAuth(convert2mp3.NewHandler(svc.Transcoder, svc.Storage).ConvertToMp3, cfg))
+	v1Router.Post("/downloadmusic", ware.MiddleWareAuth(musicdownloader.NewHandler(svc.Sidecar, svc.Downloader, svc.Transcoder, svc.Storage).DownloadMusic, cfg))
+	v1Router.Post("/gpt4free", ware.MiddleWareAuth(gpt.NewHandler(svc.Sidecar, llm.NewG4FChat(llmRouter)).ChatCompletion, cfg))
+	v1Router.Post("/shazam", ware.MiddleWareAuth(shazam.NewHandler(svc.Sidecar).Shazam, cfg))
+	v1Router.Post("/musicsearch", ware.MiddleWareAuth(musicsearch.NewHandler(svc.Sidecar).MusicSearch, cfg))
+	v1Router.Post("/youtubesummarization", ware.MiddleWareAuth(youtubeHandler.YoutubeSummarization, cfg))
+	v1Router.Post("/youtube/ask", ware.MiddleWareAuth(youtubeHandler.Ask, cfg))
+	v1Router.Post("/youtube/playlist", ware.MiddleWareAuth(youtubeHandler.SummarizePlaylist, cfg))
+	v1Router.Get("/youtube/jobs/{id}", ware.MiddleWareAuth(youtubeHandler.GetJob, cfg))
+	v1Router.Post("/image2text", ware.MiddleWareAuth(image2text.NewHandler(svc.Sidecar).Image2text, cfg))
+	v1Router.Post("/docgpt", ware.MiddleWareAuth(docgptHandler.DocGPT, cfg))
+	v1Router.Post("/documents", ware.MiddleWareAuth(docgptHandler.UploadDocument, cfg))
+	v1Router.Get("/documents", ware.MiddleWareAuth(docgptHandler.ListDocuments, cfg))
+	v1Router.Post("/documents/synthesize", ware.MiddleWareAuth(docgptHandler.Synthesize, cfg))
+	v1Router.Get("/documents/{id}", ware.MiddleWareAuth(docgptHandler.GetDocument, cfg))
+	v1Router.Delete("/documents/{id}", ware.MiddleWareAuth(docgptHandler.DeleteDocument, cfg))
+	v1Router.Post("/documents/{id}/ask", ware.MiddleWareAuth(docgptHandler.Ask, cfg))
+	v1Router.Post("/agent", ware.MiddleWareAuth(agentHandler.Completion, cfg))
+	v1Router.Post("/threads", ware.MiddleWareAuth(threadsHandler.CreateThread, cfg))
+	v1Router.Get("/threads", ware.MiddleWareAuth(threadsHandler.ListThreads, cfg))
+	v1Router.Get("/threads/{id}", ware.MiddleWareAuth(threadsHandler.GetThread, cfg))
+	v1Router.Patch("/threads/{id}", ware.MiddleWareAuth(threadsHandler.UpdateThread, cfg))
+	v1Router.Delete("/threads/{id}", ware.MiddleWareAuth(threadsHandler.DeleteThread, cfg))
+	v1Router.Post("/threads/{id}/messages", ware.MiddleWareAuth(threadsHandler.AddMessage, cfg))
+	v1Router.Get("/threads/{id}/messages", ware.MiddleWareAuth(threadsHandler.ListMessages, cfg))
+	v1Router.Post("/embeddings", ware.MiddleWareAuth(embeddingsHandler.Embeddings, cfg))
+	v1Router.Post("/collections", ware.MiddleWareAuth(embeddingsHandler.CreateCollection, cfg))
+	v1Router.Get("/collections", ware.MiddleWareAuth(embeddingsHandler.ListCollections, cfg))
+	v1Router.Get("/collections/{name}", ware.MiddleWareAuth(embeddingsHandler.GetCollection, cfg))
+	v1Router.Delete("/collections/{name}", ware.MiddleWareAuth(embeddingsHandler.DeleteCollection, cfg))
+	v1Router.Post("/collections/{name}/upsert", ware.MiddleWareAuth(embeddingsHandler.Upsert, cfg))
+	v1Router.Post("/collections/{name}/query", ware.MiddleWareAuth(embeddingsHandler.Query, cfg))
+	v1Router.Delete("/collections/{name}/items/{id}", ware.MiddleWareAuth(embeddingsHandler.DeleteItem, cfg))
+	v1Router.Get("/admin/prompts", ware.MiddleWareAdmin(adminHandler.ListPrompts, cfg))
+	v1Router.Get("/admin/prompts/{name}", ware.MiddleWareAdmin(adminHandler.GetPrompt, cfg))
+	v1Router.Post("/admin/prompts/{name}/preview", ware.MiddleWareAdmin(adminHandler.PreviewPrompt, cfg))
+}
+
+// callOpenAIEndpoints registers the OpenAI-compatible API, served under /v1.
+func callOpenAIEndpoints(openaiRouter *chi.Mux, cfg *config.APIConfig, llmRouter *llm.Router) {
+	openaiHandler := openai.NewHandler(llmRouter)
+
+	openaiRouter.Post("/chat/completions", ware.MiddleWareAuth(openaiHandler.ChatCompletions, cfg))
+	openaiRouter.Get("/models", ware.MiddleWareAuth(openaiHandler.Models, cfg))
+	openaiRouter.Get("/providers/health", ware.MiddleWareAuth(openaiHandler.Health, cfg))
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/packages/videodownloader"
+	"github.com/kingmariano/omnicron/packages/youtubesummarize"
+	"github.com/kingmariano/omnicron/services"
+)
+
+const (
+	providerTimeout = 120 * time.Second // timeout for requests to the hosted model providers
+	sidecarRetries  = 2                 // retries of transient FastAPI failures, e.g. while the server is starting
+)
+
+// newServices constructs the providers shared by every handler.
+func newServices(cfg *config.APIConfig) (*services.Services, error) {
+	downloader, err := newDownloader()
+	if err != nil {
+		return nil, err
+	}
+	if proxy := os.Getenv("DOWNLOAD_PROXY"); proxy != "" {
+		if err := videodownloader.SetLuxProxy(proxy); err != nil {
+			return nil, fmt.Errorf("invalid DOWNLOAD_PROXY: %w", err)
+		}
+	}
+	// only lux goes through the download proxy, the other clients use the proxy of the environment
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	providerClient := &http.Client{Timeout: providerTimeout, Transport: transport}
+
+	groqClient := services.NewGroqClient(cfg.GrokAPIKey, providerClient)
+	replicateClient, err := services.NewReplicateClient(cfg.ReplicateAPIKey, providerClient)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := services.NewCloudinaryStorage(cfg.CloudinaryURL, &http.Client{Transport: transport})
+	if err != nil {
+		return nil, err
+	}
+	return &services.Services{
+		Chat:          groqClient,
+		Groq:          groqClient,
+		Transcription: groqClient,
+		Predictions:   replicateClient,
+		Storage:       storage,
+		Embeddings:    newEmbeddings(replicateClient, providerClient),
+		Sidecar: sidecar.New(sidecar.Options{
+			BaseURL:    cfg.FASTAPIBaseURL,
+			APIKey:     cfg.SidecarAPIKey,
+			MaxRetries: sidecarRetries,
+			HTTPClient: &http.Client{Transport: transport},
+		}),
+		Downloader: downloader,
+		Playlists:  downloader,
+		Videos:     downloader,
+		Transcoder: services.FFmpegTranscoder{},
+	}, nil
+}
+
+// newDownloader constructs the video downloader with the policy read from DOWNLOAD_THREADS,
+// DOWNLOAD_MAX_THREADS, DOWNLOAD_RETRIES, DOWNLOAD_MAX_RETRIES, DOWNLOAD_MAX_FILE_SIZE_MB,
+// DOWNLOAD_COOKIES_DIR, DOWNLOAD_COOKIES, DOWNLOAD_PROXY and DOWNLOAD_MAX_CONCURRENT. Unset
+// variables use the defaults of videodownloader.DefaultPolicy.
+func newDownloader() (*videodownloader.LuxDownloader, error) {
+	policy := videodownloader.Policy{
+		CookiesDir: os.Getenv("DOWNLOAD_COOKIES_DIR"),
+		Cookies:    os.Getenv("DOWNLOAD_COOKIES"),
+		Proxy:      os.Getenv("DOWNLOAD_PROXY"),
+	}
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{"DOWNLOAD_THREADS", &policy.Threads},
+		{"DOWNLOAD_MAX_THREADS", &policy.MaxThreads},
+		{"DOWNLOAD_RETRIES", &policy.Retries},
+		{"DOWNLOAD_MAX_RETRIES", &policy.MaxRetries},
+		{"DOWNLOAD_MAX_CONCURRENT", &policy.MaxConcurrent},
+	}
+	for _, env := range ints {
+		value, err := intEnv(env.name)
+		if err != nil {
+			return nil, err
+		}
+		*env.value = value
+	}
+	maxFileSizeMB, err := intEnv("DOWNLOAD_MAX_FILE_SIZE_MB")
+	if err != nil {
+		return nil, err
+	}
+	policy.MaxFileSize = int64(maxFileSizeMB) << 20
+	downloader, err := videodownloader.NewLuxDownloader(policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download settings: %w", err)
+	}
+	return downloader, nil
+}
+
+// intEnv returns the non-negative integer in the environment variable name, or 0 if it is unset.
+func intEnv(name string) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 || value > math.MaxInt32 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return value, nil
+}
+
+// newEmbeddings constructs the embedding provider selected by EMBEDDINGS_PROVIDER: "replicate"
+// (the default) runs EMBEDDINGS_MODEL or all-mpnet-base-v2 on Replicate, and "openai" calls the
+// OpenAI-compatible API at EMBEDDINGS_URL with EMBEDDINGS_API_KEY.
+func newEmbeddings(predictions services.PredictionProvider, httpClient *http.Client) services.EmbeddingProvider {
+	model := os.Getenv("EMBEDDINGS_MODEL")
+	if os.Getenv("EMBEDDINGS_PROVIDER") == "openai" {
+		baseURL := os.Getenv("EMBEDDINGS_URL")
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		if model == "" {
+			model = "text-embedding-3-small"
+		}
+		return services.NewOpenAIEmbeddings(baseURL, os.Getenv("EMBEDDINGS_API_KEY"), model, httpClient)
+	}
+	if model == "" {
+		model = services.DefaultReplicateEmbeddingModel
+	}
+	return services.NewReplicateEmbeddings(predictions, model)
+}
+
+// newTranscription constructs the speech to text services of the YouTube summarizer. Videos are
+// transcribed with YOUTUBE_TRANSCRIBER, "replicate" (the default) or "groq", unless the request
+// chooses another.
+func newTranscription(svc *services.Services) (youtubesummarize.Transcription, error) {
+	transcriber := os.Getenv("YOUTUBE_TRANSCRIBER")
+	if transcriber != "" && transcriber != youtubesummarize.TranscriberReplicate && transcriber != youtubesummarize.TranscriberGroq {
+		return youtubesummarize.Transcription{}, fmt.Errorf("YOUTUBE_TRANSCRIBER must be %q or %q", youtubesummarize.TranscriberReplicate, youtubesummarize.TranscriberGroq)
+	}
+	return youtubesummarize.Transcription{
+		Default:     transcriber,
+		Predictions: svc.Predictions,
+		Groq:        svc.Transcription,
+		Downloader:  svc.Downloader,
+		Transcoder:  svc.Transcoder,
+	}, nil
+}
+
+// newLLMRouter constructs the chat router shared by the OpenAI-compatible API, groq and docgpt.
+// The Groq models and the model aliases are read from the JSON file in MODELS_CONFIG, if set.
+func newLLMRouter(svc *services.Services) (*llm.Router, error) {
+	modelsCfg := llm.DefaultConfig()
+	if path := os.Getenv("MODELS_CONFIG"); path != "" {
+		var err error
+		if modelsCfg, err = llm.LoadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	return llm.NewRouter(modelsCfg,
+		llm.NewGroqProvider(svc.Groq, modelsCfg.GroqModels),
+		llm.NewG4FProvider(svc.Sidecar),
+		llm.NewReplicateProvider(svc.Predictions),
+	)
+}
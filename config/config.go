@@ -26,5 +26,7 @@ type APIConfig struct {
 	ReplicateAPIKey string
 	CloudinaryURL   string
 	FASTAPIBaseURL  string
+	SidecarAPIKey   string // per-boot key for the python server, never the public APIKey
+	AdminAPIKey     string // key of the admin endpoints, which are disabled when it is empty
 	Port            string
 }
@@ -13,10 +13,14 @@ require (
 	github.com/iawia002/lux v0.24.1
 	github.com/joho/godotenv v1.5.1
 	github.com/jpoz/groq v0.0.0-20240513145022-7a02894105a0
+	github.com/kkdai/youtube/v2 v2.10.1
+	github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
 	github.com/replicate/replicate-go v0.22.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/stretchr/testify v1.9.0
 	github.com/u2takey/ffmpeg-go v0.5.0
-	go.uber.org/zap v1.27.0
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/net v0.28.0
 )
 
 require (
@@ -52,7 +56,6 @@ require (
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/kennygrant/sanitize v1.2.4 // indirect
-	github.com/kkdai/youtube/v2 v2.10.1 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
@@ -71,8 +74,6 @@ require (
 	github.com/u2takey/go-utils v0.3.1 // indirect
 	github.com/urfave/cli/v2 v2.27.4 // indirect
 	github.com/xrash/smetrics v0.0.0-20240521201337-686a1a2994c1 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/net v0.28.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.24.0 // indirect
 	golang.org/x/text v0.17.0 // indirect
@@ -0,0 +1,193 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package clip parses the start, end and segments of download and conversion requests and cuts
+// those parts out of the downloaded or converted file.
+package clip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSegments is the most segments a request may cut.
+const MaxSegments = 20
+
+// ErrInvalid is returned for timestamps and segments that can't be cut.
+var ErrInvalid = errors.New("invalid clip")
+
+// Segment is a part of a media file. An End of zero is the end of the file.
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Range is a segment as sent in a request, with timestamps such as 90, 1:30 or 0:01:30.5.
+type Range struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Options are the clip fields of a request. Start and End cut a single clip, Segments several.
+// Join joins the clips into one file instead of returning each of them.
+type Options struct {
+	Start    string  `json:"start,omitempty"`
+	End      string  `json:"end,omitempty"`
+	Segments []Range `json:"segments,omitempty"`
+	Join     bool    `json:"join,omitempty"`
+	Reencode bool    `json:"reencode,omitempty"`
+}
+
+// Result is a clip uploaded for the client, timed in seconds.
+type Result struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end,omitempty"`
+	URL   string  `json:"url"`
+}
+
+// Transcoder cuts and joins media files.
+type Transcoder interface {
+	Clip(ctx context.Context, inputFilePath, outputFile string, start, end time.Duration, reencode bool) error
+	Concat(ctx context.Context, inputFiles []string, outputFile string, reencode bool) error
+}
+
+// FormOptions reads Options from the form values start, end, segments, join and reencode.
+// segments is a comma separated list of ranges such as "0:10-0:20,1:00-1:30".
+func FormOptions(values func(key string) string) (Options, error) {
+	opts := Options{Start: values("start"), End: values("end")}
+	if segments := strings.TrimSpace(values("segments")); segments != "" {
+		for _, item := range strings.Split(segments, ",") {
+			start, end, ok := strings.Cut(strings.TrimSpace(item), "-")
+			if !ok {
+				return Options{}, fmt.Errorf("%w: segment %q is not start-end", ErrInvalid, item)
+			}
+			opts.Segments = append(opts.Segments, Range{Start: start, End: end})
+		}
+	}
+	for key, flag := range map[string]*bool{"join": &opts.Join, "reencode": &opts.Reencode} {
+		if value := values(key); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return Options{}, fmt.Errorf("%w: %s must be true or false", ErrInvalid, key)
+			}
+			*flag = parsed
+		}
+	}
+	return opts, nil
+}
+
+// Parse returns the segments of o, or none when o doesn't clip.
+func (o Options) Parse() ([]Segment, error) {
+	ranges := o.Segments
+	if o.Start != "" || o.End != "" {
+		if len(ranges) > 0 {
+			return nil, fmt.Errorf("%w: send either start and end or segments", ErrInvalid)
+		}
+		ranges = []Range{{Start: o.Start, End: o.End}}
+	}
+	if len(ranges) > MaxSegments {
+		return nil, fmt.Errorf("%w: at most %d segments can be cut", ErrInvalid, MaxSegments)
+	}
+	segments := make([]Segment, 0, len(ranges))
+	for _, r := range ranges {
+		segment, err := r.parse()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+func (r Range) parse() (Segment, error) {
+	var segment Segment
+	var err error
+	if r.Start != "" {
+		if segment.Start, err = ParseTimestamp(r.Start); err != nil {
+			return Segment{}, err
+		}
+	}
+	if r.End != "" {
+		if segment.End, err = ParseTimestamp(r.End); err != nil {
+			return Segment{}, err
+		}
+		if segment.End <= segment.Start {
+			return Segment{}, fmt.Errorf("%w: segment %s-%s ends before it starts", ErrInvalid, r.Start, r.End)
+		}
+	}
+	return segment, nil
+}
+
+// ParseTimestamp parses seconds, MM:SS or HH:MM:SS, with optional fractional seconds.
+func ParseTimestamp(timestamp string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(timestamp), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("%w: timestamp %q", ErrInvalid, timestamp)
+	}
+	var seconds float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 || (i < len(parts)-1 && value != float64(int(value))) {
+			return 0, fmt.Errorf("%w: timestamp %q", ErrInvalid, timestamp)
+		}
+		if i > 0 && value >= 60 {
+			return 0, fmt.Errorf("%w: timestamp %q", ErrInvalid, timestamp)
+		}
+		seconds = seconds*60 + value
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Cut cuts segments out of input and returns the clips, in order, or a single file joining them
+// when join is set. The clips are written next to input.
+func Cut(ctx context.Context, transcoder Transcoder, input string, segments []Segment, join, reencode bool) ([]string, error) {
+	ext := filepath.Ext(input)
+	base := strings.TrimSuffix(input, ext)
+	clips := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		output := fmt.Sprintf("%s_clip%d%s", base, i+1, ext)
+		if err := transcoder.Clip(ctx, input, output, segment.Start, segment.End, reencode); err != nil {
+			return nil, err
+		}
+		clips = append(clips, output)
+	}
+	if !join || len(clips) < 2 {
+		return clips, nil
+	}
+	output := base + "_clips" + ext
+	if err := transcoder.Concat(ctx, clips, output, reencode); err != nil {
+		return nil, err
+	}
+	return []string{output}, nil
+}
+
+// Results pairs the URLs of the uploaded clips with their segments.
+func Results(segments []Segment, urls []string) []Result {
+	results := make([]Result, len(urls))
+	for i, url := range urls {
+		results[i] = Result{Start: segments[i].Start.Seconds(), End: segments[i].End.Seconds(), URL: url}
+	}
+	return results
+}
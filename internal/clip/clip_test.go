@@ -0,0 +1,114 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package clip
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90":        90 * time.Second,
+		"1:30":      90 * time.Second,
+		"0:01:30.5": 90*time.Second + 500*time.Millisecond,
+		"1:00:00":   time.Hour,
+	}
+	for timestamp, want := range tests {
+		got, err := ParseTimestamp(timestamp)
+		if err != nil || got != want {
+			t.Errorf("ParseTimestamp(%q) = %v, %v, want %v", timestamp, got, err, want)
+		}
+	}
+	for _, timestamp := range []string{"", "1:2:3:4", "1:75", "-5", "1.5:00", "abc"} {
+		if _, err := ParseTimestamp(timestamp); !errors.Is(err, ErrInvalid) {
+			t.Errorf("ParseTimestamp(%q) error = %v, want ErrInvalid", timestamp, err)
+		}
+	}
+}
+
+func TestFormOptions(t *testing.T) {
+	values := map[string]string{"segments": "0:10-0:20, 1:00-", "join": "true"}
+	opts, err := FormOptions(func(key string) string { return values[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, err := opts.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Segment{{Start: 10 * time.Second, End: 20 * time.Second}, {Start: time.Minute}}
+	if !reflect.DeepEqual(segments, want) || !opts.Join {
+		t.Errorf("segments = %v, join = %v", segments, opts.Join)
+	}
+
+	for _, opts := range []Options{
+		{Start: "0:20", End: "0:10"},
+		{Start: "0:10", Segments: []Range{{Start: "1:00"}}},
+		{Segments: make([]Range, MaxSegments+1)},
+	} {
+		if _, err := opts.Parse(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%+v: error = %v, want ErrInvalid", opts, err)
+		}
+	}
+}
+
+type fakeTranscoder struct {
+	clips  []string
+	joined []string
+}
+
+func (f *fakeTranscoder) Clip(ctx context.Context, input, output string, start, end time.Duration, reencode bool) error {
+	f.clips = append(f.clips, output)
+	return nil
+}
+
+func (f *fakeTranscoder) Concat(ctx context.Context, inputs []string, output string, reencode bool) error {
+	f.joined = append(f.joined, inputs...)
+	return nil
+}
+
+func TestCut(t *testing.T) {
+	segments := []Segment{{End: 10 * time.Second}, {Start: time.Minute}}
+	transcoder := &fakeTranscoder{}
+	clips, err := Cut(context.Background(), transcoder, "dl/video.mp4", segments, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dl/video_clip1.mp4", "dl/video_clip2.mp4"}; !reflect.DeepEqual(clips, want) {
+		t.Errorf("clips = %v, want %v", clips, want)
+	}
+
+	transcoder = &fakeTranscoder{}
+	clips, err = Cut(context.Background(), transcoder, "dl/video.mp4", segments, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dl/video_clips.mp4"}; !reflect.DeepEqual(clips, want) {
+		t.Errorf("joined = %v, want %v", clips, want)
+	}
+	if !reflect.DeepEqual(transcoder.joined, transcoder.clips) {
+		t.Errorf("joined %v, want the clips %v", transcoder.joined, transcoder.clips)
+	}
+}
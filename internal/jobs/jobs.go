@@ -0,0 +1,200 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package jobs runs background jobs made of items, such as the videos of a playlist, and keeps
+// their progress in the store so it can be polled. Jobs belong to an owner, see auth.Owner.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/store"
+)
+
+// Job and item statuses.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	// StatusPartial is a job with some items that failed.
+	StatusPartial = "partial"
+	StatusFailed  = "failed"
+	// StatusInterrupted is a job that was running when the server stopped.
+	StatusInterrupted = "interrupted"
+)
+
+// Progress is the state every job has, embedded in the job types.
+type Progress struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total"`
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// New returns the progress of a new running job.
+func New() Progress {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	now := time.Now().UTC()
+	return Progress{ID: "job_" + hex.EncodeToString(b), Status: StatusRunning, CreatedAt: now, UpdatedAt: now}
+}
+
+func (p *Progress) progress() *Progress { return p }
+
+// Item is the state every item of a job has, embedded in the item types.
+type Item struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Job is a pointer to a job type embedding Progress.
+type Job interface {
+	progress() *Progress
+	// Len returns the number of items of the job, and Item the i-th of them.
+	Len() int
+	Item(i int) *Item
+}
+
+// Store saves the jobs of one kind in a store and knows which of them run in this process.
+type Store[J Job] struct {
+	store  *store.Store
+	bucket string
+	// active holds the IDs of the jobs running in this process.
+	active sync.Map
+}
+
+// NewStore returns a Store keeping jobs in bucket of s.
+func NewStore[J Job](s *store.Store, bucket string) *Store[J] {
+	return &Store[J]{store: s, bucket: bucket}
+}
+
+func (s *Store[J]) path(owner string) []string {
+	return []string{s.bucket, owner}
+}
+
+// Start saves the job of owner and calls run with it in the background, with a context that
+// expires after timeout. It returns a copy of the job as saved.
+func (s *Store[J]) Start(owner string, job J, timeout time.Duration, run func(ctx context.Context, r *Run[J])) (J, error) {
+	var saved J
+	job.progress().Total = job.Len()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return saved, err
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return saved, err
+	}
+	if err := s.store.Put(s.path(owner), job.progress().ID, job); err != nil {
+		return saved, err
+	}
+	id := job.progress().ID
+	s.active.Store(id, true)
+	// the job outlives the request
+	go func() {
+		defer s.active.Delete(id)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		run(ctx, &Run[J]{job: job, owner: owner, store: s})
+	}()
+	return saved, nil
+}
+
+// Load returns the job id of owner. A running job that isn't running in this process was
+// interrupted by a restart.
+func (s *Store[J]) Load(owner, id string) (J, error) {
+	var job J
+	if err := s.store.Get(s.path(owner), id, &job); err != nil {
+		return job, err
+	}
+	if p := job.progress(); p.Status == StatusRunning {
+		if _, ok := s.active.Load(id); !ok {
+			p.Status = StatusInterrupted
+		}
+	}
+	return job, nil
+}
+
+// Run is a job running in this process. The job is only accessed under the lock of the run.
+type Run[J Job] struct {
+	mu    sync.Mutex
+	job   J
+	owner string
+	store *Store[J]
+}
+
+// Read calls read with the job under the lock of the run.
+func (r *Run[J]) Read(read func(job J)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	read(r.job)
+}
+
+// Update applies update to the job under the lock of the run and saves it.
+func (r *Run[J]) Update(update func(job J)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	update(r.job)
+	p := r.job.progress()
+	p.UpdatedAt = time.Now().UTC()
+	if err := r.store.store.Put(r.store.path(r.owner), p.ID, r.job); err != nil {
+		log.Printf("failed to save job %s: %v", p.ID, err)
+	}
+}
+
+// Each calls process for every item of the job, concurrency at a time, and saves the progress
+// of the items. An item fails with the error process returns, otherwise it completes and the
+// result process returns is applied to the job.
+func (r *Run[J]) Each(concurrency int, process func(i int) (result func(job J), err error)) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range r.job.Len() {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r.Update(func(job J) { job.Item(i).Status = StatusRunning })
+			result, err := process(i)
+			r.Update(func(job J) {
+				item, p := job.Item(i), job.progress()
+				if err != nil {
+					item.Status, item.Error = StatusFailed, err.Error()
+					p.Failed++
+					return
+				}
+				item.Status = StatusCompleted
+				if result != nil {
+					result(job)
+				}
+				p.Completed++
+			})
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/store"
+)
+
+type testJob struct {
+	Progress
+	Items []testItem `json:"items"`
+}
+
+type testItem struct {
+	Item
+	Result int `json:"result"`
+}
+
+func (j *testJob) Len() int         { return len(j.Items) }
+func (j *testJob) Item(i int) *Item { return &j.Items[i].Item }
+
+func TestRunSavesProgress(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	jobs := NewStore[*testJob](s, "test_jobs")
+
+	done := make(chan struct{})
+	release := make(chan struct{})
+	job := &testJob{Progress: New(), Items: make([]testItem, 3)}
+	saved, err := jobs.Start("owner", job, time.Minute, func(ctx context.Context, run *Run[*testJob]) {
+		defer close(done)
+		<-release
+		run.Each(2, func(i int) (func(job *testJob), error) {
+			if i == 1 {
+				return nil, errors.New("broken")
+			}
+			return func(job *testJob) { job.Items[i].Result = i + 1 }, nil
+		})
+		run.Update(func(job *testJob) { job.Status = StatusPartial })
+	})
+	if err != nil || saved == job || saved.Total != 3 || saved.Status != StatusRunning {
+		t.Fatalf("expected a copy of the running job, got %+v, %v", saved, err)
+	}
+	if got, err := jobs.Load("owner", job.ID); err != nil || got.Status != StatusRunning {
+		t.Fatalf("expected the job to be running, got %+v, %v", got, err)
+	}
+	close(release)
+	<-done
+
+	got, err := jobs.Load("owner", job.ID)
+	if err != nil || got.Status != StatusPartial || got.Completed != 2 || got.Failed != 1 {
+		t.Fatalf("unexpected job %+v, %v", got, err)
+	}
+	if got.Items[1].Status != StatusFailed || got.Items[1].Error != "broken" || got.Items[2].Status != StatusCompleted || got.Items[2].Result != 3 {
+		t.Errorf("unexpected items %+v", got.Items)
+	}
+
+	// a running job saved by a previous process was interrupted
+	if err := s.Put([]string{"test_jobs", "owner"}, "job_old", &testJob{Progress: Progress{ID: "job_old", Status: StatusRunning}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := jobs.Load("owner", "job_old"); err != nil || got.Status != StatusInterrupted {
+		t.Errorf("expected the job to be interrupted, got %+v, %v", got, err)
+	}
+	if _, err := jobs.Load("other", job.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected the job of another owner to be missing, got %v", err)
+	}
+}
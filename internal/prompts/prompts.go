@@ -0,0 +1,223 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package prompts holds the system prompts of the built-in AI features as named, versioned
+// text/template templates. The defaults are embedded; files in a directory can override them
+// or add new versions.
+//
+// A template file is named <name>.v<version>.tmpl and may start with a front matter of
+// "key: value" lines between two "---" lines, setting its description and default model:
+//
+//	---
+//	description: Answers questions about a document
+//	model: long-context
+//	---
+//	You are DocGPT. {{.Text}}
+package prompts
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+// ErrNotFound is returned for a template name or version that doesn't exist.
+var ErrNotFound = errors.New("prompt template not found")
+
+// Template is a version of a prompt template.
+type Template struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version"`
+	Description string `json:"description,omitempty"`
+	// Model is the model used with the template when the request doesn't choose one.
+	Model  string `json:"model,omitempty"`
+	Source string `json:"source"`
+	// Origin is the file the template was loaded from, or "builtin".
+	Origin string `json:"origin"`
+	tmpl   *template.Template
+}
+
+// Execute renders the template with data. Missing map keys are errors.
+func (t *Template) Execute(data interface{}) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("prompt template %s.v%d: %w", t.Name, t.Version, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Registry holds the templates by name and version.
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]map[int]*Template
+}
+
+// New returns a Registry with the built-in templates.
+func New() *Registry {
+	r := &Registry{templates: map[string]map[int]*Template{}}
+	if err := r.load(builtin, "templates", "builtin"); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// LoadDir adds the templates of dir, replacing templates with the same name and version.
+func (r *Registry) LoadDir(dir string) error {
+	return r.load(os.DirFS(dir), ".", dir)
+}
+
+func (r *Registry) load(fsys fs.FS, dir, origin string) error {
+	names, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.tmpl")))
+	if err != nil {
+		return err
+	}
+	for _, file := range names {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		t, err := parse(filepath.Base(file), string(data))
+		if err != nil {
+			return err
+		}
+		if origin != "builtin" {
+			t.Origin = filepath.Join(origin, filepath.Base(file))
+		} else {
+			t.Origin = origin
+		}
+		r.mu.Lock()
+		if r.templates[t.Name] == nil {
+			r.templates[t.Name] = map[int]*Template{}
+		}
+		r.templates[t.Name][t.Version] = t
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// parse parses a template file named <name>.v<version>.tmpl.
+func parse(filename, source string) (*Template, error) {
+	base := strings.TrimSuffix(filename, ".tmpl")
+	i := strings.LastIndex(base, ".v")
+	if i <= 0 {
+		return nil, fmt.Errorf("prompt template %s: file name must be <name>.v<version>.tmpl", filename)
+	}
+	version, err := strconv.Atoi(base[i+2:])
+	if err != nil || version < 1 {
+		return nil, fmt.Errorf("prompt template %s: invalid version %q", filename, base[i+2:])
+	}
+	t := &Template{Name: base[:i], Version: version}
+	if rest, ok := strings.CutPrefix(source, "---\n"); ok {
+		header, body, ok := strings.Cut(rest, "\n---\n")
+		if !ok {
+			return nil, fmt.Errorf("prompt template %s: front matter isn't closed by ---", filename)
+		}
+		scanner := bufio.NewScanner(strings.NewReader(header))
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), ":")
+			switch strings.TrimSpace(key) {
+			case "description":
+				t.Description = strings.TrimSpace(value)
+			case "model":
+				t.Model = strings.TrimSpace(value)
+			}
+		}
+		source = body
+	}
+	t.Source = source
+	if t.tmpl, err = template.New(filename).Option("missingkey=error").Parse(source); err != nil {
+		return nil, fmt.Errorf("prompt template %s: %w", filename, err)
+	}
+	return t, nil
+}
+
+// Get returns the template referenced as "name" for its latest version or "name@version".
+func (r *Registry) Get(ref string) (*Template, error) {
+	name, version, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.templates[name]
+	if version == 0 {
+		for v := range versions {
+			version = max(version, v)
+		}
+	}
+	t, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	return t, nil
+}
+
+// ParseRef splits a template reference into its name and version, which is 0 for the latest.
+func ParseRef(ref string) (string, int, error) {
+	name, v, ok := strings.Cut(ref, "@")
+	if !ok {
+		return name, 0, nil
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("%w: invalid version in %q", ErrNotFound, ref)
+	}
+	return name, version, nil
+}
+
+// Render renders the template referenced by ref with data.
+func (r *Registry) Render(ref string, data interface{}) (string, error) {
+	t, err := r.Get(ref)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(data)
+}
+
+// List returns every version of every template, by name and version.
+func (r *Registry) List() []*Template {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var templates []*Template
+	for _, versions := range r.templates {
+		for _, t := range versions {
+			templates = append(templates, t)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].Version < templates[j].Version
+	})
+	return templates
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package prompts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, dir, name, source string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuiltinTemplatesRender(t *testing.T) {
+	r := New()
+	data := struct {
+		Filename, Text, Excerpts, None, Mode, URL, Title string
+		Partial                                          bool
+		Count                                            int
+	}{Filename: "a.pdf", Text: "[Page 1]\nhello", Mode: "compare", Count: 2}
+	for _, tmpl := range r.List() {
+		if tmpl.Origin != "builtin" || tmpl.Model == "" || tmpl.Description == "" {
+			t.Errorf("%s: unexpected template %+v", tmpl.Name, tmpl)
+		}
+		if _, err := tmpl.Execute(data); err != nil {
+			t.Errorf("%s: %v", tmpl.Name, err)
+		}
+	}
+}
+
+func TestLoadDirAddsVersions(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "docgpt.document.v2.tmpl", "---\ndescription: Shorter\nmodel: fast\n---\nRead {{.Filename}}.\n")
+	r := New()
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := r.Get("docgpt.document")
+	if err != nil || latest.Version != 2 || latest.Model != "fast" || latest.Description != "Shorter" {
+		t.Fatalf("expected version 2 to be the latest, got %+v, %v", latest, err)
+	}
+	if latest.Origin != filepath.Join(dir, "docgpt.document.v2.tmpl") {
+		t.Errorf("unexpected origin %q", latest.Origin)
+	}
+	prompt, err := r.Render("docgpt.document@v2", map[string]string{"Filename": "a.pdf"})
+	if err != nil || prompt != "Read a.pdf." {
+		t.Errorf("unexpected prompt %q, %v", prompt, err)
+	}
+	v1, err := r.Render("docgpt.document@1", map[string]string{"Filename": "a.pdf", "Text": "hello"})
+	if err != nil || !strings.Contains(v1, "hello") {
+		t.Errorf("expected version 1 to remain, got %q, %v", v1, err)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	r := New()
+	for _, ref := range []string{"missing", "docgpt.document@9", "docgpt.document@x"} {
+		if _, err := r.Get(ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", ref, err)
+		}
+	}
+	if _, err := r.Render("docgpt.document", map[string]string{}); err == nil {
+		t.Error("expected an error for missing data")
+	}
+
+	dir := t.TempDir()
+	writeTemplate(t, dir, "broken.v1.tmpl", "{{.Text")
+	if err := New().LoadDir(dir); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+	dir = t.TempDir()
+	writeTemplate(t, dir, "noversion.tmpl", "hi")
+	if err := New().LoadDir(dir); err == nil {
+		t.Error("expected an error for a file name without version")
+	}
+}
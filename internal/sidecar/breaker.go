@@ -0,0 +1,96 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// breaker is a consecutive-failure circuit breaker.
+// After threshold failures in a row it opens and rejects calls for openTimeout,
+// then lets a single trial call through: success closes it again, failure reopens it.
+type breaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	failures    int
+	openedAt    time.Time
+	trial       bool
+	now         func() time.Time
+}
+
+func newBreaker(threshold int, openTimeout time.Duration) *breaker {
+	return &breaker{threshold: threshold, openTimeout: openTimeout, now: time.Now}
+}
+
+// allow reports whether a call may be made.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || b.now().Sub(b.openedAt) < b.openTimeout {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record updates the breaker with the outcome of a call made with ctx.
+// Errors the server reported about the request itself don't count as failures, and calls the
+// caller cancelled or let run past its own deadline neither count nor reset the failures.
+func (b *breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if err != nil && endedByCaller(ctx) {
+		return
+	}
+	if err == nil || !countsAsFailure(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
+
+func countsAsFailure(err error) bool {
+	var sidecarErr *Error
+	if errors.As(err, &sidecarErr) {
+		return sidecarErr.StatusCode >= 500 || sidecarErr.Temporary()
+	}
+	return true
+}
+
+// errEndpointTimeout is the cause of contexts ended by the endpoint timeout.
+var errEndpointTimeout = errors.New("sidecar endpoint timeout")
+
+// endedByCaller reports whether ctx, created with the endpoint timeout, was cancelled by the
+// caller or reached the caller's deadline rather than the endpoint timeout.
+func endedByCaller(ctx context.Context) bool {
+	return ctx.Err() != nil && context.Cause(ctx) != errEndpointTimeout
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package sidecar is the client for the python FastAPI server that runs next to the Go process.
+// Every call goes through one shared http.Client with a per-endpoint timeout, is retried on
+// transient failures and is short-circuited while the server keeps failing.
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Endpoints exposed by the FastAPI server.
+const (
+	EndpointChatCompletion = "/api/v1/chat/completion"
+	EndpointShazam         = "/api/v1/shazam"
+	EndpointSearchSong     = "/api/v1/search-song"
+	EndpointImageToText    = "/api/v1/image_to_text"
+	EndpointSearchYoutube  = "/api/v1/search_youtube"
+	EndpointDocAnalyze     = "/api/v1/doc_analyze"
+)
+
+// DefaultTimeout is used for endpoints without an entry in endpointTimeouts.
+const DefaultTimeout = 60 * time.Second
+
+// endpointTimeouts holds the default timeout of each endpoint.
+// g4f and OCR can take minutes, searches should answer quickly.
+var endpointTimeouts = map[string]time.Duration{
+	EndpointChatCompletion: 300 * time.Second,
+	EndpointShazam:         60 * time.Second,
+	EndpointSearchSong:     30 * time.Second,
+	EndpointImageToText:    120 * time.Second,
+	EndpointSearchYoutube:  60 * time.Second,
+	EndpointDocAnalyze:     300 * time.Second,
+}
+
+// idempotentEndpoints can be repeated after a transport error without side effects. The other
+// endpoints generate or analyze on every call, so a request that may have reached the server
+// is not sent again.
+var idempotentEndpoints = map[string]bool{
+	EndpointShazam:        true,
+	EndpointSearchSong:    true,
+	EndpointImageToText:   true,
+	EndpointSearchYoutube: true,
+}
+
+// Options configures a Client.
+type Options struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	// MaxRetries is the number of times a call is retried after a retryable failure.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry; it doubles on every further attempt.
+	RetryBackoff time.Duration
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before a trial call is let through.
+	OpenTimeout time.Duration
+}
+
+// Client calls the FastAPI server.
+type Client struct {
+	baseURL      string
+	apiKey       string
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	breaker      *breaker
+}
+
+// New returns a Client configured with opts. Zero values fall back to sensible defaults.
+// A BaseURL of the form unix:///path/to/socket connects over a unix domain socket.
+func New(opts Options) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{}
+	}
+	if socketPath, ok := strings.CutPrefix(opts.BaseURL, "unix://"); ok {
+		opts.HTTPClient = unixClient(opts.HTTPClient, socketPath)
+		opts.BaseURL = "http://sidecar"
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+	if opts.FailureThreshold == 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.OpenTimeout == 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+	return &Client{
+		baseURL:      opts.BaseURL,
+		apiKey:       opts.APIKey,
+		httpClient:   opts.HTTPClient,
+		maxRetries:   opts.MaxRetries,
+		retryBackoff: opts.RetryBackoff,
+		breaker:      newBreaker(opts.FailureThreshold, opts.OpenTimeout),
+	}
+}
+
+// unixClient returns a copy of client that dials socketPath for every request.
+func unixClient(client *http.Client, socketPath string) *http.Client {
+	var dialer net.Dialer
+	unixClient := *client
+	unixClient.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &unixClient
+}
+
+// callOptions holds the settings of a single call.
+type callOptions struct {
+	timeout    time.Duration
+	maxRetries int
+}
+
+// CallOption overrides a setting for a single call.
+type CallOption func(*callOptions)
+
+// WithTimeout overrides the endpoint timeout for a single call.
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetries overrides the number of retries for a single call.
+func WithRetries(retries int) CallOption {
+	return func(o *callOptions) {
+		o.maxRetries = retries
+	}
+}
+
+// PostJSON posts request as JSON to endpoint and decodes the response into response.
+func (c *Client) PostJSON(ctx context.Context, endpoint string, request, response interface{}, opts ...CallOption) error {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return c.post(ctx, endpoint, "application/json", jsonData, response, opts)
+}
+
+// PostFile posts file as the "file" field of a multipart form to endpoint and decodes the response into response.
+func (c *Client) PostFile(ctx context.Context, endpoint string, file io.Reader, filename string, response interface{}, opts ...CallOption) error {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	fw, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := io.Copy(fw, file); err != nil {
+		return fmt.Errorf("failed to copy file to form field: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+	return c.post(ctx, endpoint, w.FormDataContentType(), b.Bytes(), response, opts)
+}
+
+// PostStream posts request as JSON to endpoint and returns the body of the streamed response.
+// Only establishing the stream is retried. The endpoint timeout covers the whole stream and
+// ends when the caller closes the body.
+func (c *Client) PostStream(ctx context.Context, endpoint string, request interface{}, opts ...CallOption) (io.ReadCloser, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	callOpts := c.callOptions(endpoint, opts)
+	ctx, cancel := context.WithTimeoutCause(ctx, callOpts.timeout, errEndpointTimeout)
+	resp, err := c.send(ctx, endpoint, "application/json", jsonData, callOpts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &streamBody{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// streamBody releases the call's context when the stream is closed.
+type streamBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *streamBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// callOptions returns the settings of a call to endpoint.
+func (c *Client) callOptions(endpoint string, opts []CallOption) callOptions {
+	callOpts := callOptions{timeout: DefaultTimeout, maxRetries: c.maxRetries}
+	if timeout, ok := endpointTimeouts[endpoint]; ok {
+		callOpts.timeout = timeout
+	}
+	for _, opt := range opts {
+		opt(&callOpts)
+	}
+	return callOpts
+}
+
+// post sends body to endpoint and decodes the response into response.
+func (c *Client) post(ctx context.Context, endpoint, contentType string, body []byte, response interface{}, opts []CallOption) error {
+	callOpts := c.callOptions(endpoint, opts)
+	ctx, cancel := context.WithTimeoutCause(ctx, callOpts.timeout, errEndpointTimeout)
+	defer cancel()
+
+	resp, err := c.send(ctx, endpoint, contentType, body, callOpts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", endpoint, err)
+	}
+	return nil
+}
+
+// send posts body to endpoint, retrying retryable failures, and returns the successful response.
+func (c *Client) send(ctx context.Context, endpoint, contentType string, body []byte, callOpts callOptions) (*http.Response, error) {
+	backoff := c.retryBackoff
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w: %w", ErrCircuitOpen, lastErr)
+			}
+			return nil, ErrCircuitOpen
+		}
+		resp, err := c.do(ctx, endpoint, contentType, body)
+		c.breaker.record(ctx, err)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if attempt >= callOpts.maxRetries || !retryable(err, idempotentEndpoints[endpoint]) {
+			return nil, err
+		}
+		log.Printf("sidecar call to %s failed, retrying in %v: %v", endpoint, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// do performs a single request and returns the response if its status is 200.
+func (c *Client) do(ctx context.Context, endpoint, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Api-Key", c.apiKey)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newError(endpoint, resp)
+	}
+	return resp, nil
+}
+
+// retryable reports whether a failed call may succeed when it is repeated. Transport errors of
+// calls that are not idempotent are only retried when the connection was never made.
+func retryable(err error, idempotent bool) bool {
+	var sidecarErr *Error
+	if errors.As(err, &sidecarErr) {
+		return sidecarErr.Temporary()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// transport errors such as a refused connection while the server is starting up
+	var opErr *net.OpError
+	return idempotent || (errors.As(err, &opErr) && opErr.Op == "dial")
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPostJSONRetriesTransientFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Api-Key") != "key" {
+			t.Errorf("missing Api-Key header")
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"response": "ok"}`))
+	}))
+	defer server.Close()
+
+	client := New(Options{BaseURL: server.URL, APIKey: "key", MaxRetries: 2, RetryBackoff: time.Millisecond})
+	var response struct {
+		Response string `json:"response"`
+	}
+	if err := client.PostJSON(context.Background(), EndpointChatCompletion, map[string]string{}, &response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response.Response != "ok" || calls != 3 {
+		t.Errorf("got response %q after %d calls, want \"ok\" after 3", response.Response, calls)
+	}
+}
+
+func TestTransportErrorsRetriedOnlyWhenIdempotent(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// drop the connection after the request reached the server
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		endpoint  string
+		wantCalls int32
+	}{
+		{EndpointChatCompletion, 1},
+		{EndpointSearchSong, 3},
+	}
+	for _, tc := range tests {
+		atomic.StoreInt32(&calls, 0)
+		client := New(Options{BaseURL: server.URL, MaxRetries: 2, RetryBackoff: time.Millisecond})
+		if err := client.PostJSON(context.Background(), tc.endpoint, nil, &struct{}{}); err == nil {
+			t.Fatalf("%s: expected an error", tc.endpoint)
+		}
+		if got := atomic.LoadInt32(&calls); got != tc.wantCalls {
+			t.Errorf("%s: server called %d times, want %d", tc.endpoint, got, tc.wantCalls)
+		}
+	}
+}
+
+func TestCircuitOpeningKeepsLastError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := New(Options{BaseURL: server.URL, MaxRetries: 3, RetryBackoff: time.Millisecond, FailureThreshold: 2, OpenTimeout: time.Hour})
+	err := client.PostJSON(context.Background(), EndpointSearchSong, nil, &struct{}{})
+	var sidecarErr *Error
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &sidecarErr) {
+		t.Fatalf("expected ErrCircuitOpen wrapping the last *Error, got %v", err)
+	}
+	if sidecarErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", sidecarErr.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestPostJSONErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantDetail string
+		wantStatus int
+	}{
+		{"string detail", http.StatusBadRequest, `{"detail": "Failed to complete chat"}`, "Failed to complete chat", http.StatusBadRequest},
+		{"validation detail", http.StatusUnprocessableEntity, `{"detail": [{"msg": "field required"}]}`, `[{"msg": "field required"}]`, http.StatusBadRequest},
+		{"no detail", http.StatusInternalServerError, `Internal Server Error`, EndpointShazam + " returned 500 Internal Server Error", http.StatusBadGateway},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := New(Options{BaseURL: server.URL})
+			err := client.PostJSON(context.Background(), EndpointShazam, nil, &struct{}{})
+			var sidecarErr *Error
+			if !errors.As(err, &sidecarErr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if sidecarErr.Detail != tc.wantDetail {
+				t.Errorf("got detail %q, want %q", sidecarErr.Detail, tc.wantDetail)
+			}
+			if status := HTTPStatus(err); status != tc.wantStatus {
+				t.Errorf("got status %d, want %d", status, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := New(Options{BaseURL: server.URL, FailureThreshold: 2, OpenTimeout: time.Hour})
+	for i := 0; i < 2; i++ {
+		client.PostJSON(context.Background(), EndpointSearchSong, nil, &struct{}{})
+	}
+	err := client.PostJSON(context.Background(), EndpointSearchSong, nil, &struct{}{})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("server called %d times, want 2", calls)
+	}
+	if status := HTTPStatus(err); status != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", status, http.StatusServiceUnavailable)
+	}
+}
+
+func TestCancelledCallsKeepCircuitClosed(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 4 {
+			<-release
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := New(Options{BaseURL: server.URL, FailureThreshold: 2, OpenTimeout: time.Hour})
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if err := client.PostJSON(ctx, EndpointChatCompletion, nil, &struct{}{}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := client.PostJSON(ctx, EndpointChatCompletion, nil, &struct{}{})
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	}
+	if err := client.PostJSON(context.Background(), EndpointChatCompletion, nil, &struct{}{}); err != nil {
+		t.Fatalf("expected the circuit to stay closed, got %v", err)
+	}
+}
+
+func TestEndpointTimeoutsOpenCircuit(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := New(Options{BaseURL: server.URL, FailureThreshold: 2, OpenTimeout: time.Hour})
+	for i := 0; i < 2; i++ {
+		client.PostJSON(context.Background(), EndpointChatCompletion, nil, &struct{}{}, WithTimeout(10*time.Millisecond))
+	}
+	if err := client.PostJSON(context.Background(), EndpointChatCompletion, nil, &struct{}{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+}
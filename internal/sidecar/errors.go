@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrCircuitOpen is returned without calling the server while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("python server is unavailable, try again later")
+
+// Error is a non-200 response from the FastAPI server.
+type Error struct {
+	Endpoint   string
+	StatusCode int
+	Detail     string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// Temporary reports whether the server may succeed if the call is repeated.
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// errorResponse is the error body returned by FastAPI's HTTPException.
+type errorResponse struct {
+	Detail json.RawMessage `json:"detail"`
+}
+
+// newError reads the FastAPI error body of resp.
+// detail is usually a string, but request validation errors return a list of objects.
+func newError(endpoint string, resp *http.Response) *Error {
+	sidecarErr := &Error{Endpoint: endpoint, StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(resp.Body)
+	var errResp errorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && len(errResp.Detail) > 0 {
+		var detail string
+		if err := json.Unmarshal(errResp.Detail, &detail); err == nil {
+			sidecarErr.Detail = detail
+		} else {
+			sidecarErr.Detail = string(errResp.Detail)
+		}
+	}
+	if sidecarErr.Detail == "" {
+		sidecarErr.Detail = fmt.Sprintf("%s returned %s", endpoint, resp.Status)
+	}
+	return sidecarErr
+}
+
+// HTTPStatus maps an error returned by the Client to the status code the API should respond with.
+// Rejected input is reported as a bad request, an unavailable server as 503 and a timeout as 504;
+// every other failure of the python server is a bad gateway.
+func HTTPStatus(err error) int {
+	var sidecarErr *Error
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &sidecarErr):
+		if sidecarErr.StatusCode == http.StatusBadRequest || sidecarErr.StatusCode == http.StatusUnprocessableEntity {
+			return http.StatusBadRequest
+		}
+		if sidecarErr.Temporary() {
+			return http.StatusServiceUnavailable
+		}
+	}
+	return http.StatusBadGateway
+}
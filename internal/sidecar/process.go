@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sidecar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment variables read by the python server.
+const (
+	EnvAPIKey = "SIDECAR_API_KEY" // key expected in the Api-Key header
+	EnvPort   = "SIDECAR_PORT"    // port to listen on at 127.0.0.1
+	EnvSocket = "SIDECAR_SOCKET"  // unix socket to listen on instead of a port
+)
+
+// publicEnv lists the variables that are never passed on to the python server.
+var publicEnv = []string{"MY_API_KEY"}
+
+// NewSecret returns a random key the Go process uses to authenticate to the python server.
+// A new key is generated on every boot, so it is never shared with API clients.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate sidecar secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Environ returns the environment for the python server: the current environment without the
+// public API key, plus the internal apiKey and the address from baseURL.
+// baseURL must be a loopback http URL such as http://127.0.0.1:8000 or a socket such as unix:///tmp/omnicron.sock.
+func Environ(baseURL, apiKey string) ([]string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FastAPI base URL: %w", err)
+	}
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !isPublic(kv) {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, EnvAPIKey+"="+apiKey)
+
+	if u.Scheme == "unix" {
+		return append(env, EnvSocket+"="+u.Path), nil
+	}
+	host, port := u.Hostname(), u.Port()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("FastAPI base URL %q must point to localhost or a unix socket", baseURL)
+	}
+	if port == "" {
+		port = "8000"
+	}
+	return append(env, EnvPort+"="+port), nil
+}
+
+func isPublic(kv string) bool {
+	for _, key := range publicEnv {
+		if strings.HasPrefix(kv, key+"=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package sidecar
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("MY_API_KEY", "public")
+	tests := []struct {
+		baseURL string
+		want    string
+		wantErr bool
+	}{
+		{"http://127.0.0.1:8001", EnvPort + "=8001", false},
+		{"http://localhost", EnvPort + "=8000", false},
+		{"unix:///tmp/omnicron.sock", EnvSocket + "=/tmp/omnicron.sock", false},
+		{"http://0.0.0.0:8000", "", true},
+		{"http://example.com:8000", "", true},
+	}
+	for _, tc := range tests {
+		env, err := Environ(tc.baseURL, "secret")
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.baseURL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.baseURL, err)
+		}
+		if !slices.Contains(env, tc.want) || !slices.Contains(env, EnvAPIKey+"=secret") {
+			t.Errorf("%s: environment is missing %s or the api key", tc.baseURL, tc.want)
+		}
+		if slices.Contains(env, "MY_API_KEY=public") {
+			t.Errorf("%s: public api key passed to the python server", tc.baseURL)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "sidecar.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"response": "ok"}`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := New(Options{BaseURL: "unix://" + socketPath})
+	var response struct {
+		Response string `json:"response"`
+	}
+	if err := client.PostJSON(context.Background(), EndpointSearchSong, nil, &response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response.Response != "ok" {
+		t.Errorf("got response %q, want \"ok\"", response.Response)
+	}
+}
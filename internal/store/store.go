@@ -0,0 +1,251 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package store persists JSON records in an embedded bbolt database.
+// Records live in nested buckets addressed by a path, e.g. {"threads", owner},
+// so the data of every API key is kept apart.
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotFound is returned for a key or bucket that doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// Store is an embedded key value store.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the database at path, creating it and its directory if needed.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put stores v as JSON under key in the bucket at path, creating the buckets.
+func (s *Store) Put(path []string, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := createBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Append stores the value returned by fn under the next sequence number of the bucket at path.
+// fn receives the sequence number, so it can be part of the stored value.
+func (s *Store) Append(path []string, fn func(seq uint64) interface{}) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := createBucket(tx, path)
+		if err != nil {
+			return err
+		}
+		return (&Bucket{b: b}).Append(fn)
+	})
+}
+
+// Get decodes the value under key in the bucket at path into v.
+func (s *Store) Get(path []string, key string, v interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, path)
+		if b == nil {
+			return ErrNotFound
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, v)
+	})
+}
+
+// List calls fn with every key and value of the bucket at path, in key order.
+// Nested buckets are skipped. A missing bucket is empty.
+func (s *Store) List(path []string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, path)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+			return fn(string(k), v)
+		})
+	})
+}
+
+// Delete removes the value or the nested bucket named key from the bucket at path.
+func (s *Store) Delete(path []string, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteKey(tx, path, key)
+	})
+}
+
+// Tx is a read-write transaction, see Update.
+type Tx struct {
+	tx *bolt.Tx
+}
+
+// Bucket returns the bucket at path, creating it if needed.
+func (t *Tx) Bucket(path []string) (*Bucket, error) {
+	b, err := createBucket(t.tx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{b: b}, nil
+}
+
+// Delete removes the value or the nested bucket named key from the bucket at path, see Store.Delete.
+func (t *Tx) Delete(path []string, key string) error {
+	return deleteKey(t.tx, path, key)
+}
+
+// Bucket holds the JSON records of a bucket within a transaction.
+type Bucket struct {
+	b *bolt.Bucket
+}
+
+// Put stores v as JSON under key.
+func (b *Bucket) Put(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.b.Put([]byte(key), data)
+}
+
+// Get decodes the value under key into v.
+func (b *Bucket) Get(key string, v interface{}) error {
+	data := b.b.Get([]byte(key))
+	if data == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Append stores the value returned by fn under the next sequence number, see Store.Append.
+func (b *Bucket) Append(fn func(seq uint64) interface{}) error {
+	seq, err := b.b.NextSequence()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(fn(seq))
+	if err != nil {
+		return err
+	}
+	return b.b.Put(SeqKey(seq), data)
+}
+
+// Has reports whether a value is stored under key.
+func (b *Bucket) Has(key string) bool {
+	return b.b.Get([]byte(key)) != nil
+}
+
+// Delete removes the value under key.
+func (b *Bucket) Delete(key string) error {
+	return b.b.Delete([]byte(key))
+}
+
+// Update runs fn in a single read-write transaction, which is rolled back if fn fails.
+// Writing many records in one transaction is much faster than a Put for each.
+func (s *Store) Update(fn func(tx *Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&Tx{tx: tx})
+	})
+}
+
+// SeqKey encodes a sequence number as a key that sorts in sequence order.
+func SeqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func bucket(tx *bolt.Tx, path []string) *bolt.Bucket {
+	if len(path) == 0 {
+		return nil
+	}
+	b := tx.Bucket([]byte(path[0]))
+	for _, name := range path[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(name))
+	}
+	return b
+}
+
+func deleteKey(tx *bolt.Tx, path []string, key string) error {
+	b := bucket(tx, path)
+	switch {
+	case b == nil:
+		return ErrNotFound
+	case b.Bucket([]byte(key)) != nil:
+		return b.DeleteBucket([]byte(key))
+	case b.Get([]byte(key)) != nil:
+		return b.Delete([]byte(key))
+	default:
+		return ErrNotFound
+	}
+}
+
+func createBucket(tx *bolt.Tx, path []string) (*bolt.Bucket, error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty bucket path")
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(path[0]))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range path[1:] {
+		if b, err = b.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
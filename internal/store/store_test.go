@@ -0,0 +1,79 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "nested", "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	path := []string{"items", "owner"}
+	if err := s.Put(path, "a", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Append(append(path, "log"), func(seq uint64) interface{} { return seq }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got map[string]int
+	if err := s.Get(path, "a", &got); err != nil || got["n"] != 1 {
+		t.Fatalf("expected the stored value, got %v, %v", got, err)
+	}
+	var keys []string
+	_ = s.List(path, func(key string, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if len(keys) != 1 {
+		t.Errorf("expected nested buckets to be skipped, got keys %q", keys)
+	}
+	var seqs []string
+	_ = s.List(append(path, "log"), func(_ string, value []byte) error {
+		seqs = append(seqs, string(value))
+		return nil
+	})
+	if len(seqs) != 3 || seqs[0] != "1" || seqs[2] != "3" {
+		t.Errorf("expected appended values in order, got %q", seqs)
+	}
+
+	if err := s.Delete(path, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(path, "log"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get(path, "a", &got); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.Delete(path, "log"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a missing bucket, got %v", err)
+	}
+}
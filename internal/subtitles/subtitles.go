@@ -0,0 +1,187 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package subtitles parses SRT and WebVTT subtitles and writes them as SRT, WebVTT or plain
+// text.
+package subtitles
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subtitle formats.
+const (
+	SRT  = "srt"
+	VTT  = "vtt"
+	Text = "txt"
+)
+
+// ErrFormat is returned for unknown subtitle formats.
+var ErrFormat = errors.New("unknown subtitle format")
+
+// Cue is a piece of text shown between Start and End.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+var (
+	timingPattern = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+	// tagPattern matches formatting tags such as <i>, <c.color> and the word timings <00:00:01.500>
+	// of automatic captions.
+	tagPattern = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ValidFormat reports whether format can be written.
+func ValidFormat(format string) bool {
+	return format == SRT || format == VTT || format == Text
+}
+
+// Parse parses SRT or WebVTT subtitles. Blocks without a timing line, such as the WebVTT header,
+// notes and styles, are skipped, and formatting tags are removed.
+func Parse(data []byte) ([]Cue, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var cues []Cue
+	var cue *Cue
+	var text []string
+	flush := func() {
+		if cue != nil {
+			cue.Text = strings.Join(text, "\n")
+			if cue.Text != "" {
+				cues = append(cues, *cue)
+			}
+		}
+		cue, text = nil, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if match := timingPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			start, err := parseTimestamp(match[1])
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseTimestamp(match[2])
+			if err != nil {
+				return nil, err
+			}
+			cue = &Cue{Start: start, End: end}
+			continue
+		}
+		if cue != nil {
+			if line = strings.TrimSpace(tagPattern.ReplaceAllString(line, "")); line != "" {
+				text = append(text, line)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if len(cues) == 0 {
+		return nil, errors.New("no subtitles found")
+	}
+	return cues, nil
+}
+
+// parseTimestamp parses HH:MM:SS.mmm or MM:SS.mmm, with a comma or a dot before the milliseconds.
+func parseTimestamp(timestamp string) (time.Duration, error) {
+	timestamp = strings.Replace(timestamp, ",", ".", 1)
+	parts := strings.Split(timestamp, ":")
+	var d time.Duration
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			seconds, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid timestamp %q", timestamp)
+			}
+			d = d*60 + time.Duration(seconds*float64(time.Second)+0.5)
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+		d = d*60 + time.Duration(n)*time.Second
+	}
+	return d, nil
+}
+
+// Format writes cues as format.
+func Format(cues []Cue, format string) ([]byte, error) {
+	var b bytes.Buffer
+	switch format {
+	case SRT:
+		for i, cue := range cues {
+			fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, timestamp(cue.Start, ","), timestamp(cue.End, ","), cue.Text)
+		}
+	case VTT:
+		b.WriteString("WEBVTT\n\n")
+		for _, cue := range cues {
+			fmt.Fprintf(&b, "%s --> %s\n%s\n\n", timestamp(cue.Start, "."), timestamp(cue.End, "."), cue.Text)
+		}
+	case Text:
+		// Automatic captions repeat the previous line as the next one is written.
+		var last string
+		for _, cue := range cues {
+			for _, line := range strings.Split(cue.Text, "\n") {
+				if line != last {
+					b.WriteString(line + "\n")
+					last = line
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrFormat, format)
+	}
+	return b.Bytes(), nil
+}
+
+// Convert converts SRT or WebVTT subtitles to format.
+func Convert(data []byte, format string) ([]byte, error) {
+	if !ValidFormat(format) {
+		return nil, fmt.Errorf("%w %q", ErrFormat, format)
+	}
+	cues, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return Format(cues, format)
+}
+
+// timestamp formats d as HH:MM:SS followed by sep and the milliseconds.
+func timestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package subtitles
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const vtt = `WEBVTT
+Kind: captions
+Language: en
+
+STYLE
+::cue { color: white }
+
+1
+00:00:01.000 --> 00:00:03.500 align:start position:0%
+Hello <c.colorE5E5E5>there</c>
+
+00:00:03.500 --> 00:01:02.250
+Hello there
+<00:00:04.000><c>general</c> Kenobi
+`
+
+func TestConvert(t *testing.T) {
+	cues, err := Parse([]byte(vtt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cues) != 2 || cues[0].Text != "Hello there" || cues[1].End != time.Minute+2250*time.Millisecond {
+		t.Fatalf("unexpected cues %+v", cues)
+	}
+
+	srt, err := Convert([]byte(vtt), SRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1\n00:00:01,000 --> 00:00:03,500\nHello there\n\n2\n00:00:03,500 --> 00:01:02,250\nHello there\ngeneral Kenobi\n\n"
+	if string(srt) != want {
+		t.Errorf("srt = %q, want %q", srt, want)
+	}
+
+	back, err := Convert(srt, VTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(back), "WEBVTT\n\n00:00:01.000 --> 00:00:03.500\nHello there\n") {
+		t.Errorf("vtt = %q", back)
+	}
+
+	text, err := Convert(srt, Text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "Hello there\ngeneral Kenobi\n" {
+		t.Errorf("text = %q", text)
+	}
+
+	if _, err := Convert(srt, "ass"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
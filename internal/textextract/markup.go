@@ -0,0 +1,157 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package textextract
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// csvRowsPerPage is the number of rows of a CSV page, each page starting with the header row.
+const csvRowsPerPage = 50
+
+func htmlPages(data []byte) ([]string, error) {
+	text, err := htmlText(data)
+	if err != nil {
+		return nil, err
+	}
+	return SplitPages(text, PageChars), nil
+}
+
+// htmlText returns the visible text of an HTML document, with a line break after every block.
+func htmlText(data []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			if s := strings.Join(strings.Fields(n.Data), " "); s != "" {
+				text.WriteString(s)
+				text.WriteString(" ")
+			}
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Head:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && isBlock(n.DataAtom) {
+			text.WriteString("\n")
+		}
+	}
+	walk(doc)
+	return collapseLines(text.String()), nil
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Br, atom.Li, atom.Tr, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Section, atom.Article, atom.Header, atom.Footer, atom.Blockquote, atom.Pre, atom.Table,
+		atom.Ul, atom.Ol, atom.Dt, atom.Dd, atom.Title:
+		return true
+	}
+	return false
+}
+
+// collapseLines trims every line and drops empty ones.
+func collapseLines(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// csvPages returns pages of csvRowsPerPage rows, with cells separated by " | ".
+func csvPages(data []byte) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := strings.Join(rows[0], " | ")
+	var pages []string
+	for start := 1; start < len(rows) || start == 1; start += csvRowsPerPage {
+		lines := []string{header}
+		for _, row := range rows[start:min(start+csvRowsPerPage, len(rows))] {
+			lines = append(lines, strings.Join(row, " | "))
+		}
+		pages = append(pages, strings.Join(lines, "\n"))
+	}
+	return pages, nil
+}
+
+// svgPages returns the text elements of an SVG image as a single page.
+func svgPages(data []byte) ([]string, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	var lines []string
+	skip := 0
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "style" || t.Name.Local == "script" || skip > 0 {
+				skip++
+			}
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+			}
+		case xml.CharData:
+			if s := strings.Join(strings.Fields(string(t)), " "); s != "" && skip == 0 {
+				lines = append(lines, s)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	return []string{strings.Join(lines, "\n")}, nil
+}
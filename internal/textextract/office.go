@@ -0,0 +1,370 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+func openZip(data []byte) (map[string]*zip.File, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+	return files, nil
+}
+
+// readEntry returns the content of name, limited to maxEntryBytes against zip bombs.
+func readEntry(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxEntryBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxEntryBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxEntryBytes)
+	}
+	return data, nil
+}
+
+// xmlTokens calls fn with every token of an XML document.
+func xmlTokens(data []byte, fn func(xml.Token)) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(token)
+	}
+}
+
+// docxPages returns the paragraphs of a Word document, split at its page breaks: the explicit
+// ones and those Word rendered when it last saved the document.
+func docxPages(data []byte) ([]string, error) {
+	files, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readEntry(files, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	var page strings.Builder
+	inText := false
+	flush := func() {
+		pages = append(pages, collapseLines(page.String()))
+		page.Reset()
+	}
+	err = xmlTokens(document, func(token xml.Token) {
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				page.WriteString("\t")
+			case "br":
+				if attr(t, "type") == "page" {
+					flush()
+				} else {
+					page.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				flush()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				page.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				page.Write(t)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush()
+	return splitLongPages(dropEmpty(pages)), nil
+}
+
+// xlsxPages returns a page for every sheet of a workbook, with its name on the first line and
+// the cells of a row separated by " | ".
+func xlsxPages(data []byte) ([]string, error) {
+	files, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if sharedStrings, err := readEntry(files, "xl/sharedStrings.xml"); err == nil {
+		if shared, err = xlsxSharedStrings(sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+	sheets, err := xlsxSheets(files)
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	for _, sheet := range sheets {
+		content, err := readEntry(files, sheet.path)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := xlsxRows(content, shared)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 {
+			pages = append(pages, "Sheet: "+sheet.name+"\n"+strings.Join(rows, "\n"))
+		}
+	}
+	return splitLongPages(pages), nil
+}
+
+func xlsxSharedStrings(data []byte) ([]string, error) {
+	var shared []string
+	var item strings.Builder
+	inText := false
+	err := xmlTokens(data, func(token xml.Token) {
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				item.Reset()
+			case "t":
+				inText = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				shared = append(shared, item.String())
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				item.Write(t)
+			}
+		}
+	})
+	return shared, err
+}
+
+type xlsxSheet struct {
+	name string
+	path string
+}
+
+// xlsxSheets returns the sheets in workbook order, resolving their files through the relationships.
+func xlsxSheets(files map[string]*zip.File) ([]xlsxSheet, error) {
+	workbook, err := readEntry(files, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]string{}
+	if rels, err := readEntry(files, "xl/_rels/workbook.xml.rels"); err == nil {
+		err := xmlTokens(rels, func(token xml.Token) {
+			if t, ok := token.(xml.StartElement); ok && t.Name.Local == "Relationship" {
+				target := attr(t, "Target")
+				if strings.HasPrefix(target, "/") {
+					target = strings.TrimPrefix(target, "/")
+				} else {
+					target = path.Join("xl", target)
+				}
+				targets[attr(t, "Id")] = target
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var sheets []xlsxSheet
+	err = xmlTokens(workbook, func(token xml.Token) {
+		if t, ok := token.(xml.StartElement); ok && t.Name.Local == "sheet" {
+			target, ok := targets[attr(t, "id")]
+			if !ok {
+				target = fmt.Sprintf("xl/worksheets/sheet%d.xml", len(sheets)+1)
+			}
+			sheets = append(sheets, xlsxSheet{name: attr(t, "name"), path: target})
+		}
+	})
+	return sheets, err
+}
+
+// xlsxRows returns the non-empty rows of a sheet.
+func xlsxRows(data []byte, shared []string) ([]string, error) {
+	var rows, cells []string
+	var value strings.Builder
+	cellType, inValue := "", false
+	err := xmlTokens(data, func(token xml.Token) {
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				cells = nil
+			case "c":
+				cellType = attr(t, "t")
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				cell := value.String()
+				if cellType == "s" {
+					if i, err := strconv.Atoi(cell); err == nil && i >= 0 && i < len(shared) {
+						cell = shared[i]
+					}
+				}
+				cells = append(cells, strings.TrimSpace(cell))
+			case "row":
+				if row := strings.Join(cells, " | "); strings.Trim(row, " |") != "" {
+					rows = append(rows, row)
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	})
+	return rows, err
+}
+
+// epubPages returns a page for every chapter of an ebook, in reading order.
+func epubPages(data []byte) ([]string, error) {
+	files, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+	container, err := readEntry(files, "META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	var rootfile string
+	err = xmlTokens(container, func(token xml.Token) {
+		if t, ok := token.(xml.StartElement); ok && t.Name.Local == "rootfile" && rootfile == "" {
+			rootfile = attr(t, "full-path")
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	opf, err := readEntry(files, rootfile)
+	if err != nil {
+		return nil, err
+	}
+	manifest := map[string]string{}
+	var spine []string
+	err = xmlTokens(opf, func(token xml.Token) {
+		if t, ok := token.(xml.StartElement); ok {
+			switch t.Name.Local {
+			case "item":
+				manifest[attr(t, "id")] = path.Join(path.Dir(rootfile), attr(t, "href"))
+			case "itemref":
+				spine = append(spine, attr(t, "idref"))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	for _, id := range spine {
+		chapter, err := readEntry(files, manifest[id])
+		if err != nil {
+			return nil, err
+		}
+		text, err := htmlText(chapter)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, text)
+	}
+	return splitLongPages(dropEmpty(pages)), nil
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func dropEmpty(pages []string) []string {
+	var kept []string
+	for _, page := range pages {
+		if strings.TrimSpace(page) != "" {
+			kept = append(kept, page)
+		}
+	}
+	return kept
+}
+
+// splitLongPages splits pages, such as the chapters of an ebook, that are much longer than
+// PageChars, so each stays small enough to cite.
+func splitLongPages(pages []string) []string {
+	var split []string
+	for _, page := range pages {
+		if len([]rune(page)) > 2*PageChars {
+			split = append(split, SplitPages(page, PageChars)...)
+		} else {
+			split = append(split, page)
+		}
+	}
+	return split
+}
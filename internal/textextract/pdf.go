@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package textextract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// minPageChars is the text a page of a PDF needs to not count as scanned.
+const minPageChars = 20
+
+// pdfPages returns the text layer of every page of a PDF. A PDF whose pages mostly have no text
+// was scanned, and ErrNeedsSidecar is returned so it goes through OCR.
+func pdfPages(data []byte) (pages []string, err error) {
+	// the parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("%w: unreadable PDF: %v", ErrNeedsSidecar, r)
+		}
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNeedsSidecar, err)
+	}
+	scanned := 0
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		text := ""
+		if !page.V.IsNull() {
+			if text, err = page.GetPlainText(nil); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrNeedsSidecar, err)
+			}
+		}
+		text = strings.TrimSpace(text)
+		if len([]rune(text)) < minPageChars {
+			scanned++
+		}
+		pages = append(pages, text)
+	}
+	if len(pages) == 0 || scanned*2 > len(pages) {
+		return nil, ErrNeedsSidecar
+	}
+	return pages, nil
+}
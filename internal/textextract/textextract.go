@@ -0,0 +1,213 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package textextract extracts the text of documents page by page in Go. Formats that need OCR
+// or a renderer, such as scanned PDFs, are left to the FastAPI server.
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats detected by Detect.
+const (
+	TXT      = "txt"
+	Markdown = "markdown"
+	HTML     = "html"
+	CSV      = "csv"
+	SVG      = "svg"
+	PDF      = "pdf"
+	DOCX     = "docx"
+	XLSX     = "xlsx"
+	EPUB     = "epub"
+	// read by the FastAPI server only
+	XPS  = "xps"
+	MOBI = "mobi"
+	FB2  = "fb2"
+	CBZ  = "cbz"
+)
+
+// PageChars is the size of the pages that formats without pages, such as plain text, are split into.
+const PageChars = 3000
+
+// maxEntryBytes limits the uncompressed size of a file read from an archive.
+const maxEntryBytes = 64 << 20
+
+var (
+	// ErrUnsupported is returned for a format that can't be read.
+	ErrUnsupported = errors.New("unsupported document format")
+	// ErrNeedsSidecar is returned for a supported document that only the FastAPI server can read,
+	// such as a scanned PDF that needs OCR.
+	ErrNeedsSidecar = errors.New("document needs the FastAPI server")
+)
+
+// Document is the extracted text of a document.
+type Document struct {
+	Format string
+	// Pages has the text of each page. Formats without pages are split at about PageChars
+	// characters, spreadsheets by sheet and ebooks by chapter.
+	Pages []string
+}
+
+// SupportedFormats lists the formats that can be extracted, natively or by the FastAPI server.
+func SupportedFormats() []string {
+	return []string{TXT, Markdown, HTML, CSV, SVG, PDF, DOCX, XLSX, EPUB, XPS, MOBI, FB2, CBZ}
+}
+
+// Detect returns the format of a document from its content, using the extension of filename
+// for formats that can't be told apart by content, e.g. Markdown from plain text.
+// It returns an empty string for unsupported documents.
+func Detect(data []byte, filename string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return PDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return detectZip(data, ext)
+	case len(data) >= 68 && string(data[60:68]) == "BOOKMOBI":
+		return MOBI
+	}
+	if !utf8.Valid(data) && !strings.HasPrefix(http.DetectContentType(data), "text/") {
+		return ""
+	}
+	head := strings.ToLower(string(data[:min(len(data), 1024)]))
+	switch {
+	case ext == "svg" || strings.Contains(head, "<svg"):
+		return SVG
+	case ext == "fb2" || strings.Contains(head, "<fictionbook"):
+		return FB2
+	case ext == "html" || ext == "htm" || ext == "xhtml" || strings.HasPrefix(http.DetectContentType(data), "text/html"):
+		return HTML
+	case ext == "md" || ext == "markdown":
+		return Markdown
+	case ext == "csv":
+		return CSV
+	}
+	return TXT
+}
+
+// detectZip tells the zip based formats apart by the files they contain.
+func detectZip(data []byte, ext string) string {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ""
+	}
+	for _, f := range r.File {
+		switch {
+		case f.Name == "word/document.xml":
+			return DOCX
+		case f.Name == "xl/workbook.xml":
+			return XLSX
+		case f.Name == "META-INF/container.xml" || f.Name == "mimetype" && ext == "epub":
+			return EPUB
+		case strings.HasPrefix(f.Name, "FixedDocSeq") || strings.HasPrefix(f.Name, "Documents/"):
+			return XPS
+		}
+	}
+	if ext == "cbz" {
+		return CBZ
+	}
+	return ""
+}
+
+// Extract returns the text of the document. It returns ErrUnsupported for unknown formats and
+// ErrNeedsSidecar, with the detected format, for documents left to the FastAPI server.
+func Extract(data []byte, filename string) (*Document, error) {
+	format := Detect(data, filename)
+	var pages []string
+	var err error
+	switch format {
+	case TXT, Markdown:
+		pages = textPages(data)
+	case HTML:
+		pages, err = htmlPages(data)
+	case CSV:
+		pages, err = csvPages(data)
+	case SVG:
+		pages, err = svgPages(data)
+	case PDF:
+		pages, err = pdfPages(data)
+	case DOCX:
+		pages, err = docxPages(data)
+	case XLSX:
+		pages, err = xlsxPages(data)
+	case EPUB:
+		pages, err = epubPages(data)
+	case XPS, MOBI, FB2, CBZ:
+		err = ErrNeedsSidecar
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return &Document{Format: format}, fmt.Errorf("failed to extract %s: %w", format, err)
+	}
+	return &Document{Format: format, Pages: pages}, nil
+}
+
+// textPages splits plain text at form feeds, or into pages of about PageChars characters.
+func textPages(data []byte) []string {
+	text := strings.ToValidUTF8(string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))), "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.Contains(text, "\f") {
+		var pages []string
+		for _, page := range strings.Split(text, "\f") {
+			pages = append(pages, strings.TrimSpace(page))
+		}
+		return pages
+	}
+	return SplitPages(text, PageChars)
+}
+
+// SplitPages splits text into pages of at most size characters, at line breaks where possible.
+func SplitPages(text string, size int) []string {
+	var pages []string
+	var page strings.Builder
+	chars := 0
+	flush := func() {
+		if s := strings.TrimSpace(page.String()); s != "" {
+			pages = append(pages, s)
+		}
+		page.Reset()
+		chars = 0
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		runes := []rune(line)
+		if chars+len(runes) > size {
+			flush()
+		}
+		// cut lines longer than a page
+		for len(runes) > size {
+			page.WriteString(string(runes[:size]))
+			flush()
+			runes = runes[size:]
+		}
+		page.WriteString(string(runes))
+		chars += len(runes)
+	}
+	flush()
+	return pages
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	docx := zipFiles(t, map[string]string{
+		"word/document.xml": `<w:document xmlns:w="w"><w:body>
+			<w:p><w:r><w:t>First</w:t><w:tab/><w:t>page</w:t></w:r></w:p>
+			<w:p><w:r><w:br w:type="page"/><w:t>Second page</w:t></w:r></w:p>
+		</w:body></w:document>`,
+	})
+	xlsx := zipFiles(t, map[string]string{
+		"xl/workbook.xml":            `<workbook><sheets><sheet name="Prices" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst><si><t>Item</t></si><si><t>Tea</t></si></sst>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData><row><c t="s"><v>0</v></c><c t="inlineStr"><is><t>Price</t></is></c></row><row><c t="s"><v>1</v></c><c><v>3.5</v></c></row></sheetData></worksheet>`,
+	})
+	epub := zipFiles(t, map[string]string{
+		"mimetype":               "application/epub+zip",
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`,
+		"OEBPS/content.opf":      `<package><manifest><item id="c1" href="one.xhtml"/><item id="c2" href="two.xhtml"/></manifest><spine><itemref idref="c2"/><itemref idref="c1"/></spine></package>`,
+		"OEBPS/one.xhtml":        `<html><body><p>Chapter one</p></body></html>`,
+		"OEBPS/two.xhtml":        `<html><head><title>x</title></head><body><h1>Chapter two</h1></body></html>`,
+	})
+
+	tests := []struct {
+		name      string
+		filename  string
+		data      []byte
+		wantType  string
+		wantPages []string
+	}{
+		{"txt", "notes.txt", []byte("one\ftwo"), TXT, []string{"one", "two"}},
+		{"markdown", "README.md", []byte("# Title\n\nText"), Markdown, []string{"# Title\n\nText"}},
+		{"html without extension", "page", []byte("<!DOCTYPE html><html><head><script>x()</script></head><body><p>Hello <b>you</b></p><p>Bye</p></body></html>"), HTML, []string{"Hello you\nBye"}},
+		{"csv", "data.csv", []byte("name,age\nann,30\n"), CSV, []string{"name | age\nann | 30"}},
+		{"svg", "image.svg", []byte(`<svg><style>.a{}</style><text>Label</text></svg>`), SVG, []string{"Label"}},
+		{"docx", "report.docx", docx, DOCX, []string{"First\tpage", "Second page"}},
+		{"xlsx", "prices.xlsx", xlsx, XLSX, []string{"Sheet: Prices\nItem | Price\nTea | 3.5"}},
+		{"epub in spine order", "book.epub", epub, EPUB, []string{"Chapter two", "Chapter one"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := Extract(tt.data, tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if document.Format != tt.wantType || !reflect.DeepEqual(document.Pages, tt.wantPages) {
+				t.Errorf("Extract() = %s %q, want %s %q", document.Format, document.Pages, tt.wantType, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestExtractLeavesFormatsToSidecar(t *testing.T) {
+	if _, err := Extract([]byte("%PDF-1.4\nnot really a pdf"), "scan.pdf"); !errors.Is(err, ErrNeedsSidecar) {
+		t.Errorf("expected ErrNeedsSidecar for an unreadable PDF, got %v", err)
+	}
+	cbz := zipFiles(t, map[string]string{"001.png": "png"})
+	if document, err := Extract(cbz, "comic.cbz"); !errors.Is(err, ErrNeedsSidecar) || document.Format != CBZ {
+		t.Errorf("expected ErrNeedsSidecar for a comic book, got %v", err)
+	}
+	if _, err := Extract([]byte{0x89, 'P', 'N', 'G', 0xff, 0xfe, 0x00}, "image.png"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for an image, got %v", err)
+	}
+}
+
+func TestSplitPages(t *testing.T) {
+	text := strings.Repeat("a line of text\n", 10) + strings.Repeat("z", 45)
+	pages := SplitPages(text, 40)
+	for _, page := range pages {
+		if len([]rune(page)) > 40 {
+			t.Errorf("page longer than 40 characters: %q", page)
+		}
+	}
+	if got := strings.Join(pages, ""); strings.Count(got, "a line of text") != 10 || strings.Count(got, "z") != 45 {
+		t.Errorf("expected all the text to be kept, got %q", pages)
+	}
+}
+
+// minimalPDF returns a PDF with a page showing each of texts in Helvetica.
+func minimalPDF(texts ...string) []byte {
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	var kids []string
+	for i, text := range texts {
+		page, content := 4+2*i, 5+2*i
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", content),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+		if i == 0 {
+			objects = append(objects[:2], append([]string{"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"}, objects[2:]...)...)
+		}
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(texts))
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestExtractPDFTextLayer(t *testing.T) {
+	document, err := Extract(minimalPDF("The first page has text.", "And so does the second one."), "doc.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Pages) != 2 || !strings.Contains(document.Pages[1], "second") {
+		t.Errorf("unexpected pages %q", document.Pages)
+	}
+	if _, err := Extract(minimalPDF("", ""), "scan.pdf"); !errors.Is(err, ErrNeedsSidecar) {
+		t.Errorf("expected ErrNeedsSidecar for pages without text, got %v", err)
+	}
+}
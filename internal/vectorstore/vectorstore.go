@@ -0,0 +1,299 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package vectorstore keeps named collections of embedded texts in the store and searches them
+// by cosine similarity. Collections belong to an owner, see auth.Owner.
+package vectorstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/store"
+)
+
+var (
+	// ErrNotFound is returned for a collection or an item that doesn't exist.
+	ErrNotFound = store.ErrNotFound
+	// ErrExists is returned when creating a collection whose name is taken.
+	ErrExists = errors.New("collection already exists")
+	// ErrDimensions is returned for a vector whose size doesn't match the collection.
+	ErrDimensions = errors.New("vector dimensions don't match the collection")
+)
+
+// Collection describes a collection of items.
+type Collection struct {
+	Name string `json:"name"`
+	// Dimensions is the size of the vectors, set by the first upsert.
+	Dimensions int    `json:"dimensions"`
+	Count      int    `json:"count"`
+	Model      string `json:"model"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// Item is an embedded text with its metadata.
+type Item struct {
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Vector   []float32              `json:"vector,omitempty"`
+}
+
+// Match is an item found by Query with its cosine similarity to the query.
+type Match struct {
+	Item
+	Score float32 `json:"score"`
+}
+
+// Index stores the collections in a store.
+type Index struct {
+	db *store.Store
+	// collections and items name the root buckets of the index
+	collections string
+	items       string
+}
+
+// New returns an Index backed by db.
+func New(db *store.Store) *Index {
+	return &Index{db: db, collections: "collections", items: "collection_items"}
+}
+
+// NewNamespace returns an Index backed by db whose collections are kept apart from those of New
+// and of other namespaces, for collections managed by the server rather than the API clients.
+func NewNamespace(db *store.Store, namespace string) *Index {
+	return &Index{db: db, collections: namespace + "_collections", items: namespace + "_collection_items"}
+}
+
+func (x *Index) collectionsPath(owner string) []string {
+	return []string{x.collections, owner}
+}
+
+func (x *Index) itemsPath(owner, name string) []string {
+	return []string{x.items, owner, name}
+}
+
+// CreateCollection creates an empty collection for vectors of model.
+func (x *Index) CreateCollection(owner, name, model string) (Collection, error) {
+	c := Collection{Name: name, Model: model, CreatedAt: time.Now().Unix()}
+	err := x.db.Update(func(tx *store.Tx) error {
+		b, err := tx.Bucket(x.collectionsPath(owner))
+		if err != nil {
+			return err
+		}
+		if b.Has(name) {
+			return ErrExists
+		}
+		return b.Put(name, c)
+	})
+	return c, err
+}
+
+// Collection returns the collection called name.
+func (x *Index) Collection(owner, name string) (Collection, error) {
+	var c Collection
+	err := x.db.Get(x.collectionsPath(owner), name, &c)
+	return c, err
+}
+
+// Collections lists the collections of owner by name.
+func (x *Index) Collections(owner string) ([]Collection, error) {
+	collections := []Collection{}
+	err := x.db.List(x.collectionsPath(owner), func(_ string, value []byte) error {
+		var c Collection
+		if err := json.Unmarshal(value, &c); err != nil {
+			return err
+		}
+		collections = append(collections, c)
+		return nil
+	})
+	return collections, err
+}
+
+// DeleteCollection removes the collection called name and its items.
+func (x *Index) DeleteCollection(owner, name string) error {
+	return x.db.Update(func(tx *store.Tx) error {
+		return x.DeleteCollectionTx(tx, owner, name)
+	})
+}
+
+// DeleteCollectionTx removes the collection called name and its items within tx, so the caller
+// can delete other records in the same transaction.
+func (x *Index) DeleteCollectionTx(tx *store.Tx, owner, name string) error {
+	if err := tx.Delete(x.collectionsPath(owner), name); err != nil {
+		return err
+	}
+	// an empty collection has no items bucket
+	if err := tx.Delete([]string{x.items, owner}, name); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Upsert adds the items to the collection, replacing items with the same ID, and returns the
+// updated collection. The vectors are normalized, so Query can rank by dot product.
+func (x *Index) Upsert(owner, name string, items []Item) (Collection, error) {
+	var c Collection
+	err := x.db.Update(func(tx *store.Tx) error {
+		collections, err := tx.Bucket(x.collectionsPath(owner))
+		if err != nil {
+			return err
+		}
+		if err := collections.Get(name, &c); err != nil {
+			return err
+		}
+		b, err := tx.Bucket(x.itemsPath(owner, name))
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if c.Dimensions == 0 {
+				c.Dimensions = len(item.Vector)
+			}
+			if len(item.Vector) != c.Dimensions {
+				return fmt.Errorf("%w: item %q has %d dimensions, want %d", ErrDimensions, item.ID, len(item.Vector), c.Dimensions)
+			}
+			if !b.Has(item.ID) {
+				c.Count++
+			}
+			item.Vector = normalize(item.Vector)
+			if err := b.Put(item.ID, item); err != nil {
+				return err
+			}
+		}
+		return collections.Put(name, c)
+	})
+	return c, err
+}
+
+// Delete removes the item id from the collection.
+func (x *Index) Delete(owner, name, id string) error {
+	return x.db.Update(func(tx *store.Tx) error {
+		collections, err := tx.Bucket(x.collectionsPath(owner))
+		if err != nil {
+			return err
+		}
+		var c Collection
+		if err := collections.Get(name, &c); err != nil {
+			return err
+		}
+		b, err := tx.Bucket(x.itemsPath(owner, name))
+		if err != nil {
+			return err
+		}
+		if !b.Has(id) {
+			return ErrNotFound
+		}
+		if err := b.Delete(id); err != nil {
+			return err
+		}
+		c.Count--
+		return collections.Put(name, c)
+	})
+}
+
+// Query returns the topK items most similar to vector whose metadata has every key of filter
+// with an equal value. The returned items don't include their vectors.
+func (x *Index) Query(owner, name string, vector []float32, topK int, filter map[string]interface{}) ([]Match, error) {
+	c, err := x.Collection(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	if c.Count == 0 {
+		return []Match{}, nil
+	}
+	if len(vector) != c.Dimensions {
+		return nil, fmt.Errorf("%w: query has %d dimensions, want %d", ErrDimensions, len(vector), c.Dimensions)
+	}
+	vector = normalize(vector)
+	matches := []Match{}
+	err = x.db.List(x.itemsPath(owner, name), func(_ string, value []byte) error {
+		var item Item
+		if err := json.Unmarshal(value, &item); err != nil {
+			return err
+		}
+		if !matchesFilter(item.Metadata, filter) {
+			return nil
+		}
+		score := dot(vector, item.Vector)
+		item.Vector = nil
+		matches = append(matches, Match{Item: item, Score: score})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches, nil
+}
+
+// matchesFilter compares the values as decoded from JSON, so 1 and 1.0 are equal.
+func matchesFilter(metadata, filter map[string]interface{}) bool {
+	for key, want := range filter {
+		got, ok := metadata[key]
+		if !ok || !reflect.DeepEqual(jsonValue(got), jsonValue(want)) {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return v
+	}
+	return decoded
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	normalized := make([]float32, len(v))
+	for i, f := range v {
+		normalized[i] = f / norm
+	}
+	return normalized
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package vectorstore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/kingmariano/omnicron/internal/store"
+)
+
+func TestIndex(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	x := New(db)
+
+	if _, err := x.CreateCollection("owner", "notes", "model"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x.CreateCollection("owner", "notes", "model"); !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists creating a duplicate collection, got %v", err)
+	}
+	items := []Item{
+		{ID: "a", Text: "cats", Vector: []float32{1, 0, 0}, Metadata: map[string]interface{}{"page": 1}},
+		{ID: "b", Text: "dogs", Vector: []float32{0, 2, 0}, Metadata: map[string]interface{}{"page": 2}},
+		{ID: "c", Text: "cats and dogs", Vector: []float32{1, 1, 0}, Metadata: map[string]interface{}{"page": 2}},
+	}
+	if _, err := x.Upsert("owner", "notes", items); err != nil {
+		t.Fatal(err)
+	}
+	// replacing an item doesn't change the count
+	c, err := x.Upsert("owner", "notes", items[:1])
+	if err != nil || c.Count != 3 || c.Dimensions != 3 {
+		t.Fatalf("expected 3 items of 3 dimensions, got %+v, %v", c, err)
+	}
+	if _, err := x.Upsert("owner", "notes", []Item{{ID: "d", Vector: []float32{1}}}); !errors.Is(err, ErrDimensions) {
+		t.Errorf("expected ErrDimensions, got %v", err)
+	}
+
+	matches, err := x.Query("owner", "notes", []float32{0, 1, 0}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].ID != "b" || matches[1].ID != "c" || matches[0].Vector != nil {
+		t.Errorf("unexpected matches %+v", matches)
+	}
+	matches, _ = x.Query("owner", "notes", []float32{0, 1, 0}, 5, map[string]interface{}{"page": 1.0})
+	if len(matches) != 1 || matches[0].ID != "a" {
+		t.Errorf("expected the filter to keep item a, got %+v", matches)
+	}
+
+	if err := x.Delete("owner", "notes", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := x.Collection("owner", "notes"); c.Count != 2 {
+		t.Errorf("expected 2 items after delete, got %d", c.Count)
+	}
+	if _, err := x.Collection("other", "notes"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected collections to be per owner, got %v", err)
+	}
+	if err := x.DeleteCollection("owner", "notes"); err != nil {
+		t.Fatal(err)
+	}
+	if collections, _ := x.Collections("owner"); len(collections) != 0 {
+		t.Errorf("expected no collections after delete, got %+v", collections)
+	}
+}
@@ -21,6 +21,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"github.com/kingmariano/omnicron/config"
 	"github.com/kingmariano/omnicron/internal/auth"
@@ -28,9 +29,9 @@ import (
 	"net/http"
 )
 
-type authHandler func(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig)
-
-func MiddleWareAuth(handler authHandler, cfg *config.APIConfig) http.HandlerFunc {
+// MiddleWareAuth only lets requests carrying the configured API key through to handler.
+// The owner id of the key is added to the request context, see auth.Owner.
+func MiddleWareAuth(handler http.HandlerFunc, cfg *config.APIConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		token, err := auth.GetHeaderToken(r.Header)
 		if err != nil {
@@ -42,6 +43,27 @@ func MiddleWareAuth(handler authHandler, cfg *config.APIConfig) http.HandlerFunc
 			return
 		}
 
-		handler(w, r, cfg)
+		handler(w, r.WithContext(auth.WithOwner(r.Context(), auth.OwnerID(token))))
+	}
+}
+
+// MiddleWareAdmin only lets requests carrying the configured admin API key through to handler.
+// Without an admin key, every request is forbidden.
+func MiddleWareAdmin(handler http.HandlerFunc, cfg *config.APIConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminAPIKey == "" {
+			utils.RespondWithError(w, http.StatusForbidden, "Admin endpoints are disabled, set ADMIN_API_KEY to enable them")
+			return
+		}
+		token, err := auth.GetHeaderToken(r.Header)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminAPIKey)) != 1 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Admin Api Key is invalid")
+			return
+		}
+		handler(w, r)
 	}
 }
@@ -0,0 +1,97 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package admin serves the endpoints managing the server, restricted to the admin API key.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// Handler serves the admin endpoints.
+type Handler struct {
+	prompts *prompts.Registry
+}
+
+// NewHandler returns a Handler managing the prompt templates of registry.
+func NewHandler(registry *prompts.Registry) *Handler {
+	return &Handler{prompts: registry}
+}
+
+// PromptList lists prompt templates.
+type PromptList struct {
+	Templates []*prompts.Template `json:"templates"`
+}
+
+// PreviewParams is the body of POST /admin/prompts/{name}/preview. A zero Version previews
+// the latest version.
+type PreviewParams struct {
+	Version int                    `json:"version"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// PreviewResponse is a rendered prompt template.
+type PreviewResponse struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Model   string `json:"model,omitempty"`
+	Prompt  string `json:"prompt"`
+}
+
+// ListPrompts handles GET /admin/prompts.
+func (h *Handler) ListPrompts(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, PromptList{Templates: h.prompts.List()})
+}
+
+// GetPrompt handles GET /admin/prompts/{name}, listing the versions of a template.
+func (h *Handler) GetPrompt(w http.ResponseWriter, r *http.Request) {
+	versions := h.versions(chi.URLParam(r, "name"))
+	if len(versions) == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, prompts.ErrNotFound.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, PromptList{Templates: versions})
+}
+
+// PreviewPrompt handles POST /admin/prompts/{name}/preview.
+func (h *Handler) PreviewPrompt(w http.ResponseWriter, r *http.Request) {
+	var params PreviewParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	response, err := h.preview(chi.URLParam(r, "name"), params)
+	if errors.Is(err, prompts.ErrNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/prompts"
+)
+
+func newTestServer() http.Handler {
+	h := NewHandler(prompts.New())
+	mux := chi.NewRouter()
+	mux.Get("/admin/prompts", h.ListPrompts)
+	mux.Get("/admin/prompts/{name}", h.GetPrompt)
+	mux.Post("/admin/prompts/{name}/preview", h.PreviewPrompt)
+	return mux
+}
+
+func TestPrompts(t *testing.T) {
+	server := newTestServer()
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/prompts/docgpt.retrieval", nil))
+	var list PromptList
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("get: unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	if len(list.Templates) != 1 || list.Templates[0].Source == "" || list.Templates[0].Origin != "builtin" {
+		t.Errorf("unexpected templates %+v", list.Templates)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/prompts/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing: expected status 404, got %d", rec.Code)
+	}
+
+	body := `{"data": {"Filename": "a.pdf", "Excerpts": "[1] (page 2) The dog chased the cat."}}`
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/prompts/docgpt.retrieval/preview", strings.NewReader(body)))
+	var preview PreviewResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("preview: unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	if preview.Version != 1 || !strings.Contains(preview.Prompt, `"a.pdf"`) || !strings.HasSuffix(preview.Prompt, "The dog chased the cat.") {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/prompts/docgpt.retrieval/preview", strings.NewReader(`{"data": {}}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing data: expected status 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package admin
+
+import (
+	"fmt"
+
+	"github.com/kingmariano/omnicron/internal/prompts"
+)
+
+// versions returns the versions of the template name, oldest first.
+func (h *Handler) versions(name string) []*prompts.Template {
+	var versions []*prompts.Template
+	for _, t := range h.prompts.List() {
+		if t.Name == name {
+			versions = append(versions, t)
+		}
+	}
+	return versions
+}
+
+// preview renders a version of the template name with the data of params.
+func (h *Handler) preview(name string, params PreviewParams) (*PreviewResponse, error) {
+	ref := name
+	if params.Version != 0 {
+		ref = fmt.Sprintf("%s@%d", name, params.Version)
+	}
+	t, err := h.prompts.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	data := params.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	prompt, err := t.Execute(data)
+	if err != nil {
+		return nil, err
+	}
+	return &PreviewResponse{Name: t.Name, Version: t.Version, Model: t.Model, Prompt: prompt}, nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package agent runs chat completions in which the server executes Omnicron's own capabilities
+// as tools, feeding their results back to the model until it gives a final answer.
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// Request is the body of POST /agent.
+type Request struct {
+	// Model must be able to call tools; it defaults to the "smart" alias.
+	Model       string        `json:"model"`
+	Messages    []llm.Message `json:"messages"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	// Tools names the built-in tools the model may call; all of them if empty.
+	Tools []string `json:"tools"`
+	// MaxSteps limits the model turns that call tools, see defaultMaxSteps and maxSteps.
+	MaxSteps int `json:"max_steps"`
+}
+
+// Step is a tool call executed by the agent.
+type Step struct {
+	Tool       string          `json:"tool"`
+	Arguments  json.RawMessage `json:"arguments"`
+	Output     json.RawMessage `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+// Response is the final completion of the model with the trace of the tools it called.
+// Usage covers every model turn.
+type Response struct {
+	*llm.ChatCompletion
+	Trace []Step `json:"trace"`
+	// StepLimitReached is set when the model was made to answer because it used up MaxSteps.
+	StepLimitReached bool `json:"step_limit_reached,omitempty"`
+}
+
+// Handler serves the agent endpoint.
+type Handler struct {
+	router *llm.Router
+	tools  map[string]Tool
+	names  []string
+}
+
+// NewHandler returns a Handler that answers with router and lets the model call tools.
+func NewHandler(router *llm.Router, tools []Tool) *Handler {
+	h := &Handler{router: router, tools: make(map[string]Tool, len(tools))}
+	for _, tool := range tools {
+		h.tools[tool.Name] = tool
+		h.names = append(h.names, tool.Name)
+	}
+	return h
+}
+
+// Completion handles POST /agent.
+func (h *Handler) Completion(w http.ResponseWriter, r *http.Request) {
+	var request Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if err := h.validateRequest(&request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	response, err := h.run(r.Context(), request)
+	if err != nil {
+		switch {
+		case errors.Is(err, llm.ErrUnknownModel), errors.Is(err, llm.ErrToolsUnsupported):
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			utils.RespondWithError(w, http.StatusBadGateway, fmt.Sprintf("Error handling agent completion, %v", err))
+		}
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
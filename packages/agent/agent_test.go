@@ -0,0 +1,171 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+// scriptedProvider calls the "lookup" tool until the conversation holds p.calls tool results, then
+// answers with the last of them.
+type scriptedProvider struct {
+	calls    int
+	requests []llm.ChatCompletionRequest
+}
+
+func (p *scriptedProvider) Name() string        { return "fake" }
+func (p *scriptedProvider) Models() []string    { return []string{"m"} }
+func (p *scriptedProvider) SupportsTools() bool { return true }
+
+func (p *scriptedProvider) ChatCompletion(ctx context.Context, request llm.ChatCompletionRequest) (*llm.ChatCompletion, error) {
+	p.requests = append(p.requests, request)
+	usage := &llm.Usage{PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11}
+	var results int
+	for _, m := range request.Messages {
+		if m.Role == "tool" {
+			results++
+		}
+	}
+	if results < p.calls && string(request.ToolChoice) != `"none"` {
+		return &llm.ChatCompletion{Usage: usage, Choices: []llm.Choice{{
+			Message: llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{{
+				ID:       "call_1",
+				Type:     "function",
+				Function: llm.FunctionCall{Name: "lookup", Arguments: `{"key":"answer"}`},
+			}}},
+			FinishReason: "tool_calls",
+		}}}, nil
+	}
+	last := request.Messages[len(request.Messages)-1]
+	return &llm.ChatCompletion{Usage: usage, Choices: []llm.Choice{{
+		Message:      llm.Message{Role: "assistant", Content: "final: " + last.Content},
+		FinishReason: "stop",
+	}}}, nil
+}
+
+func newTestHandler(t *testing.T, provider *scriptedProvider, lookup func(key string) (interface{}, error)) *Handler {
+	t.Helper()
+	router, err := llm.NewRouter(llm.Config{Aliases: map[string][]string{"smart": {"fake/m"}}}, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(router, []Tool{{
+		Name:       "lookup",
+		Parameters: json.RawMessage(`{"type":"object"}`),
+		Call: func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			var args struct {
+				Key string `json:"key"`
+			}
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return nil, err
+			}
+			return lookup(args.Key)
+		},
+	}})
+}
+
+func post(t *testing.T, h *Handler, body string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.Completion(rr, httptest.NewRequest(http.MethodPost, "/agent", strings.NewReader(body)))
+	var response Response
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr, response
+}
+
+func TestAgentRunsToolsUntilAnswer(t *testing.T) {
+	provider := &scriptedProvider{calls: 2}
+	h := newTestHandler(t, provider, func(key string) (interface{}, error) {
+		return map[string]string{key: "42"}, nil
+	})
+	rr, response := post(t, h, `{"messages": [{"role": "user", "content": "what is the answer?"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := response.Choices[0].Message.Content; got != `final: {"answer":"42"}` {
+		t.Errorf("unexpected answer %q", got)
+	}
+	if len(response.Trace) != 2 || response.Trace[0].Tool != "lookup" || string(response.Trace[0].Output) != `{"answer":"42"}` {
+		t.Errorf("unexpected trace %+v", response.Trace)
+	}
+	if response.Usage.TotalTokens != 33 || response.StepLimitReached {
+		t.Errorf("expected the usage of 3 turns and no step limit, got %+v, %v", response.Usage, response.StepLimitReached)
+	}
+	if tools := provider.requests[0].Tools; len(tools) != 1 || tools[0].Function.Name != "lookup" {
+		t.Errorf("expected the lookup tool to be offered, got %+v", tools)
+	}
+}
+
+func TestAgentStepLimitAndToolErrors(t *testing.T) {
+	provider := &scriptedProvider{calls: 10}
+	h := newTestHandler(t, provider, func(string) (interface{}, error) {
+		return nil, errors.New("lookup is down")
+	})
+	rr, response := post(t, h, `{"messages": [{"role": "user", "content": "hi"}], "max_steps": 2}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+	}
+	if !response.StepLimitReached || len(response.Trace) != 2 {
+		t.Errorf("expected 2 steps and the step limit, got %d steps, %v", len(response.Trace), response.StepLimitReached)
+	}
+	if response.Trace[0].Error != "lookup is down" {
+		t.Errorf("expected the tool error in the trace, got %+v", response.Trace[0])
+	}
+	if got := response.Choices[0].Message.Content; got != `final: {"error":"lookup is down"}` {
+		t.Errorf("expected the tool error to be reported to the model, got %q", got)
+	}
+
+	if rr, _ := post(t, h, `{"messages": [{"role": "user", "content": "hi"}], "tools": ["missing"]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown tool, got %d", rr.Code)
+	}
+}
+
+type fakeVideos struct{ urls []string }
+
+func (v *fakeVideos) Download(ctx context.Context, url, resolution string) (string, error) {
+	v.urls = append(v.urls, url)
+	return "https://cdn.example.com/video.mp4", nil
+}
+
+func TestDownloadVideoRejectsInternalURLs(t *testing.T) {
+	videos := &fakeVideos{}
+	tool := downloadVideoTool(videos)
+	for _, url := range []string{"http://127.0.0.1:8000/video", "http://10.0.0.1/video", "http://[::1]/video", "http://169.254.169.254/latest", "file:///etc/passwd"} {
+		if _, err := tool.Call(context.Background(), json.RawMessage(`{"url":"`+url+`"}`)); err == nil {
+			t.Errorf("%s: expected an error", url)
+		}
+	}
+	if len(videos.urls) != 0 {
+		t.Fatalf("downloaded %v", videos.urls)
+	}
+}
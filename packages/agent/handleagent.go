@@ -0,0 +1,165 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+const (
+	// defaultModel answers agent requests without a model.
+	defaultModel = "smart"
+	// defaultMaxSteps and maxSteps bound the model turns that call tools.
+	defaultMaxSteps = 5
+	maxSteps        = 10
+	// maxToolOutput is the number of bytes of a tool result sent back to the model.
+	maxToolOutput = 8000
+)
+
+// validateRequest checks request and fills in its defaults.
+func (h *Handler) validateRequest(request *Request) error {
+	if len(request.Messages) == 0 {
+		return errors.New("messages must contain at least one message")
+	}
+	if request.Model == "" {
+		request.Model = defaultModel
+	}
+	if err := h.router.Validate(request.Model); err != nil {
+		return err
+	}
+	switch {
+	case request.MaxSteps < 0 || request.MaxSteps > maxSteps:
+		return fmt.Errorf("max_steps must be between 1 and %d", maxSteps)
+	case request.MaxSteps == 0:
+		request.MaxSteps = defaultMaxSteps
+	}
+	if len(request.Tools) == 0 {
+		request.Tools = h.names
+	}
+	for _, name := range request.Tools {
+		if _, ok := h.tools[name]; !ok {
+			return fmt.Errorf("unknown tool %q, available tools are %v", name, h.names)
+		}
+	}
+	return nil
+}
+
+// run lets the model call the requested tools until it answers without calling one.
+// Once MaxSteps turns called tools, the model is asked to answer with what it has.
+func (h *Handler) run(ctx context.Context, request Request) (*Response, error) {
+	definitions := make([]llm.Tool, 0, len(request.Tools))
+	for _, name := range request.Tools {
+		definitions = append(definitions, h.tools[name].definition())
+	}
+	messages := append([]llm.Message(nil), request.Messages...)
+	response := &Response{Trace: []Step{}}
+	var usage llm.Usage
+
+	for step := 0; ; step++ {
+		chatRequest := llm.ChatCompletionRequest{
+			Model:       request.Model,
+			Messages:    messages,
+			Temperature: request.Temperature,
+			Tools:       definitions,
+		}
+		if step == request.MaxSteps {
+			chatRequest.ToolChoice = json.RawMessage(`"none"`)
+			response.StepLimitReached = true
+		}
+		completion, err := h.router.ChatCompletion(ctx, chatRequest)
+		if err != nil {
+			return nil, err
+		}
+		if completion.Usage != nil {
+			usage.PromptTokens += completion.Usage.PromptTokens
+			usage.CompletionTokens += completion.Usage.CompletionTokens
+			usage.TotalTokens += completion.Usage.TotalTokens
+		}
+		if len(completion.Choices) == 0 {
+			return nil, errors.New("completion returned no choices")
+		}
+		message := completion.Choices[0].Message
+		if len(message.ToolCalls) == 0 || response.StepLimitReached {
+			completion.Usage = &usage
+			response.ChatCompletion = completion
+			return response, nil
+		}
+
+		messages = append(messages, message)
+		for _, call := range message.ToolCalls {
+			result := h.callTool(ctx, call)
+			response.Trace = append(response.Trace, result)
+			messages = append(messages, llm.Message{
+				Role:       "tool",
+				Name:       call.Function.Name,
+				ToolCallID: call.ID,
+				Content:    toolContent(result),
+			})
+		}
+	}
+}
+
+// callTool runs a tool call of the model. A failing tool is reported to the model,
+// which can try again or answer without it.
+func (h *Handler) callTool(ctx context.Context, call llm.ToolCall) (step Step) {
+	step = Step{Tool: call.Function.Name, Arguments: json.RawMessage(call.Function.Arguments)}
+	if !json.Valid(step.Arguments) {
+		step.Arguments = json.RawMessage("{}")
+	}
+	start := time.Now()
+	defer func() { step.DurationMS = time.Since(start).Milliseconds() }()
+
+	tool, ok := h.tools[call.Function.Name]
+	if !ok {
+		step.Error = fmt.Sprintf("unknown tool %q", call.Function.Name)
+		return step
+	}
+	output, err := tool.Call(ctx, step.Arguments)
+	if err != nil {
+		log.Printf("agent tool %s failed: %v", tool.Name, err)
+		step.Error = err.Error()
+		return step
+	}
+	if step.Output, err = json.Marshal(output); err != nil {
+		step.Error = fmt.Sprintf("failed to encode tool output: %v", err)
+	}
+	return step
+}
+
+// toolContent is the message content reporting the result of step to the model.
+func toolContent(step Step) string {
+	if step.Error != "" {
+		data, _ := json.Marshal(map[string]string{"error": step.Error})
+		return string(data)
+	}
+	content := string(step.Output)
+	if len(content) > maxToolOutput {
+		content = content[:maxToolOutput] + "...(truncated)"
+	}
+	return content
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/kingmariano/omnicron/packages/image2text"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/packages/musicsearch"
+	"github.com/kingmariano/omnicron/services"
+	replicate "github.com/replicate/replicate-go"
+)
+
+const (
+	// maxImageSize is the largest image the ocr_image tool downloads.
+	maxImageSize = 20 << 20
+	// imageFetchTimeout bounds the download of an image for the ocr_image tool.
+	imageFetchTimeout = 30 * time.Second
+)
+
+// Tool is a capability the model can call in agent mode.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments.
+	Parameters json.RawMessage
+	// Call runs the tool with the arguments chosen by the model and returns a JSON encodable result.
+	Call func(ctx context.Context, arguments json.RawMessage) (interface{}, error)
+}
+
+func (t Tool) definition() llm.Tool {
+	return llm.Tool{
+		Type:     "function",
+		Function: llm.FunctionDefinition{Name: t.Name, Description: t.Description, Parameters: t.Parameters},
+	}
+}
+
+// ImageGenerator generates images from a prompt.
+type ImageGenerator interface {
+	GenerateImage(ctx context.Context, prompt string) (replicate.PredictionOutput, error)
+}
+
+// VideoDownloader downloads a video and returns a URL to the downloaded file.
+type VideoDownloader interface {
+	Download(ctx context.Context, url, resolution string) (string, error)
+}
+
+// YoutubeSummarizer summarizes a YouTube video.
+type YoutubeSummarizer interface {
+	Summarize(ctx context.Context, youtubeURL string) (string, error)
+}
+
+// Capabilities are the Omnicron features exposed as built-in tools. A nil capability leaves its tool out.
+type Capabilities struct {
+	Images  ImageGenerator
+	Videos  VideoDownloader
+	Youtube YoutubeSummarizer
+	// Sidecar serves the search_music and ocr_image tools.
+	Sidecar services.SidecarClient
+}
+
+// BuiltinTools returns the tools backed by capabilities.
+func BuiltinTools(capabilities Capabilities) []Tool {
+	var tools []Tool
+	if capabilities.Images != nil {
+		tools = append(tools, generateImageTool(capabilities.Images))
+	}
+	if capabilities.Sidecar != nil {
+		tools = append(tools, searchMusicTool(capabilities.Sidecar))
+	}
+	if capabilities.Videos != nil {
+		tools = append(tools, downloadVideoTool(capabilities.Videos))
+	}
+	if capabilities.Youtube != nil {
+		tools = append(tools, summarizeYoutubeTool(capabilities.Youtube))
+	}
+	if capabilities.Sidecar != nil {
+		tools = append(tools, ocrImageTool(capabilities.Sidecar, newPublicHTTPClient(imageFetchTimeout)))
+	}
+	return tools
+}
+
+func generateImageTool(images ImageGenerator) Tool {
+	return Tool{
+		Name:        "generate_image",
+		Description: "Generate an image from a text description. Returns the URLs of the generated images.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"prompt":{"type":"string","description":"Detailed description of the image"}},"required":["prompt"]}`),
+		Call: func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			var args struct {
+				Prompt string `json:"prompt"`
+			}
+			if err := decodeArguments(arguments, &args); err != nil {
+				return nil, err
+			}
+			if args.Prompt == "" {
+				return nil, errors.New("prompt is required")
+			}
+			output, err := images.GenerateImage(ctx, args.Prompt)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"images": output}, nil
+		},
+	}
+}
+
+func searchMusicTool(client services.SidecarClient) Tool {
+	return Tool{
+		Name:        "search_music",
+		Description: "Search songs by title, artist or lyrics. Returns the matching songs with their Shazam links.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"Song title, artist or lyrics"},"limit":{"type":"integer","description":"Maximum number of songs, default 5"}},"required":["query"]}`),
+		Call: func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			var args struct {
+				Query string `json:"query"`
+				Limit int    `json:"limit"`
+			}
+			if err := decodeArguments(arguments, &args); err != nil {
+				return nil, err
+			}
+			if args.Query == "" {
+				return nil, errors.New("query is required")
+			}
+			if args.Limit <= 0 {
+				args.Limit = 5
+			}
+			songs, err := musicsearch.CallMusicSearchFastAPI(ctx, client, musicsearch.MusicSearchRequest{Song: args.Query, Limit: args.Limit})
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"songs": songs}, nil
+		},
+	}
+}
+
+func downloadVideoTool(videos VideoDownloader) Tool {
+	return Tool{
+		Name:        "download_video",
+		Description: "Download a video from YouTube or another supported site. Returns a direct link to the downloaded file.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"url":{"type":"string","description":"URL of the video"},"resolution":{"type":"string","enum":["1080p","720p","480p","360p","240p"]}},"required":["url"]}`),
+		Call: func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			var args struct {
+				URL        string `json:"url"`
+				Resolution string `json:"resolution"`
+			}
+			if err := decodeArguments(arguments, &args); err != nil {
+				return nil, err
+			}
+			if args.URL == "" {
+				return nil, errors.New("url is required")
+			}
+			// the URL comes from the model, and the download is uploaded where anyone can read it
+			if err := checkPublicURL(ctx, args.URL); err != nil {
+				return nil, err
+			}
+			link, err := videos.Download(ctx, args.URL, args.Resolution)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"url": link}, nil
+		},
+	}
+}
+
+func summarizeYoutubeTool(youtube YoutubeSummarizer) Tool {
+	return Tool{
+		Name:        "summarize_youtube",
+		Description: "Transcribe a YouTube video and summarize what is said in it.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"url":{"type":"string","description":"URL of the YouTube video"}},"required":["url"]}`),
+		Call: func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			var args struct {
+				URL string `json:"url"`
+			}
+			if err := decodeArguments(arguments, &args); err != nil {
+				return nil, err
+			}
+			if args.URL == "" {
+				return nil, errors.New("url is required")
+			}
+			summary, err := youtube.Summarize(ctx, args.URL)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"summary": summary}, nil
+		},
+	}
+}
+
+func ocrImageTool(client services.SidecarClient, httpClient *http.Client) Tool {
+	return Tool{
+		Name:        "ocr_image",
+		Description: "Extract the text of an image available at a public URL.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"image_url":{"type":"string","description":"http or https URL of the image"}},"required":["image_url"]}`),
+		Call: func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			var args struct {
+				ImageURL string `json:"image_url"`
+			}
+			if err := decodeArguments(arguments, &args); err != nil {
+				return nil, err
+			}
+			image, filename, err := fetchImage(ctx, httpClient, args.ImageURL)
+			if err != nil {
+				return nil, err
+			}
+			response, err := image2text.CallImageToTextFastAPI(ctx, client, image, filename)
+			if err != nil {
+				return nil, err
+			}
+			return response, nil
+		},
+	}
+}
+
+// fetchImage downloads the image at rawURL and returns it with its file name.
+func fetchImage(ctx context.Context, client *http.Client, rawURL string) (io.Reader, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", errors.New("image_url must be an http or https URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch image: status %d", resp.StatusCode)
+	}
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch image: %w", err)
+	}
+	if len(image) > maxImageSize {
+		return nil, "", fmt.Errorf("image is larger than %d MB", maxImageSize>>20)
+	}
+	filename := path.Base(u.Path)
+	if filename == "." || filename == "/" {
+		filename = "image"
+	}
+	return bytes.NewReader(image), filename, nil
+}
+
+// newPublicHTTPClient returns a client that refuses to connect to loopback, private and link-local
+// addresses, since the URLs it fetches are chosen by the model.
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicIP(net.ParseIP(host)) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+}
+
+// checkPublicURL checks that rawURL is an http or https URL whose host only resolves to public
+// addresses. It is used for the URLs fetched by clients that can't be given newPublicHTTPClient.
+func checkPublicURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid url %q", rawURL)
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", u.Hostname(), err)
+	}
+	for _, address := range addresses {
+		if !isPublicIP(address.IP) {
+			return fmt.Errorf("refusing to download from non-public address %s", address.IP)
+		}
+	}
+	return nil
+}
+
+// isPublicIP reports whether ip is a public address, not a loopback, private, link-local or
+// unspecified one.
+func isPublicIP(ip net.IP) bool {
+	return ip != nil && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+func decodeArguments(arguments json.RawMessage, v interface{}) error {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(arguments, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
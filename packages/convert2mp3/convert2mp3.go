@@ -23,16 +23,40 @@ package convert2mp3
 import (
 	"net/http"
 
-	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/clip"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 )
 
+// Handler serves the convert2mp3 endpoint.
+type Handler struct {
+	transcoder services.Transcoder
+	storage    services.Storage
+}
+
+// NewHandler returns a Handler that converts media with transcoder and uploads the result to storage.
+func NewHandler(transcoder services.Transcoder, storage services.Storage) *Handler {
+	return &Handler{transcoder: transcoder, storage: storage}
+}
+
+// ResponseMsg holds the URL of the MP3, or of each clip cut out of it.
 type ResponseMsg struct {
-	URL string `json:"url"`
+	URL   string        `json:"url"`
+	Clips []clip.Result `json:"clips,omitempty"`
 }
 
-func ConvertToMp3(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+func (h *Handler) ConvertToMp3(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	clipOptions, err := clip.FormOptions(r.FormValue)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	segments, err := clipOptions.Parse()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	// creates a unique folder within the current directory
 	folderPath, err := utils.CreateUniqueFolder(utils.BasePath)
 	if err != nil {
@@ -40,7 +64,7 @@ func ConvertToMp3(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig)
 		return
 	}
 	// processes the uploaded file and converts it to mp3, then saves it to the unique folder path
-	outputfileName, err := handleRequestBodyAndConvertToMP3(r, folderPath)
+	outputfileName, err := h.handleRequestBodyAndConvertToMP3(r, folderPath)
 	if err != nil {
 		if cleanupErr := utils.DeleteFolder(folderPath); cleanupErr != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete folder: "+cleanupErr.Error())
@@ -49,8 +73,20 @@ func ConvertToMp3(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig)
 		utils.RespondWithError(w, http.StatusInternalServerError, "Conversion failed: "+err.Error())
 		return
 	}
+	if len(segments) > 0 {
+		response, err := h.uploadClips(ctx, outputfileName, segments, clipOptions)
+		if cleanupErr := utils.DeleteFolder(folderPath); cleanupErr != nil && err == nil {
+			err = cleanupErr
+		}
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, response)
+		return
+	}
 	// uploads the file to cloudinary to get back the direct url link
-	urlLink, err := utils.HandleFileUpload(ctx, outputfileName, cfg.CloudinaryURL)
+	urlLink, err := h.storage.Upload(ctx, outputfileName)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -21,13 +21,15 @@
 package convert2mp3
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/kingmariano/omnicron/internal/clip"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func handleRequestBodyAndConvertToMP3(r *http.Request, outputDir string) (string, error) {
+func (h *Handler) handleRequestBodyAndConvertToMP3(r *http.Request, outputDir string) (string, error) {
 	// handles the request body input which is either a file-form or a url form-value
 	url := r.FormValue("url")
 	//if the user has specified the url parameter handles it immedaitely
@@ -36,7 +38,7 @@ func handleRequestBodyAndConvertToMP3(r *http.Request, outputDir string) (string
 		if err != nil {
 			return "", fmt.Errorf("error downloading file %s: %v", url, err)
 		}
-		outputFileName, err := utils.ConvertFileToMP3(downloadedFileName)
+		outputFileName, err := h.transcoder.ConvertFileToMP3(downloadedFileName)
 		if err != nil {
 			return "", fmt.Errorf("error converting file %s to mp3: %v", downloadedFileName, err)
 		}
@@ -51,9 +53,32 @@ func handleRequestBodyAndConvertToMP3(r *http.Request, outputDir string) (string
 	}
 	defer file.Close()
 	// performs the conversion of the reader to mp3
-	outputFileName, err := utils.ConvertReaderToMP3(file, outputDir)
+	outputFileName, err := h.transcoder.ConvertReaderToMP3(file, outputDir)
 	if err != nil {
 		return "", fmt.Errorf("error converting uploaded file to mp3: %v", err)
 	}
 	return outputFileName, nil
 }
+
+// uploadClips cuts segments out of the MP3 at path and uploads them. A single clip or the joined
+// clips are returned in URL.
+func (h *Handler) uploadClips(ctx context.Context, path string, segments []clip.Segment, opts clip.Options) (ResponseMsg, error) {
+	clips, err := clip.Cut(ctx, h.transcoder, path, segments, opts.Join, opts.Reencode)
+	if err != nil {
+		return ResponseMsg{}, fmt.Errorf("error clipping %s: %v", path, err)
+	}
+	urls := make([]string, len(clips))
+	for i, clipPath := range clips {
+		if urls[i], err = h.storage.Upload(ctx, clipPath); err != nil {
+			return ResponseMsg{}, err
+		}
+	}
+	var response ResponseMsg
+	if len(urls) == 1 {
+		response.URL = urls[0]
+	}
+	if !opts.Join {
+		response.Clips = clip.Results(segments, urls)
+	}
+	return response, nil
+}
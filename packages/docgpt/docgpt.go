@@ -21,17 +21,72 @@
 package docgpt
 
 import (
+	"context"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/internal/vectorstore"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
+// Embedder embeds the chunks of documents, see embeddings.Handler.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Model() string
+}
+
+// Handler serves the docgpt and document endpoints.
+type Handler struct {
+	router   *llm.Router
+	sidecar  services.SidecarClient
+	store    *store.Store
+	embedder Embedder
+	// index holds a collection of chunks for every document, named after it
+	index   *vectorstore.Index
+	prompts *prompts.Registry
+}
+
+// PromptData is the data of the docgpt prompt templates. Each template uses the fields its
+// feature sets, see the descriptions of the built-in templates.
+type PromptData struct {
+	// Filename is the name of the document.
+	Filename string
+	// Text is the text of the document with its pages marked as [Page N], notes on its parts,
+	// or the documents of a synthesis.
+	Text string
+	// Excerpts are the chunks retrieved for a question, numbered as [n].
+	Excerpts string
+	// Partial is set when Text holds notes on parts of the document rather than its pages.
+	Partial bool
+	// None is the answer of a part of the document without anything relevant.
+	None string
+	// Mode is the synthesis mode and Count the number of documents synthesized.
+	Mode  string
+	Count int
+}
+
+// NewHandler returns a Handler that extracts documents through the FastAPI server, keeps them in s
+// and answers with router, using the system prompts of registry. The documents are indexed with
+// embedder for retrieval; if embedder is nil, questions are answered from the full text.
+func NewHandler(router *llm.Router, sidecar services.SidecarClient, s *store.Store, embedder Embedder, registry *prompts.Registry) *Handler {
+	return &Handler{
+		router:   router,
+		sidecar:  sidecar,
+		store:    s,
+		embedder: embedder,
+		index:    vectorstore.NewNamespace(s, "document"),
+		prompts:  registry,
+	}
+}
+
 type ResponseMsg struct {
 	Response string `json:"response"`
 }
 
-func DocGPT(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+func (h *Handler) DocGPT(w http.ResponseWriter, r *http.Request) {
 	// Parse the multipart form in the request
 	err := r.ParseMultipartForm(30 << 20) // 30MB max memory
 	if err != nil {
@@ -49,7 +104,13 @@ func DocGPT(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
 		utils.RespondWithError(w, http.StatusBadRequest, "Prompt is required")
 		return
 	}
-	response, err := CallDocGPTFastAPI(file, fileHeader, prompt, cfg.GrokAPIKey, cfg.APIKey, cfg.FASTAPIBaseURL)
+	// the template and model fields optionally override the system prompt and the model
+	template, model := r.FormValue("template"), r.FormValue("model")
+	if model, err = h.promptModel(template, legacyTemplate, model); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	response, err := h.CallDocGPTFastAPI(r.Context(), file, fileHeader, prompt, template, model)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,315 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package docgpt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+const (
+	maxDocumentBytes  = 50 << 20  // size of an uploaded document
+	maxSynthesisBytes = 100 << 20 // size of all the documents uploaded for a synthesis
+)
+
+// Answer modes of POST /documents/{id}/ask.
+const (
+	// ModeRetrieval answers from the chunks most relevant to the question. It is the default.
+	ModeRetrieval = "retrieval"
+	// ModeMapReduce reads the whole document in parts and combines what each part says, for
+	// tasks such as summarizing everything.
+	ModeMapReduce = "map_reduce"
+	// ModeFullText sends the whole document, used when it can't be indexed.
+	ModeFullText = "full_text"
+)
+
+// Document is an uploaded document whose text was extracted once, page by page.
+type Document struct {
+	ID         string `json:"id"`
+	Filename   string `json:"filename"`
+	Format     string `json:"format"`
+	PageCount  int    `json:"page_count"`
+	Characters int    `json:"characters"`
+	// Indexed is set once the chunks of the document are embedded for retrieval.
+	Indexed   bool      `json:"indexed"`
+	Chunks    int       `json:"chunks,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Page is the text extracted from a page of a document. Numbers start at 1.
+type Page struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// DocumentResponse is a document with its extracted text.
+type DocumentResponse struct {
+	Document
+	Pages []Page `json:"pages"`
+}
+
+// DocumentList is the response of GET /documents.
+type DocumentList struct {
+	Documents []Document `json:"documents"`
+}
+
+// AskParams is the body of POST /documents/{id}/ask. Questions with the same SessionID see the
+// previous questions and answers of the session; a question without one starts a new session.
+type AskParams struct {
+	Question  string `json:"question"`
+	SessionID string `json:"session_id"`
+	Model     string `json:"model"`
+	// Mode is ModeRetrieval or ModeMapReduce.
+	Mode string `json:"mode"`
+	// TopK is the number of chunks retrieved, see defaultTopK and maxTopK.
+	TopK int `json:"top_k"`
+	// Template replaces the system prompt answering the question: docgpt.retrieval,
+	// docgpt.document when answering from the full text, or docgpt.reduce in map-reduce mode.
+	Template string `json:"template"`
+}
+
+// Citation is a source of an answer. Retrieval answers cite the chunks they refer to as [n];
+// map-reduce answers cite pages, without a snippet. Syntheses cite documents by their number
+// in the request, and pages when the model named one.
+type Citation struct {
+	Source     int     `json:"source,omitempty"`
+	Document   int     `json:"document,omitempty"`
+	DocumentID string  `json:"document_id,omitempty"`
+	Page       int     `json:"page,omitempty"`
+	Snippet    string  `json:"snippet,omitempty"`
+	Score      float32 `json:"score,omitempty"`
+}
+
+// AskResponse is the answer to a question about a document.
+type AskResponse struct {
+	Answer    string `json:"answer"`
+	SessionID string `json:"session_id"`
+	// Model is the prefixed model that answered.
+	Model     string     `json:"model"`
+	Mode      string     `json:"mode"`
+	Citations []Citation `json:"citations"`
+	// Truncated is set when the document didn't fit the context window of the model and only
+	// its first pages were sent.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// SynthesizeParams is the JSON body of POST /documents/synthesize. As a multipart form, the
+// same fields are form values and the new documents are uploaded as "files".
+type SynthesizeParams struct {
+	DocumentIDs []string `json:"document_ids"`
+	// Mode is SynthesisCompare, SynthesisMergeSummary or SynthesisQuestion.
+	Mode string `json:"mode"`
+	// Question is required by SynthesisQuestion; the other modes take it as extra instructions.
+	Question string `json:"question"`
+	Model    string `json:"model"`
+	// Template replaces the docgpt.synthesis system prompt.
+	Template string `json:"template"`
+}
+
+// SynthesizedDocument is a document of a synthesis. Summarized is set when the document didn't
+// fit its share of the context window and was condensed first.
+type SynthesizedDocument struct {
+	Number     int    `json:"number"`
+	ID         string `json:"id"`
+	Filename   string `json:"filename"`
+	Summarized bool   `json:"summarized,omitempty"`
+}
+
+// SynthesizeResponse is the synthesis of several documents.
+type SynthesizeResponse struct {
+	Answer    string                `json:"answer"`
+	Mode      string                `json:"mode"`
+	Model     string                `json:"model"`
+	Documents []SynthesizedDocument `json:"documents"`
+	Citations []Citation            `json:"citations"`
+	// Truncated is set when a condensed document still didn't fit and was cut.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// UploadDocument handles POST /documents: it extracts the text of the uploaded file, stores it and
+// indexes its chunks. A document that fails to index is indexed again on its first question.
+func (h *Handler) UploadDocument(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentBytes)
+	if err := r.ParseMultipartForm(30 << 20); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error parsing multipart form, %v", err))
+		return
+	}
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error retrieving the file, %v", err))
+		return
+	}
+	defer file.Close()
+	filebytes, err := io.ReadAll(file)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error reading the file, %v", err))
+		return
+	}
+	document, err := h.createDocument(r.Context(), auth.Owner(r.Context()), filebytes, fileHeader.Filename)
+	if err != nil {
+		respondWithDocumentError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, document)
+}
+
+// ListDocuments handles GET /documents, newest first.
+func (h *Handler) ListDocuments(w http.ResponseWriter, r *http.Request) {
+	documents, err := h.listDocuments(auth.Owner(r.Context()))
+	if err != nil {
+		respondWithDocumentError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, DocumentList{Documents: documents})
+}
+
+// GetDocument handles GET /documents/{id}, returning the document with its pages.
+func (h *Handler) GetDocument(w http.ResponseWriter, r *http.Request) {
+	owner, id := auth.Owner(r.Context()), chi.URLParam(r, "id")
+	document, err := h.loadDocument(owner, id)
+	if err != nil {
+		respondWithDocumentError(w, err)
+		return
+	}
+	pages, err := h.loadPages(owner, id)
+	if err != nil {
+		respondWithDocumentError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, DocumentResponse{Document: *document, Pages: pages})
+}
+
+// DeleteDocument handles DELETE /documents/{id}, removing the document, its pages and sessions.
+func (h *Handler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	if err := h.deleteDocument(auth.Owner(r.Context()), chi.URLParam(r, "id")); err != nil {
+		respondWithDocumentError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Ask handles POST /documents/{id}/ask.
+func (h *Handler) Ask(w http.ResponseWriter, r *http.Request) {
+	var params AskParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if params.Question == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, question is required")
+		return
+	}
+	if params.Mode == "" {
+		params.Mode = ModeRetrieval
+	}
+	if params.Mode != ModeRetrieval && params.Mode != ModeMapReduce {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, mode must be %q or %q", ModeRetrieval, ModeMapReduce))
+		return
+	}
+	if params.TopK == 0 {
+		params.TopK = defaultTopK
+	}
+	if params.TopK < 0 || params.TopK > maxTopK {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, top_k must be between 1 and %d", maxTopK))
+		return
+	}
+	fallback := retrievalTemplate
+	if params.Mode == ModeMapReduce {
+		fallback = reduceTemplate
+	}
+	var err error
+	if params.Model, err = h.promptModel(params.Template, fallback, params.Model); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	response, err := h.ask(r.Context(), auth.Owner(r.Context()), chi.URLParam(r, "id"), params)
+	if err != nil {
+		respondWithDocumentError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// Synthesize handles POST /documents/synthesize: it compares, summarizes together or answers a
+// question across stored documents and uploaded files. Uploaded files are stored as documents.
+func (h *Handler) Synthesize(w http.ResponseWriter, r *http.Request) {
+	var params SynthesizeParams
+	var files []*multipart.FileHeader
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSynthesisBytes)
+		if err := r.ParseMultipartForm(30 << 20); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error parsing multipart form, %v", err))
+			return
+		}
+		for _, ids := range r.MultipartForm.Value["document_ids"] {
+			params.DocumentIDs = append(params.DocumentIDs, strings.FieldsFunc(ids, func(r rune) bool { return r == ',' || r == ' ' })...)
+		}
+		params.Mode, params.Question, params.Model = r.FormValue("mode"), r.FormValue("question"), r.FormValue("model")
+		params.Template = r.FormValue("template")
+		files = r.MultipartForm.File["files"]
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if err := h.validateSynthesis(&params, len(files)); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	owner := auth.Owner(r.Context())
+	for _, fileHeader := range files {
+		document, err := h.uploadFileHeader(r.Context(), owner, fileHeader)
+		if err != nil {
+			respondWithDocumentError(w, fmt.Errorf("%s: %w", fileHeader.Filename, err))
+			return
+		}
+		params.DocumentIDs = append(params.DocumentIDs, document.ID)
+	}
+	response, err := h.synthesize(r.Context(), owner, params)
+	if err != nil {
+		respondWithDocumentError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+func respondWithDocumentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "document or session not found")
+	case errors.Is(err, errInvalidDocument), errors.Is(err, errQuestionTooLong), errors.Is(err, errTemplate):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errStore):
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusBadGateway, err.Error())
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package docgpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/internal/vectorstore"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+// fakeEmbedder embeds a text by counting the words "cat" and "dog".
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Model() string { return "fake" }
+
+func (fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(strings.Count(text, "cat")) + 0.1, float32(strings.Count(text, "dog"))}
+	}
+	return vectors, nil
+}
+
+// fakeSidecar extracts two pages from any document and counts the extractions.
+type fakeSidecar struct {
+	extractions int
+}
+
+func (s *fakeSidecar) PostJSON(ctx context.Context, endpoint string, request, response interface{}, opts ...sidecar.CallOption) error {
+	return nil
+}
+
+func (s *fakeSidecar) PostFile(ctx context.Context, endpoint string, file io.Reader, filename string, response interface{}, opts ...sidecar.CallOption) error {
+	s.extractions++
+	response.(*AnalyzeDocResponse).Text = []string{"The cat sat on the mat.", "The dog chased the cat."}
+	return nil
+}
+
+func (s *fakeSidecar) PostStream(ctx context.Context, endpoint string, request interface{}, opts ...sidecar.CallOption) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+// fakeProvider answers with answer, or "answer" if it is empty, and records the requests.
+type fakeProvider struct {
+	answer   string
+	requests []llm.ChatCompletionRequest
+}
+
+func (p *fakeProvider) Name() string     { return "fake" }
+func (p *fakeProvider) Models() []string { return []string{"chat"} }
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, request llm.ChatCompletionRequest) (*llm.ChatCompletion, error) {
+	p.requests = append(p.requests, request)
+	answer := p.answer
+	if answer == "" {
+		answer = "answer"
+	}
+	return &llm.ChatCompletion{
+		Model:   "fake/" + request.Model,
+		Choices: []llm.Choice{{Message: llm.Message{Role: "assistant", Content: answer}}},
+	}, nil
+}
+
+func newTestServer(t *testing.T, sc *fakeSidecar, provider *fakeProvider, embedder Embedder, window int) http.Handler {
+	t.Helper()
+	return newTestServerWithPrompts(t, sc, provider, embedder, window, prompts.New())
+}
+
+func newTestServerWithPrompts(t *testing.T, sc *fakeSidecar, provider *fakeProvider, embedder Embedder, window int, registry *prompts.Registry) http.Handler {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return newTestServerWithStore(t, s, sc, provider, embedder, window, registry)
+}
+
+func newTestServerWithStore(t *testing.T, s *store.Store, sc *fakeSidecar, provider *fakeProvider, embedder Embedder, window int, registry *prompts.Registry) http.Handler {
+	t.Helper()
+	router, err := llm.NewRouter(llm.Config{
+		Aliases:        map[string][]string{docGPTModel: {"fake/chat"}, "terse": {"fake/chat"}},
+		ContextWindows: map[string]int{"fake/chat": window},
+	}, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(router, sc, s, embedder, registry)
+	mux := chi.NewRouter()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithOwner(r.Context(), "alice")))
+		})
+	})
+	mux.Post("/documents", h.UploadDocument)
+	mux.Get("/documents", h.ListDocuments)
+	mux.Post("/documents/synthesize", h.Synthesize)
+	mux.Get("/documents/{id}", h.GetDocument)
+	mux.Delete("/documents/{id}", h.DeleteDocument)
+	mux.Post("/documents/{id}/ask", h.Ask)
+	return mux
+}
+
+// upload uploads a PDF the Go extractor can't read, which is sent to the sidecar.
+func upload(t *testing.T, handler http.Handler) DocumentResponse {
+	t.Helper()
+	return uploadFile(t, handler, "pets.pdf", "%PDF-1.4\n%fake document\n")
+}
+
+func uploadFile(t *testing.T, handler http.Handler, filename, content string) DocumentResponse {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", filename)
+	_, _ = part.Write([]byte(content))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/documents", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload: expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var document DocumentResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func ask(t *testing.T, handler http.Handler, id string, params AskParams) (int, AskResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	_ = json.NewEncoder(&body).Encode(params)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/documents/"+id+"/ask", &body))
+	var response AskResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+func TestDocumentSession(t *testing.T) {
+	sc, provider := &fakeSidecar{}, &fakeProvider{}
+	server := newTestServer(t, sc, provider, nil, 8192)
+
+	document := upload(t, server)
+	if document.PageCount != 2 || len(document.Pages) != 2 || document.Pages[1].Number != 2 {
+		t.Fatalf("unexpected document %+v", document)
+	}
+
+	code, first := ask(t, server, document.ID, AskParams{Question: "Who sat on the mat?"})
+	if code != http.StatusOK || first.Answer != "answer" || first.SessionID == "" || first.Mode != ModeFullText {
+		t.Fatalf("ask: unexpected response %d %+v", code, first)
+	}
+	if code, _ := ask(t, server, document.ID, AskParams{Question: "And the dog?", SessionID: first.SessionID}); code != http.StatusOK {
+		t.Fatalf("follow-up: expected status 200, got %d", code)
+	}
+	if sc.extractions != 1 {
+		t.Errorf("expected the document to be extracted once, got %d extractions", sc.extractions)
+	}
+	last := provider.requests[len(provider.requests)-1].Messages
+	if len(last) != 4 || last[1].Content != "Who sat on the mat?" || last[2].Content != "answer" {
+		t.Errorf("expected the session history to be replayed, got %+v", last)
+	}
+	if !strings.Contains(last[0].Content, "[Page 2]\nThe dog chased the cat.") {
+		t.Errorf("expected the pages in the system prompt, got %q", last[0].Content)
+	}
+
+	if code, _ := ask(t, server, document.ID, AskParams{Question: "?", SessionID: "session_missing"}); code != http.StatusNotFound {
+		t.Errorf("unknown session: expected status 404, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/documents/"+document.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected status 204, got %d", rec.Code)
+	}
+	if code, _ := ask(t, server, document.ID, AskParams{Question: "?"}); code != http.StatusNotFound {
+		t.Errorf("deleted document: expected status 404, got %d", code)
+	}
+}
+
+func TestPagesTextTruncates(t *testing.T) {
+	pages := []Page{{Number: 1, Text: strings.Repeat("a", 100)}, {Number: 2, Text: strings.Repeat("b", 100)}}
+	text, truncated := pagesText(pages, 40)
+	if !truncated || !strings.Contains(text, "[Page 1]") || strings.Contains(text, "[Page 2]") {
+		t.Errorf("expected only the first page, got %q, %v", text, truncated)
+	}
+	if text, truncated := pagesText(pages[:1], 10); !truncated || len(text) != 40 {
+		t.Errorf("expected the start of the first page, got %q, %v", text, truncated)
+	}
+}
+
+func TestUploadExtractsTextInGo(t *testing.T) {
+	sc := &fakeSidecar{}
+	server := newTestServer(t, sc, &fakeProvider{}, nil, 8192)
+
+	document := uploadFile(t, server, "notes.md", "# Notes\n\nBuy milk.\fCall mum.")
+	if sc.extractions != 0 {
+		t.Errorf("expected markdown to be extracted without the sidecar, got %d extractions", sc.extractions)
+	}
+	if document.Format != "markdown" || document.PageCount != 2 || document.Pages[1].Text != "Call mum." {
+		t.Errorf("unexpected document %+v", document)
+	}
+}
+
+func TestRetrievalCitesPages(t *testing.T) {
+	provider := &fakeProvider{answer: "The dog chased the cat [1]."}
+	server := newTestServer(t, &fakeSidecar{}, provider, fakeEmbedder{}, 8192)
+
+	document := upload(t, server)
+	if !document.Indexed || document.Chunks != 2 {
+		t.Fatalf("expected the document to be indexed in 2 chunks, got %+v", document.Document)
+	}
+	code, response := ask(t, server, document.ID, AskParams{Question: "What did the dog do?", TopK: 1})
+	if code != http.StatusOK || response.Mode != ModeRetrieval {
+		t.Fatalf("ask: unexpected response %d %+v", code, response)
+	}
+	if len(response.Citations) != 1 || response.Citations[0].Page != 2 || response.Citations[0].Snippet != "The dog chased the cat." {
+		t.Errorf("expected a citation of page 2, got %+v", response.Citations)
+	}
+	system := provider.requests[0].Messages[0].Content
+	if !strings.Contains(system, "[1] (page 2)") || strings.Contains(system, "mat") {
+		t.Errorf("expected only the retrieved chunk in the prompt, got %q", system)
+	}
+}
+
+// renamedEmbedder is fakeEmbedder under another model name.
+type renamedEmbedder struct {
+	fakeEmbedder
+	model string
+}
+
+func (e renamedEmbedder) Model() string { return e.model }
+
+func TestRetrievalReindexesForNewModel(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	document := upload(t, newTestServerWithStore(t, s, &fakeSidecar{}, &fakeProvider{}, fakeEmbedder{}, 8192, prompts.New()))
+
+	server := newTestServerWithStore(t, s, &fakeSidecar{}, &fakeProvider{}, renamedEmbedder{model: "fake-v2"}, 8192, prompts.New())
+	if code, response := ask(t, server, document.ID, AskParams{Question: "What did the dog do?", TopK: 1}); code != http.StatusOK || response.Mode != ModeRetrieval {
+		t.Fatalf("ask: unexpected response %d %+v", code, response)
+	}
+	collection, err := vectorstore.NewNamespace(s, "document").Collection("alice", document.ID)
+	if err != nil || collection.Model != "fake-v2" || collection.Count != 2 {
+		t.Errorf("expected the document to be indexed again with fake-v2, got %+v, %v", collection, err)
+	}
+}
+
+func TestAskWithTemplate(t *testing.T) {
+	dir := t.TempDir()
+	source := "---\nmodel: terse\n---\nAnswer in one word from {{.Excerpts}}"
+	if err := os.WriteFile(filepath.Join(dir, "docgpt.terse.v1.tmpl"), []byte(source), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	registry := prompts.New()
+	if err := registry.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeProvider{}
+	server := newTestServerWithPrompts(t, &fakeSidecar{}, provider, fakeEmbedder{}, 8192, registry)
+
+	document := upload(t, server)
+	code, response := ask(t, server, document.ID, AskParams{Question: "What did the dog do?", TopK: 1, Template: "docgpt.terse"})
+	if code != http.StatusOK || response.Model != "fake/chat" {
+		t.Fatalf("ask: unexpected response %d %+v", code, response)
+	}
+	request := provider.requests[0]
+	if request.Model != "chat" || !strings.HasPrefix(request.Messages[0].Content, "Answer in one word from [1] (page 2)") {
+		t.Errorf("expected the template and its model, got %q with %q", request.Model, request.Messages[0].Content)
+	}
+	if code, _ := ask(t, server, document.ID, AskParams{Question: "?", Template: "docgpt.missing"}); code != http.StatusBadRequest {
+		t.Errorf("unknown template: expected status 400, got %d", code)
+	}
+}
+
+func TestMapReduceReadsEveryPart(t *testing.T) {
+	provider := &fakeProvider{answer: "Pets [Page 2] [Page 1]"}
+	// the window fits a single page with the question but both partial answers, so each page is
+	// read on its own and the answers are combined at once
+	server := newTestServer(t, &fakeSidecar{}, provider, nil, 290)
+
+	document := upload(t, server)
+	code, response := ask(t, server, document.ID, AskParams{Question: "Summarize", Mode: ModeMapReduce})
+	if code != http.StatusOK || response.Mode != ModeMapReduce {
+		t.Fatalf("ask: unexpected response %d %+v", code, response)
+	}
+	if len(provider.requests) != 3 {
+		t.Errorf("expected 2 map and 1 reduce requests, got %d", len(provider.requests))
+	}
+	if len(response.Citations) != 2 || response.Citations[0].Page != 1 || response.Citations[1].Page != 2 {
+		t.Errorf("expected citations of pages 1 and 2, got %+v", response.Citations)
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	text := strings.Repeat("word ", 100)
+	chunks := chunkText(text, 100, 20)
+	if len(chunks) < 5 {
+		t.Fatalf("expected the text to be split, got %d chunks", len(chunks))
+	}
+	for _, c := range chunks {
+		if len([]rune(c)) > 100 || strings.HasPrefix(c, " ") {
+			t.Errorf("unexpected chunk %q", c)
+		}
+	}
+	if chunks := chunkText("  ", 100, 20); len(chunks) != 0 {
+		t.Errorf("expected no chunks for blank text, got %q", chunks)
+	}
+}
+
+func synthesize(t *testing.T, handler http.Handler, params SynthesizeParams) (int, SynthesizeResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	_ = json.NewEncoder(&body).Encode(params)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/documents/synthesize", &body))
+	var response SynthesizeResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+func TestSynthesizeAttributesDocuments(t *testing.T) {
+	provider := &fakeProvider{answer: "A lasts a year [Doc 1, Page 1], B a month [Doc 2] [Doc 7]."}
+	server := newTestServer(t, &fakeSidecar{}, provider, nil, 8192)
+	a := uploadFile(t, server, "a.txt", "Contract A lasts one year.")
+	b := uploadFile(t, server, "b.txt", "Contract B lasts one month.")
+
+	code, response := synthesize(t, server, SynthesizeParams{DocumentIDs: []string{a.ID, b.ID, a.ID}})
+	if code != http.StatusOK || response.Mode != SynthesisCompare || len(response.Documents) != 2 {
+		t.Fatalf("unexpected response %d %+v", code, response)
+	}
+	want := []Citation{{Document: 1, DocumentID: a.ID, Page: 1}, {Document: 2, DocumentID: b.ID}}
+	if !reflect.DeepEqual(response.Citations, want) {
+		t.Errorf("citations = %+v, want %+v", response.Citations, want)
+	}
+	system := provider.requests[0].Messages[0].Content
+	if !strings.Contains(system, "=== [Doc 1] a.txt ===\n[Page 1]\nContract A") || !strings.Contains(system, "[Doc 2] b.txt") {
+		t.Errorf("expected both documents in the prompt, got %q", system)
+	}
+
+	if code, _ := synthesize(t, server, SynthesizeParams{DocumentIDs: []string{a.ID}}); code != http.StatusBadRequest {
+		t.Errorf("one document: expected status 400, got %d", code)
+	}
+	if code, _ := synthesize(t, server, SynthesizeParams{DocumentIDs: []string{a.ID, b.ID}, Mode: SynthesisQuestion}); code != http.StatusBadRequest {
+		t.Errorf("question mode without a question: expected status 400, got %d", code)
+	}
+
+	// the form of an upload takes the same fields, including the template
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("document_ids", a.ID+","+b.ID)
+	_ = form.WriteField("template", "docgpt.missing")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/documents/synthesize", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown template in a form: expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestSynthesizeSummarizesLongDocuments(t *testing.T) {
+	provider := &fakeProvider{answer: "notes [Page 1]"}
+	server := newTestServer(t, &fakeSidecar{}, provider, nil, 420)
+	short := uploadFile(t, server, "short.txt", "Short.")
+	long := uploadFile(t, server, "long.txt", strings.Repeat("Long clause. ", 40))
+
+	code, response := synthesize(t, server, SynthesizeParams{DocumentIDs: []string{short.ID, long.ID}, Mode: SynthesisMergeSummary})
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if response.Documents[0].Summarized || !response.Documents[1].Summarized {
+		t.Errorf("expected only the long document to be summarized, got %+v", response.Documents)
+	}
+	system := provider.requests[len(provider.requests)-1].Messages[0].Content
+	if !strings.Contains(system, "[Doc 2] long.txt ===\nnotes [Page 1]") {
+		t.Errorf("expected the notes of the long document in the prompt, got %q", system)
+	}
+}
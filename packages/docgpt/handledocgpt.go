@@ -22,176 +22,139 @@ package docgpt
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
-	"net/http"
+	"strings"
 
-	"github.com/h2non/filetype"
-	"github.com/jpoz/groq"
-	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/internal/textextract"
+	"github.com/kingmariano/omnicron/packages/llm"
 )
 
-const baseURL = "http://localhost:8000/api/v1/doc_analyze" // URL to the doc analyze endpoint in the FastAPI server
-
-// ErrorResponse represents the structure of error responses from the FastAPI server
-type ErrorResponse struct {
-	Detail string `json:"detail"`
-}
+// docGPTModel is the model alias answering prompts about documents, which can be long, when
+// neither the request nor its prompt template choose one.
+const docGPTModel = "long-context"
+
+// Names of the built-in prompt templates, see the prompts package.
+const (
+	legacyTemplate    = "docgpt.legacy"
+	documentTemplate  = "docgpt.document"
+	retrievalTemplate = "docgpt.retrieval"
+	mapTemplate       = "docgpt.map"
+	reduceTemplate    = "docgpt.reduce"
+	synthesisTemplate = "docgpt.synthesis"
+)
 
 // AnalyzeDocResponse represents the structure of the response from the "/doc_analyze" endpoint from the FastAPI server
 type AnalyzeDocResponse struct {
 	Text []string `json:"text"`
 }
 
-// CallDocGPTFastAPI calls the "/doc_analyze" endpoint from the FastAPI server and processes the response then uses the grok AI API client to make a request acting as a document gpt.
-func CallDocGPTFastAPI(file multipart.File, fileHeader *multipart.FileHeader, prompt, grokAPIKey, apiKey, fastAPIBaseURL string) (string, error) {
-	// Create a buffer to write our form data to
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-
+// CallDocGPTFastAPI extracts the text of the document and answers prompt about it with model, using
+// the system prompt template, or the docgpt.legacy template if it is empty.
+func (h *Handler) CallDocGPTFastAPI(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, prompt, template, model string) (string, error) {
 	// Read the file into a byte slice
 	filebytes, err := io.ReadAll(file)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
-
-	// Check if the file is empty
-	if len(filebytes) == 0 {
-		return "", errors.New("file is empty")
-	}
-
-	// Check file format if it's supported
-	fileContentType, err := filetype.Get(filebytes)
-	if err != nil {
-		return "", fmt.Errorf("failed to get file type: %w", err)
-	}
-	if !checkContentType(fileContentType.Extension) {
-		return "", fmt.Errorf("unsupported file format. supported formats are: %s", supportedFileTypes())
-	}
-
-	// Create a form file field
-	fw, err := w.CreateFormFile("file", fileHeader.Filename)
+	pages, _, err := h.extractPages(ctx, filebytes, fileHeader.Filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to create form file: %w", err)
-	}
-
-	// Copy the file into the form field
-	if _, err = io.Copy(fw, bytes.NewReader(filebytes)); err != nil {
-		return "", fmt.Errorf("failed to copy file to form field: %w", err)
-	}
-
-	// Close the multipart writer to set the terminating boundary
-	if err := w.Close(); err != nil {
-		return "", fmt.Errorf("failed to close multipart writer: %w", err)
-	}
-
-	// Create the HTTP client
-	client := &http.Client{}
-
-	// Create the HTTP request
-	req, err := http.NewRequest("POST", baseURL, &b)
-	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Api-Key", apiKey)
-
-	// Perform the HTTP request
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to perform HTTP request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check for non-200 status codes
-	if resp.StatusCode != http.StatusOK {
-		var errorMessage ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorMessage); err != nil {
-			return "", fmt.Errorf("failed to decode error message: %w", err)
-		}
-		return "", errors.New(errorMessage.Detail)
-	}
-
-	// Decode the document analysis response
-	var docResponse AnalyzeDocResponse
-	if err := json.NewDecoder(resp.Body).Decode(&docResponse); err != nil {
-		return "", fmt.Errorf("failed to decode document analysis response: %w", err)
+		return "", err
 	}
 	log.Println("done analyzing document returning text")
 	// Join the extracted text into a single string
 	docOutputText := ""
-	for _, text := range docResponse.Text {
+	for _, text := range pages {
 		docOutputText += text + "\n"
 	}
-	if docOutputText == "" {
-		return "", errors.New("document analysis returned empty text")
+	docGptPrompt, err := h.renderPrompt(template, legacyTemplate, PromptData{Text: docOutputText})
+	if err != nil {
+		return "", err
 	}
-	docGptPrompt := docGPTPrompt(docOutputText)
-	// Use the Groq library to create a chat completion request with the Groq API key
-	grokClient := groq.NewClient(groq.WithAPIKey(grokAPIKey))
-	response, err := grokClient.CreateChatCompletion(
-		groq.CompletionCreateParams{
-			Model: "mixtral-8x7b-32768",
-			Messages: []groq.Message{
-				{
-					Role:    "system",
-					Content: docGptPrompt,
-				},
-				{
-					Role:    "user",
-					Content: prompt,
-				},
+	// The long-context alias fails over from Groq to the other providers
+	response, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{
+		Model: model,
+		Messages: []llm.Message{
+			{
+				Role:    "system",
+				Content: docGptPrompt,
+			},
+			{
+				Role:    "user",
+				Content: prompt,
 			},
 		},
-	)
+	})
 	if err != nil {
-		log.Println("error occurred using the grok api; retrying with the g4f library")
-		// if the grok AI model fails try using the g4f api Library.
-		chatRequest := gpt.ChatRequest{
-			Messages: []gpt.Message{
-				{
-					Role:    "system",
-					Content: docGptPrompt,
-				},
-				{
-					Role:    "user",
-					Content: prompt,
-				},
-			},
-		}
-		g4fResponse, err := gpt.CallGPTFastAPI(chatRequest, apiKey, fastAPIBaseURL)
-		if err != nil {
-			return "", fmt.Errorf("failed to call gpt fast API: %w", err)
-		}
-		return g4fResponse.Response, nil
+		return "", fmt.Errorf("failed to answer prompt: %w", err)
 	}
-
-	// Return the response from the Groq API
+	log.Printf("docgpt prompt answered by %s", response.Model)
 	return response.Choices[0].Message.Content, nil
 }
 
-func supportedFileTypes() []string {
-	return []string{"pdf", "xps", "epub", "mobi", "fb2", "cbz", "svg", "txt"}
-}
-
-// function contains file types that are supported for document analyzing:
-func checkContentType(fileExtension string) bool {
-	supportedFileTypes := supportedFileTypes()
-	for _, fileType := range supportedFileTypes {
-		if fileExtension == fileType {
-			return true
+// extractPages returns the text of each page of the document and its format. Text is extracted in
+// Go where possible; scanned PDFs and the formats Go can't read go through the "/doc_analyze"
+// endpoint of the FastAPI server.
+func (h *Handler) extractPages(ctx context.Context, filebytes []byte, filename string) ([]string, string, error) {
+	// Check if the file is empty
+	if len(filebytes) == 0 {
+		return nil, "", fmt.Errorf("%w: file is empty", errInvalidDocument)
+	}
+	document, err := textextract.Extract(filebytes, filename)
+	switch {
+	case errors.Is(err, textextract.ErrUnsupported):
+		return nil, "", fmt.Errorf("%w: unsupported file format. supported formats are: %s", errInvalidDocument, textextract.SupportedFormats())
+	case errors.Is(err, textextract.ErrNeedsSidecar):
+		log.Printf("extracting %s document %s with the FastAPI server: %v", document.Format, filename, err)
+		// Send the document to the "/doc_analyze" endpoint for text extraction
+		var docResponse AnalyzeDocResponse
+		if err := h.sidecar.PostFile(ctx, sidecar.EndpointDocAnalyze, bytes.NewReader(filebytes), filename, &docResponse); err != nil {
+			return nil, "", fmt.Errorf("failed to analyze document: %w", err)
 		}
+		document.Pages = docResponse.Text
+	case err != nil:
+		return nil, "", fmt.Errorf("%w: %v", errInvalidDocument, err)
 	}
-	return false
+	if strings.TrimSpace(strings.Join(document.Pages, "")) == "" {
+		return nil, "", fmt.Errorf("%w: document has no text", errInvalidDocument)
+	}
+	return document.Pages, document.Format, nil
 }
 
-// input prompt to make the AI model behave as expected
-func docGPTPrompt(documentText string) string {
-	return fmt.Sprintf(`You are DocGPT, an advanced AI model specialized in interacting with and analyzing documents. Below is the text extracted from a document. Your task is to assist the user by responding to their queries about this document, providing clear and concise answers, summaries, and key points.
+// renderPrompt renders the template chosen by the request, or fallback if it chose none.
+func (h *Handler) renderPrompt(template, fallback string, data PromptData) (string, error) {
+	if template == "" {
+		template = fallback
+	}
+	prompt, err := h.prompts.Render(template, data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errTemplate, err)
+	}
+	return prompt, nil
+}
 
-	Document Text: %s `, documentText)
+// promptModel validates the template chosen by a request and returns the model to use: the one
+// chosen by the request, else the model of the template, or of fallback, else docGPTModel.
+func (h *Handler) promptModel(template, fallback, model string) (string, error) {
+	ref := template
+	if ref == "" {
+		ref = fallback
+	}
+	t, err := h.prompts.Get(ref)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case model != "":
+	case t.Model != "":
+		model = t.Model
+	default:
+		model = docGPTModel
+	}
+	return model, h.router.Validate(model)
 }
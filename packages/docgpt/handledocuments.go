@@ -0,0 +1,362 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package docgpt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+const (
+	promptTokens = 200 // tokens of the instructions around the document text
+	// maxSessionMessages is the number of previous questions and answers replayed in a session.
+	maxSessionMessages = 20
+)
+
+var (
+	errInvalidDocument = errors.New("invalid document")
+	errQuestionTooLong = errors.New("question is too long for the context window of the model")
+	errStore           = errors.New("failed to save document")
+	errTemplate        = errors.New("invalid prompt template")
+)
+
+// session is a series of questions about a document.
+type session struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// sessionMessage is a question or an answer of a session.
+type sessionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func documentsPath(owner string) []string {
+	return []string{"documents", owner}
+}
+
+func pagesPath(owner, documentID string) []string {
+	return []string{"document_pages", owner, documentID}
+}
+
+func sessionsPath(owner, documentID string) []string {
+	return []string{"document_sessions", owner, documentID}
+}
+
+func sessionMessagesPath(owner, documentID, sessionID string) []string {
+	return []string{"document_session_messages", owner, documentID, sessionID}
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// createDocument extracts the pages of the file and stores them with the document.
+func (h *Handler) createDocument(ctx context.Context, owner string, filebytes []byte, filename string) (*DocumentResponse, error) {
+	texts, format, err := h.extractPages(ctx, filebytes, filename)
+	if err != nil {
+		return nil, err
+	}
+	response := &DocumentResponse{
+		Document: Document{ID: newID("doc_"), Filename: filename, Format: format, PageCount: len(texts), CreatedAt: time.Now().UTC()},
+		Pages:    make([]Page, len(texts)),
+	}
+	for i, text := range texts {
+		response.Pages[i] = Page{Number: i + 1, Text: text}
+		response.Characters += len([]rune(text))
+	}
+	err = h.store.Update(func(tx *store.Tx) error {
+		pages, err := tx.Bucket(pagesPath(owner, response.ID))
+		if err != nil {
+			return err
+		}
+		for _, page := range response.Pages {
+			if err := pages.Put(string(store.SeqKey(uint64(page.Number))), page); err != nil {
+				return err
+			}
+		}
+		documents, err := tx.Bucket(documentsPath(owner))
+		if err != nil {
+			return err
+		}
+		return documents.Put(response.ID, response.Document)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStore, err)
+	}
+	if err := h.indexDocument(ctx, owner, &response.Document, response.Pages); err != nil {
+		log.Printf("failed to index document %s: %v", response.ID, err)
+	}
+	return response, nil
+}
+
+func (h *Handler) loadDocument(owner, id string) (*Document, error) {
+	var document Document
+	if err := h.store.Get(documentsPath(owner), id, &document); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// loadPages returns the pages of a document in order.
+func (h *Handler) loadPages(owner, id string) ([]Page, error) {
+	pages := []Page{}
+	err := h.store.List(pagesPath(owner, id), func(_ string, value []byte) error {
+		var page Page
+		if err := json.Unmarshal(value, &page); err != nil {
+			return err
+		}
+		pages = append(pages, page)
+		return nil
+	})
+	return pages, err
+}
+
+func (h *Handler) listDocuments(owner string) ([]Document, error) {
+	documents := []Document{}
+	err := h.store.List(documentsPath(owner), func(_ string, value []byte) error {
+		var document Document
+		if err := json.Unmarshal(value, &document); err != nil {
+			return err
+		}
+		documents = append(documents, document)
+		return nil
+	})
+	sort.Slice(documents, func(i, j int) bool { return documents[i].CreatedAt.After(documents[j].CreatedAt) })
+	return documents, err
+}
+
+func (h *Handler) deleteDocument(owner, id string) error {
+	return h.store.Update(func(tx *store.Tx) error {
+		if err := tx.Delete(documentsPath(owner), id); err != nil {
+			return err
+		}
+		// the pages and sessions are nested buckets named after the document, if it has any
+		for _, root := range []string{"document_pages", "document_sessions", "document_session_messages"} {
+			if err := tx.Delete([]string{root, owner}, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+		if err := h.index.DeleteCollectionTx(tx, owner, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// ask answers a question about a document with the previous questions and answers of the session,
+// and stores both in the session. The map-reduce mode reads the whole document without the history.
+func (h *Handler) ask(ctx context.Context, owner, documentID string, params AskParams) (*AskResponse, error) {
+	document, err := h.loadDocument(owner, documentID)
+	if err != nil {
+		return nil, err
+	}
+	var history []sessionMessage
+	var newSession *session
+	if params.SessionID == "" {
+		newSession = &session{ID: newID("session_"), CreatedAt: time.Now().UTC()}
+		params.SessionID = newSession.ID
+	} else {
+		var s session
+		if err := h.store.Get(sessionsPath(owner, documentID), params.SessionID, &s); err != nil {
+			return nil, err
+		}
+		if history, err = h.loadSessionMessages(owner, documentID, params.SessionID); err != nil {
+			return nil, fmt.Errorf("%w: %v", errStore, err)
+		}
+	}
+	pages, err := h.loadPages(owner, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStore, err)
+	}
+
+	var response *AskResponse
+	if params.Mode == ModeMapReduce {
+		response, err = h.mapReduce(ctx, document, pages, params)
+	} else {
+		response, err = h.answer(ctx, owner, document, pages, history, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.SessionID = params.SessionID
+	// a new session, the question and the answer are saved together, so a session never has a
+	// question without its answer
+	err = h.store.Update(func(tx *store.Tx) error {
+		if newSession != nil {
+			sessions, err := tx.Bucket(sessionsPath(owner, documentID))
+			if err != nil {
+				return err
+			}
+			if err := sessions.Put(newSession.ID, newSession); err != nil {
+				return err
+			}
+		}
+		b, err := tx.Bucket(sessionMessagesPath(owner, documentID, params.SessionID))
+		if err != nil {
+			return err
+		}
+		for _, m := range []sessionMessage{{Role: "user", Content: params.Question}, {Role: "assistant", Content: response.Answer}} {
+			m := m
+			if err := b.Append(func(uint64) interface{} { return m }); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStore, err)
+	}
+	return response, nil
+}
+
+// answer answers from the chunks of the document most relevant to the question. Documents that
+// can't be indexed, e.g. because the embedding provider is down, are sent whole instead.
+func (h *Handler) answer(ctx context.Context, owner string, document *Document, pages []Page, history []sessionMessage, params AskParams) (*AskResponse, error) {
+	if err := h.indexDocument(ctx, owner, document, pages); err != nil {
+		log.Printf("failed to index document %s, sending its full text: %v", document.ID, err)
+		messages, truncated, err := h.buildMessages(document, pages, history, params)
+		if err != nil {
+			return nil, err
+		}
+		completion, err := h.complete(ctx, params.Model, messages)
+		if err != nil {
+			return nil, err
+		}
+		return &AskResponse{Answer: completion.Choices[0].Message.Content, Model: completion.Model, Mode: ModeFullText, Truncated: truncated}, nil
+	}
+	return h.retrieve(ctx, owner, document, history, params)
+}
+
+// complete sends messages to model, making sure the completion has a choice.
+func (h *Handler) complete(ctx context.Context, model string, messages []llm.Message) (*llm.ChatCompletion, error) {
+	completion, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{Model: model, Messages: messages})
+	if err != nil {
+		return nil, fmt.Errorf("failed to answer question: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, errors.New("completion returned no choices")
+	}
+	return completion, nil
+}
+
+func (h *Handler) loadSessionMessages(owner, documentID, sessionID string) ([]sessionMessage, error) {
+	var messages []sessionMessage
+	err := h.store.List(sessionMessagesPath(owner, documentID, sessionID), func(_ string, value []byte) error {
+		var m sessionMessage
+		if err := json.Unmarshal(value, &m); err != nil {
+			return err
+		}
+		messages = append(messages, m)
+		return nil
+	})
+	return messages, err
+}
+
+// buildMessages returns the document, the recent history of the session and the question as
+// messages for params.Model. The history may use a quarter of the context window, the document
+// the rest; pages that don't fit are left out and truncated is set.
+func (h *Handler) buildMessages(document *Document, pages []Page, history []sessionMessage, params AskParams) (messages []llm.Message, truncated bool, err error) {
+	budget, err := h.questionBudget(params)
+	if err != nil {
+		return nil, false, err
+	}
+	history, budget = recentHistory(history, budget)
+	text, truncated := pagesText(pages, budget)
+	system, err := h.renderPrompt(params.Template, documentTemplate, PromptData{Filename: document.Filename, Text: text})
+	if err != nil {
+		return nil, false, err
+	}
+	return sessionMessages(system, history, params.Question), truncated, nil
+}
+
+// questionBudget returns the tokens left for the document and the history once the reply, the
+// instructions and the question are accounted for.
+func (h *Handler) questionBudget(params AskParams) (int, error) {
+	window := h.router.ContextWindow(params.Model)
+	budget := window - llm.ReplyReserve(window) - promptTokens - gpt.EstimateTokens(params.Question)
+	if budget <= 0 {
+		return 0, errQuestionTooLong
+	}
+	return budget, nil
+}
+
+// recentHistory returns the most recent messages of history that fit a quarter of budget, and
+// the budget left.
+func recentHistory(history []sessionMessage, budget int) ([]sessionMessage, int) {
+	if len(history) > maxSessionMessages {
+		history = history[len(history)-maxSessionMessages:]
+	}
+	historyBudget := budget / 4
+	first := len(history)
+	for first > 0 {
+		tokens := gpt.EstimateTokens(history[first-1].Content)
+		if tokens > historyBudget {
+			break
+		}
+		historyBudget -= tokens
+		budget -= tokens
+		first--
+	}
+	return history[first:], budget
+}
+
+func sessionMessages(system string, history []sessionMessage, question string) []llm.Message {
+	messages := []llm.Message{{Role: "system", Content: system}}
+	for _, m := range history {
+		messages = append(messages, llm.Message{Role: m.Role, Content: m.Content})
+	}
+	return append(messages, llm.Message{Role: "user", Content: question})
+}
+
+// pagesText joins the pages that fit in budget tokens, marking where each page starts.
+// If even the first page doesn't fit, its start is returned.
+func pagesText(pages []Page, budget int) (string, bool) {
+	var text strings.Builder
+	for _, page := range pages {
+		part := fmt.Sprintf("[Page %d]\n%s\n\n", page.Number, page.Text)
+		tokens := gpt.EstimateTokens(part)
+		if tokens > budget {
+			if text.Len() == 0 && budget > 0 {
+				text.WriteString(strings.ToValidUTF8(part[:min(budget*4, len(part))], ""))
+			}
+			return text.String(), true
+		}
+		budget -= tokens
+		text.WriteString(part)
+	}
+	return text.String(), false
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package docgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+// Synthesis modes of POST /documents/synthesize.
+const (
+	SynthesisCompare      = "compare"
+	SynthesisMergeSummary = "merge-summary"
+	SynthesisQuestion     = "question"
+)
+
+const (
+	minSynthesisDocuments = 2
+	maxSynthesisDocuments = 10
+	// headerTokens is the share of each document taken by its header.
+	headerTokens = 20
+)
+
+var docCitationPattern = regexp.MustCompile(`\[Doc (\d+)(?:,\s*[Pp]age (\d+))?\]`)
+
+func (h *Handler) validateSynthesis(params *SynthesizeParams, files int) error {
+	if params.Mode == "" {
+		params.Mode = SynthesisCompare
+	}
+	switch params.Mode {
+	case SynthesisCompare, SynthesisMergeSummary:
+	case SynthesisQuestion:
+		if params.Question == "" {
+			return errors.New("question is required in question mode")
+		}
+	default:
+		return fmt.Errorf("mode must be %q, %q or %q", SynthesisCompare, SynthesisMergeSummary, SynthesisQuestion)
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, id := range params.DocumentIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	params.DocumentIDs = ids
+	if n := len(ids) + files; n < minSynthesisDocuments || n > maxSynthesisDocuments {
+		return fmt.Errorf("between %d and %d documents are required, got %d", minSynthesisDocuments, maxSynthesisDocuments, n)
+	}
+	var err error
+	params.Model, err = h.promptModel(params.Template, synthesisTemplate, params.Model)
+	return err
+}
+
+// uploadFileHeader stores an uploaded file as a document.
+func (h *Handler) uploadFileHeader(ctx context.Context, owner string, fileHeader *multipart.FileHeader) (*DocumentResponse, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidDocument, err)
+	}
+	defer file.Close()
+	filebytes, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidDocument, err)
+	}
+	return h.createDocument(ctx, owner, filebytes, fileHeader.Filename)
+}
+
+// synthesize gives every document an equal share of the context window. Documents that don't
+// fit their share are condensed first with map-reduce, focused on the mode and the question.
+func (h *Handler) synthesize(ctx context.Context, owner string, params SynthesizeParams) (*SynthesizeResponse, error) {
+	n := len(params.DocumentIDs)
+	documents := make([]*Document, n)
+	pages := make([][]Page, n)
+	for i, id := range params.DocumentIDs {
+		document, err := h.loadDocument(owner, id)
+		if err != nil {
+			return nil, fmt.Errorf("document %s: %w", id, err)
+		}
+		if pages[i], err = h.loadPages(owner, id); err != nil {
+			return nil, fmt.Errorf("%w: %v", errStore, err)
+		}
+		documents[i] = document
+	}
+	budget, err := h.questionBudget(AskParams{Model: params.Model, Question: params.Question})
+	if err != nil {
+		return nil, err
+	}
+	share := budget/n - headerTokens
+	if share <= 0 {
+		return nil, errQuestionTooLong
+	}
+
+	response := &SynthesizeResponse{Mode: params.Mode, Documents: make([]SynthesizedDocument, n), Citations: []Citation{}}
+	texts := make([]string, n)
+	errs := make([]error, n)
+	sem := make(chan struct{}, mapConcurrency)
+	var wg sync.WaitGroup
+	for i, document := range documents {
+		response.Documents[i] = SynthesizedDocument{Number: i + 1, ID: document.ID, Filename: document.Filename}
+		text, truncated := pagesText(pages[i], share)
+		if !truncated {
+			texts[i] = text
+			continue
+		}
+		response.Documents[i].Summarized = true
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			notes, err := h.mapReduce(ctx, documents[i], pages[i], AskParams{Model: params.Model, Question: condenseInstruction(params)})
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to summarize %s: %w", documents[i].Filename, err)
+				return
+			}
+			texts[i] = notes.Answer
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	for i, text := range texts {
+		if gpt.EstimateTokens(text) > share {
+			text = strings.ToValidUTF8(text[:share*4], "")
+			response.Truncated = true
+		}
+		fmt.Fprintf(&content, "=== [Doc %d] %s ===\n%s\n\n", i+1, documents[i].Filename, text)
+	}
+	question := params.Question
+	if question == "" {
+		question = defaultSynthesisRequest(params.Mode)
+	}
+	system, err := h.renderPrompt(params.Template, synthesisTemplate, PromptData{Mode: params.Mode, Count: n, Text: content.String()})
+	if err != nil {
+		return nil, err
+	}
+	completion, err := h.complete(ctx, params.Model, []llm.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: question},
+	})
+	if err != nil {
+		return nil, err
+	}
+	response.Answer, response.Model = completion.Choices[0].Message.Content, completion.Model
+	response.Citations = documentCitations(response.Answer, documents)
+	return response, nil
+}
+
+// documentCitations returns the documents and pages cited as [Doc n] or [Doc n, Page m] in answer.
+func documentCitations(answer string, documents []*Document) []Citation {
+	seen := map[[2]int]bool{}
+	citations := []Citation{}
+	for _, m := range docCitationPattern.FindAllStringSubmatch(answer, -1) {
+		doc, err := strconv.Atoi(m[1])
+		if err != nil || doc < 1 || doc > len(documents) {
+			continue
+		}
+		page, _ := strconv.Atoi(m[2])
+		if key := [2]int{doc, page}; !seen[key] {
+			seen[key] = true
+			citations = append(citations, Citation{Document: doc, DocumentID: documents[doc-1].ID, Page: page})
+		}
+	}
+	sort.Slice(citations, func(i, j int) bool {
+		if citations[i].Document != citations[j].Document {
+			return citations[i].Document < citations[j].Document
+		}
+		return citations[i].Page < citations[j].Page
+	})
+	return citations
+}
+
+// condenseInstruction is the request used to condense a document that doesn't fit its share.
+func condenseInstruction(params SynthesizeParams) string {
+	switch params.Mode {
+	case SynthesisQuestion:
+		return "Extract everything in the document that helps answer this question: " + params.Question
+	case SynthesisMergeSummary:
+		instruction := "Summarize the document thoroughly, keeping its main points, facts and figures."
+		if params.Question != "" {
+			instruction += " Focus on: " + params.Question
+		}
+		return instruction
+	default:
+		instruction := "List the key facts, terms, figures, dates, obligations and positions of the document, so it can be compared with other documents."
+		if params.Question != "" {
+			instruction += " Focus on: " + params.Question
+		}
+		return instruction
+	}
+}
+
+func defaultSynthesisRequest(mode string) string {
+	if mode == SynthesisMergeSummary {
+		return "Summarize the documents together."
+	}
+	return "Compare the documents."
+}
@@ -0,0 +1,328 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package docgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/kingmariano/omnicron/internal/vectorstore"
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+const (
+	chunkSize     = 1200 // characters of a chunk
+	chunkOverlap  = 200  // characters repeated at the start of the next chunk of a page
+	defaultTopK   = 5
+	maxTopK       = 20
+	snippetLength = 300 // characters of a chunk quoted in a citation
+	// mapConcurrency limits the parts of a document read at once in map-reduce mode.
+	mapConcurrency = 4
+	// noneAnswer is the answer of a part of the document that has nothing relevant.
+	noneAnswer = "NONE"
+)
+
+var (
+	errNoEmbedder = errors.New("no embedding provider configured")
+
+	sourcePattern = regexp.MustCompile(`\[(\d+)\]`)
+	pagePattern   = regexp.MustCompile(`\[Page (\d+)\]`)
+)
+
+// chunk is a part of a page.
+type chunk struct {
+	page int
+	text string
+}
+
+// indexDocument embeds the chunks of the document into its collection, unless it is indexed
+// already with the model of h.embedder.
+func (h *Handler) indexDocument(ctx context.Context, owner string, document *Document, pages []Page) error {
+	if h.embedder == nil {
+		return errNoEmbedder
+	}
+	if document.Indexed {
+		collection, err := h.index.Collection(owner, document.ID)
+		if err != nil && !errors.Is(err, vectorstore.ErrNotFound) {
+			return err
+		}
+		if err == nil && collection.Model == h.embedder.Model() {
+			return nil
+		}
+	}
+	chunks := chunkPages(pages)
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.text
+	}
+	vectors, err := h.embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	items := make([]vectorstore.Item, len(chunks))
+	for i, c := range chunks {
+		items[i] = vectorstore.Item{
+			ID:       fmt.Sprintf("chunk_%d", i+1),
+			Text:     c.text,
+			Metadata: map[string]interface{}{"page": c.page},
+			Vector:   vectors[i],
+		}
+	}
+	// start over from the chunks of an earlier attempt, or of another embedding model
+	if err := h.index.DeleteCollection(owner, document.ID); err != nil && !errors.Is(err, vectorstore.ErrNotFound) {
+		return err
+	}
+	if _, err := h.index.CreateCollection(owner, document.ID, h.embedder.Model()); err != nil {
+		return err
+	}
+	if _, err := h.index.Upsert(owner, document.ID, items); err != nil {
+		return err
+	}
+	document.Indexed, document.Chunks = true, len(chunks)
+	return h.store.Put(documentsPath(owner), document.ID, document)
+}
+
+// retrieve answers the question from the params.TopK chunks most similar to it.
+func (h *Handler) retrieve(ctx context.Context, owner string, document *Document, history []sessionMessage, params AskParams) (*AskResponse, error) {
+	budget, err := h.questionBudget(params)
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := h.embedder.Embed(ctx, []string{params.Question})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed question: %w", err)
+	}
+	matches, err := h.index.Query(owner, document.ID, vectors[0], params.TopK, nil)
+	if err != nil {
+		return nil, err
+	}
+	history, budget = recentHistory(history, budget)
+
+	var excerpts strings.Builder
+	for i, match := range matches {
+		excerpt := fmt.Sprintf("[%d] (page %d)\n%s\n\n", i+1, pageOf(match.Item), match.Text)
+		tokens := gpt.EstimateTokens(excerpt)
+		if tokens > budget {
+			matches = matches[:i]
+			break
+		}
+		budget -= tokens
+		excerpts.WriteString(excerpt)
+	}
+	system, err := h.renderPrompt(params.Template, retrievalTemplate, PromptData{Filename: document.Filename, Excerpts: excerpts.String()})
+	if err != nil {
+		return nil, err
+	}
+	completion, err := h.complete(ctx, params.Model, sessionMessages(system, history, params.Question))
+	if err != nil {
+		return nil, err
+	}
+	answer := completion.Choices[0].Message.Content
+	return &AskResponse{Answer: answer, Model: completion.Model, Mode: ModeRetrieval, Citations: sourceCitations(answer, matches)}, nil
+}
+
+// mapReduce asks the question of every part of the document that fits the context window, then
+// combines the relevant partial answers into one.
+func (h *Handler) mapReduce(ctx context.Context, document *Document, pages []Page, params AskParams) (*AskResponse, error) {
+	budget, err := h.questionBudget(params)
+	if err != nil {
+		return nil, err
+	}
+	// split only the pages that don't fit on their own, leaving room for the page marker
+	var parts []string
+	for _, page := range pages {
+		for _, text := range chunkText(page.Text, max(budget*4-16, 64), 0) {
+			parts = append(parts, fmt.Sprintf("[Page %d]\n%s", page.Number, text))
+		}
+	}
+	for level := 0; ; level++ {
+		groups := llm.GroupParts(parts, budget)
+		if len(groups) == 1 || level == llm.MaxReduceLevels {
+			system, err := h.renderPrompt(params.Template, reduceTemplate, PromptData{
+				Filename: document.Filename,
+				Text:     strings.Join(groups[0], "\n\n"),
+				Partial:  level > 0,
+			})
+			if err != nil {
+				return nil, err
+			}
+			completion, err := h.complete(ctx, params.Model, []llm.Message{
+				{Role: "system", Content: system},
+				{Role: "user", Content: params.Question},
+			})
+			if err != nil {
+				return nil, err
+			}
+			answer := completion.Choices[0].Message.Content
+			return &AskResponse{Answer: answer, Model: completion.Model, Mode: ModeMapReduce, Citations: pageCitations(answer), Truncated: len(groups) > 1}, nil
+		}
+		if parts, err = h.mapParts(ctx, document, groups, params, level > 0); err != nil {
+			return nil, err
+		}
+		if len(parts) == 0 {
+			parts = []string{"None of the parts of the document are relevant to the question."}
+		}
+	}
+}
+
+// mapParts asks the question of every group of parts and returns the relevant answers, in order.
+func (h *Handler) mapParts(ctx context.Context, document *Document, groups [][]string, params AskParams, partial bool) ([]string, error) {
+	answers := make([]string, len(groups))
+	errs := make([]error, len(groups))
+	prompts := make([]string, len(groups))
+	for i, group := range groups {
+		var err error
+		prompts[i], err = h.renderPrompt("", mapTemplate, PromptData{
+			Filename: document.Filename,
+			Text:     strings.Join(group, "\n\n"),
+			Partial:  partial,
+			None:     noneAnswer,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sem := make(chan struct{}, mapConcurrency)
+	var wg sync.WaitGroup
+	for i := range groups {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			completion, err := h.complete(ctx, params.Model, []llm.Message{
+				{Role: "system", Content: prompts[i]},
+				{Role: "user", Content: params.Question},
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			answers[i] = strings.TrimSpace(completion.Choices[0].Message.Content)
+		}(i)
+	}
+	wg.Wait()
+	var relevant []string
+	for i, answer := range answers {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if answer != "" && !strings.EqualFold(strings.Trim(answer, ". "), noneAnswer) {
+			relevant = append(relevant, answer)
+		}
+	}
+	return relevant, nil
+}
+
+// chunkPages splits every page into overlapping chunks. Chunks don't cross pages, so each has
+// a single page to cite.
+func chunkPages(pages []Page) []chunk {
+	var chunks []chunk
+	for _, page := range pages {
+		for _, text := range chunkText(page.Text, chunkSize, chunkOverlap) {
+			chunks = append(chunks, chunk{page: page.Number, text: text})
+		}
+	}
+	return chunks
+}
+
+// chunkText splits text into chunks of at most size characters, ending them at a space where
+// possible. Each chunk starts with the last overlap characters of the previous one.
+func chunkText(text string, size, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			for i := end; i > start+size/2; i-- {
+				if unicode.IsSpace(runes[i]) {
+					end = i
+					break
+				}
+			}
+		}
+		if c := strings.TrimSpace(string(runes[start:end])); c != "" {
+			chunks = append(chunks, c)
+		}
+		if end == len(runes) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
+
+func pageOf(item vectorstore.Item) int {
+	// numbers decode from JSON as float64
+	page, _ := item.Metadata["page"].(float64)
+	return int(page)
+}
+
+// sourceCitations returns the matches cited as [n] in answer, in the order of the sources.
+func sourceCitations(answer string, matches []vectorstore.Match) []Citation {
+	cited := map[int]bool{}
+	for _, m := range sourcePattern.FindAllStringSubmatch(answer, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= 1 && n <= len(matches) {
+			cited[n] = true
+		}
+	}
+	citations := []Citation{}
+	for i, match := range matches {
+		if cited[i+1] {
+			citations = append(citations, Citation{Source: i + 1, Page: pageOf(match.Item), Snippet: snippet(match.Text), Score: match.Score})
+		}
+	}
+	return citations
+}
+
+// pageCitations returns the pages cited as [Page n] in answer, in page order.
+func pageCitations(answer string) []Citation {
+	var pages []int
+	seen := map[int]bool{}
+	for _, m := range pagePattern.FindAllStringSubmatch(answer, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && !seen[n] {
+			seen[n] = true
+			pages = append(pages, n)
+		}
+	}
+	sort.Ints(pages)
+	citations := []Citation{}
+	for _, page := range pages {
+		citations = append(citations, Citation{Page: page})
+	}
+	return citations
+}
+
+func snippet(text string) string {
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+	return string(runes[:snippetLength]) + "..."
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package embeddings serves the embeddings endpoint and the vector collections built on it.
+package embeddings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/vectorstore"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+const (
+	maxInputs    = 256 // texts embedded or upserted by one request
+	defaultTopK  = 5
+	maxTopK      = 100
+	maxNameBytes = 64
+)
+
+// EmbeddingRequest is the body of POST /embeddings. Input is a string or a list of strings.
+type EmbeddingRequest struct {
+	Input json.RawMessage `json:"input"`
+}
+
+// Embedding is the embedding of the input at Index.
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// EmbeddingResponse has the same shape as the OpenAI embeddings response.
+type EmbeddingResponse struct {
+	Object string      `json:"object"`
+	Data   []Embedding `json:"data"`
+	Model  string      `json:"model"`
+}
+
+// CollectionParams creates a collection.
+type CollectionParams struct {
+	Name string `json:"name"`
+}
+
+// UpsertItem is a text to embed and store. An item without an ID gets a random one.
+type UpsertItem struct {
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// UpsertParams is the body of POST /collections/{name}/upsert.
+type UpsertParams struct {
+	Items []UpsertItem `json:"items"`
+}
+
+// UpsertResponse is the updated collection and the IDs of the upserted items, in order.
+type UpsertResponse struct {
+	Collection vectorstore.Collection `json:"collection"`
+	IDs        []string               `json:"ids"`
+}
+
+// QueryParams is the body of POST /collections/{name}/query. Only items whose metadata has
+// every key of Filter with an equal value are returned.
+type QueryParams struct {
+	Query  string                 `json:"query"`
+	TopK   int                    `json:"top_k"`
+	Filter map[string]interface{} `json:"filter"`
+}
+
+// QueryResponse lists the matches, most similar first.
+type QueryResponse struct {
+	Matches []vectorstore.Match `json:"matches"`
+}
+
+// CollectionList is the response of GET /collections.
+type CollectionList struct {
+	Collections []vectorstore.Collection `json:"collections"`
+}
+
+// Handler serves the embeddings and collection endpoints.
+type Handler struct {
+	embedder services.EmbeddingProvider
+	index    *vectorstore.Index
+}
+
+// NewHandler returns a Handler embedding texts with embedder and storing collections in index.
+func NewHandler(embedder services.EmbeddingProvider, index *vectorstore.Index) *Handler {
+	return &Handler{embedder: embedder, index: index}
+}
+
+// Embeddings handles POST /embeddings.
+func (h *Handler) Embeddings(w http.ResponseWriter, r *http.Request) {
+	var params EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	texts, err := parseInput(params.Input)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	vectors, err := h.Embed(r.Context(), texts)
+	if err != nil {
+		respondWithEmbeddingError(w, err)
+		return
+	}
+	response := EmbeddingResponse{Object: "list", Data: make([]Embedding, len(vectors)), Model: h.embedder.Model()}
+	for i, vector := range vectors {
+		response.Data[i] = Embedding{Object: "embedding", Index: i, Embedding: vector}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// CreateCollection handles POST /collections.
+func (h *Handler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	var params CollectionParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if err := validateName(params.Name); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	collection, err := h.index.CreateCollection(auth.Owner(r.Context()), params.Name, h.embedder.Model())
+	if err != nil {
+		respondWithIndexError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, collection)
+}
+
+// ListCollections handles GET /collections.
+func (h *Handler) ListCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := h.index.Collections(auth.Owner(r.Context()))
+	if err != nil {
+		respondWithIndexError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, CollectionList{Collections: collections})
+}
+
+// GetCollection handles GET /collections/{name}.
+func (h *Handler) GetCollection(w http.ResponseWriter, r *http.Request) {
+	collection, err := h.index.Collection(auth.Owner(r.Context()), chi.URLParam(r, "name"))
+	if err != nil {
+		respondWithIndexError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, collection)
+}
+
+// DeleteCollection handles DELETE /collections/{name}, removing the collection and its items.
+func (h *Handler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	if err := h.index.DeleteCollection(auth.Owner(r.Context()), chi.URLParam(r, "name")); err != nil {
+		respondWithIndexError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Upsert handles POST /collections/{name}/upsert: it embeds the texts and stores them with
+// their metadata, replacing items with the same ID.
+func (h *Handler) Upsert(w http.ResponseWriter, r *http.Request) {
+	var params UpsertParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if err := validateItems(params.Items); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	response, err := h.upsert(r.Context(), auth.Owner(r.Context()), chi.URLParam(r, "name"), params.Items)
+	if err != nil {
+		respondWithIndexError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// Query handles POST /collections/{name}/query.
+func (h *Handler) Query(w http.ResponseWriter, r *http.Request) {
+	var params QueryParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if params.Query == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, query is required")
+		return
+	}
+	if params.TopK == 0 {
+		params.TopK = defaultTopK
+	}
+	if params.TopK < 0 || params.TopK > maxTopK {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, top_k must be between 1 and %d", maxTopK))
+		return
+	}
+	matches, err := h.query(r.Context(), auth.Owner(r.Context()), chi.URLParam(r, "name"), params)
+	if err != nil {
+		respondWithIndexError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, QueryResponse{Matches: matches})
+}
+
+// DeleteItem handles DELETE /collections/{name}/items/{id}.
+func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	if err := h.index.Delete(auth.Owner(r.Context()), chi.URLParam(r, "name"), chi.URLParam(r, "id")); err != nil {
+		respondWithIndexError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondWithIndexError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, vectorstore.ErrNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "collection or item not found")
+	case errors.Is(err, vectorstore.ErrExists):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, vectorstore.ErrDimensions), errors.Is(err, errModelMismatch):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondWithEmbeddingError(w, err)
+	}
+}
+
+// respondWithEmbeddingError reports a failure of the embedding provider as a bad gateway.
+func respondWithEmbeddingError(w http.ResponseWriter, err error) {
+	var apiErr *services.APIError
+	if errors.As(err, &apiErr) || errors.Is(err, errEmbedding) {
+		utils.RespondWithError(w, http.StatusBadGateway, fmt.Sprintf("Error embedding texts, %v", err))
+		return
+	}
+	utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/internal/vectorstore"
+)
+
+// fakeEmbedder embeds a text by counting the words "cat", "dog" and "fish".
+type fakeEmbedder struct {
+	model string
+	calls int
+}
+
+func (e *fakeEmbedder) Model() string { return e.model }
+
+func (e *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{
+			float32(strings.Count(text, "cat")),
+			float32(strings.Count(text, "dog")),
+			float32(strings.Count(text, "fish")) + 0.01,
+		}
+	}
+	return vectors, nil
+}
+
+func newTestServer(t *testing.T, embedder *fakeEmbedder) http.Handler {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	h := NewHandler(embedder, vectorstore.New(s))
+	mux := chi.NewRouter()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithOwner(r.Context(), "alice")))
+		})
+	})
+	mux.Post("/embeddings", h.Embeddings)
+	mux.Post("/collections", h.CreateCollection)
+	mux.Post("/collections/{name}/upsert", h.Upsert)
+	mux.Post("/collections/{name}/query", h.Query)
+	return mux
+}
+
+func do(t *testing.T, handler http.Handler, method, path string, body interface{}, v interface{}) int {
+	t.Helper()
+	var b bytes.Buffer
+	_ = json.NewEncoder(&b).Encode(body)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, path, &b))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s %s response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestEmbeddings(t *testing.T) {
+	server := newTestServer(t, &fakeEmbedder{model: "fake"})
+
+	var response EmbeddingResponse
+	if code := do(t, server, http.MethodPost, "/embeddings", map[string]interface{}{"input": "cat"}, &response); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if len(response.Data) != 1 || response.Data[0].Embedding[0] != 1 || response.Model != "fake" {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if code := do(t, server, http.MethodPost, "/embeddings", map[string]interface{}{"input": []string{}}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an empty input, got %d", code)
+	}
+}
+
+func TestCollectionUpsertAndQuery(t *testing.T) {
+	embedder := &fakeEmbedder{model: "fake"}
+	server := newTestServer(t, embedder)
+
+	if code := do(t, server, http.MethodPost, "/collections", CollectionParams{Name: "pets"}, nil); code != http.StatusCreated {
+		t.Fatalf("create: expected status 201, got %d", code)
+	}
+	if code := do(t, server, http.MethodPost, "/collections", CollectionParams{Name: "pets"}, nil); code != http.StatusConflict {
+		t.Errorf("create duplicate: expected status 409, got %d", code)
+	}
+	items := make([]UpsertItem, 0, 40)
+	for i := 0; i < 38; i++ {
+		items = append(items, UpsertItem{Text: "fish", Metadata: map[string]interface{}{"kind": "fish"}})
+	}
+	items = append(items,
+		UpsertItem{ID: "cat", Text: "a cat", Metadata: map[string]interface{}{"kind": "mammal"}},
+		UpsertItem{ID: "dog", Text: "a dog", Metadata: map[string]interface{}{"kind": "mammal"}},
+	)
+	var upserted UpsertResponse
+	if code := do(t, server, http.MethodPost, "/collections/pets/upsert", UpsertParams{Items: items}, &upserted); code != http.StatusOK {
+		t.Fatalf("upsert: expected status 200, got %d", code)
+	}
+	if upserted.Collection.Count != 40 || len(upserted.IDs) != 40 || upserted.IDs[0] == "" {
+		t.Errorf("unexpected upsert response %+v", upserted.Collection)
+	}
+	if embedder.calls != 2 {
+		t.Errorf("expected the texts to be embedded in 2 batches, got %d calls", embedder.calls)
+	}
+
+	var result QueryResponse
+	params := QueryParams{Query: "my dog", TopK: 2, Filter: map[string]interface{}{"kind": "mammal"}}
+	if code := do(t, server, http.MethodPost, "/collections/pets/query", params, &result); code != http.StatusOK {
+		t.Fatalf("query: expected status 200, got %d", code)
+	}
+	if len(result.Matches) != 2 || result.Matches[0].ID != "dog" || result.Matches[1].ID != "cat" {
+		t.Errorf("unexpected matches %+v", result.Matches)
+	}
+
+	if code := do(t, server, http.MethodPost, "/collections/missing/query", QueryParams{Query: "dog"}, nil); code != http.StatusNotFound {
+		t.Errorf("query missing collection: expected status 404, got %d", code)
+	}
+	embedder.model = "other"
+	if code := do(t, server, http.MethodPost, "/collections/pets/query", QueryParams{Query: "dog"}, nil); code != http.StatusBadRequest {
+		t.Errorf("query with another model: expected status 400, got %d", code)
+	}
+}
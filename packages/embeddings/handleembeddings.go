@@ -0,0 +1,167 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package embeddings
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/kingmariano/omnicron/internal/vectorstore"
+)
+
+// embedBatchSize is the number of texts sent to the provider at once.
+const embedBatchSize = 32
+
+var (
+	errEmbedding     = errors.New("embedding provider failed")
+	errModelMismatch = errors.New("collection was embedded with a different model")
+	namePattern      = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// Embed returns the embeddings of texts, calling the provider in batches. DocGPT and the
+// transcript tools use it to index their texts.
+func (h *Handler) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(texts))
+		batch, err := h.embedder.Embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errEmbedding, err)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// Model names the embedding model of the handler.
+func (h *Handler) Model() string {
+	return h.embedder.Model()
+}
+
+// Index returns the vector index of the handler.
+func (h *Handler) Index() *vectorstore.Index {
+	return h.index
+}
+
+func (h *Handler) upsert(ctx context.Context, owner, name string, params []UpsertItem) (*UpsertResponse, error) {
+	if err := h.checkModel(owner, name); err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(params))
+	for i, item := range params {
+		texts[i] = item.Text
+	}
+	vectors, err := h.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]vectorstore.Item, len(params))
+	ids := make([]string, len(params))
+	for i, item := range params {
+		if item.ID == "" {
+			item.ID = newItemID()
+		}
+		ids[i] = item.ID
+		items[i] = vectorstore.Item{ID: item.ID, Text: item.Text, Metadata: item.Metadata, Vector: vectors[i]}
+	}
+	collection, err := h.index.Upsert(owner, name, items)
+	if err != nil {
+		return nil, err
+	}
+	return &UpsertResponse{Collection: collection, IDs: ids}, nil
+}
+
+func (h *Handler) query(ctx context.Context, owner, name string, params QueryParams) ([]vectorstore.Match, error) {
+	if err := h.checkModel(owner, name); err != nil {
+		return nil, err
+	}
+	vectors, err := h.Embed(ctx, []string{params.Query})
+	if err != nil {
+		return nil, err
+	}
+	return h.index.Query(owner, name, vectors[0], params.TopK, params.Filter)
+}
+
+// checkModel makes sure the collection exists and was embedded with the current model, since
+// vectors of different models can't be compared.
+func (h *Handler) checkModel(owner, name string) error {
+	collection, err := h.index.Collection(owner, name)
+	if err != nil {
+		return err
+	}
+	if collection.Model != h.embedder.Model() {
+		return fmt.Errorf("%w: %s", errModelMismatch, collection.Model)
+	}
+	return nil
+}
+
+// parseInput accepts a string or a list of strings, like the OpenAI API.
+func parseInput(input json.RawMessage) ([]string, error) {
+	var texts []string
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		texts = []string{text}
+	} else if err := json.Unmarshal(input, &texts); err != nil {
+		return nil, errors.New("input must be a string or a list of strings")
+	}
+	if len(texts) == 0 || len(texts) > maxInputs {
+		return nil, fmt.Errorf("input must have between 1 and %d texts", maxInputs)
+	}
+	for i, text := range texts {
+		if text == "" {
+			return nil, fmt.Errorf("input %d is empty", i)
+		}
+	}
+	return texts, nil
+}
+
+func validateItems(items []UpsertItem) error {
+	if len(items) == 0 || len(items) > maxInputs {
+		return fmt.Errorf("items must have between 1 and %d items", maxInputs)
+	}
+	for i, item := range items {
+		if item.Text == "" {
+			return fmt.Errorf("item %d has no text", i)
+		}
+		if len(item.ID) > maxNameBytes {
+			return fmt.Errorf("item %d has an ID longer than %d bytes", i, maxNameBytes)
+		}
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	if len(name) == 0 || len(name) > maxNameBytes || !namePattern.MatchString(name) {
+		return fmt.Errorf("name must be 1 to %d letters, digits, '.', '_' or '-'", maxNameBytes)
+	}
+	return nil
+}
+
+func newItemID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
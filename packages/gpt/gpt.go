@@ -20,13 +20,35 @@
 package gpt
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
+// Handler serves the gpt4free endpoint.
+type Handler struct {
+	sidecar    services.SidecarClient
+	structured StructuredChat
+}
+
+// NewHandler returns a Handler that forwards chat requests to the FastAPI server. Requests for
+// JSON output are completed by structured.
+func NewHandler(sidecar services.SidecarClient, structured StructuredChat) *Handler {
+	return &Handler{sidecar: sidecar, structured: structured}
+}
+
+// StructuredChat completes requests for JSON output, validating the output against the response
+// format and sending it back to the model for repair when it doesn't match.
+type StructuredChat interface {
+	// Validate reports whether request asks for JSON output, and an error if it can't be served.
+	Validate(request ChatRequest) (bool, error)
+	ChatCompletion(ctx context.Context, request ChatRequest) (*ChatResponse, error)
+}
+
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -40,15 +62,35 @@ type ChatRequest struct {
 	Timeout  int       `json:"timeout,omitempty"`
 	Shuffle  bool      `json:"shuffle,omitempty"`
 	ImageURL string    `json:"image_url,omitempty"`
+	// ResponseFormat asks for JSON output, as in the OpenAI API, and MaxRepairs overrides how often
+	// output that doesn't match it is repaired. They are not sent to the FastAPI server.
+	ResponseFormat json.RawMessage `json:"response_format,omitempty"`
+	MaxRepairs     *int            `json:"max_repairs,omitempty"`
 }
 type ChatResponse struct {
 	Response string `json:"response"`
+	// Parsed is the JSON value of Response when JSON output was requested.
+	Parsed json.RawMessage `json:"parsed,omitempty"`
+}
+
+// Usage reports the tokens used by a completion.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// StreamUsage is the last event of a streamed completion. The token counts are estimates.
+type StreamUsage struct {
+	Usage Usage `json:"usage"`
 }
-type ErrorResponse struct {
-	Detail string `json:"detail"`
+
+// StreamError is sent when a streamed completion fails after it started.
+type StreamError struct {
+	Error string `json:"error"`
 }
 
-func ChatCompletion(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+func (h *Handler) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 	decode := json.NewDecoder(r.Body)
 	chatParams := ChatRequest{}
 	err := decode.Decode(&chatParams)
@@ -56,9 +98,28 @@ func ChatCompletion(w http.ResponseWriter, r *http.Request, cfg *config.APIConfi
 		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unmarshalling json, %v", err))
 		return
 	}
-	response, err := CallGPTFastAPI(chatParams, cfg.APIKey, cfg.FASTAPIBaseURL)
+	structured, err := h.structured.Validate(chatParams)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	if structured {
+		response, err := h.structured.ChatCompletion(r.Context(), chatParams)
+		if err != nil {
+			utils.RespondWithError(w, sidecar.HTTPStatus(err), fmt.Sprintf("Error handling chat completion, %v", err))
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, response)
+		return
+	}
+	chatParams.ResponseFormat, chatParams.MaxRepairs = nil, nil
+	if chatParams.Stream {
+		h.streamChatCompletion(w, r, chatParams)
+		return
+	}
+	response, err := CallGPTFastAPI(r.Context(), h.sidecar, chatParams)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error handling chat completion, %v", err))
+		utils.RespondWithError(w, sidecar.HTTPStatus(err), fmt.Sprintf("Error handling chat completion, %v", err))
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, response)
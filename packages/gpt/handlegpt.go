@@ -20,49 +20,131 @@
 package gpt
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"time"
+
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
 )
 
 // Calls the "/chatcompletion" endpoint from the fastAPI server
-func CallGPTFastAPI(request ChatRequest, apiKey string, fastAPIBaseURL string) (*ChatResponse, error) {
-	fastAPIGPTEndPoint := fmt.Sprintf("%s/api/v1/chat/completion", fastAPIBaseURL) //url to the chat completion endpoint in the FastAPI server
-	// marshal the request to json format for sending to the server
-	jsonData, err := json.Marshal(request)
-	if err != nil {
+func CallGPTFastAPI(ctx context.Context, client services.SidecarClient, request ChatRequest) (*ChatResponse, error) {
+	var response ChatResponse
+	if err := client.PostJSON(ctx, sidecar.EndpointChatCompletion, request, &response); err != nil {
 		return nil, err
 	}
-	client := &http.Client{
-		Timeout: time.Second * 300,
-	}
+	return &response, nil
+}
+
+// streamEvent is a line of the newline delimited JSON the fastAPI server streams for a chat completion.
+type streamEvent struct {
+	Delta string `json:"delta"`
+	Error string `json:"error"`
+	Done  bool   `json:"done"`
+}
 
-	req, err := http.NewRequest("POST", fastAPIGPTEndPoint, bytes.NewBuffer(jsonData))
+// Stream reads the text chunks of a streamed chat completion.
+type Stream struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+}
+
+// StreamGPTFastAPI starts a streamed completion on the "/chatcompletion" endpoint from the fastAPI server.
+func StreamGPTFastAPI(ctx context.Context, client services.SidecarClient, request ChatRequest) (*Stream, error) {
+	request.Stream = true
+	body, err := client.PostStream(ctx, sidecar.EndpointChatCompletion, request)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Api-Key", apiKey)
-	resp, err := client.Do(req)
+	return &Stream{body: body, decoder: json.NewDecoder(body)}, nil
+}
+
+// Recv returns the next text chunk, or io.EOF once the completion is done.
+func (s *Stream) Recv() (string, error) {
+	for {
+		var event streamEvent
+		if err := s.decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", io.ErrUnexpectedEOF // the server stopped without a done event
+			}
+			return "", err
+		}
+		switch {
+		case event.Error != "":
+			return "", errors.New(event.Error)
+		case event.Done:
+			return "", io.EOF
+		case event.Delta != "":
+			return event.Delta, nil
+		}
+	}
+}
+
+// Close stops the stream.
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
+
+// EstimateTokens approximates the number of tokens in text at four characters per token,
+// since g4f doesn't report usage.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// EstimateUsage approximates the usage of a completion of messages that returned completion.
+func EstimateUsage(messages []Message, completion string) Usage {
+	var prompt int
+	for _, m := range messages {
+		prompt += EstimateTokens(m.Content)
+	}
+	completionTokens := EstimateTokens(completion)
+	return Usage{PromptTokens: prompt, CompletionTokens: completionTokens, TotalTokens: prompt + completionTokens}
+}
+
+// streamChatCompletion writes the completion as server-sent events: a {"response": chunk} event per chunk,
+// a {"usage": ...} summary and [DONE]. Failures after the stream started are sent as an {"error": ...} event.
+func (h *Handler) streamChatCompletion(w http.ResponseWriter, r *http.Request, request ChatRequest) {
+	stream, err := StreamGPTFastAPI(r.Context(), h.sidecar, request)
 	if err != nil {
-		return nil, err
+		utils.RespondWithError(w, sidecar.HTTPStatus(err), "Error handling chat completion, "+err.Error())
+		return
 	}
-	defer resp.Body.Close()
-	//handle error when status code is not 200
-	if resp.StatusCode != 200 {
-		var errorMessage ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorMessage); err != nil {
-			return nil, err
+	defer stream.Close()
+
+	utils.StartSSE(w)
+	var completion []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if r.Context().Err() != nil {
+			log.Print("client disconnected, stopping chat completion stream")
+			return
+		}
+		if err != nil {
+			if writeErr := utils.WriteSSE(w, StreamError{Error: err.Error()}); writeErr != nil {
+				log.Print(writeErr)
+			}
+			return
+		}
+		completion = append(completion, chunk...)
+		if err := utils.WriteSSE(w, ChatResponse{Response: chunk}); err != nil {
+			log.Printf("client disconnected, stopping chat completion stream: %v", err)
+			return
 		}
-		return nil, errors.New(errorMessage.Detail)
 	}
-	var response ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+	usage := EstimateUsage(request.Messages, string(completion))
+	if err := utils.WriteSSE(w, StreamUsage{Usage: usage}); err != nil {
+		log.Print(err)
+		return
+	}
+	if err := utils.WriteSSEDone(w); err != nil {
+		log.Print(err)
 	}
-
-	return &response, nil
 }
@@ -21,43 +21,101 @@ package grok
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/go-ozzo/ozzo-validation" // Import validation package for input validation
 	"github.com/jpoz/groq"               // Import groq package for chat completions
-	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 )
 
+// Handler serves the groq endpoints.
+type Handler struct {
+	chat          services.ChatProvider
+	transcription services.TranscriptionProvider
+	router        *llm.Router
+}
+
+// NewHandler returns a Handler backed by the given chat and transcription providers.
+// router validates the requested model against the configured Groq models and streams completions.
+func NewHandler(chat services.ChatProvider, transcription services.TranscriptionProvider, router *llm.Router) *Handler {
+	return &Handler{chat: chat, transcription: transcription, router: router}
+}
+
 // validateParams validates the input parameters for creating a chat completion.
-func validateParams(g groq.CompletionCreateParams) error {
-	return validation.ValidateStruct(&g,
-		validation.Field(&g.Model, validation.Required, validation.In("llama3-8b-8192", "llama3-70b-8192", "mixtral-8x7b-32768", "gemma-7b-it")), // Validate the 'Model' field
-		validation.Field(&g.Messages, validation.Required), // Validate the 'Messages' field
+// The model must be one of the Groq models of the router's config.
+func (h *Handler) validateParams(request llm.ChatCompletionRequest) error {
+	return validation.ValidateStruct(&request,
+		validation.Field(&request.Model, validation.Required, validation.By(func(value interface{}) error {
+			if _, _, err := h.router.Resolve(groqModel(request.Model)); err != nil {
+				return errors.New("must be a valid value")
+			}
+			return nil
+		})), // Validate the 'Model' field
+		validation.Field(&request.Messages, validation.Required), // Validate the 'Messages' field
+		validation.Field(&request.ResponseFormat, validation.By(func(value interface{}) error {
+			if err := llm.ValidateResponseFormat(request.ResponseFormat); err != nil {
+				return err
+			}
+			if request.Stream && jsonResponseFormat(request) {
+				return errors.New("JSON response formats can't be streamed")
+			}
+			return nil
+		})), // Validate the 'ResponseFormat' field
 	)
 }
 
+// jsonResponseFormat reports whether request asks for JSON output, which the router validates.
+func jsonResponseFormat(request llm.ChatCompletionRequest) bool {
+	return request.ResponseFormat != nil && request.ResponseFormat.Type != "text"
+}
+
+// groqModel returns the router's name of a Groq model.
+func groqModel(model string) string {
+	return "groq/" + model
+}
+
 // ChatCompletion handles HTTP requests to create a chat completion.
-func ChatCompletion(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
-	decode := json.NewDecoder(r.Body) // Create a JSON decoder for decoding request body
-	grokParams := groq.CompletionCreateParams{}
-	err := decode.Decode(&grokParams) // Decode JSON request body into grokParams struct
+// Streamed requests, requests with tools and requests for JSON output go through the llm router,
+// which speaks Groq's wire format including tool calls and validates JSON output.
+func (h *Handler) ChatCompletion(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error reading request body, %v", err))
+		return
+	}
+	var request llm.ChatCompletionRequest
+	if err := json.Unmarshal(body, &request); err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unmarshalling json, %v", err))
 		return
 	}
 
 	// Validate the request parameters
-	err = validateParams(grokParams)
+	err = h.validateParams(request)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
 		return
 	}
 
-	// Create a new groq client with API key from config
-	client := groq.NewClient(groq.WithAPIKey(cfg.GrokAPIKey))
-	response, err := client.CreateChatCompletion(grokParams) // Call groq API to create chat completion
+	if request.Stream {
+		h.streamChatCompletion(w, r, request)
+		return
+	}
+	if len(request.Tools) > 0 || jsonResponseFormat(request) {
+		h.routedChatCompletion(w, r, request)
+		return
+	}
+
+	grokParams := groq.CompletionCreateParams{}
+	if err := json.Unmarshal(body, &grokParams); err != nil { // Decode JSON request body into grokParams struct
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	response, err := h.chat.CreateChatCompletion(r.Context(), grokParams) // Call groq API to create chat completion
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error handling chat completion, %v", err))
 		return
@@ -69,3 +127,30 @@ func ChatCompletion(w http.ResponseWriter, r *http.Request, cfg *config.APIConfi
 	// Respond with JSON containing the response message
 	utils.RespondWithJSON(w, http.StatusOK, response)
 }
+
+// routedChatCompletion creates the completion with the router, returning the tool calls
+// or the parsed JSON output of the completion.
+func (h *Handler) routedChatCompletion(w http.ResponseWriter, r *http.Request, request llm.ChatCompletionRequest) {
+	model := request.Model
+	request.Model = groqModel(model)
+	completion, err := h.router.ChatCompletion(r.Context(), request)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error handling chat completion, %v", err))
+		return
+	}
+	completion.Model = model
+	utils.RespondWithJSON(w, http.StatusOK, completion)
+}
+
+// streamChatCompletion streams the completion as server-sent chunks in Groq's format,
+// followed by a usage chunk and [DONE].
+func (h *Handler) streamChatCompletion(w http.ResponseWriter, r *http.Request, request llm.ChatCompletionRequest) {
+	request.Model = groqModel(request.Model)
+	stream, err := h.router.ChatCompletionStream(r.Context(), request)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error handling chat completion, %v", err))
+		return
+	}
+	defer stream.Close()
+	llm.WriteStream(w, r, stream, true)
+}
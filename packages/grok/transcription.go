@@ -26,12 +26,11 @@ import (
 	"os"
 
 	"github.com/jpoz/groq" // Import groq package for transcription
-	"github.com/kingmariano/omnicron/config"
 	"github.com/kingmariano/omnicron/utils"
 )
 
 // Transcription handles HTTP requests to perform transcription.
-func Transcription(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+func (h *Handler) Transcription(w http.ResponseWriter, r *http.Request) {
 	// Parse the multipart form with a max size of 10MB
 	err := r.ParseMultipartForm(10 << 20)
 	if err != nil {
@@ -80,9 +79,7 @@ func Transcription(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig
 		Language: language,
 	}
 
-	// Create a groq client with API key from config
-	client := groq.NewClient(groq.WithAPIKey(cfg.GrokAPIKey))
-	response, err := client.CreateTranscription(grokParams)
+	response, err := h.transcription.CreateTranscription(r.Context(), grokParams)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error transcribing: %v", err))
 		return
@@ -20,69 +20,22 @@
 package image2text
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"fmt"
+	"context"
 	"io"
-	"mime/multipart"
-	"net/http"
-	"time"
+
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
 )
 
 type ImageToTextResponse struct {
 	Text string `json:"text"`
 }
-type ErrorResponse struct {
-	Detail string `json:"detail"`
-}
 
-// Calls the "/image+to_text" endpoint from the fastAPI server
-func CallImageToTextFastAPI(file multipart.File, fileHeader *multipart.FileHeader, apiKey, fastAPIBaseURL string) (*ImageToTextResponse, error) {
-	fastAPIImageToTextEndpoint := fmt.Sprintf("%s/api/v1/image_to_text", fastAPIBaseURL) //url to the image to text endpoint in the python server
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-	// Create a form file field
-	fw, err := w.CreateFormFile("file", fileHeader.Filename)
-	if err != nil {
-		return nil, err
-	}
-	// Copy the file into the form field
-	if _, err = io.Copy(fw, file); err != nil {
-		return nil, err
-	}
-	// Close the multipart writer to set the terminating boundary
-	if err := w.Close(); err != nil {
-		return nil, err
-	}
-	//create the http client
-	client := &http.Client{
-		Timeout: time.Second * 300,
-	}
-	req, err := http.NewRequest("POST", fastAPIImageToTextEndpoint, &b)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Api-Key", apiKey)
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		//handle error when status code is not 200
-		var errorMessage ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorMessage); err != nil {
-			return nil, err
-		}
-		return nil, errors.New(errorMessage.Detail)
-	}
+// Calls the "/image+to_text" endpoint from the fastAPI server with the image in file
+func CallImageToTextFastAPI(ctx context.Context, client services.SidecarClient, file io.Reader, filename string) (*ImageToTextResponse, error) {
 	var response ImageToTextResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := client.PostFile(ctx, sidecar.EndpointImageToText, file, filename, &response); err != nil {
 		return nil, err
 	}
-
 	return &response, nil
-
 }
@@ -21,12 +21,23 @@ package image2text
 
 import (
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func Image2text(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the image to text endpoint.
+type Handler struct {
+	sidecar services.SidecarClient
+}
+
+// NewHandler returns a Handler that forwards OCR requests to the FastAPI server.
+func NewHandler(sidecar services.SidecarClient) *Handler {
+	return &Handler{sidecar: sidecar}
+}
+
+func (h *Handler) Image2text(w http.ResponseWriter, r *http.Request) {
 	// Parse the multipart form in the request
 	err := r.ParseMultipartForm(30 << 20) // 30MB max memory
 	if err != nil {
@@ -39,9 +50,9 @@ func Image2text(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
 		return
 	}
 	defer file.Close()
-	response, err := CallImageToTextFastAPI(file, fileHeader, cfg.APIKey, cfg.FASTAPIBaseURL)
+	response, err := CallImageToTextFastAPI(r.Context(), h.sidecar, file, fileHeader.Filename)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error calling the Image To Text Endpoint, %v", err))
+		utils.RespondWithError(w, sidecar.HTTPStatus(err), fmt.Sprintf("Error calling the Image To Text Endpoint, %v", err))
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, response)
@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"strings"
+
+	"github.com/kingmariano/omnicron/packages/gpt"
+)
+
+const (
+	// MaxReplyTokens is the most of a context window kept free for the reply, see ReplyReserve.
+	MaxReplyTokens = 1024
+	// MaxReduceLevels is the number of times the partial results of a map-reduce are condensed
+	// before the final prompt is written from the results that fit.
+	MaxReduceLevels = 3
+)
+
+// ReplyReserve returns the tokens of a context window of window tokens kept free for the reply:
+// MaxReplyTokens, or a quarter of the window if it is small.
+func ReplyReserve(window int) int {
+	return min(MaxReplyTokens, window/4)
+}
+
+// GroupParts groups consecutive parts into groups of at most budget tokens, counting a token for
+// the separator the parts are joined with. A part longer than budget is cut to fit on its own.
+func GroupParts(parts []string, budget int) [][]string {
+	var groups [][]string
+	var group []string
+	used := 0
+	for _, part := range parts {
+		tokens := gpt.EstimateTokens(part) + 1
+		if tokens > budget {
+			part = strings.ToValidUTF8(part[:min(len(part), max(budget-1, 0)*4)], "")
+			tokens = budget
+		}
+		if used+tokens > budget && len(group) > 0 {
+			groups = append(groups, group)
+			group, used = nil, 0
+		}
+		group = append(group, part)
+		used += tokens
+	}
+	if len(group) > 0 || len(groups) == 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// defaultContextWindow is the context window, in tokens, of models missing from Config.ContextWindows.
+const defaultContextWindow = 8192
+
+// Config lists the Groq models that can be requested, the candidates of every model alias
+// and the context window of the models.
+type Config struct {
+	// GroqModels are the Groq chat models that can be requested.
+	GroqModels []string `json:"groq_models"`
+	// Aliases maps a logical model such as "fast" to the prefixed models serving it, in order of preference.
+	Aliases map[string][]string `json:"aliases"`
+	// ContextWindows maps a prefixed model to the number of tokens it accepts.
+	ContextWindows map[string]int `json:"context_windows"`
+	// MaxRepairs is how often output that doesn't match the requested JSON response format
+	// is sent back to the model for repair.
+	MaxRepairs int `json:"max_repairs"`
+}
+
+// DefaultConfig returns the models and aliases used when no config file is given.
+func DefaultConfig() Config {
+	return Config{
+		GroqModels: []string{"llama3-8b-8192", "llama3-70b-8192", "mixtral-8x7b-32768", "gemma-7b-it"},
+		Aliases: map[string][]string{
+			"fast":         {"groq/llama3-8b-8192", "groq/gemma-7b-it", "g4f/gpt-3.5-turbo"},
+			"smart":        {"groq/llama3-70b-8192", "replicate/meta/meta-llama-3-70b-instruct", "g4f/gpt-4o"},
+			"long-context": {"groq/mixtral-8x7b-32768", "replicate/mistralai/mixtral-8x7b-instruct-v0.1", "g4f/default"},
+		},
+		MaxRepairs: 2,
+		ContextWindows: map[string]int{
+			"groq/llama3-8b-8192":                            8192,
+			"groq/llama3-70b-8192":                           8192,
+			"groq/mixtral-8x7b-32768":                        32768,
+			"groq/gemma-7b-it":                               8192,
+			"replicate/meta/meta-llama-3-70b-instruct":       8192,
+			"replicate/meta/meta-llama-3-8b-instruct":        8192,
+			"replicate/mistralai/mixtral-8x7b-instruct-v0.1": 32768,
+			"g4f/default":                                    8192,
+			"g4f/gpt-3.5-turbo":                              16385,
+			"g4f/gpt-4":                                      8192,
+			"g4f/gpt-4o":                                     128000,
+		},
+	}
+}
+
+// LoadConfig reads a Config from the JSON file at path. Fields missing from the file keep their defaults.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid models config %s: %w", path, err)
+	}
+	return cfg, nil
+}
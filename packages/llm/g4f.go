@@ -0,0 +1,217 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/services"
+)
+
+// g4fDefaultModel lets g4f pick a model from its rotating list of free providers.
+const g4fDefaultModel = "default"
+
+// G4FProvider serves the gpt4free models of the FastAPI server.
+type G4FProvider struct {
+	sidecar services.SidecarClient
+}
+
+// NewG4FProvider returns a G4FProvider calling the FastAPI server through sidecar.
+func NewG4FProvider(sidecar services.SidecarClient) *G4FProvider {
+	return &G4FProvider{sidecar: sidecar}
+}
+
+func (p *G4FProvider) Name() string {
+	return "g4f"
+}
+
+func (p *G4FProvider) Models() []string {
+	return []string{g4fDefaultModel, "gpt-3.5-turbo", "gpt-4", "gpt-4o"}
+}
+
+// ChatCompletion creates a completion with g4f. g4f doesn't report token usage, so Usage is left empty.
+func (p *G4FProvider) ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	response, err := gpt.CallGPTFastAPI(ctx, p.sidecar, newG4FRequest(request))
+	if err != nil {
+		return nil, err
+	}
+	return &ChatCompletion{
+		ID:      newCompletionID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   request.Model,
+		Choices: []Choice{{
+			Message:      Message{Role: "assistant", Content: response.Response},
+			FinishReason: "stop",
+		}},
+	}, nil
+}
+
+// ChatCompletionStream streams a completion from g4f. The usage at the end of the stream is estimated.
+func (p *G4FProvider) ChatCompletionStream(ctx context.Context, request ChatCompletionRequest) (Stream, error) {
+	chatRequest := newG4FRequest(request)
+	stream, err := gpt.StreamGPTFastAPI(ctx, p.sidecar, chatRequest)
+	if err != nil {
+		return nil, err
+	}
+	s := &g4fStream{
+		stream:   stream,
+		builder:  chunkBuilder{id: newCompletionID(), created: time.Now().Unix(), model: request.Model},
+		messages: chatRequest.Messages,
+	}
+	s.pending = queue{s.builder.chunk(0, Delta{Role: "assistant"}, "")}
+	return s, nil
+}
+
+// g4fStream turns the text chunks of the FastAPI server into completion chunks.
+type g4fStream struct {
+	stream     *gpt.Stream
+	builder    chunkBuilder
+	messages   []gpt.Message
+	completion strings.Builder
+	pending    queue
+	finished   bool
+}
+
+func (s *g4fStream) Recv() (*ChatCompletionChunk, error) {
+	if chunk, ok := s.pending.pop(); ok {
+		return chunk, nil
+	}
+	if s.finished {
+		return nil, io.EOF
+	}
+	text, err := s.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		s.finished = true
+		usage := gpt.EstimateUsage(s.messages, s.completion.String())
+		s.pending = queue{
+			s.builder.chunk(0, Delta{}, "stop"),
+			s.builder.usage(Usage(usage)),
+		}
+		chunk, _ := s.pending.pop()
+		return chunk, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.completion.WriteString(text)
+	return s.builder.chunk(0, Delta{Content: text}, ""), nil
+}
+
+func (s *g4fStream) Close() error {
+	return s.stream.Close()
+}
+
+// newG4FRequest converts request to the request of the FastAPI server.
+func newG4FRequest(request ChatCompletionRequest) gpt.ChatRequest {
+	chatRequest := gpt.ChatRequest{Messages: make([]gpt.Message, 0, len(request.Messages))}
+	if request.Model != g4fDefaultModel {
+		chatRequest.Model = request.Model
+	}
+	for _, m := range request.Messages {
+		chatRequest.Messages = append(chatRequest.Messages, gpt.Message{Role: m.Role, Content: m.Content})
+	}
+	return chatRequest
+}
+
+// G4FChat completes the /gpt4free requests for JSON output through a Router, which validates the
+// output and asks the model to repair it.
+type G4FChat struct {
+	router *Router
+}
+
+// NewG4FChat returns a G4FChat routing requests with router.
+func NewG4FChat(router *Router) *G4FChat {
+	return &G4FChat{router: router}
+}
+
+// Validate reports whether request asks for JSON output and checks that it can be served: the
+// response format must be valid, the model a g4f model of the router, and the request can't be
+// streamed or include an image.
+func (c *G4FChat) Validate(request gpt.ChatRequest) (bool, error) {
+	format, err := g4fResponseFormat(request)
+	if err != nil || !format.isJSON() {
+		return false, err
+	}
+	if request.Stream {
+		return false, errors.New("JSON response formats can't be streamed")
+	}
+	if request.ImageURL != "" {
+		return false, errors.New("image_url can't be combined with a JSON response format")
+	}
+	return true, c.router.Validate(g4fModel(request.Model))
+}
+
+// ChatCompletion creates a completion of request with its JSON output validated.
+func (c *G4FChat) ChatCompletion(ctx context.Context, request gpt.ChatRequest) (*gpt.ChatResponse, error) {
+	format, err := g4fResponseFormat(request)
+	if err != nil {
+		return nil, err
+	}
+	chatRequest := ChatCompletionRequest{
+		Model:          g4fModel(request.Model),
+		Messages:       make([]Message, 0, len(request.Messages)),
+		ResponseFormat: format,
+		MaxRepairs:     request.MaxRepairs,
+	}
+	for _, m := range request.Messages {
+		chatRequest.Messages = append(chatRequest.Messages, Message{Role: m.Role, Content: m.Content})
+	}
+	completion, err := c.router.ChatCompletion(ctx, chatRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, errors.New("completion returned no choices")
+	}
+	message := completion.Choices[0].Message
+	return &gpt.ChatResponse{Response: message.Content, Parsed: message.Parsed}, nil
+}
+
+// g4fResponseFormat decodes and checks the response format of request.
+func g4fResponseFormat(request gpt.ChatRequest) (*ResponseFormat, error) {
+	if len(request.ResponseFormat) == 0 || string(request.ResponseFormat) == "null" {
+		return nil, nil
+	}
+	var format ResponseFormat
+	if err := json.Unmarshal(request.ResponseFormat, &format); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponseFormat, err)
+	}
+	if err := ValidateResponseFormat(&format); err != nil {
+		return nil, err
+	}
+	return &format, nil
+}
+
+// g4fModel returns the router's name of a g4f model.
+func g4fModel(model string) string {
+	if model == "" {
+		model = g4fDefaultModel
+	}
+	return "g4f/" + model
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jpoz/groq"
+	"github.com/kingmariano/omnicron/services"
+)
+
+// GroqProvider serves the models hosted on Groq. Groq speaks the OpenAI wire format, so requests are forwarded as is.
+type GroqProvider struct {
+	client services.OpenAIClient
+	models []string
+}
+
+// NewGroqProvider returns a GroqProvider serving models.
+func NewGroqProvider(client services.OpenAIClient, models []string) *GroqProvider {
+	return &GroqProvider{client: client, models: models}
+}
+
+func (p *GroqProvider) Name() string {
+	return "groq"
+}
+
+func (p *GroqProvider) Models() []string {
+	return p.models
+}
+
+// SupportsTools reports that Groq's models can call tools, which are passed through with the request.
+func (p *GroqProvider) SupportsTools() bool {
+	return true
+}
+
+func (p *GroqProvider) ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	request.Stream = false
+	request.StreamOptions = nil
+	request.ResponseFormat = groqResponseFormat(request.ResponseFormat)
+	request.MaxRepairs = nil
+	var completion ChatCompletion
+	if err := p.client.PostJSON(ctx, "/chat/completions", request, &completion); err != nil {
+		return nil, err
+	}
+	return &completion, nil
+}
+
+// ChatCompletionStream streams a completion from Groq.
+func (p *GroqProvider) ChatCompletionStream(ctx context.Context, request ChatCompletionRequest) (Stream, error) {
+	request.Stream = true
+	request.StreamOptions = nil // Groq reports the usage in the last chunk on its own
+	request.ResponseFormat = groqResponseFormat(request.ResponseFormat)
+	request.MaxRepairs = nil
+	body, err := p.client.PostStream(ctx, "/chat/completions", request)
+	if err != nil {
+		return nil, err
+	}
+	return newSSEStream(body), nil
+}
+
+// groqResponseFormat returns the response format sent to Groq, which supports JSON mode but not
+// schemas. The schema is in the instructions of the prompt and the output is validated by the Router.
+func groqResponseFormat(format *ResponseFormat) *ResponseFormat {
+	if format != nil && format.Type == "json_schema" {
+		return &ResponseFormat{Type: "json_object"}
+	}
+	return format
+}
+
+// failedGeneration returns the output Groq rejected because it wasn't valid JSON in JSON mode.
+func failedGeneration(err error) (string, bool) {
+	var groqErr groq.Error
+	if errors.As(err, &groqErr) && groqErr.FailedGeneration != "" {
+		return groqErr.FailedGeneration, true
+	}
+	return "", false
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	healthWindow        = 20               // number of recent calls the error rate and latency are computed over
+	healthMinSamples    = 5                // calls needed before a provider can be considered unhealthy
+	unhealthyErrorRate  = 0.5              // error rate from which a provider is unhealthy
+	healthProbeInterval = 30 * time.Second // how often an unhealthy provider is tried again so it can recover
+)
+
+// callResult is the outcome of a call to a provider.
+type callResult struct {
+	failed  bool
+	latency time.Duration
+}
+
+// health tracks the rolling error rate and latency of a provider over its last healthWindow calls.
+type health struct {
+	mu          sync.Mutex
+	results     []callResult
+	next        int
+	lastFailure time.Time
+	lastProbe   time.Time
+	now         func() time.Time
+}
+
+func newHealth() *health {
+	return &health{now: time.Now}
+}
+
+// record adds the outcome of a call.
+func (h *health) record(failed bool, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := callResult{failed: failed, latency: latency}
+	if failed {
+		h.lastFailure = h.now()
+	}
+	if len(h.results) < healthWindow {
+		h.results = append(h.results, result)
+		return
+	}
+	h.results[h.next] = result
+	h.next = (h.next + 1) % healthWindow
+}
+
+// stats returns the error rate and the mean latency of the recorded calls.
+func (h *health) stats() (errorRate float64, latency time.Duration, samples int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.statsLocked()
+}
+
+func (h *health) statsLocked() (float64, time.Duration, int) {
+	if len(h.results) == 0 {
+		return 0, 0, 0
+	}
+	var failures int
+	var total time.Duration
+	for _, r := range h.results {
+		if r.failed {
+			failures++
+		}
+		total += r.latency
+	}
+	n := len(h.results)
+	return float64(failures) / float64(n), total / time.Duration(n), n
+}
+
+// healthy reports whether the provider's recent error rate is acceptable.
+func (h *health) healthy() bool {
+	errorRate, _, samples := h.stats()
+	return samples < healthMinSamples || errorRate < unhealthyErrorRate
+}
+
+// available reports whether the provider should be tried. Healthy providers always are,
+// unhealthy ones once every healthProbeInterval so they can prove they recovered.
+func (h *health) available() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	errorRate, _, samples := h.statsLocked()
+	if samples < healthMinSamples || errorRate < unhealthyErrorRate {
+		return true
+	}
+	last := h.lastFailure
+	if h.lastProbe.After(last) {
+		last = h.lastProbe
+	}
+	if h.now().Sub(last) < healthProbeInterval {
+		return false
+	}
+	h.lastProbe = h.now()
+	return true
+}
+
+// score ranks providers when none is available: fewer errors first, then lower latency.
+func (h *health) score() float64 {
+	errorRate, latency, _ := h.stats()
+	return (1 - errorRate) / (1 + latency.Seconds())
+}
+
+// ProviderHealth reports the recent health of a provider.
+type ProviderHealth struct {
+	Provider  string  `json:"provider"`
+	Healthy   bool    `json:"healthy"`
+	ErrorRate float64 `json:"error_rate"`
+	LatencyMS int64   `json:"latency_ms"`
+	Samples   int     `json:"samples"`
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
+)
+
+// ErrUnknownModel is returned for a model that no registered provider serves.
+var ErrUnknownModel = errors.New("unknown model")
+
+// ErrToolsUnsupported is returned when a request with tools names no model that can call tools.
+var ErrToolsUnsupported = errors.New("model does not support tools")
+
+// Provider is a chat backend. Models and requests use the provider's own model names, without the prefix.
+type Provider interface {
+	// Name is the prefix that routes a model to the provider, e.g. "groq".
+	Name() string
+	// Models lists the models the provider serves.
+	Models() []string
+	ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error)
+}
+
+// ToolProvider is a Provider whose models can call tools. Requests with tools are only
+// routed to tool providers.
+type ToolProvider interface {
+	Provider
+	SupportsTools() bool
+}
+
+// Router dispatches requests to a Provider by the prefix of the model name.
+// A model alias such as "fast" is served by the first healthy of its candidates,
+// failing over to the next one when a provider fails.
+type Router struct {
+	providers      map[string]Provider
+	order          []string
+	aliases        map[string][]string
+	contextWindows map[string]int
+	maxRepairs     int
+	health         map[string]*health
+}
+
+// NewRouter returns a Router serving the given providers with the aliases and context windows of cfg.
+// Every alias candidate must be a model served by one of the providers.
+func NewRouter(cfg Config, providers ...Provider) (*Router, error) {
+	r := &Router{
+		providers:      make(map[string]Provider, len(providers)),
+		aliases:        cfg.Aliases,
+		contextWindows: cfg.ContextWindows,
+		maxRepairs:     cfg.MaxRepairs,
+		health:         make(map[string]*health, len(providers)),
+	}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+		r.order = append(r.order, p.Name())
+		r.health[p.Name()] = newHealth()
+	}
+	for alias, candidates := range cfg.Aliases {
+		if strings.Contains(alias, "/") || len(candidates) == 0 {
+			return nil, fmt.Errorf("invalid model alias %q, aliases have no prefix and at least one candidate", alias)
+		}
+		for _, candidate := range candidates {
+			if _, _, err := r.Resolve(candidate); err != nil {
+				return nil, fmt.Errorf("model alias %q: %w", alias, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// Resolve returns the provider serving model and the model name without the provider prefix.
+func (r *Router) Resolve(model string) (Provider, string, error) {
+	prefix, name, ok := strings.Cut(model, "/")
+	provider, found := r.providers[prefix]
+	if !ok || !found {
+		return nil, "", fmt.Errorf("%w %q, models must be an alias or be prefixed with one of: %s", ErrUnknownModel, model, strings.Join(r.order, ", "))
+	}
+	for _, m := range provider.Models() {
+		if m == name {
+			return provider, name, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%w %q, see /v1/models for the available models", ErrUnknownModel, model)
+}
+
+// Validate reports whether model is an alias or a model served by a provider.
+func (r *Router) Validate(model string) error {
+	if _, ok := r.aliases[model]; ok {
+		return nil
+	}
+	_, _, err := r.Resolve(model)
+	return err
+}
+
+// ContextWindow returns the number of tokens model accepts. An alias accepts as many tokens as
+// the smallest of its candidates, since any of them may serve it.
+func (r *Router) ContextWindow(model string) int {
+	candidates, ok := r.aliases[model]
+	if !ok {
+		candidates = []string{model}
+	}
+	window := 0
+	for _, candidate := range candidates {
+		w, ok := r.contextWindows[candidate]
+		if !ok {
+			w = defaultContextWindow
+		}
+		if window == 0 || w < window {
+			window = w
+		}
+	}
+	return window
+}
+
+// ChatCompletion creates a completion with the provider serving request.Model.
+// The model of the response is the prefixed model that served the request.
+// Completions requested with a JSON response format are validated, see structuredCompletion.
+func (r *Router) ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	if request.ResponseFormat.isJSON() {
+		return r.structuredCompletion(ctx, request)
+	}
+	return r.completion(ctx, request)
+}
+
+// completion creates a completion with the provider serving request.Model.
+func (r *Router) completion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	var completion *ChatCompletion
+	served, err := r.route(ctx, request.Model, len(request.Tools) > 0, func(provider Provider, name string) error {
+		request.Model = name
+		var err error
+		completion, err = provider.ChatCompletion(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	completion.Model = served
+	return completion, nil
+}
+
+// route calls call with the candidates serving model until one succeeds and returns the candidate that served.
+// Available candidates are tried in order of preference. If none is available, all of them are tried,
+// healthiest first. Only errors another provider may not repeat fail over. With tools, candidates
+// whose provider can't call tools are skipped.
+func (r *Router) route(ctx context.Context, model string, tools bool, call func(provider Provider, name string) error) (string, error) {
+	candidates, isAlias := r.aliases[model]
+	if !isAlias {
+		candidates = []string{model}
+	}
+	candidates = r.rank(candidates)
+
+	var errs []error
+	for _, candidate := range candidates {
+		provider, name, err := r.Resolve(candidate)
+		if err != nil {
+			return "", err
+		}
+		if tools && !supportsTools(provider) {
+			continue
+		}
+		health := r.health[provider.Name()]
+		start := time.Now()
+		err = call(provider, name)
+		if err == nil {
+			health.record(false, time.Since(start))
+			return candidate, nil
+		}
+		if ctx.Err() != nil || !retryable(err) {
+			return "", err
+		}
+		health.record(true, time.Since(start))
+		if isAlias {
+			log.Printf("%s failed serving %s, failing over: %v", candidate, model, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", candidate, err))
+	}
+	if len(errs) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrToolsUnsupported, model)
+	}
+	return "", errors.Join(errs...)
+}
+
+func supportsTools(provider Provider) bool {
+	toolProvider, ok := provider.(ToolProvider)
+	return ok && toolProvider.SupportsTools()
+}
+
+// rank returns the available candidates in order of preference or, when none is available,
+// every candidate ordered by health score.
+func (r *Router) rank(candidates []string) []string {
+	var available []string
+	for _, candidate := range candidates {
+		prefix, _, _ := strings.Cut(candidate, "/")
+		if h, ok := r.health[prefix]; !ok || h.available() {
+			available = append(available, candidate)
+		}
+	}
+	if len(available) > 0 {
+		return available
+	}
+	ranked := append([]string(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return r.healthOf(ranked[i]).score() > r.healthOf(ranked[j]).score()
+	})
+	return ranked
+}
+
+func (r *Router) healthOf(candidate string) *health {
+	prefix, _, _ := strings.Cut(candidate, "/")
+	return r.health[prefix]
+}
+
+// retryable reports whether another provider may succeed where this one failed.
+// Requests rejected as malformed are returned to the caller; the FastAPI server answers
+// 400 for any g4f failure, so only its validation errors are final.
+func retryable(err error) bool {
+	var apiErr *services.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusUnprocessableEntity
+	}
+	var sidecarErr *sidecar.Error
+	if errors.As(err, &sidecarErr) {
+		return sidecarErr.StatusCode != http.StatusUnprocessableEntity
+	}
+	return !errors.Is(err, ErrUnknownModel) && !errors.Is(err, ErrToolsUnsupported)
+}
+
+// Models lists the aliases and the prefixed models of every provider.
+func (r *Router) Models() []Model {
+	var models []Model
+	aliases := make([]string, 0, len(r.aliases))
+	for alias := range r.aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		models = append(models, Model{ID: alias, Object: "model", OwnedBy: "omnicron"})
+	}
+	for _, name := range r.order {
+		provider := r.providers[name]
+		ids := append([]string(nil), provider.Models()...)
+		sort.Strings(ids)
+		for _, id := range ids {
+			models = append(models, Model{ID: name + "/" + id, Object: "model", OwnedBy: name})
+		}
+	}
+	return models
+}
+
+// Health reports the recent health of every provider.
+func (r *Router) Health() []ProviderHealth {
+	report := make([]ProviderHealth, 0, len(r.order))
+	for _, name := range r.order {
+		h := r.health[name]
+		errorRate, latency, samples := h.stats()
+		report = append(report, ProviderHealth{
+			Provider:  name,
+			Healthy:   h.healthy(),
+			ErrorRate: errorRate,
+			LatencyMS: latency.Milliseconds(),
+			Samples:   samples,
+		})
+	}
+	return report
+}
+
+// newCompletionID returns an id for a completion of a backend that doesn't assign one.
+func newCompletionID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kingmariano/omnicron/services"
+)
+
+// fakeProvider serves the model "m" and fails with err while it is set.
+type fakeProvider struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Name() string     { return p.name }
+func (p *fakeProvider) Models() []string { return []string{"m"} }
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &ChatCompletion{Model: request.Model, Choices: []Choice{{Message: Message{Role: "assistant", Content: p.name}}}}, nil
+}
+
+func TestRouterFailover(t *testing.T) {
+	primary := &fakeProvider{name: "primary", err: errors.New("connection refused")}
+	secondary := &fakeProvider{name: "secondary"}
+	router, err := NewRouter(Config{Aliases: map[string][]string{"fast": {"primary/m", "secondary/m"}}}, primary, secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := ChatCompletionRequest{Model: "fast", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	for i := 0; i < healthMinSamples; i++ {
+		completion, err := router.ChatCompletion(context.Background(), request)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if completion.Model != "secondary/m" {
+			t.Fatalf("served by %s, want secondary/m", completion.Model)
+		}
+	}
+	// primary is now unhealthy and skipped until the probe interval passed
+	if _, err := router.ChatCompletion(context.Background(), request); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if primary.calls != healthMinSamples {
+		t.Errorf("primary called %d times, want %d", primary.calls, healthMinSamples)
+	}
+	for _, h := range router.Health() {
+		if h.Provider == "primary" && (h.Healthy || h.ErrorRate != 1) {
+			t.Errorf("unexpected primary health %+v", h)
+		}
+	}
+}
+
+func TestRouterReturnsRequestErrors(t *testing.T) {
+	invalid := &services.APIError{StatusCode: http.StatusBadRequest, Err: errors.New("invalid temperature")}
+	primary := &fakeProvider{name: "primary", err: invalid}
+	secondary := &fakeProvider{name: "secondary"}
+	router, err := NewRouter(Config{Aliases: map[string][]string{"fast": {"primary/m", "secondary/m"}}}, primary, secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = router.ChatCompletion(context.Background(), ChatCompletionRequest{Model: "fast"})
+	if !errors.Is(err, invalid) {
+		t.Fatalf("got %v, want the request error", err)
+	}
+	if secondary.calls != 0 {
+		t.Errorf("failed over on a request error")
+	}
+}
+
+func TestNewRouterValidatesAliases(t *testing.T) {
+	if _, err := NewRouter(Config{Aliases: map[string][]string{"fast": {"missing/m"}}}, &fakeProvider{name: "primary"}); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("got %v, want ErrUnknownModel", err)
+	}
+}
+
+// toolProvider is a fakeProvider that can call tools.
+type toolProvider struct {
+	fakeProvider
+}
+
+func (p *toolProvider) SupportsTools() bool { return true }
+
+func TestRouterToolsSkipProvidersWithoutTools(t *testing.T) {
+	plain := &fakeProvider{name: "plain"}
+	tools := &toolProvider{fakeProvider{name: "tools"}}
+	router, err := NewRouter(Config{Aliases: map[string][]string{"smart": {"plain/m", "tools/m"}}}, plain, tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := ChatCompletionRequest{
+		Model:    "smart",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+		Tools:    []Tool{{Type: "function", Function: FunctionDefinition{Name: "lookup"}}},
+	}
+	completion, err := router.ChatCompletion(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if completion.Model != "tools/m" || plain.calls != 0 {
+		t.Errorf("served by %s after %d calls to plain, want tools/m only", completion.Model, plain.calls)
+	}
+
+	request.Model = "plain/m"
+	if _, err := router.ChatCompletion(context.Background(), request); !errors.Is(err, ErrToolsUnsupported) {
+		t.Errorf("expected ErrToolsUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kingmariano/omnicron/services"
+	"github.com/replicate/replicate-go"
+)
+
+// replicateLLM describes how to prompt a language model hosted on Replicate.
+type replicateLLM struct {
+	// format renders the conversation with the model's chat template.
+	format func(messages []Message) string
+	// maxTokensKey is the name of the input limiting the generated tokens.
+	maxTokensKey string
+}
+
+var replicateLLMs = map[string]replicateLLM{
+	"meta/meta-llama-3-70b-instruct":       {format: formatLlama3, maxTokensKey: "max_tokens"},
+	"meta/meta-llama-3-8b-instruct":        {format: formatLlama3, maxTokensKey: "max_tokens"},
+	"mistralai/mixtral-8x7b-instruct-v0.1": {format: formatMistral, maxTokensKey: "max_new_tokens"},
+}
+
+// ReplicateProvider serves the language models hosted on Replicate.
+type ReplicateProvider struct {
+	predictions services.PredictionProvider
+}
+
+// NewReplicateProvider returns a ReplicateProvider running predictions with predictions.
+func NewReplicateProvider(predictions services.PredictionProvider) *ReplicateProvider {
+	return &ReplicateProvider{predictions: predictions}
+}
+
+func (p *ReplicateProvider) Name() string {
+	return "replicate"
+}
+
+func (p *ReplicateProvider) Models() []string {
+	models := make([]string, 0, len(replicateLLMs))
+	for name := range replicateLLMs {
+		models = append(models, name)
+	}
+	return models
+}
+
+func (p *ReplicateProvider) ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	llm, ok := replicateLLMs[request.Model]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownModel, request.Model)
+	}
+	// the conversation is rendered here, so the model's own template must pass the prompt through unchanged
+	input := replicate.PredictionInput{
+		"prompt":          llm.format(request.Messages),
+		"prompt_template": "{prompt}",
+	}
+	if request.MaxTokens != nil {
+		input[llm.maxTokensKey] = *request.MaxTokens
+	}
+	if request.Temperature != nil {
+		input["temperature"] = *request.Temperature
+	}
+	if request.TopP != nil {
+		input["top_p"] = *request.TopP
+	}
+	if request.Seed != nil {
+		input["seed"] = *request.Seed
+	}
+	if len(request.Stop) > 0 {
+		input["stop_sequences"] = strings.Join(request.Stop, ",")
+	}
+
+	prediction, err := p.predictions.CreateModelPrediction(ctx, request.Model, input)
+	if err != nil {
+		return nil, err
+	}
+	if prediction.Status != replicate.Succeeded {
+		return nil, fmt.Errorf("prediction %s: %v", prediction.Status, prediction.Error)
+	}
+	completion := &ChatCompletion{
+		ID:      newCompletionID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   request.Model,
+		Choices: []Choice{{
+			Message:      Message{Role: "assistant", Content: strings.TrimSpace(outputText(prediction.Output))},
+			FinishReason: "stop",
+		}},
+	}
+	if m := prediction.Metrics; m != nil && m.InputTokenCount != nil && m.OutputTokenCount != nil {
+		completion.Usage = &Usage{
+			PromptTokens:     *m.InputTokenCount,
+			CompletionTokens: *m.OutputTokenCount,
+			TotalTokens:      *m.InputTokenCount + *m.OutputTokenCount,
+		}
+	}
+	return completion, nil
+}
+
+// outputText joins the tokens a language model prediction outputs.
+func outputText(output replicate.PredictionOutput) string {
+	switch out := output.(type) {
+	case string:
+		return out
+	case []interface{}:
+		var b strings.Builder
+		for _, token := range out {
+			fmt.Fprint(&b, token)
+		}
+		return b.String()
+	}
+	return ""
+}
+
+// formatLlama3 renders messages with the Llama 3 instruct template.
+func formatLlama3(messages []Message) string {
+	var b strings.Builder
+	b.WriteString("<|begin_of_text|>")
+	for _, m := range messages {
+		fmt.Fprintf(&b, "<|start_header_id|>%s<|end_header_id|>\n\n%s<|eot_id|>", m.Role, m.Content)
+	}
+	b.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+	return b.String()
+}
+
+// formatMistral renders messages with the Mistral instruct template, which has no system role:
+// system messages are prepended to the next user message.
+func formatMistral(messages []Message) string {
+	var b strings.Builder
+	var system []string
+	b.WriteString("<s>")
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			system = append(system, m.Content)
+		case "assistant":
+			fmt.Fprintf(&b, " %s</s>", m.Content)
+		default:
+			content := m.Content
+			if len(system) > 0 {
+				content = strings.Join(append(system, content), "\n\n")
+				system = nil
+			}
+			fmt.Fprintf(&b, "[INST] %s [/INST]", content)
+		}
+	}
+	return b.String()
+}
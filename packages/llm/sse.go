@@ -0,0 +1,75 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// streamError is the event sent when a stream fails after it started, in OpenAI's error format.
+type streamError struct {
+	Error struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Param   *string `json:"param"`
+		Code    *string `json:"code"`
+	} `json:"error"`
+}
+
+// WriteStream writes the chunks of stream as server-sent events, ending with [DONE].
+// The usage chunk is only sent if includeUsage is set, as OpenAI does for stream_options.include_usage.
+// A failure after the stream started is sent as an error event, and a client disconnect stops the stream.
+func WriteStream(w http.ResponseWriter, r *http.Request, stream Stream, includeUsage bool) {
+	utils.StartSSE(w)
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if r.Context().Err() != nil {
+			log.Print("client disconnected, stopping chat completion stream")
+			return
+		}
+		if err != nil {
+			var event streamError
+			event.Error.Message, event.Error.Type = err.Error(), "api_error"
+			if writeErr := utils.WriteSSE(w, event); writeErr != nil {
+				log.Print(writeErr)
+			}
+			return
+		}
+		if chunk.Usage != nil && len(chunk.Choices) == 0 && !includeUsage {
+			continue
+		}
+		if err := utils.WriteSSE(w, chunk); err != nil {
+			log.Printf("client disconnected, stopping chat completion stream: %v", err)
+			return
+		}
+	}
+	if err := utils.WriteSSEDone(w); err != nil {
+		log.Print(err)
+	}
+}
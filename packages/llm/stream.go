@@ -0,0 +1,219 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Stream is a streamed completion. Recv returns io.EOF after the last chunk.
+// The last chunk before io.EOF carries the usage, when the provider reports it, and has no choices.
+// Close must be called once the stream is no longer read.
+type Stream interface {
+	Recv() (*ChatCompletionChunk, error)
+	Close() error
+}
+
+// StreamProvider is a Provider that streams completions as they are generated.
+type StreamProvider interface {
+	Provider
+	ChatCompletionStream(ctx context.Context, request ChatCompletionRequest) (Stream, error)
+}
+
+// ChatCompletionStream streams a completion from the provider serving request.Model.
+// Failing over is only possible until the stream is established. Providers that can't stream
+// are sent as a single content chunk once the completion is done.
+func (r *Router) ChatCompletionStream(ctx context.Context, request ChatCompletionRequest) (Stream, error) {
+	var stream Stream
+	served, err := r.route(ctx, request.Model, len(request.Tools) > 0, func(provider Provider, name string) error {
+		request.Model = name
+		var err error
+		if streamer, ok := provider.(StreamProvider); ok {
+			stream, err = streamer.ChatCompletionStream(ctx, request)
+			return err
+		}
+		var completion *ChatCompletion
+		completion, err = provider.ChatCompletion(ctx, request)
+		if err == nil {
+			stream = newCompletionStream(completion)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &modelStream{Stream: stream, model: served}, nil
+}
+
+// modelStream reports the prefixed model that serves the stream in every chunk.
+type modelStream struct {
+	Stream
+	model string
+}
+
+func (s *modelStream) Recv() (*ChatCompletionChunk, error) {
+	chunk, err := s.Stream.Recv()
+	if chunk != nil {
+		chunk.Model = s.model
+	}
+	return chunk, err
+}
+
+// Model returns the prefixed model that serves the stream.
+func (s *modelStream) Model() string {
+	return s.model
+}
+
+// chunkBuilder creates the chunks of a completion.
+type chunkBuilder struct {
+	id      string
+	created int64
+	model   string
+}
+
+func (b chunkBuilder) chunk(index int, delta Delta, finishReason string) *ChatCompletionChunk {
+	choice := ChunkChoice{Index: index, Delta: delta}
+	if finishReason != "" {
+		choice.FinishReason = &finishReason
+	}
+	return &ChatCompletionChunk{ID: b.id, Object: "chat.completion.chunk", Created: b.created, Model: b.model, Choices: []ChunkChoice{choice}}
+}
+
+func (b chunkBuilder) usage(usage Usage) *ChatCompletionChunk {
+	return &ChatCompletionChunk{ID: b.id, Object: "chat.completion.chunk", Created: b.created, Model: b.model, Choices: []ChunkChoice{}, Usage: &usage}
+}
+
+// queue holds chunks to be returned before reading further.
+type queue []*ChatCompletionChunk
+
+func (q *queue) pop() (*ChatCompletionChunk, bool) {
+	if len(*q) == 0 {
+		return nil, false
+	}
+	chunk := (*q)[0]
+	*q = (*q)[1:]
+	return chunk, true
+}
+
+// completionStream streams a finished completion: the role, the content and the finish reason of
+// every choice, then the usage.
+type completionStream struct {
+	chunks queue
+}
+
+func newCompletionStream(completion *ChatCompletion) *completionStream {
+	b := chunkBuilder{id: completion.ID, created: completion.Created, model: completion.Model}
+	s := &completionStream{}
+	for _, choice := range completion.Choices {
+		s.chunks = append(s.chunks,
+			b.chunk(choice.Index, Delta{Role: choice.Message.Role}, ""),
+			b.chunk(choice.Index, Delta{Content: choice.Message.Content}, ""),
+			b.chunk(choice.Index, Delta{}, choice.FinishReason),
+		)
+	}
+	if completion.Usage != nil {
+		s.chunks = append(s.chunks, b.usage(*completion.Usage))
+	}
+	return s
+}
+
+func (s *completionStream) Recv() (*ChatCompletionChunk, error) {
+	if chunk, ok := s.chunks.pop(); ok {
+		return chunk, nil
+	}
+	return nil, io.EOF
+}
+
+func (s *completionStream) Close() error {
+	return nil
+}
+
+// sseChunk is an event of an OpenAI-compatible stream. Groq reports the usage in x_groq of the last chunk.
+type sseChunk struct {
+	ChatCompletionChunk
+	XGroq *struct {
+		Usage *Usage `json:"usage"`
+	} `json:"x_groq,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// sseStream reads the server-sent events of an OpenAI-compatible API.
+type sseStream struct {
+	body    io.ReadCloser
+	reader  *bufio.Reader
+	pending queue
+	done    bool
+}
+
+func newSSEStream(body io.ReadCloser) *sseStream {
+	return &sseStream{body: body, reader: bufio.NewReader(body)}
+}
+
+func (s *sseStream) Recv() (*ChatCompletionChunk, error) {
+	if chunk, ok := s.pending.pop(); ok {
+		return chunk, nil
+	}
+	if s.done {
+		return nil, io.EOF
+	}
+	for {
+		line, err := s.reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF // the server stopped without [DONE]
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue // blank lines, comments and other fields
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			s.done = true
+			return nil, io.EOF
+		}
+		var chunk sseChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("invalid stream event: %w", err)
+		}
+		if chunk.Error != nil {
+			return nil, errors.New(chunk.Error.Message)
+		}
+		if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			b := chunkBuilder{id: chunk.ID, created: chunk.Created, model: chunk.Model}
+			s.pending = append(s.pending, b.usage(*chunk.XGroq.Usage))
+		}
+		return &chunk.ChatCompletionChunk, nil
+	}
+}
+
+func (s *sseStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSSEStream(t *testing.T) {
+	body := strings.Join([]string{
+		`data: {"id":"1","object":"chat.completion.chunk","model":"llama3-8b-8192","choices":[{"index":0,"delta":{"role":"assistant"},"finish_reason":null}]}`,
+		``,
+		`: keep-alive`,
+		`data: {"id":"1","object":"chat.completion.chunk","model":"llama3-8b-8192","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+		``,
+		`data: {"id":"1","object":"chat.completion.chunk","model":"llama3-8b-8192","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"x_groq":{"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}}`,
+		``,
+		`data: [DONE]`,
+		``,
+	}, "\n")
+	stream := newSSEStream(io.NopCloser(strings.NewReader(body)))
+	defer stream.Close()
+
+	var content string
+	var finishReason string
+	var usage *Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+			continue
+		}
+		content += chunk.Choices[0].Delta.Content
+		if chunk.Choices[0].FinishReason != nil {
+			finishReason = *chunk.Choices[0].FinishReason
+		}
+	}
+	if content != "Hello" || finishReason != "stop" {
+		t.Errorf("got content %q and finish reason %q", content, finishReason)
+	}
+	if usage == nil || usage.TotalTokens != 4 {
+		t.Errorf("got usage %+v, want 4 total tokens", usage)
+	}
+}
+
+func TestSSEStreamTruncated(t *testing.T) {
+	body := `data: {"id":"1","choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n"
+	stream := newSSEStream(io.NopCloser(strings.NewReader(body)))
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := stream.Recv(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
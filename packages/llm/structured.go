@@ -0,0 +1,257 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// maxRepairsLimit caps the repairs a request may ask for.
+const maxRepairsLimit = 5
+
+// ErrInvalidResponseFormat is returned for a response format that can't be validated against, e.g. an invalid schema.
+var ErrInvalidResponseFormat = errors.New("invalid response_format")
+
+// StructuredOutputError is returned when the output of the model still doesn't match the
+// requested response format after every repair.
+type StructuredOutputError struct {
+	Attempts int
+	// Output is the raw text of the last attempt.
+	Output string
+	Err    error
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("model output doesn't match the response format after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *StructuredOutputError) Unwrap() error {
+	return e.Err
+}
+
+// isJSON reports whether f asks for JSON output.
+func (f *ResponseFormat) isJSON() bool {
+	return f != nil && (f.Type == "json_object" || f.Type == "json_schema")
+}
+
+// ValidateResponseFormat checks that format is supported and that its schema compiles.
+func ValidateResponseFormat(format *ResponseFormat) error {
+	if format == nil {
+		return nil
+	}
+	_, err := newOutputValidator(format)
+	return err
+}
+
+// outputValidator checks model output against a JSON response format.
+type outputValidator struct {
+	format *ResponseFormat
+	schema *jsonschema.Schema
+}
+
+func newOutputValidator(format *ResponseFormat) (*outputValidator, error) {
+	switch format.Type {
+	case "text", "json_object":
+		return &outputValidator{format: format}, nil
+	case "json_schema":
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidResponseFormat, format.Type)
+	}
+	if format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 {
+		return nil, fmt.Errorf("%w: json_schema.schema is required", ErrInvalidResponseFormat)
+	}
+	compiler := jsonschema.NewCompiler()
+	// schemas come from the request, so they must not reference files or URLs
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("loading %s is not allowed", url)
+	}
+	if err := compiler.AddResource("schema.json", bytes.NewReader(format.JSONSchema.Schema)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponseFormat, err)
+	}
+	schema, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponseFormat, err)
+	}
+	return &outputValidator{format: format, schema: schema}, nil
+}
+
+// instructions tells the model which output is expected.
+func (v *outputValidator) instructions() string {
+	if v.schema == nil {
+		return "Respond only with a valid JSON object, without any other text or formatting."
+	}
+	return fmt.Sprintf("Respond only with valid JSON, without any other text or formatting, that conforms to this JSON Schema:\n%s", v.format.JSONSchema.Schema)
+}
+
+// validate returns the JSON value of output, which may be wrapped in a markdown code block.
+func (v *outputValidator) validate(output string) (json.RawMessage, error) {
+	text := extractJSON(output)
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("output is not valid JSON: %v", err)
+	}
+	if decoder.More() {
+		return nil, errors.New("output contains more than one JSON value")
+	}
+	if v.schema == nil {
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, errors.New("output is not a JSON object")
+		}
+	} else if err := v.schema.Validate(value); err != nil {
+		return nil, validationErrors(err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(text)); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
+
+// extractJSON strips a markdown code block or text around the JSON value of output.
+func extractJSON(output string) string {
+	text := strings.TrimSpace(output)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+			text = text[newline+1:] // the language of the block
+		}
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+	if json.Valid([]byte(text)) {
+		return text
+	}
+	start := strings.IndexAny(text, "{[")
+	end := strings.LastIndexAny(text, "}]")
+	if start >= 0 && end > start {
+		return text[start : end+1]
+	}
+	return text
+}
+
+// validationErrors lists the individual schema violations of err.
+func validationErrors(err error) error {
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	var messages []string
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			location := e.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			messages = append(messages, fmt.Sprintf("at %s: %s", location, e.Message))
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(validationErr)
+	if len(messages) > 10 {
+		messages = append(messages[:10], fmt.Sprintf("and %d more", len(messages)-10))
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// structuredCompletion creates a completion whose output must match request.ResponseFormat.
+// Output that doesn't is sent back to the model with the validation errors, up to MaxRepairs
+// times. The JSON value of the output is returned in the Parsed field of the message.
+func (r *Router) structuredCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	validator, err := newOutputValidator(request.ResponseFormat)
+	if err != nil {
+		return nil, err
+	}
+	repairs := r.maxRepairs
+	if request.MaxRepairs != nil {
+		repairs = *request.MaxRepairs
+	}
+	if repairs < 0 {
+		repairs = 0
+	} else if repairs > maxRepairsLimit {
+		repairs = maxRepairsLimit
+	}
+	request.MaxRepairs = nil
+	request.Messages = withInstructions(request.Messages, validator.instructions())
+
+	var usage Usage
+	for attempt := 1; ; attempt++ {
+		var output string
+		completion, err := r.completion(ctx, request)
+		if generation, ok := failedGeneration(err); ok {
+			// Groq rejects output that isn't JSON in JSON mode, which can be repaired like any other
+			output, err = generation, errors.New("output is not valid JSON")
+		} else {
+			if err != nil {
+				return nil, err
+			}
+			if len(completion.Choices) == 0 {
+				return nil, errors.New("completion returned no choices")
+			}
+			if completion.Usage != nil {
+				usage.PromptTokens += completion.Usage.PromptTokens
+				usage.CompletionTokens += completion.Usage.CompletionTokens
+				usage.TotalTokens += completion.Usage.TotalTokens
+			}
+			output = completion.Choices[0].Message.Content
+			var parsed json.RawMessage
+			if parsed, err = validator.validate(output); err == nil {
+				completion.Choices[0].Message.Parsed = parsed
+				if completion.Usage != nil {
+					completion.Usage = &usage
+				}
+				return completion, nil
+			}
+		}
+		if attempt > repairs {
+			return nil, &StructuredOutputError{Attempts: attempt, Output: output, Err: err}
+		}
+		log.Printf("output for %s doesn't match the response format, repairing: %v", request.Model, err)
+		request.Messages = append(request.Messages,
+			Message{Role: "assistant", Content: output},
+			Message{Role: "user", Content: fmt.Sprintf("Your response is invalid: %v. %s", err, validator.instructions())},
+		)
+	}
+}
+
+// withInstructions returns messages with instructions added to the system prompt.
+func withInstructions(messages []Message, instructions string) []Message {
+	result := make([]Message, 0, len(messages)+1)
+	if len(messages) > 0 && messages[0].Role == "system" {
+		system := messages[0]
+		system.Content += "\n\n" + instructions
+		return append(append(result, system), messages[1:]...)
+	}
+	result = append(result, Message{Role: "system", Content: instructions})
+	return append(result, messages...)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jpoz/groq"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/services"
+)
+
+// scriptedProvider returns the outputs in order, or fails with the error in place of an output.
+type scriptedProvider struct {
+	outputs  []interface{}
+	requests []ChatCompletionRequest
+}
+
+func (p *scriptedProvider) Name() string     { return "scripted" }
+func (p *scriptedProvider) Models() []string { return []string{"m"} }
+
+func (p *scriptedProvider) ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletion, error) {
+	p.requests = append(p.requests, request)
+	output := p.outputs[0]
+	p.outputs = p.outputs[1:]
+	if err, ok := output.(error); ok {
+		return nil, err
+	}
+	return &ChatCompletion{
+		Choices: []Choice{{Message: Message{Role: "assistant", Content: output.(string)}}},
+		Usage:   &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+var personFormat = &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchema{
+	Name:   "person",
+	Schema: json.RawMessage(`{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}},"required":["name","age"]}`),
+}}
+
+func structuredRequest(format *ResponseFormat) ChatCompletionRequest {
+	return ChatCompletionRequest{
+		Model:          "scripted/m",
+		Messages:       []Message{{Role: "user", Content: "Who is Ada?"}},
+		ResponseFormat: format,
+	}
+}
+
+func TestStructuredCompletionRepairs(t *testing.T) {
+	provider := &scriptedProvider{outputs: []interface{}{
+		`{"name": "Ada"}`,
+		"```json\n{\"name\": \"Ada\", \"age\": 36}\n```",
+	}}
+	router, err := NewRouter(Config{MaxRepairs: 2}, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completion, err := router.ChatCompletion(context.Background(), structuredRequest(personFormat))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	message := completion.Choices[0].Message
+	if string(message.Parsed) != `{"name":"Ada","age":36}` || !strings.Contains(message.Content, "```json") {
+		t.Errorf("expected the parsed object and the raw text, got %s and %q", message.Parsed, message.Content)
+	}
+	if completion.Usage.TotalTokens != 30 {
+		t.Errorf("expected the usage of both attempts, got %+v", completion.Usage)
+	}
+	if !strings.Contains(provider.requests[0].Messages[0].Content, `"required":["name","age"]`) {
+		t.Errorf("expected the schema in the system prompt, got %+v", provider.requests[0].Messages[0])
+	}
+	repair := provider.requests[1].Messages
+	if last := repair[len(repair)-1]; !strings.Contains(last.Content, "missing properties: 'age'") {
+		t.Errorf("expected the validation errors in the repair prompt, got %q", last.Content)
+	}
+}
+
+func TestStructuredCompletionGivesUp(t *testing.T) {
+	rejected := &services.APIError{StatusCode: http.StatusBadRequest, Err: groq.Error{
+		Type: "invalid_request_error", Message: "Failed to generate JSON", FailedGeneration: "Ada is 36",
+	}}
+	provider := &scriptedProvider{outputs: []interface{}{rejected, "not json"}}
+	router, err := NewRouter(Config{MaxRepairs: 2}, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := structuredRequest(&ResponseFormat{Type: "json_object"})
+	repairs := 1
+	request.MaxRepairs = &repairs
+
+	_, err = router.ChatCompletion(context.Background(), request)
+	var outputErr *StructuredOutputError
+	if !errors.As(err, &outputErr) || outputErr.Attempts != 2 || outputErr.Output != "not json" {
+		t.Fatalf("expected a StructuredOutputError after 2 attempts, got %v", err)
+	}
+	if repair := provider.requests[1].Messages; repair[len(repair)-2].Content != "Ada is 36" {
+		t.Errorf("expected the generation rejected by Groq to be repaired, got %+v", repair)
+	}
+}
+
+func TestValidateResponseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  *ResponseFormat
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "json object", format: &ResponseFormat{Type: "json_object"}},
+		{name: "schema", format: personFormat},
+		{name: "missing schema", format: &ResponseFormat{Type: "json_schema"}, wantErr: true},
+		{name: "invalid schema", format: &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchema{Schema: json.RawMessage(`{"type": 1}`)}}, wantErr: true},
+		{name: "remote reference", format: &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchema{Schema: json.RawMessage(`{"$ref": "file:///etc/passwd"}`)}}, wantErr: true},
+		{name: "unknown type", format: &ResponseFormat{Type: "xml"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateResponseFormat(tc.format)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidResponseFormat) {
+				t.Errorf("expected ErrInvalidResponseFormat, got %v", err)
+			}
+		})
+	}
+}
+
+// fakeSidecar answers g4f chat completions with the responses in order.
+type fakeSidecar struct {
+	services.SidecarClient
+	responses []string
+	requests  []gpt.ChatRequest
+}
+
+func (s *fakeSidecar) PostJSON(ctx context.Context, endpoint string, request, response interface{}, opts ...sidecar.CallOption) error {
+	s.requests = append(s.requests, request.(gpt.ChatRequest))
+	response.(*gpt.ChatResponse).Response = s.responses[0]
+	s.responses = s.responses[1:]
+	return nil
+}
+
+func TestG4FChatRepairs(t *testing.T) {
+	fake := &fakeSidecar{responses: []string{`{"name": "Ada"}`, `{"name": "Ada", "age": 36}`}}
+	router, err := NewRouter(Config{MaxRepairs: 2}, NewG4FProvider(fake))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := NewG4FChat(router)
+	format, _ := json.Marshal(personFormat)
+	request := gpt.ChatRequest{
+		Messages:       []gpt.Message{{Role: "user", Content: "Who is Ada?"}},
+		ResponseFormat: format,
+	}
+	structured, err := chat.Validate(request)
+	if err != nil || !structured {
+		t.Fatalf("Validate() = %v, %v, want a structured request", structured, err)
+	}
+	response, err := chat.ChatCompletion(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(response.Parsed) != `{"name":"Ada","age":36}` || len(fake.requests) != 2 {
+		t.Errorf("expected the repaired object after 2 calls, got %s after %d", response.Parsed, len(fake.requests))
+	}
+	if fake.requests[0].ResponseFormat != nil {
+		t.Errorf("expected the response format to stay out of the FastAPI request")
+	}
+
+	for _, invalid := range []gpt.ChatRequest{
+		{ResponseFormat: json.RawMessage(`{"type": "xml"}`)},
+		{ResponseFormat: format, Stream: true},
+		{ResponseFormat: format, Model: "unknown"},
+	} {
+		if _, err := chat.Validate(invalid); err == nil {
+			t.Errorf("Validate(%+v) accepted an invalid request", invalid)
+		}
+	}
+	if structured, err := chat.Validate(gpt.ChatRequest{ResponseFormat: json.RawMessage(`{"type": "text"}`)}); structured || err != nil {
+		t.Errorf("Validate() = %v, %v for a text response format", structured, err)
+	}
+}
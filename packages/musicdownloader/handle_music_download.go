@@ -20,65 +20,34 @@
 package musicdownloader
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
-	"github.com/kingmariano/omnicron/packages/videodownloader"
+
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
-	"net/http"
-	"time"
 )
 
-func CallSearchYoutubeFastdownloadYoutubeLink(ctx context.Context, request SongRequest, apiKey, fastAPIBaseURL, outputPath, cloudinaryURL string) (string, error) {
-	fastAPISearchYoutubeEndPoint := fmt.Sprintf("%s/api/v1/search_youtube", fastAPIBaseURL) //url to the search_youtube endpoint in the FastAPI server
-	// marshal the request to json format for sending to the server
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return "", err
-	}
-	client := &http.Client{
-		Timeout: time.Second * 300,
-	}
-	req, err := http.NewRequest("POST", fastAPISearchYoutubeEndPoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Api-Key", apiKey)
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	//handle error when status code is not 200
-	if resp.StatusCode != 200 {
-		var errorMessage ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorMessage); err != nil {
-			return "", err
-		}
-		return "", errors.New(errorMessage.Detail)
-	}
+func (h *Handler) CallSearchYoutubeFastdownloadYoutubeLink(ctx context.Context, request SongRequest, outputPath string) (string, error) {
 	var response SongResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := h.sidecar.PostJSON(ctx, sidecar.EndpointSearchYoutube, request, &response); err != nil {
 		return "", err
 	}
 	if response.Response == "" {
 		return "", errors.New("no results found")
 	}
 	// Download all the video in the list
-	videopath, err := videodownloader.DownloadVideoData(response.Response, utils.OutputName, outputPath, "")
+	videopath, err := h.downloader.Download(ctx, response.Response, utils.OutputName, outputPath, services.DownloadOptions{})
 	if err != nil {
 		return "", err
 	}
 	// Convert the downloaded videos to MP3 format
-	audiopath, err := utils.ConvertFileToMP3(videopath)
+	audiopath, err := h.transcoder.ConvertFileToMP3(videopath)
 	if err != nil {
 		return "", err
 	}
 	// Upload the converted audio file to Cloudinary and retrieve direct URLs
-	audioDirectURL, err := utils.HandleFileUpload(ctx, audiopath, cloudinaryURL)
+	audioDirectURL, err := h.storage.Upload(ctx, audiopath)
 	if err != nil {
 		return "", err
 	}
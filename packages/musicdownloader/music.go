@@ -23,11 +23,29 @@ package musicdownloader
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
+// Handler serves the music download endpoint.
+type Handler struct {
+	sidecar    services.SidecarClient
+	downloader services.Downloader
+	transcoder services.Transcoder
+	storage    services.Storage
+}
+
+// NewHandler returns a Handler that finds songs through the FastAPI server, downloads and converts them, and uploads the result to storage.
+func NewHandler(sidecar services.SidecarClient, downloader services.Downloader, transcoder services.Transcoder, storage services.Storage) *Handler {
+	return &Handler{
+		sidecar:    sidecar,
+		downloader: downloader,
+		transcoder: transcoder,
+		storage:    storage,
+	}
+}
+
 type SongRequest struct {
 	Query string `json:"query"`
 	Limit int    `json:"limit,omitempty"`
@@ -36,11 +54,7 @@ type SongResponse struct {
 	Response string `json:"response"`
 }
 
-type ErrorResponse struct {
-	Detail string `json:"detail"`
-}
-
-func DownloadMusic(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+func (h *Handler) DownloadMusic(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	decode := json.NewDecoder(r.Body)
 	params := SongRequest{}
@@ -56,7 +70,7 @@ func DownloadMusic(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig
 		return
 	}
 	//for accurate and precise result maxlength should be set to one.
-	audioDirectURL, err := CallSearchYoutubeFastdownloadYoutubeLink(ctx, params, cfg.APIKey, cfg.FASTAPIBaseURL, folderPath, cfg.CloudinaryURL)
+	audioDirectURL, err := h.CallSearchYoutubeFastdownloadYoutubeLink(ctx, params, folderPath)
 	if err != nil {
 		if cleanupErr := utils.DeleteFolder(folderPath); cleanupErr != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete folder: "+cleanupErr.Error())
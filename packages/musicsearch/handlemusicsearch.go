@@ -20,12 +20,10 @@
 package musicsearch
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"net/http"
-	"time"
+	"context"
+
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
 )
 
 // MusicSearchRequest defines the structure of the request sent to the FastAPI server.
@@ -96,11 +94,6 @@ type MusicSearchResponse struct {
 	} `json:"tracks"`
 }
 
-// ErrorResponse defines the structure for error JSON responses.
-type ErrorResponse struct {
-	Detail string `json:"detail"`
-}
-
 // FilteredResponse is a struct to store the filtered results it contains the SonName,ShazamURL,SongImage gotten from the shazam API
 type FilteredResponse struct {
 	SongName  string `json:"song_name"`
@@ -109,46 +102,9 @@ type FilteredResponse struct {
 }
 
 // CallMusicSearchFastAPI makes a request to the FastAPI server endpoint for music search.
-func CallMusicSearchFastAPI(request MusicSearchRequest, apiKey, FASTAPIBaseURL string) ([]FilteredResponse, error) {
-	fastAPIMusicSearchEndpoint := fmt.Sprintf("%s/api/v1/search-song", FASTAPIBaseURL)
-	// Marshal request data to JSON
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: time.Second * 30,
-	}
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", fastAPIMusicSearchEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Api-Key", apiKey)
-
-	// Send HTTP request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// Check response status code
-	if resp.StatusCode != http.StatusOK {
-		var errorMessage ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorMessage); err != nil {
-			return nil, err
-		}
-		return nil, errors.New(errorMessage.Detail)
-	}
-
-	// Decode JSON response
+func CallMusicSearchFastAPI(ctx context.Context, client services.SidecarClient, request MusicSearchRequest) ([]FilteredResponse, error) {
 	var response MusicSearchResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := client.PostJSON(ctx, sidecar.EndpointSearchSong, request, &response); err != nil {
 		return nil, err
 	}
 
@@ -22,12 +22,23 @@ package musicsearch
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func MusicSearch(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the music search endpoint.
+type Handler struct {
+	sidecar services.SidecarClient
+}
+
+// NewHandler returns a Handler that forwards search requests to the FastAPI server.
+func NewHandler(sidecar services.SidecarClient) *Handler {
+	return &Handler{sidecar: sidecar}
+}
+
+func (h *Handler) MusicSearch(w http.ResponseWriter, r *http.Request) {
 	decode := json.NewDecoder(r.Body)
 	musicSearchParams := MusicSearchRequest{}
 	err := decode.Decode(&musicSearchParams)
@@ -35,9 +46,9 @@ func MusicSearch(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig)
 		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unmarshalling json, %v", err))
 		return
 	}
-	response, err := CallMusicSearchFastAPI(musicSearchParams, cfg.APIKey, cfg.FASTAPIBaseURL)
+	response, err := CallMusicSearchFastAPI(r.Context(), h.sidecar, musicSearchParams)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		utils.RespondWithError(w, sidecar.HTTPStatus(err), err.Error())
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusOK, response)
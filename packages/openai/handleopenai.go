@@ -0,0 +1,110 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// errorResponse is OpenAI's error body, which the SDKs parse into their error types.
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// respondWithError writes an error in OpenAI's format.
+func respondWithError(w http.ResponseWriter, code int, message, errCode string) {
+	errType := "invalid_request_error"
+	if code >= 500 {
+		errType = "api_error"
+		log.Printf("Responding with 5XX error: %s", message)
+	}
+	detail := errorDetail{Message: message, Type: errType}
+	if errCode != "" {
+		detail.Code = &errCode
+	}
+	utils.RespondWithJSON(w, code, errorResponse{Error: detail})
+}
+
+// respondWithProviderError maps an error returned by a provider to an OpenAI error.
+func respondWithProviderError(w http.ResponseWriter, err error) {
+	var sidecarErr *sidecar.Error
+	switch {
+	case errors.Is(err, llm.ErrUnknownModel):
+		respondWithError(w, http.StatusNotFound, err.Error(), "model_not_found")
+	case errors.Is(err, llm.ErrToolsUnsupported), errors.Is(err, llm.ErrInvalidResponseFormat):
+		respondWithError(w, http.StatusBadRequest, err.Error(), "")
+	case errors.As(err, new(*llm.StructuredOutputError)):
+		respondWithError(w, http.StatusBadGateway, err.Error(), "invalid_structured_output")
+	case errors.As(err, &sidecarErr), errors.Is(err, sidecar.ErrCircuitOpen):
+		respondWithError(w, sidecar.HTTPStatus(err), err.Error(), "")
+	default:
+		respondWithError(w, http.StatusBadGateway, fmt.Sprintf("Error handling chat completion, %v", err), "")
+	}
+}
+
+func validateRequest(request llm.ChatCompletionRequest) error {
+	if request.Model == "" {
+		return errors.New("model is required")
+	}
+	if len(request.Messages) == 0 {
+		return errors.New("messages must contain at least one message")
+	}
+	for _, m := range request.Messages {
+		switch m.Role {
+		case "system", "user", "assistant":
+		case "tool":
+			if m.ToolCallID == "" {
+				return errors.New("tool messages require tool_call_id")
+			}
+		default:
+			return fmt.Errorf("unsupported message role %q", m.Role)
+		}
+	}
+	if err := llm.ValidateResponseFormat(request.ResponseFormat); err != nil {
+		return err
+	}
+	if request.Stream && request.ResponseFormat != nil && request.ResponseFormat.Type != "text" {
+		return errors.New("JSON response formats are validated and can't be streamed")
+	}
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			return fmt.Errorf("unsupported tool type %q", tool.Type)
+		}
+		if tool.Function.Name == "" {
+			return errors.New("tool functions require a name")
+		}
+	}
+	return nil
+}
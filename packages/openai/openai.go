@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package openai serves an OpenAI-compatible chat completions API on top of the llm providers,
+// so existing OpenAI SDKs and tools can use Omnicron by changing their base URL.
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// servedModelHeader reports the prefixed model that served a completion, which differs from the
+// requested model when an alias was requested.
+const servedModelHeader = "X-Omnicron-Model"
+
+// Handler serves the /v1 endpoints.
+type Handler struct {
+	router *llm.Router
+}
+
+// NewHandler returns a Handler dispatching completions with router.
+func NewHandler(router *llm.Router) *Handler {
+	return &Handler{router: router}
+}
+
+// ChatCompletions handles POST /v1/chat/completions.
+func (h *Handler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request llm.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err), "")
+		return
+	}
+	if err := validateRequest(request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if request.Stream {
+		stream, err := h.router.ChatCompletionStream(r.Context(), request)
+		if err != nil {
+			respondWithProviderError(w, err)
+			return
+		}
+		defer stream.Close()
+		if served, ok := stream.(interface{ Model() string }); ok {
+			w.Header().Set(servedModelHeader, served.Model())
+		}
+		llm.WriteStream(w, r, stream, request.StreamOptions != nil && request.StreamOptions.IncludeUsage)
+		return
+	}
+	completion, err := h.router.ChatCompletion(r.Context(), request)
+	if err != nil {
+		respondWithProviderError(w, err)
+		return
+	}
+	w.Header().Set(servedModelHeader, completion.Model)
+	utils.RespondWithJSON(w, http.StatusOK, completion)
+}
+
+// Models handles GET /v1/models.
+func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, llm.ModelList{Object: "list", Data: h.router.Models()})
+}
+
+// Health handles GET /v1/providers/health, reporting the recent error rate and latency of every provider.
+func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.router.Health())
+}
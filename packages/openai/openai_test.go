@@ -0,0 +1,143 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+// fakeProvider answers every request with the content of the last message.
+type fakeProvider struct {
+	request llm.ChatCompletionRequest
+}
+
+func (p *fakeProvider) Name() string     { return "fake" }
+func (p *fakeProvider) Models() []string { return []string{"echo/v1"} }
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, request llm.ChatCompletionRequest) (*llm.ChatCompletion, error) {
+	p.request = request
+	return &llm.ChatCompletion{
+		ID:     "chatcmpl-1",
+		Object: "chat.completion",
+		Model:  request.Model,
+		Choices: []llm.Choice{{
+			Message:      llm.Message{Role: "assistant", Content: request.Messages[len(request.Messages)-1].Content},
+			FinishReason: "stop",
+		}},
+		Usage: &llm.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2},
+	}, nil
+}
+
+func newRouter(t *testing.T, providers ...llm.Provider) *llm.Router {
+	router, err := llm.NewRouter(llm.Config{}, providers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+func TestChatCompletions(t *testing.T) {
+	provider := &fakeProvider{}
+	handler := NewHandler(newRouter(t, provider))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   []string
+	}{
+		{
+			name:       "stream",
+			body:       `{"model": "fake/echo/v1", "messages": [{"role": "user", "content": "hi"}], "stream": true, "stream_options": {"include_usage": true}}`,
+			wantStatus: http.StatusOK,
+			wantBody: []string{
+				`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":0,"model":"fake/echo/v1","choices":[{"index":0,"delta":{"role":"assistant"},"finish_reason":null}]}`,
+				`"delta":{"content":"hi"},"finish_reason":null`,
+				`"delta":{},"finish_reason":"stop"`,
+				`"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}`,
+				"data: [DONE]\n\n",
+			},
+		},
+		{
+			name:       "completion",
+			body:       `{"model": "fake/echo/v1", "messages": [{"role": "user", "content": [{"type": "text", "text": "hi"}]}], "stop": "\n"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"model":"fake/echo/v1"`, `"content":"hi"`, `"finish_reason":"stop"`, `"total_tokens":2`},
+		},
+		{
+			name:       "unknown model",
+			body:       `{"model": "groq/llama3-70b-8192", "messages": [{"role": "user", "content": "hi"}]}`,
+			wantStatus: http.StatusNotFound,
+			wantBody:   []string{`"code":"model_not_found"`},
+		},
+		{
+			name:       "tools unsupported",
+			body:       `{"model": "fake/echo/v1", "messages": [{"role": "user", "content": "hi"}], "tools": [{"type": "function", "function": {"name": "lookup"}}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   []string{`does not support tools`},
+		},
+		{
+			name:       "no messages",
+			body:       `{"model": "fake/echo/v1", "messages": []}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   []string{`"type":"invalid_request_error"`},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			handler.ChatCompletions(rr, req)
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rr.Code, tc.wantStatus, rr.Body.String())
+			}
+			for _, want := range tc.wantBody {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("body %s does not contain %s", rr.Body.String(), want)
+				}
+			}
+		})
+	}
+	if provider.request.Model != "echo/v1" || len(provider.request.Stop) != 1 {
+		t.Errorf("provider got model %q and stop %q, want the unprefixed model and one stop sequence", provider.request.Model, provider.request.Stop)
+	}
+}
+
+func TestModels(t *testing.T) {
+	handler := NewHandler(newRouter(t, &fakeProvider{}))
+	rr := httptest.NewRecorder()
+	handler.Models(rr, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+
+	var list llm.ModelList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Object != "list" || len(list.Data) != 1 || list.Data[0].ID != "fake/echo/v1" || list.Data[0].OwnedBy != "fake" {
+		t.Errorf("unexpected model list %+v", list)
+	}
+}
@@ -24,22 +24,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	replicate "github.com/replicate/replicate-go"
 	"net/http"
 )
 
-func processImageModelInput(imageModel *rep.ReplicateModel, ctx context.Context, r *http.Request, modelIndex int, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processImageModelInput(imageModel *rep.ReplicateModel, ctx context.Context, r *http.Request, modelIndex int, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	if imageModel.Category == "Low" {
-		replicateInput, err := processLowImageGenerationInput(ctx, r, modelIndex, cfg)
+		replicateInput, err := processLowImageGenerationInput(ctx, r, modelIndex, predictions)
 		if err != nil {
 			return nil, err
 		}
 		return replicateInput, nil
 	} else if imageModel.Category == "High" {
-		replicateInput, err := processHighImageGenerationInput(ctx, r, modelIndex, cfg)
+		replicateInput, err := processHighImageGenerationInput(ctx, r, modelIndex, predictions)
 		if err != nil {
 			return nil, err
 		}
@@ -49,7 +49,7 @@ func processImageModelInput(imageModel *rep.ReplicateModel, ctx context.Context,
 }
 
 // doesnt support image to image generation
-func processLowImageGenerationInput(_ context.Context, r *http.Request, modelIndex int, _ *config.APIConfig) (replicate.PredictionInput, error) {
+func processLowImageGenerationInput(_ context.Context, r *http.Request, modelIndex int, _ services.PredictionProvider) (replicate.PredictionInput, error) {
 	var lowImageGenerationParams rep.LowImageGenerationParams
 	decoder := json.NewDecoder(r.Body)
 	switch modelIndex {
@@ -64,7 +64,11 @@ func processLowImageGenerationInput(_ context.Context, r *http.Request, modelInd
 	if err != nil {
 		return nil, err
 	}
-	input := replicate.PredictionInput{
+	return lowImageGenerationInput(params), nil
+}
+
+func lowImageGenerationInput(params rep.LowImageGenerationParams) replicate.PredictionInput {
+	return replicate.PredictionInput{
 		"prompt":              params.Prompt,
 		"negative_prompt":     params.NegativePrompt,
 		"width":               params.Width,
@@ -74,12 +78,29 @@ func processLowImageGenerationInput(_ context.Context, r *http.Request, modelInd
 		"guidance_scale":      params.GuidanceScale,
 		"num_inference_steps": params.NumInferenceSteps,
 	}
+}
 
-	return input, nil
+// defaultImageModel generates the images of callers that only have a prompt, such as the agent tools.
+const defaultImageModel = "bytedance/sdxl-lightning-4step"
+
+// GenerateImage generates an image of prompt with the default parameters of the default model
+// and returns the output of the prediction, a list of image URLs.
+func (h *Handler) GenerateImage(ctx context.Context, prompt string) (replicate.PredictionOutput, error) {
+	model, err := rep.GetModelByName(defaultImageModel, rep.ImageModels)
+	if err != nil {
+		return nil, err
+	}
+	params := rep.LowImageGenerationParams{}.NewSdxlLightning4StepImageGenerationInput()
+	params.Prompt = prompt
+	prediction, err := h.predictions.CreatePrediction(ctx, model.Version, lowImageGenerationInput(params), nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return prediction.Output, nil
 }
 
 // support imagetoimage generation
-func processHighImageGenerationInput(ctx context.Context, r *http.Request, modelIndex int, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processHighImageGenerationInput(ctx context.Context, r *http.Request, modelIndex int, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	var HighImageGenerationParams rep.HighImageGenerationParams
 	err := r.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
@@ -118,7 +139,7 @@ func processHighImageGenerationInput(ctx context.Context, r *http.Request, model
 	// Handle image file
 	imageFile, imageFileHeader, err := r.FormFile("image")
 	if err == nil {
-		repFile, err := rep.RequestFileToReplicateFile(ctx, imageFileHeader, cfg.ReplicateAPIKey)
+		repFile, err := predictions.UploadFile(ctx, imageFileHeader)
 		if err != nil {
 			return nil, err
 		}
@@ -131,7 +152,7 @@ func processHighImageGenerationInput(ctx context.Context, r *http.Request, model
 	// Handle mask file
 	maskFile, maskFileHeader, err := r.FormFile("mask")
 	if err == nil {
-		repFile, err := rep.RequestFileToReplicateFile(ctx, maskFileHeader, cfg.ReplicateAPIKey)
+		repFile, err := predictions.UploadFile(ctx, maskFileHeader)
 		if err != nil {
 			return nil, err
 		}
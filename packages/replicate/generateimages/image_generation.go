@@ -20,13 +20,23 @@
 package generateimages
 
 import (
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func ImageGeneration(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the image generation endpoint.
+type Handler struct {
+	predictions services.PredictionProvider
+}
+
+// NewHandler returns a Handler that runs image generation predictions with predictions.
+func NewHandler(predictions services.PredictionProvider) *Handler {
+	return &Handler{predictions: predictions}
+}
+
+func (h *Handler) ImageGeneration(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	model := r.URL.Query().Get("model")
 	if model == "" {
@@ -39,21 +49,16 @@ func ImageGeneration(w http.ResponseWriter, r *http.Request, cfg *config.APIConf
 		return
 	}
 
-	predictionFunc, ok := rep.ImageGenModels[*repImageModel]
-	if !ok {
-		utils.RespondWithError(w, http.StatusNotFound, "model not found")
-		return
-	}
 	modelIndx := rep.GetModelIndex(model, rep.ImageModels)
 
-	predictionInput, err := processImageModelInput(repImageModel, ctx, r, modelIndx, cfg)
+	predictionInput, err := processImageModelInput(repImageModel, ctx, r, modelIndx, h.predictions)
 
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	ImagePrediction, err := predictionFunc(ctx, cfg.ReplicateAPIKey, repImageModel.Version, predictionInput, nil, false)
+	ImagePrediction, err := h.predictions.CreatePrediction(ctx, repImageModel.Version, predictionInput, nil, false)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
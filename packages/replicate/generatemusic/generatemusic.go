@@ -20,13 +20,23 @@
 package generatemusic
 
 import (
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func MusicGen(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the music generation endpoint.
+type Handler struct {
+	predictions services.PredictionProvider
+}
+
+// NewHandler returns a Handler that runs music generation predictions with predictions.
+func NewHandler(predictions services.PredictionProvider) *Handler {
+	return &Handler{predictions: predictions}
+}
+
+func (h *Handler) MusicGen(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	model := r.URL.Query().Get("model")
 	if model == "" {
@@ -38,17 +48,12 @@ func MusicGen(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
 		utils.RespondWithError(w, http.StatusNotFound, "model not found")
 		return
 	}
-	predictionFunc, ok := rep.MusicGenModels[*repMusicModel]
-	if !ok {
-		utils.RespondWithError(w, http.StatusNotFound, "model not found")
-		return
-	}
-	predictionInput, err := processMusicModelInput(repMusicModel, ctx, r, cfg)
+	predictionInput, err := processMusicModelInput(repMusicModel, ctx, r, h.predictions)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	MusicGenPrediction, err := predictionFunc(ctx, cfg.ReplicateAPIKey, repMusicModel.Version, predictionInput, nil, false)
+	MusicGenPrediction, err := h.predictions.CreatePrediction(ctx, repMusicModel.Version, predictionInput, nil, false)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -23,23 +23,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	replicate "github.com/replicate/replicate-go"
 	"log"
 	"net/http"
 )
 
-func processMusicModelInput(MusicModel *rep.ReplicateModel, ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processMusicModelInput(MusicModel *rep.ReplicateModel, ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	if MusicModel.Category == "Low" {
-		replicateInput, err := processLowMusicGenInput(ctx, r, cfg)
+		replicateInput, err := processLowMusicGenInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
 		return replicateInput, nil
 	} else if MusicModel.Category == "High" {
-		replicateInput, err := processHighMusicGenInput(ctx, r, cfg)
+		replicateInput, err := processHighMusicGenInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
@@ -48,7 +48,7 @@ func processMusicModelInput(MusicModel *rep.ReplicateModel, ctx context.Context,
 	return nil, errors.New("music model category unavailable")
 }
 
-func processLowMusicGenInput(_ context.Context, r *http.Request, _ *config.APIConfig) (replicate.PredictionInput, error) {
+func processLowMusicGenInput(_ context.Context, r *http.Request, _ services.PredictionProvider) (replicate.PredictionInput, error) {
 	log.Println("This is low music model generation")
 	var LowMusicGenerationModelsParams rep.LowMusicGenerationParams
 	decoder := json.NewDecoder(r.Body)
@@ -72,7 +72,7 @@ func processLowMusicGenInput(_ context.Context, r *http.Request, _ *config.APICo
 	return input, nil
 
 }
-func processHighMusicGenInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processHighMusicGenInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	log.Println("This is high music model generation")
 	var HighMusicGenerationParams rep.HighMusicGenerationParams
 	prompt := r.FormValue("prompt")
@@ -95,7 +95,7 @@ func processHighMusicGenInput(ctx context.Context, r *http.Request, cfg *config.
 	utils.SetStringValue(r.FormValue("output_format"), &HighMusicGenerationParams.OutputFormat)
 	inputAudioFile, inputAudioFileHeader, err := r.FormFile("input_audio")
 	if err == nil {
-		repFile, err := rep.RequestFileToReplicateFile(ctx, inputAudioFileHeader, cfg.ReplicateAPIKey)
+		repFile, err := predictions.UploadFile(ctx, inputAudioFileHeader)
 		if err != nil {
 			return nil, err
 		}
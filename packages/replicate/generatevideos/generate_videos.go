@@ -20,13 +20,23 @@
 package generatevideos
 
 import (
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func VideoGeneration(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the video generation endpoint.
+type Handler struct {
+	predictions services.PredictionProvider
+}
+
+// NewHandler returns a Handler that runs video generation predictions with predictions.
+func NewHandler(predictions services.PredictionProvider) *Handler {
+	return &Handler{predictions: predictions}
+}
+
+func (h *Handler) VideoGeneration(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	model := r.URL.Query().Get("model")
 	if model == "" {
@@ -38,17 +48,12 @@ func VideoGeneration(w http.ResponseWriter, r *http.Request, cfg *config.APIConf
 		utils.RespondWithError(w, http.StatusNotFound, "model not found")
 		return
 	}
-	predictionFunc, ok := rep.VideoGenModels[*repVideoModel]
-	if !ok {
-		utils.RespondWithError(w, http.StatusNotFound, "model not found")
-		return
-	}
-	predictionInput, err := processVideoModelInput(repVideoModel, ctx, r, cfg)
+	predictionInput, err := processVideoModelInput(repVideoModel, ctx, r, h.predictions)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	videoGenPrediction, err := predictionFunc(ctx, cfg.ReplicateAPIKey, repVideoModel.Version, predictionInput, nil, false)
+	videoGenPrediction, err := h.predictions.CreatePrediction(ctx, repVideoModel.Version, predictionInput, nil, false)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -23,16 +23,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	replicate "github.com/replicate/replicate-go"
 	"net/http"
 )
 
-func processVideoModelInput(imageModel *rep.ReplicateModel, ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processVideoModelInput(imageModel *rep.ReplicateModel, ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	if imageModel.Category == "High" {
-		replicateInput, err := processHighVideoInput(ctx, r, cfg)
+		replicateInput, err := processHighVideoInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
@@ -41,7 +41,7 @@ func processVideoModelInput(imageModel *rep.ReplicateModel, ctx context.Context,
 	return nil, errors.New("image category unavailable")
 }
 
-func processHighVideoInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processHighVideoInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	var HighVideoGenerationParams rep.HighVideoGenerationParams
 	err := r.ParseMultipartForm(50 << 20) // 50MB
 	if err != nil {
@@ -69,7 +69,7 @@ func processHighVideoInput(ctx context.Context, r *http.Request, cfg *config.API
 	// Handle initial video file
 	videoFile, videoFileHeader, err := r.FormFile("init_video")
 	if err == nil {
-		repFile, err := rep.RequestFileToReplicateFile(ctx, videoFileHeader, cfg.ReplicateAPIKey)
+		repFile, err := predictions.UploadFile(ctx, videoFileHeader)
 		if err != nil {
 			return nil, err
 		}
@@ -23,23 +23,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	replicate "github.com/replicate/replicate-go"
 	"log"
 	"net/http"
 )
 
-func processImageUpscaleModelInput(imageModel *rep.ReplicateModel, ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processImageUpscaleModelInput(imageModel *rep.ReplicateModel, ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	if imageModel.Category == "High" {
-		replicateInput, err := processHighUpscalingInput(ctx, r, cfg)
+		replicateInput, err := processHighUpscalingInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
 		return replicateInput, nil
 	} else if imageModel.Category == "Low" {
-		replicateInput, err := processLowUpscalingInput(ctx, r, cfg)
+		replicateInput, err := processLowUpscalingInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
@@ -47,7 +47,7 @@ func processImageUpscaleModelInput(imageModel *rep.ReplicateModel, ctx context.C
 	}
 	return nil, errors.New("image category unavailable")
 }
-func processLowUpscalingInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processLowUpscalingInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	log.Println("This is  low upscaling")
 	var LowImageUpscaleGenerationParams rep.LowImageUpscaleGenerationParams
 	err := r.ParseMultipartForm(10 << 20) // 10MB
@@ -60,7 +60,7 @@ func processLowUpscalingInput(ctx context.Context, r *http.Request, cfg *config.
 	if err != nil {
 		return nil, fmt.Errorf("provide image file: %v", err)
 	}
-	repFile, err := rep.RequestFileToReplicateFile(ctx, imageFileHeader, cfg.ReplicateAPIKey)
+	repFile, err := predictions.UploadFile(ctx, imageFileHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +75,7 @@ func processLowUpscalingInput(ctx context.Context, r *http.Request, cfg *config.
 	return input, nil
 }
 
-func processHighUpscalingInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processHighUpscalingInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	log.Println("This is  high upscaling")
 	var HighImageUpscaleGenerationParams rep.HighImageUpscaleGenerationParams
 	err := r.ParseMultipartForm(10 << 20) // 10MB
@@ -89,7 +89,7 @@ func processHighUpscalingInput(ctx context.Context, r *http.Request, cfg *config
 	if err != nil {
 		return nil, fmt.Errorf("provide image file: %v", err)
 	}
-	repFile, err := rep.RequestFileToReplicateFile(ctx, imageFileHeader, cfg.ReplicateAPIKey)
+	repFile, err := predictions.UploadFile(ctx, imageFileHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -20,13 +20,23 @@
 package imageupscale
 
 import (
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func ImageUpscale(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the image upscale endpoint.
+type Handler struct {
+	predictions services.PredictionProvider
+}
+
+// NewHandler returns a Handler that runs image upscale predictions with predictions.
+func NewHandler(predictions services.PredictionProvider) *Handler {
+	return &Handler{predictions: predictions}
+}
+
+func (h *Handler) ImageUpscale(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	model := r.URL.Query().Get("model")
 	if model == "" {
@@ -38,17 +48,12 @@ func ImageUpscale(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig)
 		utils.RespondWithError(w, http.StatusNotFound, "model not found")
 		return
 	}
-	predictionFunc, ok := rep.ImageUpscaleGenModels[*repImageUpscaleModel]
-	if !ok {
-		utils.RespondWithError(w, http.StatusNotFound, "model not found")
-		return
-	}
-	predictionInput, err := processImageUpscaleModelInput(repImageUpscaleModel, ctx, r, cfg)
+	predictionInput, err := processImageUpscaleModelInput(repImageUpscaleModel, ctx, r, h.predictions)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	ImageUpscalePrediction, err := predictionFunc(ctx, cfg.ReplicateAPIKey, repImageUpscaleModel.Version, predictionInput, nil, false)
+	ImageUpscalePrediction, err := h.predictions.CreatePrediction(ctx, repImageUpscaleModel.Version, predictionInput, nil, false)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -23,22 +23,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"github.com/replicate/replicate-go"
 	"net/http"
 )
 
-func processSTTModelInput(STTModel *rep.ReplicateModel, ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processSTTModelInput(STTModel *rep.ReplicateModel, ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	if STTModel.Category == "Low" {
-		replicateInput, err := processLowSTTInput(ctx, r, cfg)
+		replicateInput, err := processLowSTTInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
 		return replicateInput, nil
 	} else if STTModel.Category == "High" {
-		replicateInput, err := processHighSTTInput(ctx, r, cfg)
+		replicateInput, err := processHighSTTInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
@@ -48,7 +48,7 @@ func processSTTModelInput(STTModel *rep.ReplicateModel, ctx context.Context, r *
 
 }
 
-func processLowSTTInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processLowSTTInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	var LowSTTParams rep.LowSTTParams
 	err := r.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
@@ -59,7 +59,7 @@ func processLowSTTInput(ctx context.Context, r *http.Request, cfg *config.APICon
 	if err != nil {
 		return nil, fmt.Errorf("provide audio file: %v", err)
 	}
-	repFile, err := rep.RequestFileToReplicateFile(ctx, audioFileHeader, cfg.ReplicateAPIKey)
+	repFile, err := predictions.UploadFile(ctx, audioFileHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +87,7 @@ func processLowSTTInput(ctx context.Context, r *http.Request, cfg *config.APICon
 	return input, nil
 
 }
-func processHighSTTInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processHighSTTInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	var HighSTTParams rep.HighSTTParams
 	err := r.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
@@ -96,7 +96,7 @@ func processHighSTTInput(ctx context.Context, r *http.Request, cfg *config.APICo
 	HighSTTParams = rep.HighSTTParams{}.InsanelyFastWhisperWithVideo()
 	audioFile, audioFileHeader, err := r.FormFile("audio")
 	if err == nil {
-		repFile, err := rep.RequestFileToReplicateFile(ctx, audioFileHeader, cfg.ReplicateAPIKey)
+		repFile, err := predictions.UploadFile(ctx, audioFileHeader)
 		if err != nil {
 			return nil, err
 		}
@@ -20,13 +20,23 @@
 package stt
 
 import (
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func STT(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the speech to text endpoint.
+type Handler struct {
+	predictions services.PredictionProvider
+}
+
+// NewHandler returns a Handler that runs speech to text predictions with predictions.
+func NewHandler(predictions services.PredictionProvider) *Handler {
+	return &Handler{predictions: predictions}
+}
+
+func (h *Handler) STT(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	model := r.URL.Query().Get("model")
 	if model == "" {
@@ -38,17 +48,12 @@ func STT(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
 		utils.RespondWithError(w, http.StatusNotFound, "model not found")
 		return
 	}
-	predictionFunc, ok := rep.STTGenModels[*repSTTModel]
-	if !ok {
-		utils.RespondWithError(w, http.StatusNotFound, "model not found")
-		return
-	}
-	predictionInput, err := processSTTModelInput(repSTTModel, ctx, r, cfg)
+	predictionInput, err := processSTTModelInput(repSTTModel, ctx, r, h.predictions)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	STTPrediction, err := predictionFunc(ctx, cfg.ReplicateAPIKey, repSTTModel.Version, predictionInput, nil, false)
+	STTPrediction, err := h.predictions.CreatePrediction(ctx, repSTTModel.Version, predictionInput, nil, false)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -23,29 +23,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	replicate "github.com/replicate/replicate-go"
 	"log"
 	"net/http"
 )
 
-func processTTSModelInput(TTSModel *rep.ReplicateModel, ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processTTSModelInput(TTSModel *rep.ReplicateModel, ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	if TTSModel.Category == "Low" {
-		replicateInput, err := processLowTTSInput(ctx, r, cfg)
+		replicateInput, err := processLowTTSInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
 		return replicateInput, nil
 	} else if TTSModel.Category == "Medium" {
-		replicateInput, err := processMediumTTSInput(ctx, r, cfg)
+		replicateInput, err := processMediumTTSInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
 		return replicateInput, nil
 	} else if TTSModel.Category == "High" {
-		replicateInput, err := processHighTTSInput(ctx, r, cfg)
+		replicateInput, err := processHighTTSInput(ctx, r, predictions)
 		if err != nil {
 			return nil, err
 		}
@@ -54,7 +54,7 @@ func processTTSModelInput(TTSModel *rep.ReplicateModel, ctx context.Context, r *
 	return nil, errors.New("tts category unavailable")
 }
 
-func processLowTTSInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processLowTTSInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	var LowTTSParams rep.LowTTSParams
 	err := r.ParseMultipartForm(10 << 20) // 10MB
 	if err != nil {
@@ -65,7 +65,7 @@ func processLowTTSInput(ctx context.Context, r *http.Request, cfg *config.APICon
 	if err != nil {
 		return nil, fmt.Errorf("provide audio file: %v", err)
 	}
-	repFile, err := rep.RequestFileToReplicateFile(ctx, audioFileHeader, cfg.ReplicateAPIKey)
+	repFile, err := predictions.UploadFile(ctx, audioFileHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +86,7 @@ func processLowTTSInput(ctx context.Context, r *http.Request, cfg *config.APICon
 	return input, nil
 }
 
-func processMediumTTSInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processMediumTTSInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	log.Println("This is  medium TTS")
 	var MediumTTSParams rep.MediumTTSParams
 	err := r.ParseMultipartForm(50 << 20) // 50MB
@@ -98,7 +98,7 @@ func processMediumTTSInput(ctx context.Context, r *http.Request, cfg *config.API
 	if err != nil {
 		return nil, fmt.Errorf("provide song_input file: %v", err)
 	}
-	repFile, err := rep.RequestFileToReplicateFile(ctx, audioFileHeader, cfg.ReplicateAPIKey)
+	repFile, err := predictions.UploadFile(ctx, audioFileHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +152,7 @@ func processMediumTTSInput(ctx context.Context, r *http.Request, cfg *config.API
 	}
 	return input, nil
 }
-func processHighTTSInput(ctx context.Context, r *http.Request, cfg *config.APIConfig) (replicate.PredictionInput, error) {
+func processHighTTSInput(ctx context.Context, r *http.Request, predictions services.PredictionProvider) (replicate.PredictionInput, error) {
 	var HighTTSParams rep.HighTTSParams
 	err := r.ParseMultipartForm(50 << 20) // 50MB
 	if err != nil {
@@ -163,7 +163,7 @@ func processHighTTSInput(ctx context.Context, r *http.Request, cfg *config.APICo
 	if err != nil {
 		return nil, fmt.Errorf("provide audio file: %v", err)
 	}
-	repFile, err := rep.RequestFileToReplicateFile(ctx, audioFileHeader, cfg.ReplicateAPIKey)
+	repFile, err := predictions.UploadFile(ctx, audioFileHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -20,13 +20,23 @@
 package tts
 
 import (
-	"github.com/kingmariano/omnicron/config"
 	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
-func TTS(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+// Handler serves the text to speech endpoint.
+type Handler struct {
+	predictions services.PredictionProvider
+}
+
+// NewHandler returns a Handler that runs text to speech predictions with predictions.
+func NewHandler(predictions services.PredictionProvider) *Handler {
+	return &Handler{predictions: predictions}
+}
+
+func (h *Handler) TTS(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	model := r.URL.Query().Get("model")
 	if model == "" {
@@ -38,17 +48,12 @@ func TTS(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
 		utils.RespondWithError(w, http.StatusNotFound, "model not found")
 		return
 	}
-	predictionFunc, ok := rep.TTSGenModels[*repTTSModel]
-	if !ok {
-		utils.RespondWithError(w, http.StatusNotFound, "model not found")
-		return
-	}
-	predictionInput, err := processTTSModelInput(repTTSModel, ctx, r, cfg)
+	predictionInput, err := processTTSModelInput(repTTSModel, ctx, r, h.predictions)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	TTSPrediction, err := predictionFunc(ctx, cfg.ReplicateAPIKey, repTTSModel.Version, predictionInput, nil, false)
+	TTSPrediction, err := h.predictions.CreatePrediction(ctx, repTTSModel.Version, predictionInput, nil, false)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -20,14 +20,11 @@
 package shazam
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
+	"context"
 	"mime/multipart"
-	"net/http"
-	"time"
+
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/kingmariano/omnicron/services"
 )
 
 // ShazamResponse defines the structure of the JSON response from the FastAPI server.
@@ -133,10 +130,6 @@ type ShazamResponse struct {
 	Tagid string `json:"tagid"`
 }
 
-type ErrorResponse struct {
-	Detail string `json:"detail"`
-}
-
 // FilteredResponse is a struct to store the filtered results it contains the SonName,ShazamURL,SongImage gotten from the shazam API
 type FilteredResponse struct {
 	SongName  string `json:"song_name"`
@@ -145,50 +138,9 @@ type FilteredResponse struct {
 }
 
 // Calls the "/shazam" endpoint from the fastAPI server
-func CallShazamFastAPI(file multipart.File, fileHeader *multipart.FileHeader, apiKey, fastAPIBaseURL string) (*FilteredResponse, error) {
-	fastAPIShazamEndpoint := fmt.Sprintf("%s/api/v1/shazam", fastAPIBaseURL) //url to the shazam endpoint in the python server
-	// Create a buffer to write our form data to
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-	// Create a form file field
-	fw, err := w.CreateFormFile("file", fileHeader.Filename)
-	if err != nil {
-		return nil, err
-	}
-	// Copy the file into the form field
-	if _, err = io.Copy(fw, file); err != nil {
-		return nil, err
-	}
-	// Close the multipart writer to set the terminating boundary
-	if err := w.Close(); err != nil {
-		return nil, err
-	}
-	//create the http client
-	client := &http.Client{
-		Timeout: time.Second * 300,
-	}
-
-	req, err := http.NewRequest("POST", fastAPIShazamEndpoint, &b)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Api-Key", apiKey)
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		//handle error when status code is not 200
-		var errorMessage ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorMessage); err != nil {
-			return nil, err
-		}
-		return nil, errors.New(errorMessage.Detail)
-	}
+func CallShazamFastAPI(ctx context.Context, client services.SidecarClient, file multipart.File, fileHeader *multipart.FileHeader) (*FilteredResponse, error) {
 	var response ShazamResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := client.PostFile(ctx, sidecar.EndpointShazam, file, fileHeader.Filename, &response); err != nil {
 		return nil, err
 	}
 	res := response
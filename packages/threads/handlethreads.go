@@ -0,0 +1,328 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package threads
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+const (
+	// summaryModel condenses the messages that no longer fit a thread's context window.
+	summaryModel = "fast"
+	// summaryTokens is kept free in the context window for the summary of older messages.
+	summaryTokens = 512
+	// titleLength is the number of characters of the first message used as the title of an untitled thread.
+	titleLength = 60
+)
+
+var (
+	errMessageTooLong = errors.New("message is too long for the context window of the model")
+	errStore          = errors.New("failed to save thread")
+)
+
+func threadsPath(owner string) []string {
+	return []string{"threads", owner}
+}
+
+func messagesPath(owner, threadID string) []string {
+	return []string{"thread_messages", owner, threadID}
+}
+
+func newThreadID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "thread_" + hex.EncodeToString(b)
+}
+
+// decodeParams decodes the JSON body of r into params. An empty body leaves params unchanged.
+func decodeParams(r *http.Request, params *ThreadParams) error {
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyParams copies the fields set in params to thread.
+func (h *Handler) applyParams(thread *Thread, params ThreadParams) error {
+	if params.Model != nil {
+		if err := h.router.Validate(*params.Model); err != nil {
+			return err
+		}
+		thread.Model = *params.Model
+	}
+	if params.Title != nil {
+		thread.Title = *params.Title
+	}
+	if params.SystemPrompt != nil {
+		thread.SystemPrompt = *params.SystemPrompt
+	}
+	return nil
+}
+
+// threadLock is the lock of a thread and the number of requests holding or waiting for it.
+type threadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock serializes the changes to a thread, so concurrent messages don't interleave its history.
+// The lock of a thread is dropped once no request holds or waits for it.
+func (h *Handler) lock(owner, threadID string) func() {
+	key := owner + "/" + threadID
+	h.locksMu.Lock()
+	l, ok := h.locks[key]
+	if !ok {
+		l = &threadLock{}
+		h.locks[key] = l
+	}
+	l.refs++
+	h.locksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		h.locksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(h.locks, key)
+		}
+		h.locksMu.Unlock()
+	}
+}
+
+func (h *Handler) loadThread(owner, threadID string) (*Thread, error) {
+	var thread Thread
+	if err := h.store.Get(threadsPath(owner), threadID, &thread); err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+func (h *Handler) listThreads(owner string) ([]Thread, error) {
+	threads := []Thread{}
+	err := h.store.List(threadsPath(owner), func(_ string, value []byte) error {
+		var thread Thread
+		if err := json.Unmarshal(value, &thread); err != nil {
+			return err
+		}
+		threads = append(threads, thread)
+		return nil
+	})
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].UpdatedAt.After(threads[j].UpdatedAt)
+	})
+	return threads, err
+}
+
+func (h *Handler) listMessages(owner, threadID string) ([]Message, error) {
+	messages := []Message{}
+	err := h.store.List(messagesPath(owner, threadID), func(_ string, value []byte) error {
+		var message Message
+		if err := json.Unmarshal(value, &message); err != nil {
+			return err
+		}
+		messages = append(messages, message)
+		return nil
+	})
+	return messages, err
+}
+
+func (h *Handler) deleteThread(owner, threadID string) error {
+	return h.store.Update(func(tx *store.Tx) error {
+		if err := tx.Delete(threadsPath(owner), threadID); err != nil {
+			return err
+		}
+		// a thread without messages has no message bucket
+		if err := tx.Delete(messagesPath(owner, threadID)[:2], threadID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// reply answers params.Content with the thread history and stores both messages.
+// Nothing is stored when the completion fails, so the client can simply retry.
+func (h *Handler) reply(ctx context.Context, owner string, thread *Thread, params MessageParams) (*MessageResponse, error) {
+	history, err := h.listMessages(owner, thread.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStore, err)
+	}
+	model := thread.Model
+	if params.Model != "" {
+		model = params.Model
+	}
+	messages, err := h.buildContext(ctx, thread, history, params.Content, model)
+	if err != nil {
+		return nil, err
+	}
+	completion, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{Model: model, Messages: messages})
+	if err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, errors.New("completion returned no choices")
+	}
+
+	now := time.Now().UTC()
+	response := &MessageResponse{
+		Message: Message{Role: "user", Content: params.Content, CreatedAt: now},
+		Reply:   Message{Role: "assistant", Content: completion.Choices[0].Message.Content, Model: completion.Model, CreatedAt: now},
+	}
+	if thread.Title == "" {
+		thread.Title = title(params.Content)
+	}
+	thread.MessageCount = len(history) + 2
+	thread.UpdatedAt = now
+	// the messages and the thread are saved together, so a failure leaves neither
+	err = h.store.Update(func(tx *store.Tx) error {
+		messages, err := tx.Bucket(messagesPath(owner, thread.ID))
+		if err != nil {
+			return err
+		}
+		for _, message := range []*Message{&response.Message, &response.Reply} {
+			err := messages.Append(func(seq uint64) interface{} {
+				message.ID = fmt.Sprintf("msg_%d", seq)
+				return message
+			})
+			if err != nil {
+				return err
+			}
+		}
+		threads, err := tx.Bucket(threadsPath(owner))
+		if err != nil {
+			return err
+		}
+		return threads.Put(thread.ID, thread)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStore, err)
+	}
+	return response, nil
+}
+
+// buildContext returns the messages sent to model: the system prompt with the summary of older
+// messages, as much recent history as fits the context window, and content. History that no
+// longer fits is folded into thread.Summary; if summarizing fails it is only left out.
+func (h *Handler) buildContext(ctx context.Context, thread *Thread, history []Message, content, model string) ([]llm.Message, error) {
+	window := h.router.ContextWindow(model)
+	budget := window - llm.ReplyReserve(window) - summaryTokens - gpt.EstimateTokens(thread.SystemPrompt) - gpt.EstimateTokens(content)
+	if budget < 0 {
+		return nil, errMessageTooLong
+	}
+
+	first := len(history)
+	for first > thread.SummarizedMessages {
+		tokens := gpt.EstimateTokens(history[first-1].Content)
+		if tokens > budget {
+			break
+		}
+		budget -= tokens
+		first--
+	}
+	if dropped := history[thread.SummarizedMessages:first]; len(dropped) > 0 {
+		summary, err := h.summarize(ctx, thread.Summary, dropped)
+		if err != nil {
+			log.Printf("failed to summarize thread %s, truncating its history: %v", thread.ID, err)
+		} else {
+			thread.Summary = summary
+			thread.SummarizedMessages = first
+		}
+	}
+
+	var messages []llm.Message
+	if system := systemPrompt(thread); system != "" {
+		messages = append(messages, llm.Message{Role: "system", Content: system})
+	}
+	for _, m := range history[first:] {
+		messages = append(messages, llm.Message{Role: m.Role, Content: m.Content})
+	}
+	return append(messages, llm.Message{Role: "user", Content: content}), nil
+}
+
+// summarize folds messages into the previous summary of a thread.
+func (h *Handler) summarize(ctx context.Context, previous string, messages []Message) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&transcript, "Summary so far: %s\n\n", previous)
+	}
+	for _, m := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.Role, m.Content)
+	}
+	// keep the most recent part of the transcript if it doesn't fit the summary model
+	text := transcript.String()
+	if limit := (h.router.ContextWindow(summaryModel) - 2*summaryTokens) * 4; limit > 0 && len(text) > limit {
+		text = strings.ToValidUTF8(text[len(text)-limit:], "")
+	}
+	completion, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{
+		Model: summaryModel,
+		Messages: []llm.Message{
+			{Role: "system", Content: "Summarize the conversation below in under 300 words. Keep names, facts, decisions and open questions, so the conversation can continue from the summary alone."},
+			{Role: "user", Content: text},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 || completion.Choices[0].Message.Content == "" {
+		return "", errors.New("summary is empty")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+func systemPrompt(thread *Thread) string {
+	if thread.Summary == "" {
+		return thread.SystemPrompt
+	}
+	summary := "Summary of the earlier conversation: " + thread.Summary
+	if thread.SystemPrompt == "" {
+		return summary
+	}
+	return thread.SystemPrompt + "\n\n" + summary
+}
+
+// title returns the start of content, cut at a word boundary.
+func title(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= titleLength {
+		return content
+	}
+	cut := string(runes[:titleLength])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "..."
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package threads keeps conversations on the server, so clients only send the new message
+// and the history is replayed to the model for them.
+package threads
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// defaultModel answers threads created without a model.
+const defaultModel = "smart"
+
+// Thread is a conversation owned by an API key.
+type Thread struct {
+	ID           string `json:"id"`
+	Title        string `json:"title,omitempty"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	Model        string `json:"model"`
+	// Summary condenses the oldest SummarizedMessages messages, which no longer fit the context window.
+	Summary            string    `json:"summary,omitempty"`
+	SummarizedMessages int       `json:"summarized_messages,omitempty"`
+	MessageCount       int       `json:"message_count"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// Message is a message of a thread.
+type Message struct {
+	ID      string `json:"id"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Model is the prefixed model that wrote an assistant message.
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ThreadParams creates or updates a thread. Fields left out of an update are unchanged.
+type ThreadParams struct {
+	Title        *string `json:"title"`
+	SystemPrompt *string `json:"system_prompt"`
+	Model        *string `json:"model"`
+}
+
+// MessageParams adds a user message to a thread. Model overrides the thread's model for this reply.
+type MessageParams struct {
+	Content string `json:"content"`
+	Model   string `json:"model"`
+}
+
+// MessageResponse is the stored user message and the assistant's reply.
+type MessageResponse struct {
+	Message Message `json:"message"`
+	Reply   Message `json:"reply"`
+}
+
+// ThreadList is the response of GET /threads.
+type ThreadList struct {
+	Threads []Thread `json:"threads"`
+}
+
+// MessageList is the response of GET /threads/{id}/messages.
+type MessageList struct {
+	Messages []Message `json:"messages"`
+}
+
+// Handler serves the thread endpoints.
+type Handler struct {
+	store  *store.Store
+	router *llm.Router
+	// locks serializes the replies of a thread, see lock
+	locksMu sync.Mutex
+	locks   map[string]*threadLock
+}
+
+// NewHandler returns a Handler persisting threads in s and answering them with router.
+func NewHandler(s *store.Store, router *llm.Router) *Handler {
+	return &Handler{store: s, router: router, locks: map[string]*threadLock{}}
+}
+
+// CreateThread handles POST /threads.
+func (h *Handler) CreateThread(w http.ResponseWriter, r *http.Request) {
+	var params ThreadParams
+	if err := decodeParams(r, &params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	thread := &Thread{ID: newThreadID(), Model: defaultModel}
+	if err := h.applyParams(thread, params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	thread.CreatedAt = time.Now().UTC()
+	thread.UpdatedAt = thread.CreatedAt
+	if err := h.store.Put(threadsPath(auth.Owner(r.Context())), thread.ID, thread); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error saving thread, %v", err))
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, thread)
+}
+
+// ListThreads handles GET /threads, most recently updated first.
+func (h *Handler) ListThreads(w http.ResponseWriter, r *http.Request) {
+	threads, err := h.listThreads(auth.Owner(r.Context()))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error listing threads, %v", err))
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, ThreadList{Threads: threads})
+}
+
+// GetThread handles GET /threads/{id}.
+func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
+	thread, err := h.loadThread(auth.Owner(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, thread)
+}
+
+// UpdateThread handles PATCH /threads/{id}.
+func (h *Handler) UpdateThread(w http.ResponseWriter, r *http.Request) {
+	var params ThreadParams
+	if err := decodeParams(r, &params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	owner, id := auth.Owner(r.Context()), chi.URLParam(r, "id")
+	unlock := h.lock(owner, id)
+	defer unlock()
+
+	thread, err := h.loadThread(owner, id)
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	if err := h.applyParams(thread, params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	thread.UpdatedAt = time.Now().UTC()
+	if err := h.store.Put(threadsPath(owner), thread.ID, thread); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error saving thread, %v", err))
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, thread)
+}
+
+// DeleteThread handles DELETE /threads/{id}, removing the thread and its messages.
+func (h *Handler) DeleteThread(w http.ResponseWriter, r *http.Request) {
+	owner, id := auth.Owner(r.Context()), chi.URLParam(r, "id")
+	unlock := h.lock(owner, id)
+	defer unlock()
+
+	if err := h.deleteThread(owner, id); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddMessage handles POST /threads/{id}/messages: it stores the user message and replies to it
+// with the thread history, summarizing the oldest messages once they no longer fit the model.
+func (h *Handler) AddMessage(w http.ResponseWriter, r *http.Request) {
+	var params MessageParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if params.Content == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, content is required")
+		return
+	}
+	if params.Model != "" {
+		if err := h.router.Validate(params.Model); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+			return
+		}
+	}
+	owner, id := auth.Owner(r.Context()), chi.URLParam(r, "id")
+	unlock := h.lock(owner, id)
+	defer unlock()
+
+	thread, err := h.loadThread(owner, id)
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	response, err := h.reply(r.Context(), owner, thread, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, errMessageTooLong):
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, errStore):
+			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		default:
+			utils.RespondWithError(w, http.StatusBadGateway, fmt.Sprintf("Error handling chat completion, %v", err))
+		}
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// ListMessages handles GET /threads/{id}/messages, oldest first.
+func (h *Handler) ListMessages(w http.ResponseWriter, r *http.Request) {
+	owner, id := auth.Owner(r.Context()), chi.URLParam(r, "id")
+	if _, err := h.loadThread(owner, id); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	messages, err := h.listMessages(owner, id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error listing messages, %v", err))
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, MessageList{Messages: messages})
+}
+
+func respondWithStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "thread not found")
+		return
+	}
+	utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error reading thread, %v", err))
+}
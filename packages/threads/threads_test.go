@@ -0,0 +1,214 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package threads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+// fakeProvider replies "reply" to chat requests and "summary" to summary requests, recording them.
+type fakeProvider struct {
+	requests []llm.ChatCompletionRequest
+}
+
+func (p *fakeProvider) Name() string     { return "fake" }
+func (p *fakeProvider) Models() []string { return []string{"chat", "summary"} }
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, request llm.ChatCompletionRequest) (*llm.ChatCompletion, error) {
+	p.requests = append(p.requests, request)
+	content := "reply"
+	if request.Model == "summary" {
+		content = "summary"
+	}
+	return &llm.ChatCompletion{
+		Model:   "fake/" + request.Model,
+		Choices: []llm.Choice{{Message: llm.Message{Role: "assistant", Content: content}}},
+	}, nil
+}
+
+func newTestServer(t *testing.T, provider *fakeProvider, window int) http.Handler {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	router, err := llm.NewRouter(llm.Config{
+		Aliases:        map[string][]string{"smart": {"fake/chat"}, "fast": {"fake/summary"}},
+		ContextWindows: map[string]int{"fake/chat": window},
+	}, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(s, router)
+	mux := chi.NewRouter()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithOwner(r.Context(), r.Header.Get("Owner"))))
+		})
+	})
+	mux.Post("/threads", h.CreateThread)
+	mux.Get("/threads", h.ListThreads)
+	mux.Delete("/threads/{id}", h.DeleteThread)
+	mux.Post("/threads/{id}/messages", h.AddMessage)
+	mux.Get("/threads/{id}/messages", h.ListMessages)
+	return mux
+}
+
+func do(t *testing.T, handler http.Handler, owner, method, path string, body interface{}, v interface{}) int {
+	t.Helper()
+	var b bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&b).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &b)
+	req.Header.Set("Owner", owner)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s %s response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestThreadConversation(t *testing.T) {
+	provider := &fakeProvider{}
+	server := newTestServer(t, provider, 8192)
+	systemPrompt := "You are terse."
+
+	var thread Thread
+	if code := do(t, server, "alice", http.MethodPost, "/threads", ThreadParams{SystemPrompt: &systemPrompt}, &thread); code != http.StatusCreated {
+		t.Fatalf("create: expected status 201, got %d", code)
+	}
+	for _, content := range []string{"Hello", "How are you?"} {
+		var response MessageResponse
+		if code := do(t, server, "alice", http.MethodPost, "/threads/"+thread.ID+"/messages", MessageParams{Content: content}, &response); code != http.StatusOK {
+			t.Fatalf("add message: expected status 200, got %d", code)
+		}
+		if response.Reply.Content != "reply" || response.Reply.Model != "fake/chat" {
+			t.Errorf("unexpected reply %+v", response.Reply)
+		}
+	}
+
+	last := provider.requests[len(provider.requests)-1]
+	var roles []string
+	for _, m := range last.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user" {
+		t.Errorf("expected the history to be replayed, got roles %s", got)
+	}
+	if last.Messages[0].Content != systemPrompt {
+		t.Errorf("expected the system prompt %q, got %q", systemPrompt, last.Messages[0].Content)
+	}
+
+	var messages MessageList
+	do(t, server, "alice", http.MethodGet, "/threads/"+thread.ID+"/messages", nil, &messages)
+	if len(messages.Messages) != 4 || messages.Messages[0].Content != "Hello" {
+		t.Errorf("unexpected messages %+v", messages.Messages)
+	}
+
+	// threads are scoped to the API key that created them
+	var list ThreadList
+	do(t, server, "bob", http.MethodGet, "/threads", nil, &list)
+	if len(list.Threads) != 0 {
+		t.Errorf("expected no threads for another owner, got %d", len(list.Threads))
+	}
+	if code := do(t, server, "bob", http.MethodPost, "/threads/"+thread.ID+"/messages", MessageParams{Content: "Hi"}, nil); code != http.StatusNotFound {
+		t.Errorf("expected status 404 for another owner, got %d", code)
+	}
+
+	if code := do(t, server, "alice", http.MethodDelete, "/threads/"+thread.ID, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("delete: expected status 204, got %d", code)
+	}
+	do(t, server, "alice", http.MethodGet, "/threads", nil, &list)
+	if len(list.Threads) != 0 {
+		t.Errorf("expected the thread to be deleted, got %d threads", len(list.Threads))
+	}
+}
+
+func TestThreadSummarizesOldMessages(t *testing.T) {
+	provider := &fakeProvider{}
+	// the window leaves room for about two of the long messages below
+	server := newTestServer(t, provider, 2400)
+
+	var thread Thread
+	do(t, server, "alice", http.MethodPost, "/threads", nil, &thread)
+	long := strings.Repeat("word ", 300)
+	for i := 0; i < 4; i++ {
+		if code := do(t, server, "alice", http.MethodPost, "/threads/"+thread.ID+"/messages", MessageParams{Content: long}, nil); code != http.StatusOK {
+			t.Fatalf("add message: expected status 200, got %d", code)
+		}
+	}
+
+	var summarized bool
+	for _, request := range provider.requests {
+		summarized = summarized || request.Model == "summary"
+	}
+	if !summarized {
+		t.Fatal("expected the oldest messages to be summarized")
+	}
+	last := provider.requests[len(provider.requests)-1]
+	if last.Messages[0].Role != "system" || !strings.Contains(last.Messages[0].Content, "summary") {
+		t.Errorf("expected the summary in the system prompt, got %+v", last.Messages[0])
+	}
+
+	var messages MessageList
+	do(t, server, "alice", http.MethodGet, "/threads/"+thread.ID+"/messages", nil, &messages)
+	if len(messages.Messages) != 8 {
+		t.Errorf("expected every message to be kept, got %d", len(messages.Messages))
+	}
+}
+
+func TestThreadLocksAreDropped(t *testing.T) {
+	h := NewHandler(nil, nil)
+	unlock := h.lock("alice", "thread_1")
+	done := make(chan struct{})
+	go func() {
+		h.lock("alice", "thread_1")()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("a second request got the lock of the thread while it was held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-done
+	if len(h.locks) != 0 {
+		t.Errorf("expected the lock to be dropped, %d left", len(h.locks))
+	}
+}
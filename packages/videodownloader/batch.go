@@ -0,0 +1,244 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/jobs"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+var errPlaylist = errors.New("failed to list the videos of the playlist")
+
+const (
+	// defaultBatchConcurrency and maxBatchConcurrency limit the videos downloaded at once.
+	defaultBatchConcurrency = 2
+	maxBatchConcurrency     = 4
+	// defaultBatchVideos and maxBatchVideos limit the videos of a playlist downloaded.
+	defaultBatchVideos = 25
+	maxBatchVideos     = 50
+	jobTimeout         = 2 * time.Hour
+)
+
+// batchJob is a running job and the folder its archive is built in.
+type batchJob struct {
+	*jobs.Run[*Job]
+	folder string
+	// opts are the download options of every video.
+	opts services.DownloadOptions
+}
+
+// startBatch lists the videos of the batch and downloads them in the background.
+func (h *Handler) startBatch(ctx context.Context, owner string, params BatchParams) (*Job, error) {
+	job := &Job{Progress: jobs.New(), Resolution: params.Resolution, Output: params.Output}
+	for _, url := range params.URLs {
+		job.Items = append(job.Items, JobItem{URL: url, Item: jobs.Item{Status: jobs.StatusPending}})
+	}
+	if params.Playlist != "" {
+		playlist, err := h.playlists.Playlist(ctx, params.Playlist, params.MaxVideos)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errPlaylist, err)
+		}
+		if len(playlist.Videos) == 0 {
+			return nil, fmt.Errorf("%w: the playlist has no videos", errPlaylist)
+		}
+		job.Title = playlist.Title
+		for _, video := range playlist.Videos[:min(len(playlist.Videos), params.MaxVideos)] {
+			job.Items = append(job.Items, JobItem{URL: video.URL, PlaylistItem: video.Item, Title: video.Title, Item: jobs.Item{Status: jobs.StatusPending}})
+		}
+	}
+	var folder string
+	if job.Output == OutputZIP {
+		var err error
+		if folder, err = utils.CreateUniqueFolder(utils.BasePath); err != nil {
+			return nil, err
+		}
+	}
+	opts := params.Settings.options(params.Resolution)
+	response, err := h.jobs.Start(owner, job, jobTimeout, func(ctx context.Context, run *jobs.Run[*Job]) {
+		h.runBatch(ctx, &batchJob{Run: run, folder: folder, opts: opts}, params.Concurrency)
+	})
+	if err != nil {
+		if folder != "" {
+			_ = utils.DeleteFolder(folder)
+		}
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+	return response, nil
+}
+
+// runBatch downloads the videos of the job, concurrency at a time, then uploads the archive.
+func (h *Handler) runBatch(ctx context.Context, run *batchJob, concurrency int) {
+	run.Each(concurrency, func(i int) (func(job *Job), error) {
+		response, file, err := h.downloadItem(ctx, run, i)
+		return func(job *Job) { job.Items[i].Response, job.Items[i].File = response, file }, err
+	})
+
+	var completed int
+	run.Read(func(job *Job) { completed = job.Completed })
+	var archive string
+	var err error
+	if run.folder != "" {
+		if completed > 0 {
+			archive, err = h.uploadArchive(ctx, run)
+		}
+		if err := utils.DeleteFolder(run.folder); err != nil {
+			log.Printf("removing %s: %v", run.folder, err)
+		}
+	}
+	run.Update(func(job *Job) {
+		switch {
+		case job.Completed == 0 || err != nil:
+			job.Status = jobs.StatusFailed
+		case job.Failed > 0:
+			job.Status = jobs.StatusPartial
+		default:
+			job.Status = jobs.StatusCompleted
+		}
+		if err != nil {
+			job.ArchiveError = err.Error()
+		}
+		job.Archive = archive
+	})
+}
+
+// downloadItem downloads the i-th video of the job. For the urls output it uploads the video and
+// returns its URL, for the zip output it leaves the video in the job folder and returns its name
+// in the archive.
+func (h *Handler) downloadItem(ctx context.Context, run *batchJob, i int) (response, file string, err error) {
+	var item JobItem
+	run.Read(func(job *Job) { item = job.Items[i] })
+	opts := run.opts
+	opts.PlaylistItem = item.PlaylistItem
+	if run.folder == "" {
+		response, err = h.upload(ctx, item.URL, opts)
+		return response, "", err
+	}
+	folder := filepath.Join(run.folder, strconv.Itoa(i))
+	if err := os.Mkdir(folder, 0750); err != nil {
+		return "", "", err
+	}
+	videoPath, err := h.downloader.Download(ctx, item.URL, utils.OutputName, folder, opts)
+	if err != nil {
+		return "", "", fmt.Errorf("Conversion failed: %w", err)
+	}
+	return "", archiveName(i, item.Title, filepath.Ext(videoPath)), nil
+}
+
+// uploadArchive writes the downloaded videos of the job to a ZIP archive and uploads it.
+func (h *Handler) uploadArchive(ctx context.Context, run *batchJob) (string, error) {
+	var items []JobItem
+	var title string
+	run.Read(func(job *Job) { items, title = append([]JobItem(nil), job.Items...), job.Title })
+	if title == "" {
+		title = "videos"
+	}
+	archivePath := filepath.Join(run.folder, archiveName(-1, title, ".zip"))
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return "", err
+	}
+	archive := zip.NewWriter(out)
+	for i, item := range items {
+		if item.Status != jobs.StatusCompleted {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(run.folder, strconv.Itoa(i), utils.OutputName+".*"))
+		if err != nil || len(files) == 0 {
+			out.Close()
+			return "", fmt.Errorf("the download of %s is missing", item.URL)
+		}
+		if err := addToArchive(archive, files[0], item.File); err != nil {
+			out.Close()
+			return "", err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	url, err := h.storage.Upload(ctx, archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload the archive: %w", err)
+	}
+	return url, nil
+}
+
+// addToArchive stores the file at path in archive as name. Videos are already compressed, so
+// they are stored without compression.
+func addToArchive(archive *zip.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name, header.Method = name, zip.Store
+	w, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// archiveName returns a file name for the i-th video titled title, numbered from 1. A negative i
+// isn't numbered.
+func archiveName(i int, title, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = "video"
+	}
+	if len(name) > 100 {
+		name = strings.ToValidUTF8(name[:100], "")
+	}
+	if i < 0 {
+		return name + ext
+	}
+	return fmt.Sprintf("%03d %s%s", i+1, name, ext)
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/jobs"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+type fakePlaylists struct{}
+
+func (fakePlaylists) Playlist(ctx context.Context, url string, maxVideos int) (*services.Playlist, error) {
+	if strings.Contains(url, "bilibili.com") {
+		return &services.Playlist{Videos: []services.PlaylistVideo{
+			{Title: "Part 1", URL: url, Item: 1},
+			{Title: "Part 2", URL: url, Item: 2},
+		}}, nil
+	}
+	return &services.Playlist{Title: "Cooking", Videos: []services.PlaylistVideo{
+		{ID: "aaaaaaaaaaa", Title: "Pasta", URL: "https://www.youtube.com/watch?v=aaaaaaaaaaa"},
+		{ID: "bbbbbbbbbbb", Title: "Bread", URL: "https://www.youtube.com/watch?v=bbbbbbbbbbb"},
+		{ID: "ccccccccccc", Title: "Soup/Stew", URL: "https://www.youtube.com/watch?v=ccccccccccc"},
+	}}, nil
+}
+
+// fakeStorage records the entries of the archives and the contents of the other files it
+// uploads.
+type fakeStorage struct {
+	mu       sync.Mutex
+	entries  []string
+	contents map[string]string
+}
+
+func (f *fakeStorage) Upload(ctx context.Context, file interface{}) (string, error) {
+	path := file.(string)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if filepath.Ext(path) == ".zip" {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return "", err
+		}
+		defer archive.Close()
+		for _, entry := range archive.File {
+			f.entries = append(f.entries, entry.Name)
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		if f.contents == nil {
+			f.contents = map[string]string{}
+		}
+		f.contents[filepath.Base(path)] = string(data)
+	}
+	return "https://cdn.example.com/" + filepath.Base(path), nil
+}
+
+// newBatchServer returns a router serving the batch endpoints of a Handler with downloader and
+// storage for the API key alice.
+func newBatchServer(t *testing.T, downloader *fakeDownloader, storage *fakeStorage) http.Handler {
+	t.Helper()
+	basePath := utils.BasePath
+	utils.BasePath = t.TempDir() + "/"
+	t.Cleanup(func() { utils.BasePath = basePath })
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	h := NewHandler(downloader, nil, fakePlaylists{}, nil, storage, s)
+	mux := chi.NewRouter()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithOwner(r.Context(), "alice")))
+		})
+	})
+	mux.Post("/downloadvideo/batch", h.DownloadBatch)
+	mux.Get("/downloadvideo/jobs/{id}", h.GetJob)
+	return mux
+}
+
+// runBatch starts a batch job with body and polls it until it is done.
+func runBatch(t *testing.T, mux http.Handler, body string) Job {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/downloadvideo/batch", strings.NewReader(body)))
+	var job Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil || rec.Code != http.StatusAccepted {
+		t.Fatalf("start: unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == jobs.StatusRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/downloadvideo/jobs/"+job.ID, nil))
+		job = Job{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return job
+}
+
+func TestBatchJobArchivesPartialResults(t *testing.T) {
+	downloader := &fakeDownloader{content: "video", fail: "https://www.youtube.com/watch?v=bbbbbbbbbbb"}
+	storage := &fakeStorage{}
+	mux := newBatchServer(t, downloader, storage)
+
+	job := runBatch(t, mux, `{"urls": ["https://vimeo.com/1"], "playlist": "https://www.youtube.com/playlist?list=PL1", "output": "zip", "concurrency": 2}`)
+	if job.Total != 4 || job.Title != "Cooking" {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if job.Status != jobs.StatusPartial || job.Completed != 3 || job.Failed != 1 || job.Archive != "https://cdn.example.com/Cooking.zip" {
+		t.Fatalf("expected a partial job with an archive, got %+v", job)
+	}
+	if job.Items[2].Status != jobs.StatusFailed || !strings.Contains(job.Items[2].Error, "video unavailable") {
+		t.Errorf("unexpected items %+v", job.Items)
+	}
+	want := []string{"001 video.mp4", "002 Pasta.mp4", "004 Soup_Stew.mp4"}
+	if !reflect.DeepEqual(storage.entries, want) {
+		t.Errorf("archive entries = %v, want %v", storage.entries, want)
+	}
+	if entries, _ := os.ReadDir(utils.BasePath); len(entries) != 0 {
+		t.Errorf("the job folder was not removed: %v", entries)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/downloadvideo/jobs/job_missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestBatchJobDownloadsPlaylistItems(t *testing.T) {
+	downloader := &fakeDownloader{content: "video"}
+	mux := newBatchServer(t, downloader, &fakeStorage{})
+
+	rec := httptest.NewRecorder()
+	body := `{"playlist": "https://www.bilibili.com/video/BV1", "options": {"cookies": "bilibili.txt"}}`
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/downloadvideo/batch", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid options: expected status 400 before the job starts, got %d", rec.Code)
+	}
+
+	job := runBatch(t, mux, `{"playlist": "https://www.bilibili.com/video/BV1"}`)
+	if job.Status != jobs.StatusCompleted || job.Total != 2 || job.Items[1].PlaylistItem != 2 || job.Items[1].Response == "" {
+		t.Fatalf("expected the parts to be downloaded, got %+v", job)
+	}
+	sort.Ints(downloader.items)
+	if !reflect.DeepEqual(downloader.items, []int{1, 2}) {
+		t.Errorf("expected the parts to be downloaded by their number, got %v", downloader.items)
+	}
+}
@@ -20,72 +20,334 @@
 package videodownloader
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/clip"
+	"github.com/kingmariano/omnicron/internal/jobs"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
+	"math"
 	"net/http"
 )
 
+// Handler serves the video download endpoint.
+type Handler struct {
+	downloader services.Downloader
+	videos     services.VideoInspector
+	playlists  services.PlaylistExtractor
+	transcoder services.Transcoder
+	storage    services.Storage
+	jobs       *jobs.Store[*Job]
+	streams    streamCache
+}
+
+// NewHandler returns a Handler that inspects videos with videos, lists playlists with playlists,
+// downloads videos with downloader, cuts clips with transcoder and uploads them to storage. Batch
+// jobs are saved in s.
+func NewHandler(downloader services.Downloader, videos services.VideoInspector, playlists services.PlaylistExtractor, transcoder services.Transcoder, storage services.Storage, s *store.Store) *Handler {
+	return &Handler{downloader: downloader, videos: videos, playlists: playlists, transcoder: transcoder, storage: storage, jobs: jobs.NewStore[*Job](s, "video_jobs")}
+}
+
+// DownloadParams selects the stream to download by its ID in Stream, as listed by /video/info,
+// or by a quality preference in Resolution, such as 720p, best or worst. The clip options cut
+// parts out of the video.
 type DownloadParams struct {
 	URL        string `json:"url"`
 	Resolution string `json:"resolution"`
+	Stream     string `json:"stream"`
+	clip.Options
+	// Subtitles are the languages of the subtitles to download, converted to SubtitleFormat.
+	Subtitles      []string `json:"subtitles"`
+	SubtitleFormat string   `json:"subtitle_format"`
+	// EmbedSubtitles muxes the subtitles into the video as soft subtitles.
+	EmbedSubtitles bool `json:"embed_subtitles"`
+	// Settings tune the download within the limits of the server.
+	Settings DownloadSettings `json:"options"`
+}
+
+// DownloadSettings are the download options a request may set. Zero values use the defaults of
+// the server, and values above its limits are rejected.
+type DownloadSettings struct {
+	Threads       int   `json:"threads"`
+	Retries       int   `json:"retries"`
+	MaxFileSizeMB int64 `json:"max_file_size_mb"`
+	// Cookies names a cookies file in the cookies directory of the server.
+	Cookies string `json:"cookies"`
+}
+
+// options returns the settings as the options of a download in format.
+func (s DownloadSettings) options(format string) services.DownloadOptions {
+	maxFileSize := s.MaxFileSizeMB << 20
+	if s.MaxFileSizeMB > math.MaxInt64>>20 {
+		maxFileSize = -1
+	}
+	return services.DownloadOptions{
+		Format:      format,
+		Threads:     s.Threads,
+		Retries:     s.Retries,
+		MaxFileSize: maxFileSize,
+		Cookies:     s.Cookies,
+	}
+}
+
+// downloadOptions returns the options of the download, with the stream or quality to download.
+func (p DownloadParams) downloadOptions() services.DownloadOptions {
+	format := p.Resolution
+	if p.Stream != "" {
+		format = p.Stream
+	}
+	return p.Settings.options(format)
 }
 
 // DownloadVideo handles the video download process.
 // It accepts a POST request with JSON body containing URL and resolution.
 // It downloads the video from the provided URL, stores it in a temporary directory,
 // uploads the video to Cloudinary, and returns the Cloudinary URL of the uploaded video.
+// With ?delivery=stream or an Accept header asking for a video, the file is
+// streamed back in the response instead.
 //
 // Parameters:
-//  w http.ResponseWriter: The response writer for the HTTP request.
-//  r *http.Request: The HTTP request.
-//  cfg *config.ApiConfig: The API configuration.
+//
+//	w http.ResponseWriter: The response writer for the HTTP request.
+//	r *http.Request: The HTTP request.
 //
 // Return values:
-//  None.
+//
+//	None.
 type ResponseMsg struct {
-	Response string `json:"response"`
+	Response  string           `json:"response"`
+	Clips     []clip.Result    `json:"clips,omitempty"`
+	Subtitles []SubtitleResult `json:"subtitles,omitempty"`
 }
 
-func DownloadVideo(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
-	ctx := r.Context()
+// SubtitleResult is an uploaded subtitle file.
+type SubtitleResult struct {
+	Language string `json:"language"`
+	Format   string `json:"format"`
+	URL      string `json:"url"`
+}
+
+func (h *Handler) DownloadVideo(w http.ResponseWriter, r *http.Request) {
+	mode, err := delivery(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	decode := json.NewDecoder(r.Body)
 	params := DownloadParams{}
-	err := decode.Decode(&params)
+	err = decode.Decode(&params)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unmarshalling json, %v", err))
 		return
 	}
+	segments, err := params.Parse()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := params.validateSubtitles(mode, segments); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.downloader.Validate(params.downloadOptions()); err != nil {
+		utils.RespondWithError(w, downloadStatus(err), err.Error())
+		return
+	}
+	var subs []services.Subtitle
+	if len(params.Subtitles) > 0 {
+		subs, err = h.videos.Subtitles(r.Context(), params.URL, params.Subtitles)
+		if err != nil {
+			utils.RespondWithError(w, downloadStatus(err), err.Error())
+			return
+		}
+	}
+	if mode == DeliveryStream {
+		if len(segments) > 1 && !params.Join {
+			utils.RespondWithError(w, http.StatusBadRequest, "streamed downloads return a single file, set join to stream several segments")
+			return
+		}
+		h.streamVideo(w, r, params, segments, subs)
+		return
+	}
+	if len(segments) > 0 || len(subs) > 0 {
+		response, err := h.downloadFiles(r.Context(), params, segments, subs)
+		if err != nil {
+			utils.RespondWithError(w, downloadStatus(err), err.Error())
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, response)
+		return
+	}
+	urlLink, err := h.upload(r.Context(), params.URL, params.downloadOptions())
+	if err != nil {
+		utils.RespondWithError(w, downloadStatus(err), err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, ResponseMsg{Response: urlLink})
+}
+
+// downloadStatus returns the status code of a failed download.
+func downloadStatus(err error) int {
+	if errors.Is(err, ErrNoStream) || errors.Is(err, ErrNoSubtitles) || errors.Is(err, ErrOptions) || errors.Is(err, ErrFileTooLarge) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Download downloads the video at url in format, uploads it to storage and returns its URL.
+// format is a stream ID or a quality preference.
+func (h *Handler) Download(ctx context.Context, url, format string) (string, error) {
+	return h.upload(ctx, url, services.DownloadOptions{Format: format})
+}
+
+// upload downloads the video at url with opts, uploads it to storage and returns its URL.
+func (h *Handler) upload(ctx context.Context, url string, opts services.DownloadOptions) (string, error) {
 	//creates a temporary file to store the downloaded video
 	folderPath, err := utils.CreateUniqueFolder(utils.BasePath)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return "", err
 	}
-	videoPath, err := DownloadVideoData(params.URL, utils.OutputName, folderPath, params.Resolution)
+	videoPath, err := h.downloader.Download(ctx, url, utils.OutputName, folderPath, opts)
 	if err != nil {
 		if cleanupErr := utils.DeleteFolder(folderPath); cleanupErr != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete folder: "+cleanupErr.Error())
-			return
+			return "", fmt.Errorf("Failed to delete folder: %w", cleanupErr)
 		}
-		utils.RespondWithError(w, http.StatusInternalServerError, "Conversion failed: "+err.Error())
-		return
+		return "", fmt.Errorf("Conversion failed: %w", err)
 	}
 
 	//upload the video file to cloudinary and return the file URL
-	urlLink, err := utils.HandleFileUpload(ctx, videoPath, cfg.CloudinaryURL)
+	urlLink, err := h.storage.Upload(ctx, videoPath)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return "", err
 	}
 
 	// Remove the directory after uploading
-	err = utils.DeleteFolder(folderPath)
+	if err := utils.DeleteFolder(folderPath); err != nil {
+		return "", err
+	}
+	return urlLink, nil
+}
+
+// Outputs of a batch download.
+const (
+	// OutputURLs uploads every video on its own.
+	OutputURLs = "urls"
+	// OutputZIP uploads a single ZIP archive of the videos.
+	OutputZIP = "zip"
+)
+
+// BatchParams is the body of POST /downloadvideo/batch. Playlist is expanded into its videos,
+// which are downloaded after URLs.
+type BatchParams struct {
+	URLs       []string `json:"urls"`
+	Playlist   string   `json:"playlist"`
+	Resolution string   `json:"resolution"`
+	Output     string   `json:"output"`
+	// MaxVideos is the number of videos downloaded from the start of the playlist, see
+	// defaultBatchVideos and maxBatchVideos.
+	MaxVideos int `json:"max_videos"`
+	// Concurrency is the number of videos downloaded at once, see defaultBatchConcurrency and
+	// maxBatchConcurrency.
+	Concurrency int `json:"concurrency"`
+	// Settings tune the download of every video, see DownloadSettings.
+	Settings DownloadSettings `json:"options"`
+}
+
+// Job is a batch of videos downloaded in the background. Its items are updated as each video is
+// downloaded, and the archive is uploaded when they are all done.
+type Job struct {
+	jobs.Progress
+	Title        string    `json:"title,omitempty"`
+	Resolution   string    `json:"resolution,omitempty"`
+	Output       string    `json:"output"`
+	Items        []JobItem `json:"items"`
+	Archive      string    `json:"archive,omitempty"`
+	ArchiveError string    `json:"archive_error,omitempty"`
+}
+
+func (j *Job) Len() int              { return len(j.Items) }
+func (j *Job) Item(i int) *jobs.Item { return &j.Items[i].Item }
+
+// JobItem is a video of a batch job. Response is the URL of the video for the urls output and
+// File its name in the archive for the zip output. PlaylistItem numbers a video that has no URL of
+// its own within the playlist at URL.
+type JobItem struct {
+	URL          string `json:"url"`
+	PlaylistItem int    `json:"playlist_item,omitempty"`
+	Title        string `json:"title,omitempty"`
+	jobs.Item
+	Response string `json:"response,omitempty"`
+	File     string `json:"file,omitempty"`
+}
+
+// DownloadBatch handles POST /downloadvideo/batch, starting a job that downloads the videos.
+func (h *Handler) DownloadBatch(w http.ResponseWriter, r *http.Request) {
+	var params BatchParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if len(params.URLs) == 0 && params.Playlist == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, urls or playlist is required")
+		return
+	}
+	if params.Output == "" {
+		params.Output = OutputURLs
+	}
+	if params.Output != OutputURLs && params.Output != OutputZIP {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, output must be %q or %q", OutputURLs, OutputZIP))
+		return
+	}
+	if params.MaxVideos == 0 {
+		params.MaxVideos = defaultBatchVideos
+	}
+	if params.MaxVideos < 0 || params.MaxVideos > maxBatchVideos {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, max_videos must be between 1 and %d", maxBatchVideos))
+		return
+	}
+	if len(params.URLs) > maxBatchVideos {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, at most %d urls can be downloaded", maxBatchVideos))
+		return
+	}
+	if params.Concurrency == 0 {
+		params.Concurrency = defaultBatchConcurrency
+	}
+	if params.Concurrency < 0 || params.Concurrency > maxBatchConcurrency {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, concurrency must be between 1 and %d", maxBatchConcurrency))
+		return
+	}
+	// the options are checked before the job starts, or every video would fail with them
+	if err := h.downloader.Validate(params.Settings.options(params.Resolution)); err != nil {
+		utils.RespondWithError(w, downloadStatus(err), err.Error())
+		return
+	}
+	job, err := h.startBatch(r.Context(), auth.Owner(r.Context()), params)
+	if errors.Is(err, errPlaylist) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	utils.RespondWithJSON(w, http.StatusAccepted, job)
+}
 
-	utils.RespondWithJSON(w, http.StatusOK, ResponseMsg{Response: urlLink})
+// GetJob handles GET /downloadvideo/jobs/{id}, returning the progress and results of a batch job.
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Load(auth.Owner(r.Context()), chi.URLParam(r, "id"))
+	if errors.Is(err, store.ErrNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, job)
 }
@@ -0,0 +1,235 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iawia002/lux/config"
+	"github.com/iawia002/lux/extractors"
+	"github.com/iawia002/lux/utils"
+)
+
+// errNoRanges is returned when a server answers a range request with the whole file.
+var errNoRanges = errors.New("the server does not support range requests")
+
+// sizeLimit counts the bytes written by the downloads of a video and fails them once there are
+// more than max. A zero max is unlimited.
+type sizeLimit struct {
+	max     int64
+	written atomic.Int64
+}
+
+func (l *sizeLimit) add(n int64) error {
+	if l.written.Add(n) > l.max && l.max > 0 {
+		return fmt.Errorf("%w: the video is larger than %d bytes", ErrFileTooLarge, l.max)
+	}
+	return nil
+}
+
+// limitedWriter writes to w while the limit allows it.
+type limitedWriter struct {
+	w     io.Writer
+	limit *sizeLimit
+}
+
+func (w limitedWriter) Write(p []byte) (int, error) {
+	if err := w.limit.add(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// fetcher downloads the parts of a stream extracted by lux. Unlike the lux downloader it stops
+// with its context and as soon as the video is larger than the limit.
+type fetcher struct {
+	client  *http.Client
+	referer string
+	threads int
+	retries int
+	limit   *sizeLimit
+}
+
+// fetchStream downloads stream into outputPath and returns the path of the file. Several parts
+// are downloaded at once and merged with ffmpeg.
+func (f *fetcher) fetchStream(ctx context.Context, data *extractors.Data, stream *extractors.Stream, outputName, outputPath string) (string, error) {
+	path := filepath.Join(outputPath, outputName+"."+stream.Ext)
+	switch {
+	case len(stream.Parts) == 0:
+		return "", fmt.Errorf("%w: the stream has no parts", ErrNoStream)
+	case len(stream.Parts) == 1:
+		return path, f.fetchPart(ctx, stream.Parts[0], path, f.threads)
+	case data.Type != extractors.DataTypeVideo:
+		return "", fmt.Errorf("%w: only videos can be downloaded", ErrNoStream)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, max(f.threads, 1))
+	paths := make([]string, len(stream.Parts))
+	for i, part := range stream.Parts {
+		paths[i] = filepath.Join(outputPath, fmt.Sprintf("%s[%d].%s", outputName, i, part.Ext))
+		wg.Add(1)
+		go func(part *extractors.Part, path string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if err := f.fetchPart(ctx, part, path, 1); err != nil {
+				once.Do(func() { firstErr = err })
+				cancel()
+			}
+		}(part, paths[i])
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return "", firstErr
+	}
+	if stream.Ext != "mp4" || stream.NeedMux {
+		return path, utils.MergeFilesWithSameExtension(paths, path)
+	}
+	return path, utils.MergeToMP4(paths, path, filepath.Join(outputPath, outputName))
+}
+
+// fetchPart downloads part into path with up to threads connections, each fetching a range of
+// the part. Parts of unknown size, and servers without range requests, use a single connection.
+func (f *fetcher) fetchPart(ctx context.Context, part *extractors.Part, path string, threads int) error {
+	temp := path + ".download"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	err = errNoRanges
+	if threads > 1 && part.Size > 0 {
+		err = f.fetchRanges(ctx, part, file, threads)
+	}
+	if errors.Is(err, errNoRanges) {
+		if err = file.Truncate(0); err == nil {
+			_, err = f.fetchRange(ctx, part.URL, file, 0, -1)
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// fetchRanges downloads part into file with threads connections. When the server doesn't support
+// range requests it returns errNoRanges and takes what was written off the limit.
+func (f *fetcher) fetchRanges(ctx context.Context, part *extractors.Part, file *os.File, threads int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		written  atomic.Int64
+	)
+	chunk := (part.Size + int64(threads) - 1) / int64(threads)
+	for start := int64(0); start < part.Size; start += chunk {
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			n, err := f.fetchRange(ctx, part.URL, file, start, end)
+			written.Add(n)
+			if err != nil {
+				once.Do(func() { firstErr = err })
+				cancel()
+			}
+		}(start, min(start+chunk, part.Size)-1)
+	}
+	wg.Wait()
+	if errors.Is(firstErr, errNoRanges) {
+		f.limit.add(-written.Load())
+	}
+	return firstErr
+}
+
+// fetchRange downloads the bytes from start to end of url into the same place of file, retrying
+// from where a failed attempt stopped. A negative end downloads the rest of the file. It returns
+// the number of bytes written.
+func (f *fetcher) fetchRange(ctx context.Context, url string, file *os.File, start, end int64) (int64, error) {
+	var written int64
+	for attempt := 0; ; attempt++ {
+		n, err := f.get(ctx, url, io.NewOffsetWriter(file, start+written), start+written, end)
+		written += n
+		if err == nil || errors.Is(err, ErrFileTooLarge) || errors.Is(err, errNoRanges) || attempt >= f.retries {
+			return written, err
+		}
+		select {
+		case <-ctx.Done():
+			return written, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// get copies the bytes from start to end of url to w.
+func (f *fetcher) get(ctx context.Context, url string, w io.Writer, start, end int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range config.FakeHeaders {
+		req.Header.Set(k, v)
+	}
+	// a compressed body would be saved as it is
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set("Referer", f.referer)
+	ranged := start > 0 || end >= 0
+	if ranged {
+		bytes := "bytes=" + strconv.FormatInt(start, 10) + "-"
+		if end >= 0 {
+			bytes += strconv.FormatInt(end, 10)
+		}
+		req.Header.Set("Range", bytes)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= http.StatusBadRequest:
+		return 0, fmt.Errorf("failed to download video: %s", resp.Status)
+	case ranged && resp.StatusCode != http.StatusPartialContent:
+		return 0, errNoRanges
+	}
+	return io.Copy(limitedWriter{w: w, limit: f.limit}, resp.Body)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iawia002/lux/extractors"
+)
+
+func TestFetchPartUsesRanges(t *testing.T) {
+	video := bytes.Repeat([]byte("0123456789"), 10000)
+	var ranges atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranges.Add(1)
+		}
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(video))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	f := &fetcher{client: server.Client(), limit: &sizeLimit{}}
+	part := &extractors.Part{URL: server.URL, Size: int64(len(video)), Ext: "mp4"}
+	if err := f.fetchPart(context.Background(), part, path, 4); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, video) || ranges.Load() != 4 {
+		t.Errorf("got %d bytes with %d range requests, want %d bytes with 4", len(got), ranges.Load(), len(video))
+	}
+}
+
+func TestFetchPartStopsAtLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the size is unknown and the body never ends
+		chunk := make([]byte, 32<<10)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	f := &fetcher{client: server.Client(), retries: 3, limit: &sizeLimit{max: 1 << 20}}
+	part := &extractors.Part{URL: server.URL, Ext: "mp4"}
+	err := f.fetchPart(context.Background(), part, filepath.Join(dir, "video.mp4"), 4)
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("fetchPart() error = %v, want ErrFileTooLarge", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kingmariano/omnicron/internal/clip"
+	"github.com/kingmariano/omnicron/internal/subtitles"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// validateSubtitles checks the subtitle options of p and defaults the subtitle format to SRT.
+func (p *DownloadParams) validateSubtitles(mode string, segments []clip.Segment) error {
+	if p.SubtitleFormat == "" {
+		p.SubtitleFormat = subtitles.SRT
+	}
+	if !subtitles.ValidFormat(p.SubtitleFormat) {
+		return fmt.Errorf("subtitle_format must be %q, %q or %q", subtitles.SRT, subtitles.VTT, subtitles.Text)
+	}
+	if len(p.Subtitles) == 0 {
+		if p.EmbedSubtitles {
+			return errors.New("embed_subtitles needs the languages of the subtitles in subtitles")
+		}
+		return nil
+	}
+	if p.EmbedSubtitles && len(segments) > 0 {
+		return errors.New("subtitles can't be embedded in clips")
+	}
+	if mode == DeliveryStream && !p.EmbedSubtitles {
+		return errors.New("streamed downloads return a single file, set embed_subtitles to stream subtitles")
+	}
+	return nil
+}
+
+// downloadFiles downloads the video of params, embeds subs in it or cuts segments out of it, and
+// uploads the video or its clips and the subtitles. A single clip or the joined clips are
+// returned in Response.
+func (h *Handler) downloadFiles(ctx context.Context, params DownloadParams, segments []clip.Segment, subs []services.Subtitle) (ResponseMsg, error) {
+	folderPath, err := utils.CreateUniqueFolder(utils.BasePath)
+	if err != nil {
+		return ResponseMsg{}, err
+	}
+	defer func() {
+		if err := utils.DeleteFolder(folderPath); err != nil {
+			log.Printf("removing %s: %v", folderPath, err)
+		}
+	}()
+	videoPath, err := h.downloader.Download(ctx, params.URL, utils.OutputName, folderPath, params.downloadOptions())
+	if err != nil {
+		return ResponseMsg{}, fmt.Errorf("Conversion failed: %w", err)
+	}
+	if params.EmbedSubtitles {
+		if videoPath, err = h.embedSubtitles(ctx, videoPath, subs); err != nil {
+			return ResponseMsg{}, err
+		}
+	}
+	outputs := []string{videoPath}
+	if len(segments) > 0 {
+		if outputs, err = clip.Cut(ctx, h.transcoder, videoPath, segments, params.Join, params.Reencode); err != nil {
+			return ResponseMsg{}, err
+		}
+	}
+	urls := make([]string, len(outputs))
+	for i, path := range outputs {
+		if urls[i], err = h.storage.Upload(ctx, path); err != nil {
+			return ResponseMsg{}, err
+		}
+	}
+	var response ResponseMsg
+	if len(urls) == 1 {
+		response.Response = urls[0]
+	}
+	if len(segments) > 0 && !params.Join {
+		response.Clips = clip.Results(segments, urls)
+	}
+	for i, sub := range subs {
+		path := filepath.Join(folderPath, fmt.Sprintf("%s.%d.%s.%s", utils.OutputName, i+1, fileLanguage(sub.Language), params.SubtitleFormat))
+		if err := writeSubtitle(path, sub, params.SubtitleFormat); err != nil {
+			return ResponseMsg{}, err
+		}
+		url, err := h.storage.Upload(ctx, path)
+		if err != nil {
+			return ResponseMsg{}, err
+		}
+		response.Subtitles = append(response.Subtitles, SubtitleResult{Language: sub.Language, Format: params.SubtitleFormat, URL: url})
+	}
+	return response, nil
+}
+
+// embedSubtitles muxes subs into the video at videoPath as soft subtitles and returns the path
+// of the new video. MP4 videos stay MP4, and other videos become MKV.
+func (h *Handler) embedSubtitles(ctx context.Context, videoPath string, subs []services.Subtitle) (string, error) {
+	dir := filepath.Dir(videoPath)
+	files := make([]services.SubtitleFile, len(subs))
+	for i, sub := range subs {
+		path := filepath.Join(dir, fmt.Sprintf("embed.%d.srt", i+1))
+		if err := writeSubtitle(path, sub, subtitles.SRT); err != nil {
+			return "", err
+		}
+		files[i] = services.SubtitleFile{Path: path, Language: sub.Language}
+	}
+	ext := ".mkv"
+	if strings.EqualFold(filepath.Ext(videoPath), ".mp4") {
+		ext = ".mp4"
+	}
+	output := strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "_subtitled" + ext
+	if err := h.transcoder.MuxSubtitles(ctx, videoPath, files, output); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// writeSubtitle converts sub to format and writes it to path.
+func writeSubtitle(path string, sub services.Subtitle, format string) error {
+	data, err := subtitles.Convert(sub.Data, format)
+	if err != nil {
+		return fmt.Errorf("failed to convert the %s subtitles: %w", sub.Language, err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// fileLanguage makes a language code safe to use in a file name.
+func fileLanguage(language string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, language)
+}
@@ -20,26 +20,34 @@
 package videodownloader
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 
 	_ "github.com/iawia002/lux/app"
-	"github.com/iawia002/lux/downloader"
 	"github.com/iawia002/lux/extractors"
+	"github.com/kingmariano/omnicron/services"
 )
 
 // extractUrl is a function that extracts video data from a given URL using the lux library.
 //
 // Parameters:
 // url: A string representing the URL of the video to be extracted.
+// cookie: The cookies sent by the extractors that support them.
+// item: The number of the video to extract from the playlist at url, or 0 for the video at url.
 //
 // Returns:
 // A slice of pointers to extractors.Data, representing the extracted video data.
-func extractURL(URL string) ([]*extractors.Data, error) {
-
-	data, err := extractors.Extract(URL, extractors.Options{})
+func extractURL(URL, cookie string, item int) ([]*extractors.Data, error) {
+	options := extractors.Options{Cookie: cookie}
+	if item > 0 {
+		options.Playlist, options.Items = true, strconv.Itoa(item)
+	}
+	data, err := extractors.Extract(URL, options)
 	if err != nil {
 		return nil, err
 	}
@@ -53,80 +61,115 @@ func deleteContents(dir string) error {
 	return nil
 }
 
-// handleStreamResolution is a function that converts a given video resolution string
-// into the corresponding stream identifier used by the lux library.
-//
-// Parameters:
-// resolution: A string representing the desired video resolution.
-//
-//	Supported values are "1080p", "720p", "480p", "360p", "240p".
-//
-// Returns:
-// A string representing the corresponding stream identifier.
-// If the input resolution is not supported, an empty string is returned.
-func handleStreamResolution(resolution string) string {
-	var stream string
-	switch resolution {
-	case "1080p":
-		stream = "137"
-	case "720p":
-		stream = "136"
-	case "480p":
-		stream = "135"
-	case "360p":
-		stream = "396"
-	case "240p":
-		stream = "133"
-	default:
-		stream = ""
-	}
-	return stream
+// LuxDownloader downloads videos with the lux library within the limits of a Policy.
+type LuxDownloader struct {
+	policy Policy
+	client *http.Client
+	slots  chan struct{}
+}
+
+// NewLuxDownloader returns a LuxDownloader with policy. Zero values of policy use the defaults of
+// DefaultPolicy.
+func NewLuxDownloader(policy Policy) (*LuxDownloader, error) {
+	policy, err := policy.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &LuxDownloader{
+		policy: policy,
+		client: policy.httpClient(),
+		slots:  make(chan struct{}, policy.MaxConcurrent),
+	}, nil
+}
+
+// Validate checks opts against the policy and reads the cookies it names.
+func (d *LuxDownloader) Validate(opts services.DownloadOptions) error {
+	opts, err := d.policy.resolve(opts)
+	if err != nil {
+		return err
+	}
+	_, err = d.policy.cookies(opts.Cookies)
+	return err
+}
+
+// Download downloads the video at url into outputPath and returns the path of the downloaded file.
+// It waits while the maximum number of downloads are running.
+func (d *LuxDownloader) Download(ctx context.Context, url, outputName, outputPath string, opts services.DownloadOptions) (string, error) {
+	opts, err := d.policy.resolve(opts)
+	if err != nil {
+		return "", err
+	}
+	cookie, err := d.policy.cookies(opts.Cookies)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case d.slots <- struct{}{}:
+		defer func() { <-d.slots }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return downloadVideo(ctx, d.client, url, outputName, outputPath, cookie, opts)
 }
 
 // DownloadVideoData is a function that downloads a video from a given URL,
-// with the specified output name, path, and resolution.
-// It uses the lux library for extracting video data and downloading the video.
-// If an error occurs during the process, it cleans up by removing unnecessary files.
+// with the specified output name, path, and format, using the default Policy.
 //
 // Parameters:
 // url: The URL of the video to be downloaded.
 // outputName: The name of the output file.
 // outputPath: The path where the output file will be saved.
-// resolution: The desired resolution of the video.
+// format: The ID of the stream to download, or a quality such as 720p, best or worst.
 //
 // Returns:
-// An error if any error occurs during the process, otherwise nil.
-func DownloadVideoData(url string, outputName string, outputPath string, resolution string) (string, error) {
-	data, err := extractURL(url)
+// The path of the downloaded file, or an error if any error occurs during the process.
+func DownloadVideoData(url string, outputName string, outputPath string, format string) (string, error) {
+	d, err := NewLuxDownloader(Policy{})
 	if err != nil {
 		return "", err
 	}
-	stream := handleStreamResolution(resolution)
+	return d.Download(context.Background(), url, outputName, outputPath, services.DownloadOptions{Format: format})
+}
 
-	download := downloader.New(downloader.Options{
-		OutputName:   outputName,
-		OutputPath:   outputPath,
-		Stream:       stream,
-		RetryTimes:   25,
-		MultiThread:  true,
-		ThreadNumber: 50,
-	})
-	err = download.Download(data[0])
+// downloadVideo extracts a video with the lux library and downloads it with client.
+// If an error occurs during the process, it cleans up by removing unnecessary files.
+func downloadVideo(ctx context.Context, client *http.Client, url, outputName, outputPath, cookie string, opts services.DownloadOptions) (string, error) {
+	data, err := extractVideo(url, cookie, opts.PlaylistItem)
 	if err != nil {
-		log.Println("cleaning up, deleting folder...")
-		if err := deleteContents(outputPath); err != nil {
-			return "", err
-		}
 		return "", err
 	}
-	files, err := filepath.Glob(outputPath + "/" + outputName + ".*")
+	id, err := selectStream(data.Streams, opts.Format)
 	if err != nil {
 		return "", err
 	}
-	if len(files) == 0 {
-		return "", errors.New("no video file found")
+	stream := pickStream(data.Streams, id)
+	if stream == nil {
+		return "", fmt.Errorf("%w: the video has no streams", ErrNoStream)
+	}
+	if opts.MaxFileSize > 0 {
+		switch {
+		case stream.Size == 0:
+			return "", fmt.Errorf("%w: the size of the video is unknown and the limit is %d bytes", ErrFileTooLarge, opts.MaxFileSize)
+		case stream.Size > opts.MaxFileSize:
+			return "", fmt.Errorf("%w: the video is larger than %d bytes", ErrFileTooLarge, opts.MaxFileSize)
+		}
+	}
+
+	fetch := &fetcher{
+		client:  client,
+		referer: data.URL,
+		threads: opts.Threads,
+		retries: opts.Retries,
+		limit:   &sizeLimit{max: opts.MaxFileSize},
+	}
+	videoPath, err := fetch.fetchStream(ctx, data, stream, outputName, outputPath)
+	if err != nil {
+		log.Println("cleaning up, deleting folder...")
+		if err := deleteContents(outputPath); err != nil {
+			return "", err
+		}
+		return "", err
 	}
-	videoPath := files[0]
 	fileInfo, err := os.Stat(videoPath)
 	if err != nil {
 		return "", err
@@ -134,5 +177,25 @@ func DownloadVideoData(url string, outputName string, outputPath string, resolut
 	if fileInfo.Size() == 0 {
 		return "", errors.New("downloaded video file is empty")
 	}
+	if opts.MaxFileSize > 0 && fileInfo.Size() > opts.MaxFileSize {
+		if err := os.Remove(videoPath); err != nil {
+			log.Println("failed to delete the video:", err)
+		}
+		return "", fmt.Errorf("%w: the video is larger than %d bytes", ErrFileTooLarge, opts.MaxFileSize)
+	}
 	return videoPath, nil
 }
+
+// pickStream returns the stream with id, or the largest stream when id is empty.
+func pickStream(streams map[string]*extractors.Stream, id string) *extractors.Stream {
+	if id != "" {
+		return streams[id]
+	}
+	var largest *extractors.Stream
+	for _, s := range streams {
+		if largest == nil || s.Size > largest.Size {
+			largest = s
+		}
+	}
+	return largest
+}
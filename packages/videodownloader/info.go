@@ -0,0 +1,232 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iawia002/lux/extractors"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+	"github.com/kkdai/youtube/v2"
+)
+
+// ErrNoStream is returned when a format names neither a stream of the video nor a quality.
+var ErrNoStream = errors.New("no matching stream")
+
+var (
+	// heightPattern finds the resolution in a stream quality such as "1080p60 video/mp4" or "高清 720P".
+	heightPattern = regexp.MustCompile(`(?i)\b(\d{3,4})p`)
+	codecsPattern = regexp.MustCompile(`codecs="([^"]+)"`)
+	// qualityPattern matches a quality preference such as 720p or 720.
+	qualityPattern = regexp.MustCompile(`(?i)^(\d{3,4})p?$`)
+)
+
+// InfoParams is the request body of VideoInfo.
+type InfoParams struct {
+	URL string `json:"url"`
+}
+
+// InfoResponse is a video with its duration in seconds.
+type InfoResponse struct {
+	*services.VideoInfo
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// VideoInfo returns the title, site, duration, streams and subtitles of the video at the URL in the
+// request body. The ID of a stream can be sent to DownloadVideo.
+func (h *Handler) VideoInfo(w http.ResponseWriter, r *http.Request) {
+	var params InfoParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if params.URL == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	info, err := h.videos.Info(r.Context(), params.URL)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadGateway, fmt.Sprintf("failed to inspect the video: %v", err))
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, InfoResponse{VideoInfo: info, Duration: info.Duration.Seconds()})
+}
+
+// Info extracts the video at url and lists its streams, best first, and its subtitles. The
+// duration is only known for YouTube videos.
+func (d *LuxDownloader) Info(ctx context.Context, url string) (*services.VideoInfo, error) {
+	video, err := d.extract(url)
+	if err != nil {
+		return nil, err
+	}
+	info := &services.VideoInfo{
+		Title:     video.Title,
+		Site:      video.Site,
+		Type:      string(video.Type),
+		Streams:   videoStreams(video.Streams),
+		Subtitles: subtitleTracks(luxSubtitles(video.Captions)),
+	}
+	if isYouTube(url) {
+		client := youtube.Client{HTTPClient: d.client}
+		if v, err := client.GetVideoContext(ctx, url); err == nil {
+			info.Duration = v.Duration
+			info.Subtitles = subtitleTracks(youtubeSubtitles(v))
+		}
+	}
+	return info, nil
+}
+
+// extract extracts the video at url with the default cookies of the policy.
+func (d *LuxDownloader) extract(url string) (*extractors.Data, error) {
+	cookie, err := d.policy.cookies(d.policy.Cookies)
+	if err != nil {
+		return nil, err
+	}
+	return extractVideo(url, cookie, 0)
+}
+
+// extractVideo returns the first video lux extracts from url, or the video numbered item of the
+// playlist at url if item isn't 0.
+func extractVideo(url, cookie string, item int) (*extractors.Data, error) {
+	data, err := extractURL(url, cookie, item)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || data[0] == nil {
+		return nil, errors.New("no video found")
+	}
+	if data[0].Err != nil {
+		return nil, data[0].Err
+	}
+	return data[0], nil
+}
+
+// videoStreams lists streams from the highest resolution to the lowest, the largest first
+// within a resolution. Streams without a resolution come last.
+func videoStreams(streams map[string]*extractors.Stream) []services.VideoStream {
+	list := make([]services.VideoStream, 0, len(streams))
+	for id, stream := range streams {
+		item := services.VideoStream{
+			ID:        id,
+			Quality:   stream.Quality,
+			Height:    streamHeight(stream.Quality),
+			Size:      stream.Size,
+			Container: stream.Ext,
+		}
+		if match := codecsPattern.FindStringSubmatch(stream.Quality); match != nil {
+			item.Codec = match[1]
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Height != list[j].Height {
+			return list[i].Height > list[j].Height
+		}
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func streamHeight(quality string) int {
+	match := heightPattern.FindStringSubmatch(quality)
+	if match == nil {
+		return 0
+	}
+	height, _ := strconv.Atoi(match[1])
+	return height
+}
+
+// selectStream resolves format against streams and returns the ID of the stream to download.
+// format is a stream ID, best, worst or a resolution such as 720p, which picks the highest
+// resolution not above it, or the lowest one if every stream is above it. MP4 streams are
+// preferred within a resolution. An empty format leaves the choice to lux.
+func selectStream(streams map[string]*extractors.Stream, format string) (string, error) {
+	format = strings.TrimSpace(format)
+	if _, ok := streams[format]; ok || format == "" {
+		return format, nil
+	}
+	list := videoStreams(streams)
+	if len(list) == 0 {
+		return "", fmt.Errorf("%w: the video has no streams", ErrNoStream)
+	}
+	var want int
+	switch strings.ToLower(format) {
+	case "best":
+		return list[0].ID, nil
+	case "worst":
+		for i := len(list) - 1; i >= 0; i-- {
+			if list[i].Height > 0 {
+				return preferMP4(list, list[i].Height), nil
+			}
+		}
+		return list[len(list)-1].ID, nil
+	default:
+		match := qualityPattern.FindStringSubmatch(format)
+		if match == nil {
+			return "", fmt.Errorf("%w: %q is neither a stream ID nor a quality", ErrNoStream, format)
+		}
+		want, _ = strconv.Atoi(match[1])
+	}
+	lowest := 0
+	for _, stream := range list {
+		if stream.Height == 0 {
+			continue
+		}
+		if stream.Height <= want {
+			return preferMP4(list, stream.Height), nil
+		}
+		lowest = stream.Height
+	}
+	if lowest == 0 {
+		// No stream names its resolution.
+		return list[0].ID, nil
+	}
+	return preferMP4(list, lowest), nil
+}
+
+// preferMP4 returns the first MP4 stream of height in list, or its first stream of height.
+func preferMP4(list []services.VideoStream, height int) string {
+	id := ""
+	for _, stream := range list {
+		if stream.Height != height {
+			continue
+		}
+		if stream.Container == "mp4" {
+			return stream.ID
+		}
+		if id == "" {
+			id = stream.ID
+		}
+	}
+	return id
+}
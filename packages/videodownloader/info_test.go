@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/iawia002/lux/extractors"
+)
+
+func TestSelectStream(t *testing.T) {
+	streams := map[string]*extractors.Stream{
+		"137": {Quality: `1080p video/mp4; codecs="avc1.640028"`, Size: 900, Ext: "mp4"},
+		"248": {Quality: `1080p video/webm; codecs="vp9"`, Size: 950, Ext: "webm"},
+		"136": {Quality: `720p video/mp4; codecs="avc1.4d401f"`, Size: 500, Ext: "mp4"},
+		"133": {Quality: `240p video/mp4; codecs="avc1.4d4015"`, Size: 100, Ext: "mp4"},
+		"140": {Quality: `audio/mp4; codecs="mp4a.40.2"`, Size: 50, Ext: "m4a"},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", ""},
+		{"248", "248"},
+		{"best", "248"},
+		{"1080p", "137"},
+		{"720p", "136"},
+		{"480p", "133"},
+		{"360", "133"},
+		{"144p", "133"},
+		{"4320p", "137"},
+		{"worst", "133"},
+	}
+	for _, tt := range tests {
+		got, err := selectStream(streams, tt.format)
+		if err != nil {
+			t.Errorf("selectStream(%q): %v", tt.format, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("selectStream(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+	if _, err := selectStream(streams, "hd"); !errors.Is(err, ErrNoStream) {
+		t.Errorf("selectStream(hd) error = %v, want ErrNoStream", err)
+	}
+
+	list := videoStreams(streams)
+	if list[0].ID != "248" || list[len(list)-1].ID != "140" {
+		t.Errorf("streams are not sorted best first: %+v", list)
+	}
+	if list[1].Height != 1080 || list[1].Codec != "avc1.640028" || list[1].Container != "mp4" {
+		t.Errorf("stream 137 = %+v", list[1])
+	}
+}
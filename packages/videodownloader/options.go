@@ -0,0 +1,237 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kingmariano/omnicron/services"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ErrOptions is returned when the download options of a request are not allowed by the Policy.
+var ErrOptions = errors.New("invalid download options")
+
+// ErrFileTooLarge is returned when a video is larger than the maximum file size.
+var ErrFileTooLarge = errors.New("file too large")
+
+const maxCookiesSize = 1 << 20
+
+// Policy holds the download settings of the server and the limits of the settings a request
+// may choose. Zero values use the defaults of DefaultPolicy.
+type Policy struct {
+	// Threads is the number of connections downloading a file, and MaxThreads the most a
+	// request may ask for.
+	Threads    int
+	MaxThreads int
+	// Retries is the number of times a failed part is downloaded again, and MaxRetries the
+	// most a request may ask for.
+	Retries    int
+	MaxRetries int
+	// MaxFileSize is the size in bytes of the largest file downloaded. Zero is unlimited, and
+	// then nothing bounds the disk space a download takes.
+	MaxFileSize int64
+	// CookiesDir is the directory of the cookies files requests may name, and Cookies the
+	// file used when a request names none.
+	CookiesDir string
+	Cookies    string
+	// Proxy is the URL of the proxy the YouTube client and subtitle downloads go through. lux
+	// only goes through it after SetLuxProxy.
+	Proxy string
+	// MaxConcurrent is the number of downloads running at once across all requests.
+	MaxConcurrent int
+}
+
+// DefaultPolicy returns the settings used when none are configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		Threads:       8,
+		MaxThreads:    16,
+		Retries:       3,
+		MaxRetries:    10,
+		MaxConcurrent: 4,
+	}
+}
+
+// withDefaults replaces the zero values of p with the defaults and checks the result.
+func (p Policy) withDefaults() (Policy, error) {
+	defaults := DefaultPolicy()
+	if p.Threads == 0 {
+		p.Threads = defaults.Threads
+		if p.MaxThreads > 0 {
+			p.Threads = min(p.Threads, p.MaxThreads)
+		}
+	}
+	if p.MaxThreads == 0 {
+		p.MaxThreads = max(defaults.MaxThreads, p.Threads)
+	}
+	if p.Retries == 0 {
+		p.Retries = defaults.Retries
+		if p.MaxRetries > 0 {
+			p.Retries = min(p.Retries, p.MaxRetries)
+		}
+	}
+	if p.MaxRetries == 0 {
+		p.MaxRetries = max(defaults.MaxRetries, p.Retries)
+	}
+	if p.MaxConcurrent == 0 {
+		p.MaxConcurrent = defaults.MaxConcurrent
+	}
+	switch {
+	case p.Threads < 0 || p.MaxThreads < p.Threads:
+		return p, fmt.Errorf("threads %d must be between 1 and the maximum %d", p.Threads, p.MaxThreads)
+	case p.Retries < 0 || p.MaxRetries < p.Retries:
+		return p, fmt.Errorf("retries %d must be between 1 and the maximum %d", p.Retries, p.MaxRetries)
+	case p.MaxConcurrent < 0:
+		return p, errors.New("max concurrent downloads must be positive")
+	case p.MaxFileSize < 0:
+		return p, errors.New("max file size must not be negative")
+	case p.Cookies != "" && p.CookiesDir == "":
+		return p, errors.New("default cookies need a cookies directory")
+	}
+	if p.Proxy != "" {
+		if _, err := proxyURL(p.Proxy); err != nil {
+			return p, err
+		}
+	}
+	if p.Cookies != "" {
+		if _, err := p.cookies(p.Cookies); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// resolve checks opts against the policy and fills in its defaults.
+func (p Policy) resolve(opts services.DownloadOptions) (services.DownloadOptions, error) {
+	switch {
+	case opts.Threads < 0 || opts.Threads > p.MaxThreads:
+		return opts, fmt.Errorf("%w: threads must be between 1 and %d", ErrOptions, p.MaxThreads)
+	case opts.Retries < 0 || opts.Retries > p.MaxRetries:
+		return opts, fmt.Errorf("%w: retries must be between 1 and %d", ErrOptions, p.MaxRetries)
+	case opts.MaxFileSize < 0:
+		return opts, fmt.Errorf("%w: max file size must not be negative", ErrOptions)
+	case p.MaxFileSize > 0 && opts.MaxFileSize > p.MaxFileSize:
+		return opts, fmt.Errorf("%w: max file size must be at most %d bytes", ErrOptions, p.MaxFileSize)
+	}
+	if opts.Threads == 0 {
+		opts.Threads = p.Threads
+	}
+	if opts.Retries == 0 {
+		opts.Retries = p.Retries
+	}
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = p.MaxFileSize
+	}
+	if opts.Cookies == "" {
+		opts.Cookies = p.Cookies
+	}
+	return opts, nil
+}
+
+// cookies returns the contents of the cookies file name in the cookies directory. name must be a
+// file name, not a path, so requests cannot read other files of the server.
+func (p Policy) cookies(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if p.CookiesDir == "" {
+		return "", fmt.Errorf("%w: cookies are not enabled", ErrOptions)
+	}
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("%w: invalid cookies name %q", ErrOptions, name)
+	}
+	file, err := os.Open(filepath.Join(p.CookiesDir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%w: unknown cookies %q", ErrOptions, name)
+		}
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxCookiesSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read cookies %q: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// httpClient returns the client of the YouTube client and subtitle downloads.
+func (p Policy) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.Proxy != "" {
+		proxy, _ := proxyURL(p.Proxy)
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// SetLuxProxy sends the requests of lux through proxy. lux builds its transports with
+// http.ProxyFromEnvironment, which reads the environment on its first call and keeps the result,
+// so proxy is set in the environment for that first call only and the environment is restored.
+// http.DefaultTransport, which lux doesn't use, gets the proxy of the environment back. It must
+// run before any request of the process; the short links of ixigua, which lux resolves with the
+// default client, don't go through proxy.
+func SetLuxProxy(proxy string) error {
+	target, err := proxyURL(proxy)
+	if err != nil {
+		return err
+	}
+	environment := httpproxy.FromEnvironment().ProxyFunc()
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY"} {
+		previous, set := os.LookupEnv(name)
+		if err := os.Setenv(name, proxy); err != nil {
+			return err
+		}
+		if set {
+			defer os.Setenv(name, previous)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	probe := &http.Request{URL: &url.URL{Scheme: "https", Host: "example.com"}}
+	if got, err := http.ProxyFromEnvironment(probe); err != nil || got == nil || got.String() != target.String() {
+		return errors.New("the proxy of the environment was read before the download proxy could be set")
+	}
+	http.DefaultTransport.(*http.Transport).Proxy = func(req *http.Request) (*url.URL, error) {
+		return environment(req.URL)
+	}
+	return nil
+}
+
+func proxyURL(raw string) (*url.URL, error) {
+	proxy, err := url.Parse(raw)
+	if err != nil || proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", raw)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5":
+		return proxy, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+}
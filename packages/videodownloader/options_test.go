@@ -0,0 +1,121 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kingmariano/omnicron/services"
+)
+
+func TestPolicyResolve(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bilibili.txt"), []byte("SESSDATA=abc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := Policy{MaxFileSize: 100 << 20, CookiesDir: dir}.withDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := policy.resolve(services.DownloadOptions{Format: "720p", Retries: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := services.DownloadOptions{Format: "720p", Threads: 8, Retries: 5, MaxFileSize: 100 << 20}
+	if opts != want {
+		t.Errorf("resolve() = %+v, want %+v", opts, want)
+	}
+
+	for _, opts := range []services.DownloadOptions{
+		{Threads: 17},
+		{Retries: -1},
+		{MaxFileSize: 200 << 20},
+	} {
+		if _, err := policy.resolve(opts); !errors.Is(err, ErrOptions) {
+			t.Errorf("resolve(%+v) error = %v, want ErrOptions", opts, err)
+		}
+	}
+
+	unlimited, err := Policy{}.withDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unlimited.resolve(services.DownloadOptions{MaxFileSize: -1}); err == nil || err.Error() != "invalid download options: max file size must not be negative" {
+		t.Errorf("resolve() error = %v", err)
+	}
+
+	cookie, err := policy.cookies("bilibili.txt")
+	if err != nil || cookie != "SESSDATA=abc" {
+		t.Errorf("cookies() = %q, %v", cookie, err)
+	}
+	for _, name := range []string{"../bilibili.txt", "missing.txt", ".hidden"} {
+		if _, err := policy.cookies(name); !errors.Is(err, ErrOptions) {
+			t.Errorf("cookies(%q) error = %v, want ErrOptions", name, err)
+		}
+	}
+
+	if _, err := (Policy{Threads: 32, MaxThreads: 16}).withDefaults(); err == nil {
+		t.Error("withDefaults() accepted threads above the maximum")
+	}
+	if _, err := (Policy{Proxy: "ftp://proxy:21"}).withDefaults(); err == nil {
+		t.Error("withDefaults() accepted an ftp proxy")
+	}
+}
+
+func TestDownloadWaitsForASlot(t *testing.T) {
+	d, err := NewLuxDownloader(Policy{MaxConcurrent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = d.Download(ctx, "https://youtu.be/ZT0yQgUIZho", "video", t.TempDir(), services.DownloadOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Download() error = %v, want the context deadline while every slot is taken", err)
+	}
+
+	if _, err := d.Download(context.Background(), "https://youtu.be/ZT0yQgUIZho", "video", t.TempDir(), services.DownloadOptions{Threads: 100}); !errors.Is(err, ErrOptions) {
+		t.Errorf("Download() error = %v, want ErrOptions", err)
+	}
+}
+
+func TestValidateChecksCookies(t *testing.T) {
+	d, err := NewLuxDownloader(Policy{CookiesDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Validate(services.DownloadOptions{Threads: 4}); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	for _, opts := range []services.DownloadOptions{{Threads: 100}, {Cookies: "missing.txt"}} {
+		if err := d.Validate(opts); !errors.Is(err, ErrOptions) {
+			t.Errorf("Validate(%+v) error = %v, want ErrOptions", opts, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/iawia002/lux/extractors"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kkdai/youtube/v2"
+)
+
+// Playlist lists at most maxVideos videos of the playlist at playlistURL. YouTube playlists are
+// listed with the client the lux YouTube extractor is built on, as lux would resolve the streams
+// of every video up front, and a channel URL of the form /channel/UC... lists the uploads of the
+// channel. Other sites are listed by lux.
+func (d *LuxDownloader) Playlist(ctx context.Context, playlistURL string, maxVideos int) (*services.Playlist, error) {
+	if !isYouTube(playlistURL) {
+		return d.luxPlaylist(ctx, playlistURL, maxVideos)
+	}
+	id, err := playlistID(playlistURL)
+	if err != nil {
+		return nil, err
+	}
+	client := youtube.Client{HTTPClient: d.client}
+	playlist, err := client.GetPlaylistContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the playlist: %w", err)
+	}
+	result := &services.Playlist{Title: playlist.Title}
+	for _, entry := range playlist.Videos[:min(len(playlist.Videos), maxVideos)] {
+		result.Videos = append(result.Videos, services.PlaylistVideo{
+			ID:       entry.ID,
+			Title:    entry.Title,
+			URL:      "https://www.youtube.com/watch?v=" + entry.ID,
+			Duration: entry.Duration,
+		})
+	}
+	return result, nil
+}
+
+// luxPlaylist lists the first maxVideos videos lux extracts from playlistURL as a playlist, such
+// as the parts of a multi-part bilibili video. Videos are numbered within the playlist, as some of
+// them share its URL. lux can't be cancelled, so when ctx is done the extraction is left to finish
+// in the background.
+func (d *LuxDownloader) luxPlaylist(ctx context.Context, playlistURL string, maxVideos int) (*services.Playlist, error) {
+	cookie, err := d.policy.cookies(d.policy.Cookies)
+	if err != nil {
+		return nil, err
+	}
+	type extraction struct {
+		data []*extractors.Data
+		err  error
+	}
+	done := make(chan extraction, 1)
+	go func() {
+		// lux leaves the items past the end of the playlist nil
+		data, err := extractors.Extract(playlistURL, extractors.Options{Playlist: true, ItemStart: 1, ItemEnd: maxVideos, Cookie: cookie})
+		done <- extraction{data, err}
+	}()
+	var extracted extraction
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case extracted = <-done:
+	}
+	if extracted.err != nil {
+		return nil, fmt.Errorf("failed to list the playlist: %w", extracted.err)
+	}
+	result := &services.Playlist{}
+	for i, video := range extracted.data[:min(len(extracted.data), maxVideos)] {
+		if video == nil {
+			continue
+		}
+		result.Videos = append(result.Videos, services.PlaylistVideo{Title: video.Title, URL: playlistURL, Item: i + 1})
+	}
+	return result, nil
+}
+
+// playlistID returns the ID of the playlist at playlistURL. The uploads of channel UCxxx are
+// the playlist UUxxx.
+func playlistID(playlistURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(playlistURL))
+	if err != nil {
+		return "", err
+	}
+	if list := u.Query().Get("list"); list != "" {
+		return list, nil
+	}
+	if channel, ok := strings.CutPrefix(u.Path, "/channel/"); ok {
+		channel, _, _ = strings.Cut(channel, "/")
+		if rest, ok := strings.CutPrefix(channel, "UC"); ok && rest != "" {
+			return "UU" + rest, nil
+		}
+	}
+	if strings.HasPrefix(u.Path, "/@") || strings.HasPrefix(u.Path, "/c/") || strings.HasPrefix(u.Path, "/user/") {
+		return "", errors.New("channel names aren't supported, use the channel's /channel/UC... URL")
+	}
+	return "", errors.New("not a playlist or channel URL")
+}
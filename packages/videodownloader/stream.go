@@ -0,0 +1,279 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/clip"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// Delivery modes of DownloadVideo.
+const (
+	DeliveryURL    = "url"
+	DeliveryStream = "stream"
+)
+
+// delivery returns the delivery mode of r. The delivery query parameter takes
+// precedence over an Accept header asking for a video.
+func delivery(r *http.Request) (string, error) {
+	switch mode := r.URL.Query().Get("delivery"); mode {
+	case DeliveryURL, DeliveryStream:
+		return mode, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown delivery %q, expected %q or %q", mode, DeliveryURL, DeliveryStream)
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && strings.HasPrefix(mediaType, "video/") {
+			return DeliveryStream, nil
+		}
+	}
+	return DeliveryURL, nil
+}
+
+// The streamed videos are kept for streamTTL, but at most maxStreamEntries of them taking up to
+// maxStreamBytes. Beyond that the oldest are removed first.
+var (
+	streamTTL              = 10 * time.Minute
+	maxStreamEntries       = 32
+	maxStreamBytes   int64 = 4 << 30
+)
+
+// streamBasePath is the prefix of the folders of streamed videos, told apart from the folders of
+// other downloads so SweepStreams can remove them.
+func streamBasePath() string {
+	return utils.BasePath + "-stream-"
+}
+
+// SweepStreams removes the streamed videos kept by a previous run of the server.
+func SweepStreams() error {
+	folders, err := filepath.Glob(streamBasePath() + "*")
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		if err := utils.DeleteFolder(folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamEntry is a streamed video kept in a streamCache.
+type streamEntry struct {
+	key    string
+	path   string
+	folder string
+	size   int64
+	seq    uint64
+	timer  *time.Timer
+	// refs counts the requests serving the video. The folder of a removed entry is only
+	// deleted once none is left.
+	refs    int
+	removed bool
+}
+
+// streamCache keeps the streamed videos, so that resuming a download with Range doesn't
+// download the video again.
+type streamCache struct {
+	mu      sync.Mutex
+	entries map[string]*streamEntry
+	bytes   int64
+	seq     uint64
+}
+
+// acquire returns the video kept for key, which stays on disk until it is released.
+func (c *streamCache) acquire(key string) (*streamEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if ok {
+		e.refs++
+	}
+	return e, ok
+}
+
+// put keeps the video at path for key and returns it acquired. The oldest videos are removed
+// while the cache holds too many.
+func (c *streamCache) put(key, path, folder string, size int64) *streamEntry {
+	c.mu.Lock()
+	c.seq++
+	e := &streamEntry{key: key, path: path, folder: folder, size: size, seq: c.seq, refs: 1}
+	if c.entries == nil {
+		c.entries = make(map[string]*streamEntry)
+	}
+	var folders []string
+	if old, ok := c.entries[key]; ok {
+		folders = append(folders, c.remove(old)...)
+	}
+	c.entries[key] = e
+	c.bytes += size
+	for len(c.entries) > maxStreamEntries || c.bytes > maxStreamBytes {
+		var oldest *streamEntry
+		for _, other := range c.entries {
+			if oldest == nil || other.seq < oldest.seq {
+				oldest = other
+			}
+		}
+		folders = append(folders, c.remove(oldest)...)
+	}
+	if !e.removed {
+		e.timer = time.AfterFunc(streamTTL, func() {
+			c.mu.Lock()
+			folders := c.remove(e)
+			c.mu.Unlock()
+			deleteStreams(folders)
+		})
+	}
+	c.mu.Unlock()
+	deleteStreams(folders)
+	return e
+}
+
+// release ends a request serving e.
+func (c *streamCache) release(e *streamEntry) {
+	c.mu.Lock()
+	e.refs--
+	done := e.removed && e.refs == 0
+	c.mu.Unlock()
+	if done {
+		deleteStreams([]string{e.folder})
+	}
+}
+
+// remove takes e out of the cache and returns its folder if no request is serving it.
+// c.mu must be held.
+func (c *streamCache) remove(e *streamEntry) []string {
+	if e.removed {
+		return nil
+	}
+	e.removed = true
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	if c.entries[e.key] == e {
+		delete(c.entries, e.key)
+	}
+	c.bytes -= e.size
+	if e.refs > 0 {
+		return nil
+	}
+	return []string{e.folder}
+}
+
+func deleteStreams(folders []string) {
+	for _, folder := range folders {
+		if err := utils.DeleteFolder(folder); err != nil {
+			log.Printf("removing %s: %v", folder, err)
+		}
+	}
+}
+
+// streamVideo downloads the video and writes it to w, serving Range requests. The video is kept
+// in h.streams, and requests for the same video are served from it.
+func (h *Handler) streamVideo(w http.ResponseWriter, r *http.Request, params DownloadParams, segments []clip.Segment, subs []services.Subtitle) {
+	key := videoKey(auth.Owner(r.Context()), params)
+	entry, ok := h.streams.acquire(key)
+	if !ok {
+		folderPath, err := utils.CreateUniqueFolder(streamBasePath())
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		videoPath, err := h.prepareStream(r.Context(), folderPath, params, segments, subs)
+		var info os.FileInfo
+		if err == nil {
+			info, err = os.Stat(videoPath)
+		}
+		if err != nil {
+			deleteStreams([]string{folderPath})
+			utils.RespondWithError(w, downloadStatus(err), err.Error())
+			return
+		}
+		entry = h.streams.put(key, videoPath, folderPath, info.Size())
+	}
+	defer h.streams.release(entry)
+	file, err := os.Open(entry.path)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := filepath.Base(entry.path)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	// A video downloaded again after it was removed has a new modification time. The ETag stays
+	// the same for the same video and size, letting clients resume with If-Range.
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, key[:16], info.Size()))
+	http.ServeContent(w, r, name, time.Time{}, file)
+}
+
+// prepareStream downloads the video into folderPath, embeds its subtitles and cuts its segments,
+// and returns the path of the file to stream.
+func (h *Handler) prepareStream(ctx context.Context, folderPath string, params DownloadParams, segments []clip.Segment, subs []services.Subtitle) (string, error) {
+	videoPath, err := h.downloader.Download(ctx, params.URL, utils.OutputName, folderPath, params.downloadOptions())
+	if err != nil {
+		return "", fmt.Errorf("Conversion failed: %w", err)
+	}
+	if len(subs) > 0 {
+		if videoPath, err = h.embedSubtitles(ctx, videoPath, subs); err != nil {
+			return "", err
+		}
+	}
+	if len(segments) > 0 {
+		clips, err := clip.Cut(ctx, h.transcoder, videoPath, segments, params.Join, params.Reencode)
+		if err != nil {
+			return "", err
+		}
+		videoPath = clips[0]
+	}
+	return videoPath, nil
+}
+
+// videoKey identifies the file downloaded for params by owner.
+func videoKey(owner string, params DownloadParams) string {
+	opts := params.downloadOptions()
+	options, _ := json.Marshal([]interface{}{params.Options, params.Subtitles, params.EmbedSubtitles, opts})
+	sum := sha256.Sum256([]byte(owner + "\x00" + params.URL + "\x00" + string(options)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+type fakeDownloader struct {
+	content string
+	fail    string
+
+	mu      sync.Mutex
+	folders []string
+	// items are the playlist items downloaded.
+	items []int
+}
+
+func (f *fakeDownloader) Download(ctx context.Context, url, outputName, outputPath string, opts services.DownloadOptions) (string, error) {
+	f.mu.Lock()
+	f.folders = append(f.folders, outputPath)
+	if opts.PlaylistItem > 0 {
+		f.items = append(f.items, opts.PlaylistItem)
+	}
+	f.mu.Unlock()
+	if url == f.fail {
+		return "", errors.New("video unavailable")
+	}
+	path := filepath.Join(outputPath, outputName+".mp4")
+	return path, os.WriteFile(path, []byte(f.content), 0o600)
+}
+
+// Validate rejects cookies, like a policy without a cookies directory.
+func (f *fakeDownloader) Validate(opts services.DownloadOptions) error {
+	if opts.Cookies != "" {
+		return fmt.Errorf("%w: cookies are not enabled", ErrOptions)
+	}
+	return nil
+}
+
+func TestStreamVideoServesRange(t *testing.T) {
+	basePath := utils.BasePath
+	utils.BasePath = t.TempDir() + "/"
+	t.Cleanup(func() { utils.BasePath = basePath })
+	ttl := streamTTL
+	streamTTL = 200 * time.Millisecond
+	t.Cleanup(func() { streamTTL = ttl })
+
+	downloader := &fakeDownloader{content: "0123456789"}
+	h := NewHandler(downloader, nil, nil, nil, nil, nil)
+	body := `{"url": "https://youtu.be/ZT0yQgUIZho", "resolution": "720p"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/downloadvideo?delivery=stream", strings.NewReader(body))
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	h.DownloadVideo(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Body.String(); got != "2345" {
+		t.Errorf("body = %q, want %q", got, "2345")
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename=youtube.mp4` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	etag := rec.Header().Get("ETag")
+
+	// Resuming with the ETag of the first response gets the rest of the file without
+	// downloading it again.
+	req = httptest.NewRequest(http.MethodPost, "/downloadvideo", strings.NewReader(body))
+	req.Header.Set("Accept", "video/mp4")
+	req.Header.Set("Range", "bytes=6-")
+	req.Header.Set("If-Range", etag)
+	rec = httptest.NewRecorder()
+	h.DownloadVideo(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("resumed status = %d", rec.Code)
+	}
+	if got, _ := io.ReadAll(rec.Body); string(got) != "6789" {
+		t.Errorf("resumed body = %q, want %q", got, "6789")
+	}
+
+	key := videoKey("", DownloadParams{URL: "https://youtu.be/ZT0yQgUIZho", Resolution: "720p"})
+	entry, ok := h.streams.acquire(key)
+	if !ok || len(downloader.folders) != 1 {
+		t.Fatalf("expected the video to be downloaded once and kept, got %d downloads", len(downloader.folders))
+	}
+	h.streams.release(entry)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, folder := range downloader.folders {
+		for _, err := os.Stat(folder); !os.IsNotExist(err); _, err = os.Stat(folder) {
+			if time.Now().After(deadline) {
+				t.Fatalf("folder %s was not removed: %v", folder, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if _, ok := h.streams.acquire(key); ok {
+		t.Error("the video is still kept after it was removed")
+	}
+}
+
+func TestStreamCacheEvictsOldestAfterRelease(t *testing.T) {
+	entries := maxStreamEntries
+	maxStreamEntries = 2
+	t.Cleanup(func() { maxStreamEntries = entries })
+
+	var c streamCache
+	folders := make([]string, 3)
+	served := make([]*streamEntry, 3)
+	for i := range folders {
+		folders[i] = t.TempDir()
+		served[i] = c.put(fmt.Sprint(i), filepath.Join(folders[i], "video.mp4"), folders[i], 10)
+	}
+	c.release(served[1])
+	c.release(served[2])
+	if _, ok := c.acquire("0"); ok {
+		t.Error("the oldest video is still kept")
+	}
+	// the first video is still being served, so its folder stays until it is released
+	if _, err := os.Stat(folders[0]); err != nil {
+		t.Fatalf("folder of a served video was removed: %v", err)
+	}
+	c.release(served[0])
+	if _, err := os.Stat(folders[0]); !os.IsNotExist(err) {
+		t.Errorf("folder of the evicted video was not removed: %v", err)
+	}
+	if e, ok := c.acquire("2"); !ok || c.bytes != 20 {
+		t.Errorf("got %v, %d bytes, want the newest video and 20 bytes", ok, c.bytes)
+	} else {
+		c.release(e)
+	}
+}
+
+func TestSweepStreams(t *testing.T) {
+	basePath := utils.BasePath
+	utils.BasePath = filepath.Join(t.TempDir(), "downloads")
+	t.Cleanup(func() { utils.BasePath = basePath })
+
+	stream, err := utils.CreateUniqueFolder(streamBasePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := utils.CreateUniqueFolder(utils.BasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SweepStreams(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stream); !os.IsNotExist(err) {
+		t.Errorf("stream folder was not removed: %v", err)
+	}
+	if _, err := os.Stat(download); err != nil {
+		t.Errorf("download folder was removed: %v", err)
+	}
+}
+
+func TestDeliveryRejectsUnknownMode(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/downloadvideo?delivery=email", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	NewHandler(&fakeDownloader{}, nil, nil, nil, nil, nil).DownloadVideo(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
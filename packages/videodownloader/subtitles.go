@@ -0,0 +1,216 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iawia002/lux/extractors"
+	"github.com/kingmariano/omnicron/internal/subtitles"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kkdai/youtube/v2"
+)
+
+// ErrNoSubtitles is returned when a video has no subtitles in a requested language.
+var ErrNoSubtitles = errors.New("no subtitles")
+
+const maxSubtitleSize = 10 << 20
+
+const subtitleTimeout = 30 * time.Second
+
+// subtitleSource is a subtitle track and where to download it from.
+type subtitleSource struct {
+	track     services.SubtitleTrack
+	url       string
+	format    string
+	transform func([]byte) ([]byte, error)
+}
+
+// Subtitles downloads the subtitles of the video at videoURL in languages. YouTube captions are
+// listed with the YouTube client, and the subtitles of other sites are the captions lux extracts.
+func (d *LuxDownloader) Subtitles(ctx context.Context, videoURL string, languages []string) ([]services.Subtitle, error) {
+	var sources []subtitleSource
+	if isYouTube(videoURL) {
+		client := youtube.Client{HTTPClient: d.client}
+		video, err := client.GetVideoContext(ctx, videoURL)
+		if err != nil {
+			return nil, err
+		}
+		sources = youtubeSubtitles(video)
+	} else {
+		video, err := d.extract(videoURL)
+		if err != nil {
+			return nil, err
+		}
+		sources = luxSubtitles(video.Captions)
+	}
+	selected, err := selectSubtitles(sources, languages)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]services.Subtitle, 0, len(selected))
+	for _, source := range selected {
+		data, err := fetchSubtitle(ctx, d.client, source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download the %s subtitles: %w", source.track.Language, err)
+		}
+		result = append(result, services.Subtitle{SubtitleTrack: source.track, Format: source.format, Data: data})
+	}
+	return result, nil
+}
+
+// youtubeSubtitles lists the caption tracks of a YouTube video, downloaded as WebVTT.
+func youtubeSubtitles(video *youtube.Video) []subtitleSource {
+	sources := make([]subtitleSource, 0, len(video.CaptionTracks))
+	for _, track := range video.CaptionTracks {
+		sources = append(sources, subtitleSource{
+			track: services.SubtitleTrack{
+				Language:  track.LanguageCode,
+				Name:      track.Name.SimpleText,
+				Automatic: track.Kind == "asr",
+			},
+			url:    track.BaseURL + "&fmt=vtt",
+			format: subtitles.VTT,
+		})
+	}
+	return sources
+}
+
+// luxSubtitles lists the SRT and WebVTT captions extracted by lux, named by their key. Other
+// captions, such as the danmaku comments of bilibili, are skipped.
+func luxSubtitles(captions map[string]*extractors.CaptionPart) []subtitleSource {
+	var sources []subtitleSource
+	for name, caption := range captions {
+		if caption == nil || (caption.Ext != subtitles.SRT && caption.Ext != subtitles.VTT) {
+			continue
+		}
+		sources = append(sources, subtitleSource{
+			track:     services.SubtitleTrack{Language: name},
+			url:       caption.URL,
+			format:    caption.Ext,
+			transform: caption.Transform,
+		})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].track.Language < sources[j].track.Language })
+	return sources
+}
+
+func subtitleTracks(sources []subtitleSource) []services.SubtitleTrack {
+	tracks := make([]services.SubtitleTrack, len(sources))
+	for i, source := range sources {
+		tracks[i] = source.track
+	}
+	return tracks
+}
+
+// selectSubtitles picks a source for every language. A language matches its exact code first,
+// then codes of the same base language, so en matches en-GB. Subtitles written by people are
+// preferred over automatic ones.
+func selectSubtitles(sources []subtitleSource, languages []string) ([]subtitleSource, error) {
+	selected := make([]subtitleSource, 0, len(languages))
+	for _, language := range languages {
+		source, ok := matchSubtitle(sources, func(code string) bool { return strings.EqualFold(code, language) })
+		if !ok {
+			base, _, _ := strings.Cut(language, "-")
+			source, ok = matchSubtitle(sources, func(code string) bool {
+				codeBase, _, _ := strings.Cut(code, "-")
+				return strings.EqualFold(codeBase, base)
+			})
+		}
+		if !ok {
+			var available []string
+			for _, source := range sources {
+				available = append(available, source.track.Language)
+			}
+			if len(available) == 0 {
+				return nil, fmt.Errorf("%w: the video has no subtitles", ErrNoSubtitles)
+			}
+			return nil, fmt.Errorf("%w in %q, the video has %s", ErrNoSubtitles, language, strings.Join(available, ", "))
+		}
+		selected = append(selected, source)
+	}
+	return selected, nil
+}
+
+func matchSubtitle(sources []subtitleSource, match func(code string) bool) (subtitleSource, bool) {
+	var automatic *subtitleSource
+	for i, source := range sources {
+		if !match(source.track.Language) {
+			continue
+		}
+		if !source.track.Automatic {
+			return source, true
+		}
+		if automatic == nil {
+			automatic = &sources[i]
+		}
+	}
+	if automatic != nil {
+		return *automatic, true
+	}
+	return subtitleSource{}, false
+}
+
+func fetchSubtitle(ctx context.Context, client *http.Client, source subtitleSource) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, subtitleTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status " + resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSubtitleSize))
+	if err != nil {
+		return nil, err
+	}
+	if source.transform != nil {
+		return source.transform(data)
+	}
+	return data, nil
+}
+
+// isYouTube reports whether rawURL is a YouTube video URL.
+func isYouTube(rawURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m.", "music."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	return host == "youtube.com" || host == "youtu.be"
+}
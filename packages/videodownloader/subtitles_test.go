@@ -0,0 +1,147 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package videodownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iawia002/lux/extractors"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+)
+
+func TestSelectSubtitles(t *testing.T) {
+	sources := []subtitleSource{
+		{track: services.SubtitleTrack{Language: "en", Automatic: true}},
+		{track: services.SubtitleTrack{Language: "en-GB", Name: "English (UK)"}},
+		{track: services.SubtitleTrack{Language: "fr"}},
+	}
+	selected, err := selectSubtitles(sources, []string{"en", "EN-gb", "fr-CA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, source := range selected {
+		got = append(got, source.track.Language)
+	}
+	if want := []string{"en", "en-GB", "fr"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selected %v, want %v", got, want)
+	}
+	if _, err := selectSubtitles(sources, []string{"de"}); !errors.Is(err, ErrNoSubtitles) || !strings.Contains(err.Error(), "en, en-GB, fr") {
+		t.Errorf("expected ErrNoSubtitles listing the languages, got %v", err)
+	}
+
+	captions := map[string]*extractors.CaptionPart{
+		"danmaku":  {Part: extractors.Part{URL: "https://comment.bilibili.com/1.xml", Ext: "xml"}},
+		"subtitle": {Part: extractors.Part{URL: "https://i0.hdslb.com/1.json", Ext: "srt"}},
+	}
+	if tracks := subtitleTracks(luxSubtitles(captions)); len(tracks) != 1 || tracks[0].Language != "subtitle" {
+		t.Errorf("lux subtitles = %+v", tracks)
+	}
+}
+
+type fakeInspector struct{}
+
+func (fakeInspector) Info(ctx context.Context, url string) (*services.VideoInfo, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (fakeInspector) Subtitles(ctx context.Context, url string, languages []string) ([]services.Subtitle, error) {
+	var subs []services.Subtitle
+	for _, language := range languages {
+		if language != "en" {
+			return nil, ErrNoSubtitles
+		}
+		subs = append(subs, services.Subtitle{
+			SubtitleTrack: services.SubtitleTrack{Language: "en"},
+			Format:        "srt",
+			Data:          []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n"),
+		})
+	}
+	return subs, nil
+}
+
+// muxTranscoder records the subtitles it muxes.
+type muxTranscoder struct {
+	services.Transcoder
+	muxed []services.SubtitleFile
+}
+
+func (m *muxTranscoder) MuxSubtitles(ctx context.Context, input string, subtitles []services.SubtitleFile, output string) error {
+	for _, subtitle := range subtitles {
+		if _, err := os.Stat(subtitle.Path); err != nil {
+			return err
+		}
+	}
+	m.muxed = subtitles
+	return os.WriteFile(output, []byte("video with subtitles"), 0600)
+}
+
+func TestDownloadVideoWithSubtitles(t *testing.T) {
+	basePath := utils.BasePath
+	utils.BasePath = t.TempDir() + "/"
+	t.Cleanup(func() { utils.BasePath = basePath })
+
+	transcoder := &muxTranscoder{}
+	storage := &fakeStorage{}
+	h := NewHandler(&fakeDownloader{content: "video"}, fakeInspector{}, nil, transcoder, storage, nil)
+
+	body := `{"url": "https://youtu.be/ZT0yQgUIZho", "subtitles": ["en"], "subtitle_format": "vtt", "embed_subtitles": true}`
+	rec := httptest.NewRecorder()
+	h.DownloadVideo(rec, httptest.NewRequest(http.MethodPost, "/downloadvideo", strings.NewReader(body)))
+	var response ResponseMsg
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	if response.Response != "https://cdn.example.com/youtube_subtitled.mp4" {
+		t.Errorf("response = %q", response.Response)
+	}
+	if len(transcoder.muxed) != 1 || transcoder.muxed[0].Language != "en" {
+		t.Errorf("muxed %+v", transcoder.muxed)
+	}
+	want := []SubtitleResult{{Language: "en", Format: "vtt", URL: "https://cdn.example.com/youtube.1.en.vtt"}}
+	if !reflect.DeepEqual(response.Subtitles, want) {
+		t.Errorf("subtitles = %+v, want %+v", response.Subtitles, want)
+	}
+	if got := storage.contents["youtube.1.en.vtt"]; got != "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n\n" {
+		t.Errorf("uploaded subtitles = %q", got)
+	}
+
+	for _, body := range []string{
+		`{"url": "https://youtu.be/ZT0yQgUIZho", "subtitles": ["de"]}`,
+		`{"url": "https://youtu.be/ZT0yQgUIZho", "subtitles": ["en"], "subtitle_format": "ass"}`,
+		`{"url": "https://youtu.be/ZT0yQgUIZho", "embed_subtitles": true}`,
+	} {
+		rec := httptest.NewRecorder()
+		h.DownloadVideo(rec, httptest.NewRequest(http.MethodPost, "/downloadvideo", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
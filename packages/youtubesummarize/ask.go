@@ -0,0 +1,275 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+const (
+	askTemplate   = "youtube.ask"
+	excerptChars  = 800 // length of the excerpts of a transcript questions are answered from
+	snippetLength = 300
+)
+
+var (
+	errVideoNotTranscribed = errors.New("the video hasn't been transcribed, send its url")
+	errQuestionTooLong     = errors.New("the question is too long for the model")
+)
+
+// excerpt is a run of consecutive segments of a transcript, from Start to End seconds.
+type excerpt struct {
+	Start, End float64
+	Lines      []string
+	// starts are the start times of Lines.
+	starts []float64
+	score  float64
+}
+
+func (e excerpt) text() string {
+	return strings.Join(e.Lines, "\n")
+}
+
+// textFrom returns the lines of the excerpt from the one said at seconds.
+func (e excerpt) textFrom(seconds float64) string {
+	i := sort.Search(len(e.starts), func(i int) bool { return math.Floor(e.starts[i]) > seconds }) - 1
+	return strings.Join(e.Lines[max(i, 0):], "\n")
+}
+
+// ask answers params.Question from the transcript of the video, transcribing it first unless
+// only its ID is given.
+func (h *Handler) ask(ctx context.Context, params AskParams, template *prompts.Template, model string) (*AskResponse, error) {
+	youtubeURL, id := params.URL, params.VideoID
+	var transcript *Transcript
+	transcriber := params.Transcriber
+	if youtubeURL == "" {
+		var err error
+		if transcript, transcriber, err = h.cachedTranscript(id, transcriber); err != nil {
+			return nil, err
+		}
+		youtubeURL = "https://www.youtube.com/watch?v=" + id
+	} else {
+		id = videoID(youtubeURL)
+		var err error
+		if transcript, err = h.transcribe(ctx, youtubeURL, transcriber); err != nil {
+			return nil, err
+		}
+	}
+	excerpts := transcriptExcerpts(transcript)
+	if len(excerpts) == 0 {
+		return nil, errNoTimestamps
+	}
+
+	empty, err := template.Execute(PromptData{URL: youtubeURL})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTemplate, err)
+	}
+	window := h.router.ContextWindow(model)
+	budget := window - llm.ReplyReserve(window) - gpt.EstimateTokens(empty) - gpt.EstimateTokens(params.Question)
+	if budget <= 0 {
+		return nil, errQuestionTooLong
+	}
+	selected := selectExcerpts(excerpts, params.Question, budget)
+	texts := make([]string, len(selected))
+	for i, e := range selected {
+		texts[i] = e.text()
+	}
+	system, err := template.Execute(PromptData{URL: youtubeURL, Excerpts: strings.Join(texts, "\n\n")})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTemplate, err)
+	}
+	completion, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: "system", Content: system},
+			{Role: "user", Content: params.Question},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to answer with model %s: %v", model, err)
+	}
+	answer := completion.Choices[0].Message.Content
+	return &AskResponse{
+		Answer:      answer,
+		VideoID:     id,
+		Model:       completion.Model,
+		Transcriber: transcriber,
+		Citations:   timestampCitations(answer, selected, youtubeURL),
+		Partial:     len(selected) < len(excerpts),
+	}, nil
+}
+
+// cachedTranscript returns the transcript of the video id made by transcriber, or by any
+// transcriber if it is empty, and the transcriber that made it.
+func (h *Handler) cachedTranscript(id, transcriber string) (*Transcript, string, error) {
+	candidates := []string{transcriber}
+	if transcriber == "" {
+		candidates = []string{h.stt.defaultTranscriber(), TranscriberReplicate, TranscriberGroq}
+	}
+	if h.store != nil {
+		for _, candidate := range candidates {
+			var transcript Transcript
+			if err := h.store.Get(transcriptsPath, candidate+":"+id, &transcript); err == nil {
+				return &transcript, candidate, nil
+			}
+		}
+	}
+	return nil, "", errVideoNotTranscribed
+}
+
+// transcriptExcerpts groups the segments of transcript into excerpts of about excerptChars.
+func transcriptExcerpts(transcript *Transcript) []excerpt {
+	var excerpts []excerpt
+	var current *excerpt
+	length := 0
+	for _, segment := range transcript.Segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		if current == nil || length >= excerptChars {
+			if current != nil {
+				current.End = segment.Start
+			}
+			excerpts = append(excerpts, excerpt{Start: segment.Start, End: math.Inf(1)})
+			current, length = &excerpts[len(excerpts)-1], 0
+		}
+		current.Lines = append(current.Lines, fmt.Sprintf("[%s] %s", formatTimestamp(int(segment.Start)), text))
+		current.starts = append(current.starts, segment.Start)
+		length += len(text)
+	}
+	return excerpts
+}
+
+// selectExcerpts returns the excerpts most relevant to question that fit in budget tokens, in
+// the order of the video. Relevance is the tf-idf weight of the words of the question; if no
+// excerpt has any of them, the excerpts are taken from the start of the video.
+func selectExcerpts(excerpts []excerpt, question string, budget int) []excerpt {
+	total := 0
+	for _, e := range excerpts {
+		total += gpt.EstimateTokens(e.text()) + 1
+	}
+	if total <= budget {
+		return excerpts
+	}
+	terms := map[string]bool{}
+	for _, word := range words(question) {
+		terms[word] = true
+	}
+	counts := make([]map[string]int, len(excerpts))
+	frequency := map[string]int{}
+	for i, e := range excerpts {
+		counts[i] = map[string]int{}
+		for _, word := range words(e.text()) {
+			if terms[word] {
+				if counts[i][word] == 0 {
+					frequency[word]++
+				}
+				counts[i][word]++
+			}
+		}
+	}
+	ranked := make([]excerpt, len(excerpts))
+	copy(ranked, excerpts)
+	for i := range ranked {
+		for word, n := range counts[i] {
+			ranked[i].score += (1 + math.Log(float64(n))) * math.Log(1+float64(len(excerpts))/float64(frequency[word]))
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	var selected []excerpt
+	used := 0
+	for _, e := range ranked {
+		tokens := gpt.EstimateTokens(e.text()) + 1
+		if used+tokens > budget || (e.score == 0 && ranked[0].score > 0) {
+			continue
+		}
+		selected = append(selected, e)
+		used += tokens
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Start < selected[j].Start })
+	return selected
+}
+
+// words returns the lowercase words of text longer than two letters.
+func words(text string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len(word) > 2 {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// timestampPattern matches the [MM:SS] or [H:MM:SS] times cited in an answer.
+var timestampPattern = regexp.MustCompile(`\[((?:\d+:)?\d{1,2}:\d{2})\]`)
+
+// timestampCitations returns the times cited in answer that fall in one of excerpts, in order
+// of first citation.
+func timestampCitations(answer string, excerpts []excerpt, youtubeURL string) []TimestampCitation {
+	var citations []TimestampCitation
+	seen := map[int]bool{}
+	for _, match := range timestampPattern.FindAllStringSubmatch(answer, -1) {
+		start := parseTimestamp(match[1])
+		if seen[start] {
+			continue
+		}
+		seen[start] = true
+		for _, e := range excerpts {
+			if float64(start) >= math.Floor(e.Start) && float64(start) < e.End {
+				citations = append(citations, TimestampCitation{
+					Start:     start,
+					Timestamp: formatTimestamp(start),
+					URL:       chapterURL(youtubeURL, start),
+					Snippet:   snippet(e.textFrom(float64(start))),
+				})
+				break
+			}
+		}
+	}
+	return citations
+}
+
+// snippet shortens text to about snippetLength bytes, cutting between words.
+func snippet(text string) string {
+	if len(text) <= snippetLength {
+		return text
+	}
+	cut := strings.LastIndexByte(text[:snippetLength], ' ')
+	if cut <= 0 {
+		cut = snippetLength
+	}
+	return strings.ToValidUTF8(text[:cut], "") + "..."
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+// recordingProvider answers with answer and records the system prompts.
+type recordingProvider struct {
+	answer  string
+	mu      sync.Mutex
+	systems []string
+}
+
+func (p *recordingProvider) Name() string     { return "fake" }
+func (p *recordingProvider) Models() []string { return []string{"chat"} }
+
+func (p *recordingProvider) ChatCompletion(ctx context.Context, request llm.ChatCompletionRequest) (*llm.ChatCompletion, error) {
+	p.mu.Lock()
+	p.systems = append(p.systems, request.Messages[0].Content)
+	p.mu.Unlock()
+	return &llm.ChatCompletion{
+		Model:   "fake/" + request.Model,
+		Choices: []llm.Choice{{Message: llm.Message{Role: "assistant", Content: p.answer}}},
+	}, nil
+}
+
+func askVideo(t *testing.T, h *Handler, params AskParams) (int, AskResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	_ = json.NewEncoder(&body).Encode(params)
+	rec := httptest.NewRecorder()
+	h.Ask(rec, httptest.NewRequest(http.MethodPost, "/youtube/ask", &body))
+	var response AskResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+func TestAskCachedTranscript(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	var segments []Segment
+	for i := 0; i < 200; i++ {
+		text := fmt.Sprintf("Filler talk number %d about nothing in particular at all.", i)
+		if i == 150 {
+			text = "The secret ingredient of the recipe is smoked paprika."
+		}
+		segments = append(segments, Segment{Start: float64(i * 10), Text: text})
+	}
+	if err := s.Put(transcriptsPath, "groq:dQw4w9WgXcQ", Transcript{Segments: segments}); err != nil {
+		t.Fatal(err)
+	}
+	provider := &recordingProvider{answer: "Smoked paprika [25:00], not salt [00:00] [99:00]."}
+	router, err := llm.NewRouter(llm.Config{ContextWindows: map[string]int{"fake/chat": 1024}}, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(Transcription{}, nil, s, router, prompts.New())
+
+	code, response := askVideo(t, h, AskParams{VideoID: "dQw4w9WgXcQ", Question: "What is the secret ingredient?", Model: "fake/chat"})
+	if code != http.StatusOK || response.Transcriber != TranscriberGroq || !response.Partial {
+		t.Fatalf("ask: unexpected response %d %+v", code, response)
+	}
+	system := provider.systems[0]
+	if !strings.Contains(system, "[25:00] The secret ingredient") || strings.Contains(system, "[00:00]") {
+		t.Errorf("expected only the relevant part of the transcript in the prompt, got %q", system)
+	}
+	if len(response.Citations) != 1 || response.Citations[0].Start != 1500 ||
+		response.Citations[0].URL != "https://www.youtube.com/watch?t=1500s&v=dQw4w9WgXcQ" || !strings.Contains(response.Citations[0].Snippet, "paprika") {
+		t.Errorf("expected a citation of 25:00, got %+v", response.Citations)
+	}
+
+	if code, _ := askVideo(t, h, AskParams{VideoID: "aaaaaaaaaaa", Question: "?", Model: "fake/chat"}); code != http.StatusNotFound {
+		t.Errorf("untranscribed video: expected status 404, got %d", code)
+	}
+	if code, _ := askVideo(t, h, AskParams{Question: "?"}); code != http.StatusBadRequest {
+		t.Errorf("no video: expected status 400, got %d", code)
+	}
+}
@@ -20,113 +20,92 @@
 package youtubesummarize
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"mime/multipart"
-	"net/http"
-	"net/url"
-	"time"
 
-	"github.com/jpoz/groq"
+	"github.com/kingmariano/omnicron/internal/prompts"
 )
 
-type WhisperResponse struct {
-	CompletedAt time.Time   `json:"completed_at"`
-	CreatedAt   time.Time   `json:"created_at"`
-	DataRemoved bool        `json:"data_removed"`
-	Error       interface{} `json:"error"`
-	ID          string      `json:"id"`
-	Input       struct {
-		URL          string `json:"url"`
-		Task         string `json:"task"`
-		Timestamp    string `json:"timestamp"`
-		BatchSize    int    `json:"batch_size"`
-		DiariseAudio bool   `json:"diarise_audio"`
-	} `json:"input"`
-	Logs    string `json:"logs"`
-	Metrics struct {
-		PredictTime float64 `json:"predict_time"`
-		TotalTime   float64 `json:"total_time"`
-	} `json:"metrics"`
-	Output struct {
-		Text   string `json:"text"`
-		Chunks []struct {
-			Text      string    `json:"text"`
-			Timestamp []float64 `json:"timestamp"`
-		} `json:"chunks"`
-	} `json:"output"`
-	StartedAt time.Time `json:"started_at"`
-	Status    string    `json:"status"`
-	Urls      struct {
-		Get    string `json:"get"`
-		Cancel string `json:"cancel"`
-	} `json:"urls"`
-	Version string `json:"version"`
+// Summary modes.
+const (
+	ModeTLDR     = "tldr"
+	ModeBullets  = "bullets"
+	ModeChapters = "chapters"
+)
+
+// modeTemplates are the default system prompts of the summary modes.
+var modeTemplates = map[string]string{
+	ModeTLDR:     "youtube.summary",
+	ModeBullets:  "youtube.bullets",
+	ModeChapters: "youtube.chapters",
 }
 
-const baseURL = "http://localhost:9000/api/v1/replicate/stt" //
-// This function performs an api call to the replicate endpoint to transcribe the youtube video url and then sends the text to GPT AI MODEL to summarize.
-func handleYoutubeSummariztion(youtubeURL, apiKey, grokAPIKey string) (string, error) {
-	// Create a buffer to write our form data to
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-	// Create a form file field and write the url to it.
-	if err := w.WriteField("url", youtubeURL); err != nil {
-		return "", err
-	}
-	params := url.Values{}
-	params.Add("model", "turian/insanely-fast-whisper-with-video")
-	finalURL := baseURL + "?" + params.Encode()
-	//create the http client
-	// Close the multipart writer to set the terminating boundary
-	if err := w.Close(); err != nil {
+// PromptData is the data of the summary prompt templates.
+type PromptData struct {
+	// URL is the url of the video.
+	URL string
+	// Partial is set when the transcript was too long for the model and the user message holds
+	// notes on its parts instead.
+	Partial bool
+	// Excerpts are the parts of the transcript a question is answered from, one per line
+	// starting with its time as [MM:SS].
+	Excerpts string
+	// Title is the title of the playlist and Count the number of videos of a digest.
+	Title string
+	Count int
+}
+
+// Summarize transcribes the youtube video url and summarizes the transcript in tldr mode with the default prompt template and model.
+func (h *Handler) Summarize(ctx context.Context, youtubeURL string) (string, error) {
+	template, model, err := h.summaryPrompt(ModeTLDR, "", "")
+	if err != nil {
 		return "", err
 	}
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", finalURL, &b)
+	summary, err := h.summarize(ctx, youtubeURL, h.stt.defaultTranscriber(), ModeTLDR, template, model)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Api-Key", apiKey)
-	resp, err := client.Do(req)
+	return summary.Response, nil
+}
+
+// summaryPrompt returns the template named by ref, or the one of mode, and the model to use:
+// model if it is set, else the model of the template.
+func (h *Handler) summaryPrompt(mode, ref, model string) (*prompts.Template, string, error) {
+	if _, ok := modeTemplates[mode]; !ok {
+		return nil, "", fmt.Errorf("mode must be %q, %q or %q", ModeTLDR, ModeBullets, ModeChapters)
+	}
+	if ref == "" {
+		ref = modeTemplates[mode]
+	}
+	return h.promptModel(ref, model)
+}
+
+// promptModel returns the template named by ref and the model to use: model if it is set, else
+// the model of the template.
+func (h *Handler) promptModel(ref, model string) (*prompts.Template, string, error) {
+	template, err := h.prompts.Get(ref)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
-	defer resp.Body.Close()
-	var WhisperResponseMessage WhisperResponse
-	if resp.StatusCode != 200 {
-		//handle error when status code is not 200
-		if err := json.NewDecoder(resp.Body).Decode(&WhisperResponseMessage); err != nil {
-			return "", fmt.Errorf("error decoding json response: %v", err)
-		}
-		return "", fmt.Errorf("error making api call to the whisper AI Model %v", WhisperResponseMessage.Error)
+	if model == "" {
+		model = template.Model
 	}
-	// The Api call succeeded marshal the output and return the text.
-	//Use the grok AI model to process the summarization.
-	if err := json.NewDecoder(resp.Body).Decode(&WhisperResponseMessage); err != nil {
-		return "", err
+	if model == "" {
+		return nil, "", fmt.Errorf("template %s doesn't set a model, a model is required", ref)
 	}
-	youtubeTranscribedText := WhisperResponseMessage.Output.Text
+	return template, model, h.router.Validate(model)
+}
 
-	grokClient := groq.NewClient(groq.WithAPIKey(grokAPIKey))
-	response, err := grokClient.CreateChatCompletion(groq.CompletionCreateParams{
-		Model: "llama3-70b-8192",
-		Messages: []groq.Message{
-			{
-				Role:    "system",
-				Content: "You are a highly skilled AI model specialized in summarizing text transcribed From Youtube Videos. Your goal is to provide concise, accurate, and coherent summaries of the provided content.",
-			},
-			{
-				Role:    "user",
-				Content: youtubeTranscribedText,
-			},
-		},
-	})
+// summarize transcribes the youtube video url with transcriber and summarizes the transcript with model.
+func (h *Handler) summarize(ctx context.Context, youtubeURL, transcriber, mode string, template *prompts.Template, model string) (*ResponseMsg, error) {
+	transcript, err := h.transcribe(ctx, youtubeURL, transcriber)
+	if err != nil {
+		return nil, err
+	}
+	response, err := h.summarizeTranscript(ctx, youtubeURL, transcript, mode, template, model)
 	if err != nil {
-		return "", fmt.Errorf("failed to process summarization with grok model %v", err)
+		return nil, err
 	}
-	res := response.Choices[0].Message.Content
-	return res, nil
+	response.Transcriber = transcriber
+	return response, nil
 }
@@ -0,0 +1,160 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kingmariano/omnicron/internal/jobs"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+var errPlaylist = errors.New("failed to list the videos of the playlist")
+
+const (
+	digestTemplate = "youtube.digest"
+	// defaultPlaylistConcurrency and maxPlaylistConcurrency limit the videos summarized at once.
+	defaultPlaylistConcurrency = 3
+	maxPlaylistConcurrency     = 5
+	// defaultPlaylistVideos and maxPlaylistVideos limit the videos of a playlist summarized.
+	defaultPlaylistVideos = 25
+	maxPlaylistVideos     = 100
+	jobTimeout            = 2 * time.Hour
+)
+
+// playlistJob is a running job and the settings of its summaries.
+type playlistJob struct {
+	*jobs.Run[*Job]
+	transcriber string
+	template    *prompts.Template
+	model       string
+}
+
+// startPlaylist lists the videos of the playlist and summarizes them in the background.
+func (h *Handler) startPlaylist(ctx context.Context, owner string, params PlaylistParams, template *prompts.Template, model string) (*Job, error) {
+	playlist, err := h.playlists.Playlist(ctx, params.URL, params.MaxVideos)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPlaylist, err)
+	}
+	if len(playlist.Videos) == 0 {
+		return nil, fmt.Errorf("%w: the playlist has no videos", errPlaylist)
+	}
+	// the parts of a video on another site are only reachable through the playlist
+	if playlist.Videos[0].Item != 0 {
+		return nil, fmt.Errorf("%w: only YouTube playlists and channels can be summarized", errPlaylist)
+	}
+	job := &Job{
+		Progress:    jobs.New(),
+		URL:         params.URL,
+		Title:       playlist.Title,
+		Mode:        params.Mode,
+		Model:       model,
+		Transcriber: params.Transcriber,
+	}
+	for _, video := range playlist.Videos[:min(len(playlist.Videos), params.MaxVideos)] {
+		job.Items = append(job.Items, JobItem{VideoID: video.ID, Title: video.Title, URL: video.URL, Item: jobs.Item{Status: jobs.StatusPending}})
+	}
+	response, err := h.jobs.Start(owner, job, jobTimeout, func(ctx context.Context, run *jobs.Run[*Job]) {
+		h.runPlaylist(ctx, &playlistJob{Run: run, transcriber: params.Transcriber, template: template, model: model}, params.Concurrency)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+	return response, nil
+}
+
+// runPlaylist summarizes the videos of the job, concurrency at a time, then writes the digest.
+func (h *Handler) runPlaylist(ctx context.Context, run *playlistJob, concurrency int) {
+	run.Each(concurrency, func(i int) (func(job *Job), error) {
+		var url, mode string
+		run.Read(func(job *Job) { url, mode = job.Items[i].URL, job.Mode })
+		summary, err := h.summarize(ctx, url, run.transcriber, mode, run.template, run.model)
+		if err != nil {
+			return nil, err
+		}
+		return func(job *Job) { job.Items[i].Summary, job.Items[i].Chapters = summary.Response, summary.Chapters }, nil
+	})
+
+	digest, err := h.digest(ctx, run)
+	run.Update(func(job *Job) {
+		switch {
+		case job.Completed == 0:
+			job.Status = jobs.StatusFailed
+		case job.Failed > 0 || err != nil:
+			job.Status = jobs.StatusPartial
+		default:
+			job.Status = jobs.StatusCompleted
+		}
+		if err != nil {
+			job.DigestError = err.Error()
+		}
+		job.Digest = digest
+	})
+}
+
+// digest combines the summaries of the videos into one. Each summary gets an equal share of
+// the context window.
+func (h *Handler) digest(ctx context.Context, run *playlistJob) (string, error) {
+	var summaries []string
+	var title string
+	run.Read(func(job *Job) {
+		for i, item := range job.Items {
+			if item.Status == jobs.StatusCompleted {
+				summaries = append(summaries, fmt.Sprintf("[Video %d] %s\n%s", i+1, item.Title, item.Summary))
+			}
+		}
+		title = job.Title
+	})
+	if len(summaries) == 0 {
+		return "", nil
+	}
+	system, err := h.prompts.Render(digestTemplate, PromptData{Title: title, Count: len(summaries)})
+	if err != nil {
+		return "", err
+	}
+	window := h.router.ContextWindow(run.model)
+	share := (window - llm.ReplyReserve(window) - gpt.EstimateTokens(system)) / len(summaries)
+	if share <= 0 {
+		return "", fmt.Errorf("the summaries don't fit the context window of %s", run.model)
+	}
+	for i, summary := range summaries {
+		if gpt.EstimateTokens(summary) > share {
+			summaries[i] = strings.ToValidUTF8(summary[:share*4-4], "") + "..."
+		}
+	}
+	completion, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{
+		Model: run.model,
+		Messages: []llm.Message{
+			{Role: "system", Content: system},
+			{Role: "user", Content: strings.Join(summaries, "\n\n")},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write the digest with model %s: %v", run.model, err)
+	}
+	return completion.Choices[0].Message.Content, nil
+}
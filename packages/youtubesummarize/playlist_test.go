@@ -0,0 +1,106 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/jobs"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/services"
+)
+
+type fakePlaylists struct{}
+
+func (fakePlaylists) Playlist(ctx context.Context, url string, maxVideos int) (*services.Playlist, error) {
+	playlist := &services.Playlist{Title: "Cooking"}
+	for _, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"} {
+		playlist.Videos = append(playlist.Videos, services.PlaylistVideo{ID: id, Title: "Video " + id[:1], URL: "https://www.youtube.com/watch?v=" + id})
+	}
+	return playlist, nil
+}
+
+func TestPlaylistJobKeepsPartialResults(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	router, err := llm.NewRouter(llm.Config{}, &recordingProvider{answer: "summary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	predictions := &fakePredictions{fail: "https://www.youtube.com/watch?v=bbbbbbbbbbb"}
+	h := NewHandler(Transcription{Predictions: predictions}, fakePlaylists{}, s, router, prompts.New())
+	mux := chi.NewRouter()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithOwner(r.Context(), "alice")))
+		})
+	})
+	mux.Post("/youtube/playlist", h.SummarizePlaylist)
+	mux.Get("/youtube/jobs/{id}", h.GetJob)
+
+	rec := httptest.NewRecorder()
+	body := `{"url": "https://www.youtube.com/playlist?list=PL1", "model": "fake/chat", "max_videos": 3, "concurrency": 2}`
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/youtube/playlist", strings.NewReader(body)))
+	var job Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil || rec.Code != http.StatusAccepted {
+		t.Fatalf("start: unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	if job.Total != 3 || job.Title != "Cooking" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == jobs.StatusRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/youtube/jobs/"+job.ID, nil))
+		job = Job{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != jobs.StatusPartial || job.Completed != 2 || job.Failed != 1 || job.Digest != "summary" {
+		t.Fatalf("expected a partial job with a digest, got %+v", job)
+	}
+	if job.Items[1].Status != jobs.StatusFailed || !strings.Contains(job.Items[1].Error, "video unavailable") || job.Items[0].Summary != "summary" {
+		t.Errorf("unexpected items %+v", job.Items)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/youtube/jobs/job_missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: expected status 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jpoz/groq"
+	"github.com/kingmariano/omnicron/internal/store"
+	rep "github.com/kingmariano/omnicron/packages/replicate"
+	"github.com/kingmariano/omnicron/services"
+	"github.com/kingmariano/omnicron/utils"
+	"github.com/replicate/replicate-go"
+)
+
+// Speech to text services the videos can be transcribed with.
+const (
+	// TranscriberReplicate runs insanely-fast-whisper-with-video on Replicate, which fetches the
+	// video itself.
+	TranscriberReplicate = "replicate"
+	// TranscriberGroq downloads the audio of the video and sends it to Groq Whisper.
+	TranscriberGroq = "groq"
+)
+
+const (
+	replicateWhisperModel = "turian/insanely-fast-whisper-with-video"
+	groqMaxAudioBytes     = 25 << 20 // largest file Groq transcribes
+)
+
+// transcriptsPath is the bucket caching the transcripts by transcriber and video ID. The
+// transcript of a video is the same for every API key.
+var transcriptsPath = []string{"youtube_transcripts"}
+
+// Transcription holds the speech to text services the videos are transcribed with.
+type Transcription struct {
+	// Default is the transcriber of the requests that don't choose one, TranscriberReplicate
+	// if it is empty.
+	Default     string
+	Predictions services.PredictionProvider
+	Groq        services.TranscriptionProvider
+	Downloader  services.Downloader
+	Transcoder  services.Transcoder
+}
+
+func (t Transcription) defaultTranscriber() string {
+	if t.Default == "" {
+		return TranscriberReplicate
+	}
+	return t.Default
+}
+
+// Transcript is the text of a video, and its segments with their start in seconds when the
+// transcriber times them.
+type Transcript struct {
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+// Segment is a timed part of a transcript.
+type Segment struct {
+	Start float64 `json:"start"`
+	Text  string  `json:"text"`
+}
+
+// whisperOutput is the output of insanely-fast-whisper-with-video.
+type whisperOutput struct {
+	Text   string `json:"text"`
+	Chunks []struct {
+		Text      string    `json:"text"`
+		Timestamp []float64 `json:"timestamp"`
+	} `json:"chunks"`
+}
+
+// transcribe transcribes the youtube video url with transcriber, or returns the transcript it
+// made of the same video before.
+func (h *Handler) transcribe(ctx context.Context, youtubeURL, transcriber string) (*Transcript, error) {
+	key := ""
+	if id := videoID(youtubeURL); id != "" && h.store != nil {
+		key = transcriber + ":" + id
+		var transcript Transcript
+		err := h.store.Get(transcriptsPath, key, &transcript)
+		if err == nil {
+			return &transcript, nil
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("failed to read cached transcript %s: %v", key, err)
+		}
+	}
+	var transcript *Transcript
+	var err error
+	switch transcriber {
+	case TranscriberReplicate:
+		transcript, err = h.transcribeReplicate(ctx, youtubeURL)
+	case TranscriberGroq:
+		transcript, err = h.transcribeGroq(ctx, youtubeURL)
+	default:
+		return nil, fmt.Errorf("unknown transcriber %q", transcriber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		if err := h.store.Put(transcriptsPath, key, transcript); err != nil {
+			log.Printf("failed to cache transcript %s: %v", key, err)
+		}
+	}
+	return transcript, nil
+}
+
+// transcribeReplicate transcribes the video with Whisper on Replicate, timing its chunks.
+func (h *Handler) transcribeReplicate(ctx context.Context, youtubeURL string) (*Transcript, error) {
+	if h.stt.Predictions == nil {
+		return nil, errors.New("the replicate transcriber isn't configured")
+	}
+	model, err := rep.GetModelByName(replicateWhisperModel, rep.STTModels)
+	if err != nil {
+		return nil, err
+	}
+	params := rep.HighSTTParams{}.InsanelyFastWhisperWithVideo()
+	prediction, err := h.stt.Predictions.CreatePrediction(ctx, model.Version, replicate.PredictionInput{
+		"url":        youtubeURL,
+		"task":       *params.Task,
+		"batch_size": *params.BatchSize,
+		"timestamp":  *params.Timestamp,
+	}, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("error making api call to the whisper AI Model %v", err)
+	}
+	if prediction.Error != nil {
+		return nil, fmt.Errorf("error making api call to the whisper AI Model %v", prediction.Error)
+	}
+	data, err := json.Marshal(prediction.Output)
+	if err != nil {
+		return nil, err
+	}
+	var output whisperOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("unexpected output of the whisper AI Model: %v", err)
+	}
+	transcript := &Transcript{Text: output.Text}
+	for _, chunk := range output.Chunks {
+		segment := Segment{Text: chunk.Text}
+		if len(chunk.Timestamp) > 0 {
+			segment.Start = chunk.Timestamp[0]
+		}
+		transcript.Segments = append(transcript.Segments, segment)
+	}
+	return transcript, nil
+}
+
+// transcribeGroq downloads the audio of the video and transcribes it with Groq Whisper.
+func (h *Handler) transcribeGroq(ctx context.Context, youtubeURL string) (*Transcript, error) {
+	if h.stt.Groq == nil || h.stt.Downloader == nil || h.stt.Transcoder == nil {
+		return nil, errors.New("the groq transcriber isn't configured")
+	}
+	folderPath, err := utils.CreateUniqueFolder(utils.BasePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := utils.DeleteFolder(folderPath); err != nil {
+			log.Printf("failed to delete folder %s: %v", folderPath, err)
+		}
+	}()
+	videoPath, err := h.stt.Downloader.Download(ctx, youtubeURL, utils.OutputName, folderPath, services.DownloadOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download video: %w", err)
+	}
+	audioPath, err := h.stt.Transcoder.ConvertFileToMP3(videoPath)
+	if err != nil {
+		return nil, err
+	}
+	audio, err := os.Open(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer audio.Close()
+	info, err := audio.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > groqMaxAudioBytes {
+		return nil, fmt.Errorf("the audio of the video is %dMB, larger than the %dMB Groq transcribes; use the %s transcriber", info.Size()>>20, groqMaxAudioBytes>>20, TranscriberReplicate)
+	}
+	transcription, err := h.stt.Groq.CreateTranscription(ctx, groq.TranscriptionCreateParams{
+		File:           audio,
+		Model:          groq.TranslationModel_WhisperLargeV3,
+		ResponseFormat: "verbose_json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to transcribe the video with groq: %w", err)
+	}
+	transcript := &Transcript{Text: transcription.Text}
+	for _, segment := range transcription.Segments {
+		transcript.Segments = append(transcript.Segments, Segment{Start: segment.Start, Text: segment.Text})
+	}
+	return transcript, nil
+}
+
+// videoIDPattern matches the 11 character IDs of YouTube videos.
+var videoIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// videoID returns the ID of the YouTube video at youtubeURL, or "" if it isn't a video URL.
+func videoID(youtubeURL string) string {
+	u, err := url.Parse(strings.TrimSpace(youtubeURL))
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	var id string
+	switch host {
+	case "youtu.be":
+		id = strings.Trim(u.Path, "/")
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		if u.Path == "/watch" {
+			id = u.Query().Get("v")
+		} else if rest, ok := cutAnyPrefix(u.Path, "/shorts/", "/embed/", "/live/", "/v/"); ok {
+			id, _, _ = strings.Cut(rest, "/")
+		}
+	}
+	if !videoIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+func cutAnyPrefix(s string, prefixes ...string) (string, bool) {
+	for _, prefix := range prefixes {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/replicate/replicate-go"
+)
+
+// fakePredictions returns a timed whisper output, except for the url fail, and counts the
+// predictions.
+type fakePredictions struct {
+	mu          sync.Mutex
+	fail        string
+	predictions int
+	input       replicate.PredictionInput
+}
+
+func (p *fakePredictions) CreatePrediction(ctx context.Context, version string, input replicate.PredictionInput, webhook *replicate.Webhook, stream bool) (*replicate.Prediction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.predictions++
+	p.input = input
+	if input["url"] == p.fail {
+		return nil, errors.New("video unavailable")
+	}
+	return &replicate.Prediction{Output: map[string]interface{}{
+		"text": "Hello there. Welcome back.",
+		"chunks": []interface{}{
+			map[string]interface{}{"text": " Hello there.", "timestamp": []interface{}{0.0, 2.5}},
+			map[string]interface{}{"text": " Welcome back.", "timestamp": []interface{}{2.5, nil}},
+		},
+	}}, nil
+}
+
+func (p *fakePredictions) CreateModelPrediction(ctx context.Context, model string, input replicate.PredictionInput) (*replicate.Prediction, error) {
+	return nil, nil
+}
+
+func (p *fakePredictions) UploadFile(ctx context.Context, fileHeader *multipart.FileHeader) (*replicate.File, error) {
+	return nil, nil
+}
+
+func TestTranscribeCachesByVideoID(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	predictions := &fakePredictions{}
+	h := NewHandler(Transcription{Predictions: predictions}, nil, s, nil, nil)
+
+	first, err := h.transcribe(context.Background(), "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=x", TranscriberReplicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Transcript{Text: "Hello there. Welcome back.", Segments: []Segment{{Start: 0, Text: " Hello there."}, {Start: 2.5, Text: " Welcome back."}}}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("unexpected transcript %+v", first)
+	}
+	if predictions.input["url"] != "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=x" || predictions.input["timestamp"] != "chunk" {
+		t.Errorf("unexpected prediction input %v", predictions.input)
+	}
+
+	second, err := h.transcribe(context.Background(), "https://youtu.be/dQw4w9WgXcQ", TranscriberReplicate)
+	if err != nil || !reflect.DeepEqual(second, want) {
+		t.Fatalf("expected the cached transcript, got %+v, %v", second, err)
+	}
+	if predictions.predictions != 1 {
+		t.Errorf("expected the video to be transcribed once, got %d predictions", predictions.predictions)
+	}
+}
+
+func TestVideoID(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":     "dQw4w9WgXcQ",
+		"https://m.youtube.com/watch?v=dQw4w9WgXcQ&t=10s": "dQw4w9WgXcQ",
+		"https://youtu.be/dQw4w9WgXcQ?si=abc":             "dQw4w9WgXcQ",
+		"https://www.youtube.com/shorts/WO7wT-FX2mA":      "WO7wT-FX2mA",
+		"https://www.youtube.com/embed/dQw4w9WgXcQ":       "dQw4w9WgXcQ",
+		"https://www.youtube.com/playlist?list=PL123":     "",
+		"https://example.com/watch?v=dQw4w9WgXcQ":         "",
+		"not a url": "",
+	} {
+		if got := videoID(url); got != want {
+			t.Errorf("videoID(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
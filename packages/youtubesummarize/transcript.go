@@ -0,0 +1,236 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/packages/gpt"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+const (
+	notesTemplate    = "youtube.notes"
+	notesConcurrency = 4
+)
+
+var (
+	errNoTimestamps = errors.New("the transcript has no timestamps, chapters can't be made")
+	// errNoRoom is returned when the prompt template fills the context window of the model.
+	errNoRoom = errors.New("the prompt template leaves no room for the transcript")
+	// errTemplate is returned when a prompt template fails to render.
+	errTemplate = errors.New("invalid prompt template")
+)
+
+// summarizeTranscript summarizes transcript with model. A transcript too long for the model is
+// split into parts that are condensed into timestamped notes, which are summarized instead.
+func (h *Handler) summarizeTranscript(ctx context.Context, youtubeURL string, transcript *Transcript, mode string, template *prompts.Template, model string) (*ResponseMsg, error) {
+	lines, timed := transcriptLines(transcript)
+	if mode == ModeChapters && !timed {
+		return nil, errNoTimestamps
+	}
+	// the partial prompt is the longest, leave room for it
+	longest, err := template.Execute(PromptData{URL: youtubeURL, Partial: true})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTemplate, err)
+	}
+	window := h.router.ContextWindow(model)
+	budget := window - llm.ReplyReserve(window) - gpt.EstimateTokens(longest)
+	if budget <= 0 {
+		return nil, fmt.Errorf("%w in the context window of %s", errNoRoom, model)
+	}
+	var parts []string
+	for _, line := range lines {
+		parts = append(parts, splitText(line, budget*4)...)
+	}
+	for level := 0; ; level++ {
+		groups := llm.GroupParts(parts, budget)
+		if len(groups) == 1 || level == llm.MaxReduceLevels {
+			system, err := template.Execute(PromptData{URL: youtubeURL, Partial: level > 0})
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errTemplate, err)
+			}
+			completion, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{
+				Model: model,
+				Messages: []llm.Message{
+					{Role: "system", Content: system},
+					{Role: "user", Content: strings.Join(groups[0], "\n")},
+				},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to process summarization with model %s: %v", model, err)
+			}
+			summary := completion.Choices[0].Message.Content
+			response := &ResponseMsg{Response: summary, Mode: mode, Model: completion.Model, Truncated: len(groups) > 1}
+			if mode == ModeChapters {
+				response.Chapters = parseChapters(summary, youtubeURL)
+			}
+			return response, nil
+		}
+		if parts, err = h.notes(ctx, youtubeURL, groups, model, level > 0); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// notes condenses each group of transcript lines, or of notes if partial is set, into notes.
+func (h *Handler) notes(ctx context.Context, youtubeURL string, groups [][]string, model string, partial bool) ([]string, error) {
+	system, err := h.prompts.Render(notesTemplate, PromptData{URL: youtubeURL, Partial: partial})
+	if err != nil {
+		return nil, err
+	}
+	notes := make([]string, len(groups))
+	errs := make([]error, len(groups))
+	sem := make(chan struct{}, notesConcurrency)
+	var wg sync.WaitGroup
+	for i := range groups {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			completion, err := h.router.ChatCompletion(ctx, llm.ChatCompletionRequest{
+				Model: model,
+				Messages: []llm.Message{
+					{Role: "system", Content: system},
+					{Role: "user", Content: strings.Join(groups[i], "\n")},
+				},
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to take notes with model %s: %v", model, err)
+				return
+			}
+			notes[i] = strings.TrimSpace(completion.Choices[0].Message.Content)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return notes, nil
+}
+
+// transcriptLines returns the segments of transcript as lines starting with their time as
+// [MM:SS], or its text if it has no segments, in which case timed is false.
+func transcriptLines(transcript *Transcript) (lines []string, timed bool) {
+	for _, segment := range transcript.Segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s", formatTimestamp(int(segment.Start)), text))
+	}
+	if len(lines) > 0 {
+		return lines, true
+	}
+	return []string{strings.TrimSpace(transcript.Text)}, false
+}
+
+// splitText splits text into pieces of at most size bytes, between words where possible.
+func splitText(text string, size int) []string {
+	if len(text) <= size {
+		return []string{text}
+	}
+	var pieces []string
+	var piece strings.Builder
+	for _, word := range strings.Fields(text) {
+		if piece.Len() > 0 && piece.Len()+1+len(word) > size {
+			pieces = append(pieces, piece.String())
+			piece.Reset()
+		}
+		if piece.Len() > 0 {
+			piece.WriteByte(' ')
+		}
+		piece.WriteString(word)
+	}
+	if piece.Len() > 0 {
+		pieces = append(pieces, piece.String())
+	}
+	return pieces
+}
+
+// chapterLine matches the first line of a chapter, such as "[01:23] Title" or "## 1:02:03 - Title".
+var chapterLine = regexp.MustCompile(`^[#*\-\s]*\[?((?:\d+:)?\d{1,2}:\d{2})\]?[*\s]*[-\x{2013}:]?\s*(.+)$`)
+
+// parseChapters parses the chapters of a summary in chapters mode, each starting with a line
+// holding its start time and title, followed by its summary.
+func parseChapters(summary, youtubeURL string) []Chapter {
+	var chapters []Chapter
+	for _, line := range strings.Split(summary, "\n") {
+		line = strings.TrimSpace(line)
+		if match := chapterLine.FindStringSubmatch(line); match != nil {
+			start := parseTimestamp(match[1])
+			chapters = append(chapters, Chapter{
+				Title:     strings.Trim(match[2], "*# "),
+				Start:     start,
+				Timestamp: formatTimestamp(start),
+				URL:       chapterURL(youtubeURL, start),
+			})
+			continue
+		}
+		if line == "" || len(chapters) == 0 {
+			continue
+		}
+		last := &chapters[len(chapters)-1]
+		last.Summary = strings.TrimSpace(last.Summary + " " + strings.TrimLeft(line, "*- "))
+	}
+	return chapters
+}
+
+// formatTimestamp formats seconds as MM:SS, or H:MM:SS from an hour on.
+func formatTimestamp(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// parseTimestamp parses a timestamp matched by chapterLine into seconds.
+func parseTimestamp(timestamp string) int {
+	seconds := 0
+	for _, field := range strings.Split(timestamp, ":") {
+		n, _ := strconv.Atoi(field)
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
+
+// chapterURL links to the video at seconds.
+func chapterURL(youtubeURL string, seconds int) string {
+	u, err := url.Parse(youtubeURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	query := u.Query()
+	query.Set("t", strconv.Itoa(seconds)+"s")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package youtubesummarize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/packages/llm"
+)
+
+// fakeProvider answers notes requests with "[00:00] notes" and summaries with answer.
+type fakeProvider struct {
+	answer string
+	mu     sync.Mutex
+	notes  int
+}
+
+func (p *fakeProvider) Name() string     { return "fake" }
+func (p *fakeProvider) Models() []string { return []string{"chat"} }
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, request llm.ChatCompletionRequest) (*llm.ChatCompletion, error) {
+	answer := p.answer
+	if strings.Contains(request.Messages[0].Content, "Write concise notes") {
+		p.mu.Lock()
+		p.notes++
+		p.mu.Unlock()
+		answer = "[00:00] notes"
+	}
+	return &llm.ChatCompletion{
+		Model:   "fake/" + request.Model,
+		Choices: []llm.Choice{{Message: llm.Message{Role: "assistant", Content: answer}}},
+	}, nil
+}
+
+func newTestHandler(t *testing.T, provider *fakeProvider, window int) *Handler {
+	t.Helper()
+	router, err := llm.NewRouter(llm.Config{ContextWindows: map[string]int{"fake/chat": window}}, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(Transcription{}, nil, nil, router, prompts.New())
+}
+
+func transcript(segments int) *Transcript {
+	var t Transcript
+	for i := 0; i < segments; i++ {
+		t.Segments = append(t.Segments, Segment{Start: float64(i * 30), Text: fmt.Sprintf(" Segment %d of the video.", i)})
+	}
+	return &t
+}
+
+func TestChapters(t *testing.T) {
+	provider := &fakeProvider{answer: "[00:00] Intro\nThe host says hello.\n\n**[01:30] Setup**\nThe tools are installed.\nThen tested."}
+	h := newTestHandler(t, provider, 8192)
+	template, model, err := h.summaryPrompt(ModeChapters, "", "fake/chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := h.summarizeTranscript(context.Background(), "https://www.youtube.com/watch?v=abc", transcript(5), ModeChapters, template, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Chapter{
+		{Title: "Intro", Start: 0, Timestamp: "00:00", URL: "https://www.youtube.com/watch?t=0s&v=abc", Summary: "The host says hello."},
+		{Title: "Setup", Start: 90, Timestamp: "01:30", URL: "https://www.youtube.com/watch?t=90s&v=abc", Summary: "The tools are installed. Then tested."},
+	}
+	if !reflect.DeepEqual(response.Chapters, want) {
+		t.Errorf("unexpected chapters %+v", response.Chapters)
+	}
+	if provider.notes != 0 || response.Truncated {
+		t.Errorf("expected the transcript to be summarized whole, got %d notes requests", provider.notes)
+	}
+
+	_, err = h.summarizeTranscript(context.Background(), "", &Transcript{Text: "untimed"}, ModeChapters, template, model)
+	if err != errNoTimestamps || summaryStatus(err) != http.StatusBadRequest {
+		t.Errorf("expected errNoTimestamps without chunks, got %v", err)
+	}
+	// the prompt alone fills the window
+	h = newTestHandler(t, provider, 100)
+	_, err = h.summarizeTranscript(context.Background(), "", transcript(5), ModeChapters, template, model)
+	if !errors.Is(err, errNoRoom) || summaryStatus(err) != http.StatusBadRequest {
+		t.Errorf("expected errNoRoom with status 400, got %v", err)
+	}
+}
+
+func TestLongTranscriptIsSummarizedFromNotes(t *testing.T) {
+	provider := &fakeProvider{answer: "summary"}
+	// the window fits about 20 segments after the prompt and reply
+	h := newTestHandler(t, provider, 500)
+	template, model, err := h.summaryPrompt(ModeBullets, "", "fake/chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := h.summarizeTranscript(context.Background(), "https://youtu.be/abc", transcript(100), ModeBullets, template, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Response != "summary" || response.Mode != ModeBullets || response.Truncated {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if provider.notes < 2 {
+		t.Errorf("expected the parts to be condensed into notes, got %d notes requests", provider.notes)
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	for seconds, want := range map[int]string{0: "00:00", 75: "01:15", 3725: "1:02:05"} {
+		if got := formatTimestamp(seconds); got != want || parseTimestamp(got) != seconds {
+			t.Errorf("formatTimestamp(%d) = %q", seconds, got)
+		}
+	}
+}
@@ -21,21 +21,68 @@ package youtubesummarize
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/kingmariano/omnicron/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/kingmariano/omnicron/internal/auth"
+	"github.com/kingmariano/omnicron/internal/jobs"
+	"github.com/kingmariano/omnicron/internal/prompts"
+	"github.com/kingmariano/omnicron/internal/store"
+	"github.com/kingmariano/omnicron/packages/llm"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 	"net/http"
 )
 
+// Handler serves the youtube summarization endpoint.
+type Handler struct {
+	stt       Transcription
+	playlists services.PlaylistExtractor
+	store     *store.Store
+	router    *llm.Router
+	prompts   *prompts.Registry
+	jobs      *jobs.Store[*Job]
+}
+
+// NewHandler returns a Handler that transcribes videos with stt, caching the transcripts and the playlist jobs in s, and summarizes them with router, using the prompts of registry.
+// Playlists are listed with playlists.
+func NewHandler(stt Transcription, playlists services.PlaylistExtractor, s *store.Store, router *llm.Router, registry *prompts.Registry) *Handler {
+	return &Handler{stt: stt, playlists: playlists, store: s, router: router, prompts: registry, jobs: jobs.NewStore[*Job](s, "youtube_jobs")}
+}
+
 // youtube url should be provided
 type YoutubeRequest struct {
 	URL string `json:"url"`
+	// Mode is ModeTLDR, the default, ModeBullets or ModeChapters.
+	Mode string `json:"mode"`
+	// Transcriber is TranscriberReplicate or TranscriberGroq, by default the one configured.
+	Transcriber string `json:"transcriber"`
+	// Template replaces the system prompt of the mode, and Model the model of the template.
+	Template string `json:"template"`
+	Model    string `json:"model"`
 }
 type ResponseMsg struct {
 	Response string `json:"response"`
+	Mode     string `json:"mode"`
+	Model    string `json:"model"`
+	// Transcriber is the speech to text service the transcript comes from.
+	Transcriber string `json:"transcriber"`
+	// Chapters are the chapters parsed from the response in chapters mode.
+	Chapters []Chapter `json:"chapters,omitempty"`
+	// Truncated is set when the transcript was too long to be summarized whole.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Chapter is a titled part of a video starting at Start seconds. URL links to the video at Start.
+type Chapter struct {
+	Title     string `json:"title"`
+	Start     int    `json:"start"`
+	Timestamp string `json:"timestamp"`
+	URL       string `json:"url"`
+	Summary   string `json:"summary,omitempty"`
 }
 
-func YoutubeSummarization(w http.ResponseWriter, r *http.Request, cfg *config.APIConfig) {
+func (h *Handler) YoutubeSummarization(w http.ResponseWriter, r *http.Request) {
 	decode := json.NewDecoder(r.Body)
 	youtubeParams := YoutubeRequest{}
 	err := decode.Decode(&youtubeParams)
@@ -43,10 +90,222 @@ func YoutubeSummarization(w http.ResponseWriter, r *http.Request, cfg *config.AP
 		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unmarshalling json, %v", err))
 		return
 	}
-	summary, err := handleYoutubeSummariztion(youtubeParams.URL, cfg.APIKey, cfg.GrokAPIKey)
+	if youtubeParams.Mode == "" {
+		youtubeParams.Mode = ModeTLDR
+	}
+	template, model, err := h.summaryPrompt(youtubeParams.Mode, youtubeParams.Template, youtubeParams.Model)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	if youtubeParams.Transcriber == "" {
+		youtubeParams.Transcriber = h.stt.defaultTranscriber()
+	}
+	if youtubeParams.Transcriber != TranscriberReplicate && youtubeParams.Transcriber != TranscriberGroq {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, transcriber must be %q or %q", TranscriberReplicate, TranscriberGroq))
+		return
+	}
+	summary, err := h.summarize(r.Context(), youtubeParams.URL, youtubeParams.Transcriber, youtubeParams.Mode, template, model)
+	if err != nil {
+		utils.RespondWithError(w, summaryStatus(err), err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, summary)
+}
+
+// summaryStatus returns the status code of a failed summary or question: 404 for a video that
+// wasn't transcribed, 400 for requests the transcript or the prompt template can't serve.
+func summaryStatus(err error) int {
+	switch {
+	case errors.Is(err, errVideoNotTranscribed):
+		return http.StatusNotFound
+	case errors.Is(err, errQuestionTooLong), errors.Is(err, errNoTimestamps), errors.Is(err, errNoRoom), errors.Is(err, errTemplate):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// AskParams is the body of POST /youtube/ask. The video is given by URL, or by the VideoID of a
+// video transcribed before.
+type AskParams struct {
+	URL      string `json:"url"`
+	VideoID  string `json:"video_id"`
+	Question string `json:"question"`
+	// Transcriber transcribes the video at URL, or chooses the transcript of VideoID.
+	Transcriber string `json:"transcriber"`
+	// Template replaces the youtube.ask system prompt, and Model the model of the template.
+	Template string `json:"template"`
+	Model    string `json:"model"`
+}
+
+// TimestampCitation is a time of the video cited by an answer, with the transcript around it.
+type TimestampCitation struct {
+	Start     int    `json:"start"`
+	Timestamp string `json:"timestamp"`
+	URL       string `json:"url"`
+	Snippet   string `json:"snippet"`
+}
+
+// AskResponse is the answer to a question about a video. Partial is set when the transcript
+// was too long for the model and the answer comes from its most relevant parts.
+type AskResponse struct {
+	Answer      string              `json:"answer"`
+	VideoID     string              `json:"video_id,omitempty"`
+	Model       string              `json:"model"`
+	Transcriber string              `json:"transcriber"`
+	Citations   []TimestampCitation `json:"citations"`
+	Partial     bool                `json:"partial,omitempty"`
+}
+
+// Ask handles POST /youtube/ask.
+func (h *Handler) Ask(w http.ResponseWriter, r *http.Request) {
+	var params AskParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if params.Question == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, question is required")
+		return
+	}
+	if (params.URL == "") == (params.VideoID == "") {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, either url or video_id is required")
+		return
+	}
+	if params.VideoID != "" && !videoIDPattern.MatchString(params.VideoID) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, video_id is invalid")
+		return
+	}
+	if params.URL != "" && params.Transcriber == "" {
+		params.Transcriber = h.stt.defaultTranscriber()
+	}
+	if params.Transcriber != "" && params.Transcriber != TranscriberReplicate && params.Transcriber != TranscriberGroq {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, transcriber must be %q or %q", TranscriberReplicate, TranscriberGroq))
+		return
+	}
+	ref := params.Template
+	if ref == "" {
+		ref = askTemplate
+	}
+	template, model, err := h.promptModel(ref, params.Model)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	response, err := h.ask(r.Context(), params, template, model)
+	if err != nil {
+		utils.RespondWithError(w, summaryStatus(err), err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// PlaylistParams is the body of POST /youtube/playlist. The other fields are the same as for
+// the summary of a video.
+type PlaylistParams struct {
+	// URL is a playlist URL, or a channel URL of the form /channel/UC... for its uploads.
+	URL         string `json:"url"`
+	Mode        string `json:"mode"`
+	Transcriber string `json:"transcriber"`
+	Template    string `json:"template"`
+	Model       string `json:"model"`
+	// MaxVideos is the number of videos summarized from the start of the playlist, see
+	// defaultPlaylistVideos and maxPlaylistVideos.
+	MaxVideos int `json:"max_videos"`
+	// Concurrency is the number of videos summarized at once, see defaultPlaylistConcurrency
+	// and maxPlaylistConcurrency.
+	Concurrency int `json:"concurrency"`
+}
+
+// Job is a playlist summarized in the background. Its items are updated as each video is
+// summarized, and the digest combining their summaries is written when they are all done.
+type Job struct {
+	jobs.Progress
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Mode        string    `json:"mode"`
+	Model       string    `json:"model"`
+	Transcriber string    `json:"transcriber"`
+	Items       []JobItem `json:"items"`
+	Digest      string    `json:"digest,omitempty"`
+	DigestError string    `json:"digest_error,omitempty"`
+}
+
+func (j *Job) Len() int              { return len(j.Items) }
+func (j *Job) Item(i int) *jobs.Item { return &j.Items[i].Item }
+
+// JobItem is a video of a playlist job and its summary, or the error summarizing it.
+type JobItem struct {
+	VideoID string `json:"video_id"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	jobs.Item
+	Summary  string    `json:"summary,omitempty"`
+	Chapters []Chapter `json:"chapters,omitempty"`
+}
+
+// SummarizePlaylist handles POST /youtube/playlist, starting a job that summarizes the videos.
+func (h *Handler) SummarizePlaylist(w http.ResponseWriter, r *http.Request) {
+	var params PlaylistParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling json, %v", err))
+		return
+	}
+	if params.URL == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Validation error, url is required")
+		return
+	}
+	if params.Mode == "" {
+		params.Mode = ModeTLDR
+	}
+	if params.Transcriber == "" {
+		params.Transcriber = h.stt.defaultTranscriber()
+	}
+	if params.Transcriber != TranscriberReplicate && params.Transcriber != TranscriberGroq {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, transcriber must be %q or %q", TranscriberReplicate, TranscriberGroq))
+		return
+	}
+	if params.MaxVideos == 0 {
+		params.MaxVideos = defaultPlaylistVideos
+	}
+	if params.MaxVideos < 0 || params.MaxVideos > maxPlaylistVideos {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, max_videos must be between 1 and %d", maxPlaylistVideos))
+		return
+	}
+	if params.Concurrency == 0 {
+		params.Concurrency = defaultPlaylistConcurrency
+	}
+	if params.Concurrency < 0 || params.Concurrency > maxPlaylistConcurrency {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, concurrency must be between 1 and %d", maxPlaylistConcurrency))
+		return
+	}
+	template, model, err := h.summaryPrompt(params.Mode, params.Template, params.Model)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Validation error, %v", err))
+		return
+	}
+	job, err := h.startPlaylist(r.Context(), auth.Owner(r.Context()), params, template, model)
+	if errors.Is(err, errPlaylist) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusAccepted, job)
+}
+
+// GetJob handles GET /youtube/jobs/{id}, returning the progress and results of a playlist job.
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Load(auth.Owner(r.Context()), chi.URLParam(r, "id"))
+	if errors.Is(err, store.ErrNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "job not found")
+		return
+	}
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusOK, ResponseMsg{Response: summary})
+	utils.RespondWithJSON(w, http.StatusOK, job)
 }
@@ -22,14 +22,16 @@ This module defines the FastAPI router for the omnicron python backend server.
 """
 
 import fitz
+import json
 import os
+import secrets
 import subprocess
 import aiofiles
 import asyncio
 from pathlib import Path  # Standard library imports
 from tempfile import NamedTemporaryFile
 from typing import List
-from fastapi.responses import JSONResponse
+from fastapi.responses import JSONResponse, StreamingResponse
 import requests  # Third-party imports
 from fastapi import APIRouter, Depends, HTTPException, File, UploadFile
 from fastapi.security.api_key import APIKeyHeader
@@ -47,14 +49,14 @@ router = APIRouter()
 env_path = Path(__file__).resolve().parents[2] / ".env"
 load_dotenv(env_path)
 
-# Get the API key from the environment
-api_key = os.getenv('MY_API_KEY')
+# Get the internal API key generated by the Go server on every boot
+api_key = os.getenv('SIDECAR_API_KEY')
 grok_api_key = os.getenv('GROK_API_KEY')
 gemini_api_key = os.getenv('GEMINI_PRO_API_KEY')
 tessdata_prefix = os.getenv('TESSDATA_PREFIX')
 # Check if essential environment variables are set
 if not api_key:
-    raise RuntimeError("MY_API_KEY environment variable is not set.")
+    raise RuntimeError("SIDECAR_API_KEY environment variable is not set. Start the server through the Go binary.")
 if not grok_api_key:
     raise RuntimeError("GROK_API_KEY environment variable is not set.")
 if not gemini_api_key:
@@ -78,7 +80,7 @@ def check_api_key(key: str = Depends(api_key_header)):
     """
     if key is None:
         raise HTTPException(status_code=401, detail="Provide Api Key")
-    elif key != api_key:
+    elif not secrets.compare_digest(key, api_key):
         raise HTTPException(status_code=401, detail="Invalid Api Key")
     return key
 
@@ -160,12 +162,31 @@ async def chat_completion(request: ChatCompletionRequest, _: str = Depends(check
             request.shuffle,
             image_bytes
         )
+        if request.stream:
+            return StreamingResponse(_stream_events(response), media_type="application/x-ndjson")
         return {"response": response}
     except Exception as err:
         raise HTTPException(
             status_code=400, detail=f"Failed to complete chat: {err}") from err
 
 
+def _stream_events(chunks):
+    """
+    Yield the chunks of a streamed chat completion as newline delimited JSON events.
+
+    Every chunk is sent as {"delta": text}. The stream ends with {"done": true},
+    or with {"error": message} if the completion fails midway.
+    """
+    try:
+        for chunk in chunks:
+            if chunk:
+                yield json.dumps({"delta": str(chunk)}) + "\n"
+    except Exception as err:
+        yield json.dumps({"error": f"Failed to complete chat: {err}"}) + "\n"
+        return
+    yield json.dumps({"done": True}) + "\n"
+
+
 @router.post("/shazam")
 async def shazam_endpoint(file: UploadFile = File(...),
                           _: str = Depends(check_api_key)):
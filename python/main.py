@@ -22,8 +22,8 @@ This module defines the main FastAPI application for the omnicron python backend
 """
 
 import asyncio
+import os
 from fastapi import FastAPI
-from fastapi.middleware.cors import CORSMiddleware
 from endpoints import router
 import uvicorn
 
@@ -37,15 +37,9 @@ except RuntimeError:
 print(f"Using event loop: {type(loop)}\n")
 print(f"Current event loop policy: {asyncio.get_event_loop_policy()}")
 
+# The server is only called by the Go process, so it listens on localhost
+# or a unix socket and doesn't need CORS.
 app = FastAPI(title="omnicron python backend server")
-
-app.add_middleware(
-    CORSMiddleware,
-    allow_origins=["*"],
-    allow_credentials=True,
-    allow_methods=["*"],
-    allow_headers=["*"],
-)
 app.include_router(router, prefix="/api/v1")
 
 
@@ -58,4 +52,9 @@ def read_root():
 
 
 if __name__ == "__main__":
-    uvicorn.run("main:app", host="0.0.0.0", port=8000, reload=True)
+    socket_path = os.getenv('SIDECAR_SOCKET')
+    if socket_path:
+        uvicorn.run("main:app", uds=socket_path, reload=True)
+    else:
+        port = int(os.getenv('SIDECAR_PORT', '8000'))
+        uvicorn.run("main:app", host="127.0.0.1", port=port, reload=True)
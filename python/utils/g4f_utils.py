@@ -60,11 +60,6 @@ def _create_message_list(messages: List[Message]) -> List[dict]:
     return [{"role": message.role, "content": message.content} for message in messages]
 
 
-def _handle_stream_response(response: iter) -> List[str]:
-    """Handle stream response and return a list of strings"""
-    return list(response)
-
-
 def get_chat_completion_response(
     grok_api_key: str,
     gemini_api_key: str,
@@ -83,7 +78,7 @@ def get_chat_completion_response(
         messages: List of Message enum
         api_key: API key for g4f library
         proxy: Proxy URL for g4f library
-        stream: Whether to stream the response
+        stream: Whether to stream the response. If set, an iterator over the text chunks is returned
         timeout: Timeout for g4f library
         model: Model to use for chat completion
         shuffle: Whether to shuffle providers
@@ -127,9 +122,7 @@ def get_chat_completion_response(
                 timeout=timeout,
             )
 
-        if stream:
-            return _handle_stream_response(response)
-
+        # a streamed response is an iterator over the text chunks
         return response
 
     except ValueError as e:
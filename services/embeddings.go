@@ -0,0 +1,162 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	replicate "github.com/replicate/replicate-go"
+)
+
+// DefaultReplicateEmbeddingModel is the version of replicate/all-mpnet-base-v2, which embeds
+// texts into 768 dimensions.
+const DefaultReplicateEmbeddingModel = "b6b7585c9640cd7a9572c6e129c9549d79c9c31f0d3fdce7baac7c67ca38f305"
+
+// OpenAIEmbeddings embeds texts with the /embeddings endpoint of an OpenAI-compatible API.
+type OpenAIEmbeddings struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewOpenAIEmbeddings returns an OpenAIEmbeddings calling the API at baseURL, e.g. https://api.openai.com/v1.
+func NewOpenAIEmbeddings(baseURL, apiKey, model string, httpClient *http.Client) *OpenAIEmbeddings {
+	return &OpenAIEmbeddings{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: httpClient,
+	}
+}
+
+func (e *OpenAIEmbeddings) Model() string {
+	return e.model
+}
+
+// Embed returns the embedding of every text, in order.
+func (e *OpenAIEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{StatusCode: resp.StatusCode, Err: fmt.Errorf("embeddings request failed with status %d: %s", resp.StatusCode, data)}
+	}
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings response: %w", err)
+	}
+	embeddings := make([][]float32, len(texts))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings response has an invalid index %d", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	return checkEmbeddings(embeddings)
+}
+
+// ReplicateEmbeddings embeds texts with a Replicate model taking a JSON list of texts in
+// text_batch, such as replicate/all-mpnet-base-v2.
+type ReplicateEmbeddings struct {
+	predictions PredictionProvider
+	version     string
+}
+
+// NewReplicateEmbeddings returns a ReplicateEmbeddings running the model version with predictions.
+func NewReplicateEmbeddings(predictions PredictionProvider, version string) *ReplicateEmbeddings {
+	return &ReplicateEmbeddings{predictions: predictions, version: version}
+}
+
+func (e *ReplicateEmbeddings) Model() string {
+	return e.version
+}
+
+// Embed returns the embedding of every text, in order.
+func (e *ReplicateEmbeddings) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	batch, err := json.Marshal(texts)
+	if err != nil {
+		return nil, err
+	}
+	prediction, err := e.predictions.CreatePrediction(ctx, e.version, replicate.PredictionInput{"text_batch": string(batch)}, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	// the output is a list of {"embedding": [...]}, one for each text
+	data, err := json.Marshal(prediction.Output)
+	if err != nil {
+		return nil, err
+	}
+	var output []struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("unexpected embedding model output: %w", err)
+	}
+	if len(output) != len(texts) {
+		return nil, fmt.Errorf("embedding model returned %d embeddings for %d texts", len(output), len(texts))
+	}
+	embeddings := make([][]float32, len(output))
+	for i, o := range output {
+		embeddings[i] = o.Embedding
+	}
+	return checkEmbeddings(embeddings)
+}
+
+// checkEmbeddings makes sure every text got an embedding of the same size.
+func checkEmbeddings(embeddings [][]float32) ([][]float32, error) {
+	for _, embedding := range embeddings {
+		if len(embedding) == 0 {
+			return nil, errors.New("embedding provider returned an empty embedding")
+		}
+		if len(embedding) != len(embeddings[0]) {
+			return nil, errors.New("embedding provider returned embeddings of different sizes")
+		}
+	}
+	return embeddings, nil
+}
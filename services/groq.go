@@ -0,0 +1,212 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jpoz/groq"
+)
+
+const groqBaseURL = "https://api.groq.com/openai/v1"
+
+// ErrStreamingUnsupported is returned when a streamed completion is requested from a provider that can't stream.
+var ErrStreamingUnsupported = errors.New("streaming completions are not supported")
+
+// GroqClient talks to the Groq API over a shared http.Client.
+type GroqClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+	// streamClient is httpClient without its timeout, which would cut streams off while they
+	// are read. The timeout of httpClient only covers waiting for the response headers.
+	streamClient *http.Client
+}
+
+// NewGroqClient returns a GroqClient authenticating with apiKey.
+func NewGroqClient(apiKey string, httpClient *http.Client) *GroqClient {
+	streamClient := *httpClient
+	streamClient.Timeout = 0
+	return &GroqClient{
+		apiKey:       apiKey,
+		baseURL:      groqBaseURL,
+		httpClient:   httpClient,
+		streamClient: &streamClient,
+	}
+}
+
+// CreateChatCompletion creates a chat completion with the given parameters.
+func (c *GroqClient) CreateChatCompletion(ctx context.Context, params groq.CompletionCreateParams) (*groq.ChatCompletion, error) {
+	if params.Stream {
+		return nil, ErrStreamingUnsupported
+	}
+	var completion groq.ChatCompletion
+	if err := c.PostJSON(ctx, "/chat/completions", params, &completion); err != nil {
+		return nil, err
+	}
+	return &completion, nil
+}
+
+// PostJSON posts request as JSON to the OpenAI-compatible Groq endpoint at path and decodes the response into response.
+func (c *GroqClient) PostJSON(ctx context.Context, path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, response)
+}
+
+// CreateTranscription transcribes the audio file in params.
+func (c *GroqClient) CreateTranscription(ctx context.Context, params groq.TranscriptionCreateParams) (*Transcription, error) {
+	if params.File == nil {
+		return nil, errors.New("audio file is required")
+	}
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	fw, err := w.CreateFormFile("file", filepath.Base(params.File.Name()))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(fw, params.File); err != nil {
+		return nil, err
+	}
+	model := string(params.Model)
+	if model == "" {
+		model = groq.TranslationModel_WhisperLargeV3
+	}
+	fields := map[string]string{
+		"model":           model,
+		"language":        params.Language,
+		"prompt":          params.Prompt,
+		"response_format": string(params.ResponseFormat),
+	}
+	if params.Temperature != 0 {
+		fields["temperature"] = strconv.FormatFloat(float64(params.Temperature), 'f', -1, 32)
+	}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := w.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/audio/transcriptions", &b)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	var transcription Transcription
+	if err := c.do(req, &transcription); err != nil {
+		return nil, err
+	}
+	return &transcription, nil
+}
+
+// PostStream posts request as JSON to the OpenAI-compatible Groq endpoint at path and returns the
+// server-sent events of the response. The caller must close the returned body.
+func (c *GroqClient) PostStream(ctx context.Context, path string, request interface{}) (io.ReadCloser, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if c.httpClient.Timeout > 0 {
+		timer := time.AfterFunc(c.httpClient.Timeout, cancel)
+		defer timer.Stop()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.sendWith(c.streamClient, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &streamBody{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// streamBody releases the context of a stream when it is closed.
+type streamBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *streamBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// do sends the request and decodes a successful response into out.
+func (c *GroqClient) do(req *http.Request, out interface{}) error {
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends the request and returns the response if its status is 200.
+func (c *GroqClient) send(req *http.Request) (*http.Response, error) {
+	return c.sendWith(c.httpClient, req)
+}
+
+// sendWith sends the request with client and returns the response if its status is 200.
+func (c *GroqClient) sendWith(client *http.Client, req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var errResp groq.ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error.Message == "" {
+			return nil, &APIError{StatusCode: resp.StatusCode, Err: fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))}
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Err: errResp.Error}
+	}
+	return resp, nil
+}
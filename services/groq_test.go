@@ -0,0 +1,110 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jpoz/groq"
+)
+
+func TestGroqClientCreateChatCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"Invalid API Key","type":"invalid_request_error"}}`))
+			return
+		}
+		var params groq.CompletionCreateParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(groq.ChatCompletion{
+			Model:   params.Model,
+			Choices: []groq.Choice{{Message: groq.ChoiceMessage{Role: "assistant", Content: "Hi"}}},
+		})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		wantErr string
+	}{
+		{name: "valid key", apiKey: "test-key"},
+		{name: "invalid key", apiKey: "wrong", wantErr: "invalid_request_error: Invalid API Key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewGroqClient(tt.apiKey, server.Client())
+			client.baseURL = server.URL
+			completion, err := client.CreateChatCompletion(context.Background(), groq.CompletionCreateParams{
+				Model:    "llama3-8b-8192",
+				Messages: []groq.Message{{Role: "user", Content: "Hello"}},
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := completion.Choices[0].Message.Content; got != "Hi" {
+				t.Errorf("expected content %q, got %q", "Hi", got)
+			}
+		})
+	}
+}
+
+func TestGroqClientStreamOutlivesTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			_, _ = w.Write([]byte("data: {}\n\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(40 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	httpClient := server.Client()
+	httpClient.Timeout = 50 * time.Millisecond
+	client := NewGroqClient("test-key", httpClient)
+	client.baseURL = server.URL
+	body, err := client.PostStream(context.Background(), "/chat/completions", groq.CompletionCreateParams{Stream: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("stream cut off after %d bytes: %v", len(data), err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/replicate/replicate-go"
+)
+
+// ReplicateClient runs predictions on Replicate with a single reusable client.
+type ReplicateClient struct {
+	r8 *replicate.Client
+}
+
+// NewReplicateClient returns a ReplicateClient authenticating with token.
+func NewReplicateClient(token string, httpClient *http.Client) (*ReplicateClient, error) {
+	r8, err := replicate.NewClient(replicate.WithToken(token), replicate.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return &ReplicateClient{r8: r8}, nil
+}
+
+// CreatePrediction creates a new prediction for the model version and waits for it to complete.
+func (c *ReplicateClient) CreatePrediction(ctx context.Context, version string, input replicate.PredictionInput, webhook *replicate.Webhook, stream bool) (*replicate.Prediction, error) {
+	prediction, err := c.r8.CreatePrediction(ctx, version, input, webhook, stream)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.r8.Wait(ctx, prediction); err != nil {
+		return nil, err
+	}
+	log.Println("successfully executed prediction")
+	return prediction, nil
+}
+
+// CreateModelPrediction runs the latest version of an official model such as meta/meta-llama-3-70b-instruct
+// and waits for it to complete.
+func (c *ReplicateClient) CreateModelPrediction(ctx context.Context, model string, input replicate.PredictionInput) (*replicate.Prediction, error) {
+	owner, name, ok := strings.Cut(model, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid model %q, expected owner/name", model)
+	}
+	prediction, err := c.r8.CreatePredictionWithModel(ctx, owner, name, input, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.r8.Wait(ctx, prediction); err != nil {
+		return nil, err
+	}
+	return prediction, nil
+}
+
+// UploadFile uploads the request file to Replicate so it can be used as a prediction input.
+func (c *ReplicateClient) UploadFile(ctx context.Context, fileHeader *multipart.FileHeader) (*replicate.File, error) {
+	requestFile, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer requestFile.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, requestFile); err != nil {
+		return nil, err
+	}
+	return c.r8.CreateFileFromBuffer(ctx, buf, &replicate.CreateFileOptions{})
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package services defines the provider interfaces the HTTP handlers depend on.
+// The concrete providers are constructed once at startup and injected into the
+// handler structs, so connections and timeouts are shared across requests and
+// every provider can be swapped for a fake in tests.
+package services
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"time"
+
+	"github.com/jpoz/groq"
+	"github.com/kingmariano/omnicron/internal/sidecar"
+	"github.com/replicate/replicate-go"
+)
+
+// ChatProvider creates chat completions.
+type ChatProvider interface {
+	CreateChatCompletion(ctx context.Context, params groq.CompletionCreateParams) (*groq.ChatCompletion, error)
+}
+
+// OpenAIClient posts requests to a provider's OpenAI-compatible API.
+type OpenAIClient interface {
+	PostJSON(ctx context.Context, path string, request, response interface{}) error
+	// PostStream posts request and returns the body of the streamed response, which the caller must close.
+	PostStream(ctx context.Context, path string, request interface{}) (io.ReadCloser, error)
+}
+
+// TranscriptionProvider transcribes audio files.
+type TranscriptionProvider interface {
+	CreateTranscription(ctx context.Context, params groq.TranscriptionCreateParams) (*Transcription, error)
+}
+
+// PredictionProvider runs predictions against hosted models and uploads the files they consume.
+type PredictionProvider interface {
+	CreatePrediction(ctx context.Context, version string, input replicate.PredictionInput, webhook *replicate.Webhook, stream bool) (*replicate.Prediction, error)
+	CreateModelPrediction(ctx context.Context, model string, input replicate.PredictionInput) (*replicate.Prediction, error)
+	UploadFile(ctx context.Context, fileHeader *multipart.FileHeader) (*replicate.File, error)
+}
+
+// Storage uploads a file and returns a direct URL to it.
+// file may be a local path, a URL or an io.Reader.
+type Storage interface {
+	Upload(ctx context.Context, file interface{}) (string, error)
+}
+
+// SidecarClient calls the endpoints exposed by the python FastAPI server.
+type SidecarClient interface {
+	PostJSON(ctx context.Context, endpoint string, request, response interface{}, opts ...sidecar.CallOption) error
+	PostFile(ctx context.Context, endpoint string, file io.Reader, filename string, response interface{}, opts ...sidecar.CallOption) error
+	PostStream(ctx context.Context, endpoint string, request interface{}, opts ...sidecar.CallOption) (io.ReadCloser, error)
+}
+
+// Downloader downloads the media behind a URL into outputPath and returns the path of the downloaded file.
+type Downloader interface {
+	Download(ctx context.Context, url, outputName, outputPath string, opts DownloadOptions) (string, error)
+	// Validate checks opts against the limits of the downloader without downloading anything.
+	Validate(opts DownloadOptions) error
+}
+
+// DownloadOptions are the settings of a download. Zero values use the downloader's defaults.
+type DownloadOptions struct {
+	// Format is the ID of a stream listed by a VideoInspector or a quality preference such as
+	// 720p, best or worst. An empty format picks the best stream.
+	Format string
+	// Threads is the number of connections downloading the file.
+	Threads int
+	// Retries is the number of times a failed part is downloaded again.
+	Retries int
+	// MaxFileSize is the size in bytes of the largest file downloaded.
+	MaxFileSize int64
+	// Cookies names a cookies file configured on the server.
+	Cookies string
+	// PlaylistItem downloads the video numbered PlaylistItem of the playlist at the URL instead,
+	// see PlaylistVideo.Item.
+	PlaylistItem int
+}
+
+// VideoInspector lists the streams and subtitles of a video and downloads its subtitles.
+type VideoInspector interface {
+	Info(ctx context.Context, url string) (*VideoInfo, error)
+	// Subtitles downloads the subtitles of the video in languages, as SRT or WebVTT.
+	Subtitles(ctx context.Context, url string, languages []string) ([]Subtitle, error)
+}
+
+// VideoInfo describes a video and its streams. Duration is zero when the site doesn't report it.
+type VideoInfo struct {
+	Title     string          `json:"title"`
+	Site      string          `json:"site"`
+	Type      string          `json:"type"`
+	Duration  time.Duration   `json:"-"`
+	Streams   []VideoStream   `json:"streams"`
+	Subtitles []SubtitleTrack `json:"subtitles"`
+}
+
+// SubtitleTrack is a subtitle language of a video. Automatic is set for subtitles generated by
+// speech recognition.
+type SubtitleTrack struct {
+	Language  string `json:"language"`
+	Name      string `json:"name,omitempty"`
+	Automatic bool   `json:"automatic,omitempty"`
+}
+
+// Subtitle is a downloaded subtitle track. Format is srt or vtt.
+type Subtitle struct {
+	SubtitleTrack
+	Format string
+	Data   []byte
+}
+
+// SubtitleFile is a subtitle file muxed into a video.
+type SubtitleFile struct {
+	Path     string
+	Language string
+}
+
+// VideoStream is a stream a video can be downloaded in. Height is zero for audio streams and for
+// streams whose quality doesn't name a resolution.
+type VideoStream struct {
+	ID        string `json:"id"`
+	Quality   string `json:"quality"`
+	Height    int    `json:"height,omitempty"`
+	Size      int64  `json:"size"`
+	Container string `json:"container"`
+	Codec     string `json:"codec,omitempty"`
+}
+
+// PlaylistExtractor lists the videos of a playlist.
+type PlaylistExtractor interface {
+	// Playlist lists at most maxVideos videos from the start of the playlist at url.
+	Playlist(ctx context.Context, url string, maxVideos int) (*Playlist, error)
+}
+
+// Playlist is a list of videos, such as a YouTube playlist or the uploads of a channel.
+type Playlist struct {
+	Title  string
+	Videos []PlaylistVideo
+}
+
+// PlaylistVideo is a video of a playlist.
+type PlaylistVideo struct {
+	ID       string
+	Title    string
+	URL      string
+	Duration time.Duration
+	// Item numbers the video from 1 within the playlist at URL, for videos without a URL of their
+	// own such as the parts of a bilibili video. It is 0 for videos with their own URL.
+	Item int
+}
+
+// EmbeddingProvider turns texts into embedding vectors for semantic search.
+type EmbeddingProvider interface {
+	// Embed returns the embedding of every text, in order. All embeddings have the same size.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model names the embedding model. Vectors of different models can't be compared.
+	Model() string
+}
+
+// Transcoder converts media files.
+type Transcoder interface {
+	ConvertFileToMP3(inputFilePath string) (string, error)
+	ConvertReaderToMP3(reader io.Reader, outputDir string) (string, error)
+	// Clip writes the part of inputFilePath between start and end to outputFile. An end of zero is
+	// the end of the file. Streams are copied unless reencode is set or copying fails.
+	Clip(ctx context.Context, inputFilePath, outputFile string, start, end time.Duration, reencode bool) error
+	// Concat joins inputFiles into outputFile, in order.
+	Concat(ctx context.Context, inputFiles []string, outputFile string, reencode bool) error
+	// MuxSubtitles writes the video at inputFilePath with subtitles as soft subtitle streams to
+	// outputFile, which is an MP4 or MKV file.
+	MuxSubtitles(ctx context.Context, inputFilePath string, subtitles []SubtitleFile, outputFile string) error
+}
+
+// Transcription is the text recognised in an audio file. Segments are only returned for the
+// verbose_json response format.
+type Transcription struct {
+	Text     string                 `json:"text"`
+	Segments []TranscriptionSegment `json:"segments,omitempty"`
+}
+
+// TranscriptionSegment is a part of a transcription, timed in seconds from the start of the audio.
+type TranscriptionSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// APIError is an error response of a provider's API.
+type APIError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Services holds the providers shared by every handler.
+type Services struct {
+	Chat          ChatProvider
+	Groq          OpenAIClient
+	Transcription TranscriptionProvider
+	Predictions   PredictionProvider
+	Storage       Storage
+	Embeddings    EmbeddingProvider
+	Sidecar       SidecarClient
+	Downloader    Downloader
+	Playlists     PlaylistExtractor
+	Videos        VideoInspector
+	Transcoder    Transcoder
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/cloudinary/cloudinary-go/api/uploader"
+	cldconfig "github.com/cloudinary/cloudinary-go/config"
+)
+
+// CloudinaryStorage uploads files to Cloudinary.
+type CloudinaryStorage struct {
+	upload cloudinaryUploader
+}
+
+// cloudinaryUploader is the part of the Cloudinary upload API used by CloudinaryStorage.
+type cloudinaryUploader interface {
+	Upload(ctx context.Context, file interface{}, params uploader.UploadParams) (*uploader.UploadResult, error)
+}
+
+// NewCloudinaryStorage returns a CloudinaryStorage configured from a cloudinary:// URL that
+// uploads with client.
+func NewCloudinaryStorage(cloudinaryURL string, client *http.Client) (*CloudinaryStorage, error) {
+	cloudinaryConfig, err := cldconfig.NewFromURL(cloudinaryURL)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := uploader.NewWithConfiguration(cloudinaryConfig)
+	if err != nil {
+		return nil, err
+	}
+	upload.Logger.Writer = cloudinaryLog{}
+	upload.Client = *client
+	return &CloudinaryStorage{upload: upload}, nil
+}
+
+// cloudinaryLog writes the logs of the Cloudinary client with the standard logger.
+type cloudinaryLog struct{}
+
+func (cloudinaryLog) Debug(v ...interface{}) {
+	log.Println(append([]interface{}{"cloudinary debug:"}, v...)...)
+}
+
+func (cloudinaryLog) Error(v ...interface{}) {
+	log.Println(append([]interface{}{"cloudinary error:"}, v...)...)
+}
+
+// Upload uploads the file to Cloudinary and returns its direct URL.
+func (s *CloudinaryStorage) Upload(ctx context.Context, file interface{}) (string, error) {
+	uploadResult, err := s.upload.Upload(ctx, file, uploader.UploadParams{})
+	if err != nil {
+		log.Printf("cloudinary upload failed: %v", err)
+		return "", err
+	}
+	if uploadResult.Error.Message != "" {
+		log.Printf("cloudinary upload failed: %s", uploadResult.Error.Message)
+		return "", fmt.Errorf("cloudinary upload failed: %s", uploadResult.Error.Message)
+	}
+	return uploadResult.URL, nil
+}
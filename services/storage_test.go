@@ -18,41 +18,32 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 // SOFTWARE.
 
-package utils
+package services
 
 import (
 	"context"
-	"github.com/cloudinary/cloudinary-go"
+	"testing"
+
+	"github.com/cloudinary/cloudinary-go/api"
 	"github.com/cloudinary/cloudinary-go/api/uploader"
-	cldconfig "github.com/cloudinary/cloudinary-go/config"
-	"go.uber.org/zap"
 )
 
-// HandleFileUpload is a function that handles file uploads to Cloudinary.
-// It  uploads the file to Cloudinary and returns the Direct URL of the uploaded file.
-//
-// If any error occurs during the process, the function returns an empty string and the error.
-func HandleFileUpload(ctx context.Context, file interface{}, cloudinaryURL string) (string, error) {
-	var URLString string
-	cld, err := cloudinary.NewFromURL(cloudinaryURL)
-	if err != nil {
-		return "", err
-	}
-	var zapLogger, _ = zap.NewDevelopment()
-	cld.Logger.Writer = zapLogger.Sugar().With("source", "cloudinary")
-	cloudinaryConfig, err := cldconfig.NewFromURL(cloudinaryURL)
-	if err != nil {
-		return "", err
-	}
-	upload, err := uploader.NewWithConfiguration(cloudinaryConfig)
-	if err != nil {
-		return "", err
-	}
-	uploadResult, err := upload.Upload(ctx, file, uploader.UploadParams{})
-	if err != nil {
-		return "", err
+type stubUploader struct {
+	result uploader.UploadResult
+}
+
+func (s stubUploader) Upload(ctx context.Context, file interface{}, params uploader.UploadParams) (*uploader.UploadResult, error) {
+	return &s.result, nil
+}
+
+func TestCloudinaryStorageUpload(t *testing.T) {
+	storage := &CloudinaryStorage{upload: stubUploader{uploader.UploadResult{SecureURL: "https://res.cloudinary.com/v.mp4", URL: "http://res.cloudinary.com/v.mp4"}}}
+	if url, err := storage.Upload(context.Background(), "v.mp4"); err != nil || url != "http://res.cloudinary.com/v.mp4" {
+		t.Errorf("Upload() = %q, %v", url, err)
 	}
-	URLString = uploadResult.URL
-	return URLString, nil
 
+	storage = &CloudinaryStorage{upload: stubUploader{uploader.UploadResult{Error: api.ErrorResp{Message: "Invalid image file"}}}}
+	if url, err := storage.Upload(context.Background(), "v.mp4"); err == nil || url != "" {
+		t.Errorf("expected the error of the upload result, got %q, %v", url, err)
+	}
 }
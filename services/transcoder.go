@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Charles Ozochukwu
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/kingmariano/omnicron/utils"
+)
+
+// FFmpegTranscoder converts media with the ffmpeg binary on the host.
+type FFmpegTranscoder struct{}
+
+// ConvertFileToMP3 converts the file at inputFilePath to MP3 and returns the output path.
+func (FFmpegTranscoder) ConvertFileToMP3(inputFilePath string) (string, error) {
+	return utils.ConvertFileToMP3(inputFilePath)
+}
+
+// ConvertReaderToMP3 writes the media in reader to outputDir, converts it to MP3 and returns the output path.
+func (FFmpegTranscoder) ConvertReaderToMP3(reader io.Reader, outputDir string) (string, error) {
+	return utils.ConvertReaderToMP3(reader, outputDir)
+}
+
+// Clip writes the part of inputFilePath between start and end to outputFile.
+func (FFmpegTranscoder) Clip(ctx context.Context, inputFilePath, outputFile string, start, end time.Duration, reencode bool) error {
+	return utils.ClipFile(ctx, inputFilePath, outputFile, start, end, reencode)
+}
+
+// Concat joins inputFiles into outputFile.
+func (FFmpegTranscoder) Concat(ctx context.Context, inputFiles []string, outputFile string, reencode bool) error {
+	return utils.ConcatFiles(ctx, inputFiles, outputFile, reencode)
+}
+
+// MuxSubtitles writes the video at inputFilePath with subtitles to outputFile.
+func (FFmpegTranscoder) MuxSubtitles(ctx context.Context, inputFilePath string, subtitles []SubtitleFile, outputFile string) error {
+	paths := make([]string, len(subtitles))
+	languages := make([]string, len(subtitles))
+	for i, subtitle := range subtitles {
+		paths[i], languages[i] = subtitle.Path, subtitle.Language
+	}
+	return utils.MuxSubtitles(ctx, inputFilePath, paths, languages, outputFile)
+}
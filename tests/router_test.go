@@ -5,13 +5,16 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/kingmariano/omnicron/config"
+	"github.com/kingmariano/omnicron/internal/sidecar"
 	ware "github.com/kingmariano/omnicron/middleware"
 	"github.com/kingmariano/omnicron/packages/gpt"
 	"github.com/kingmariano/omnicron/packages/grok"
+	"github.com/kingmariano/omnicron/packages/llm"
 	"github.com/kingmariano/omnicron/packages/musicdownloader"
 	"github.com/kingmariano/omnicron/packages/replicate/generateimages"
 	"github.com/kingmariano/omnicron/packages/replicate/generatemusic"
@@ -20,6 +23,7 @@ import (
 	"github.com/kingmariano/omnicron/packages/replicate/stt"
 	"github.com/kingmariano/omnicron/packages/replicate/tts"
 	"github.com/kingmariano/omnicron/packages/videodownloader"
+	"github.com/kingmariano/omnicron/services"
 	"github.com/kingmariano/omnicron/utils"
 )
 
@@ -47,23 +51,50 @@ func setupRouter(t *testing.T) (*chi.Mux, *config.APIConfig) {
 		Port:            port,
 	}
 
+	httpClient := &http.Client{Timeout: 2 * time.Minute}
+	groqClient := services.NewGroqClient(cfg.GrokAPIKey, httpClient)
+	replicateClient, err := services.NewReplicateClient(cfg.ReplicateAPIKey, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := services.NewCloudinaryStorage(cfg.CloudinaryURL, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecarClient := sidecar.New(sidecar.Options{BaseURL: cfg.FASTAPIBaseURL, APIKey: cfg.SidecarAPIKey})
+	downloader, err := videodownloader.NewLuxDownloader(videodownloader.Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcoder := services.FFmpegTranscoder{}
+	modelsCfg := llm.DefaultConfig()
+	llmRouter, err := llm.NewRouter(modelsCfg,
+		llm.NewGroqProvider(groqClient, modelsCfg.GroqModels),
+		llm.NewG4FProvider(sidecarClient),
+		llm.NewReplicateProvider(replicateClient),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grokHandler := grok.NewHandler(groqClient, groqClient, llmRouter)
+
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
 	v1Router := chi.NewRouter()
 	v1Router.Get("/readiness", utils.HandleReadiness())
-	v1Router.Post("/grok/chatcompletion", ware.MiddleWareAuth(grok.ChatCompletion, cfg))
-	v1Router.Post("/grok/transcription", ware.MiddleWareAuth(grok.Transcription, cfg)) // deprecated
-	v1Router.Post("/replicate/imagegeneration", ware.MiddleWareAuth(generateimages.ImageGeneration, cfg))
-	v1Router.Post("/replicate/imageupscale", ware.MiddleWareAuth(imageupscale.ImageUpscale, cfg))
-	v1Router.Post("/replicate/videogeneration", ware.MiddleWareAuth(generatevideos.VideoGeneration, cfg))
-	v1Router.Post("/replicate/tts", ware.MiddleWareAuth(tts.TTS, cfg))
-	v1Router.Post("/replicate/stt", ware.MiddleWareAuth(stt.STT, cfg))
-	v1Router.Post("/replicate/musicgeneration", ware.MiddleWareAuth(generatemusic.MusicGen, cfg))
-	v1Router.Post("/downloadvideo", ware.MiddleWareAuth(videodownloader.DownloadVideo, cfg))
-	v1Router.Post("/downloadvideo", ware.MiddleWareAuth(musicdownloader.DownloadMusic, cfg))
-	v1Router.Post("/chatgpt", ware.MiddleWareAuth(gpt.ChatCompletion, cfg))
+	v1Router.Post("/grok/chatcompletion", ware.MiddleWareAuth(grokHandler.ChatCompletion, cfg))
+	v1Router.Post("/grok/transcription", ware.MiddleWareAuth(grokHandler.Transcription, cfg)) // deprecated
+	v1Router.Post("/replicate/imagegeneration", ware.MiddleWareAuth(generateimages.NewHandler(replicateClient).ImageGeneration, cfg))
+	v1Router.Post("/replicate/imageupscale", ware.MiddleWareAuth(imageupscale.NewHandler(replicateClient).ImageUpscale, cfg))
+	v1Router.Post("/replicate/videogeneration", ware.MiddleWareAuth(generatevideos.NewHandler(replicateClient).VideoGeneration, cfg))
+	v1Router.Post("/replicate/tts", ware.MiddleWareAuth(tts.NewHandler(replicateClient).TTS, cfg))
+	v1Router.Post("/replicate/stt", ware.MiddleWareAuth(stt.NewHandler(replicateClient).STT, cfg))
+	v1Router.Post("/replicate/musicgeneration", ware.MiddleWareAuth(generatemusic.NewHandler(replicateClient).MusicGen, cfg))
+	v1Router.Post("/downloadvideo", ware.MiddleWareAuth(videodownloader.NewHandler(downloader, downloader, downloader, transcoder, storage, nil).DownloadVideo, cfg))
+	v1Router.Post("/downloadvideo", ware.MiddleWareAuth(musicdownloader.NewHandler(sidecarClient, downloader, transcoder, storage).DownloadMusic, cfg))
+	v1Router.Post("/chatgpt", ware.MiddleWareAuth(gpt.NewHandler(sidecarClient, llm.NewG4FChat(llmRouter)).ChatCompletion, cfg))
 	router.Mount("/api/v1", v1Router)
 
 	return router, cfg
@@ -22,6 +22,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/h2non/filetype"
@@ -32,7 +33,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var ErrUnsupportedFileFormat = errors.New("unsupported file format")
@@ -100,6 +103,92 @@ func ConvertFileToMP3(inputFilePath string) (string, error) {
 	return outputFile, nil // Return the output file path
 }
 
+// ClipFile writes the part of inputFilePath between start and end to outputFile. An end of zero
+// clips to the end of the file. The streams are copied unless reencode is set, which is fast but
+// starts the clip at the keyframe before start. It re-encodes when copying fails.
+func ClipFile(ctx context.Context, inputFilePath, outputFile string, start, end time.Duration, reencode bool) error {
+	inputArgs := ffmpeg.KwArgs{"ss": ffmpegSeconds(start)}
+	if end > 0 {
+		inputArgs["to"] = ffmpegSeconds(end)
+	}
+	if !reencode {
+		err := runFFmpeg(ctx, ffmpeg.Input(inputFilePath, inputArgs).
+			Output(outputFile, ffmpeg.KwArgs{"c": "copy", "avoid_negative_ts": "make_zero"}))
+		if err == nil {
+			return nil
+		}
+		log.Printf("copying the streams of %s failed, re-encoding: %v", inputFilePath, err)
+	}
+	if err := runFFmpeg(ctx, ffmpeg.Input(inputFilePath, inputArgs).Output(outputFile)); err != nil {
+		return fmt.Errorf("error clipping file %s: %v", inputFilePath, err)
+	}
+	return nil
+}
+
+// ConcatFiles joins inputFiles into outputFile, in order. The streams are copied unless reencode
+// is set or copying fails, so the files should have the same codecs.
+func ConcatFiles(ctx context.Context, inputFiles []string, outputFile string, reencode bool) error {
+	var list strings.Builder
+	for _, file := range inputFiles {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		// The concat demuxer quotes paths like a shell.
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	listFile := outputFile + ".txt"
+	if err := os.WriteFile(listFile, []byte(list.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write the concat list: %w", err)
+	}
+	defer os.Remove(listFile)
+
+	inputArgs := ffmpeg.KwArgs{"f": "concat", "safe": 0}
+	if !reencode {
+		err := runFFmpeg(ctx, ffmpeg.Input(listFile, inputArgs).Output(outputFile, ffmpeg.KwArgs{"c": "copy"}))
+		if err == nil {
+			return nil
+		}
+		log.Printf("copying the streams of %d files failed, re-encoding: %v", len(inputFiles), err)
+	}
+	if err := runFFmpeg(ctx, ffmpeg.Input(listFile, inputArgs).Output(outputFile)); err != nil {
+		return fmt.Errorf("error joining %d files: %v", len(inputFiles), err)
+	}
+	return nil
+}
+
+// MuxSubtitles copies the streams of inputFilePath and the subtitle files to outputFile, tagging
+// the i-th subtitle with the i-th language. MP4 outputs store the subtitles as mov_text and other
+// outputs, such as MKV, as SRT.
+func MuxSubtitles(ctx context.Context, inputFilePath string, subtitlePaths, languages []string, outputFile string) error {
+	inputs := []*ffmpeg.Stream{ffmpeg.Input(inputFilePath)}
+	args := ffmpeg.KwArgs{"c": "copy", "c:s": "srt"}
+	if strings.EqualFold(filepath.Ext(outputFile), ".mp4") {
+		args["c:s"] = "mov_text"
+	}
+	for i, path := range subtitlePaths {
+		inputs = append(inputs, ffmpeg.Input(path))
+		if i < len(languages) && languages[i] != "" {
+			args[fmt.Sprintf("metadata:s:s:%d", i)] = "language=" + languages[i]
+		}
+	}
+	if err := runFFmpeg(ctx, ffmpeg.Output(inputs, outputFile, args)); err != nil {
+		return fmt.Errorf("error adding subtitles to %s: %v", inputFilePath, err)
+	}
+	return nil
+}
+
+// runFFmpeg runs stream, overwriting its output, and kills ffmpeg when ctx is done.
+func runFFmpeg(ctx context.Context, stream *ffmpeg.Stream) error {
+	stream.Context = ctx
+	return stream.OverWriteOutput().Run()
+}
+
+// ffmpegSeconds formats d as seconds for ffmpeg.
+func ffmpegSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
 // ConvertReaderToMP3 reads a video from an io.Reader and converts it to MP3.
 func ConvertReaderToMP3(reader io.Reader, outputDir string) (string, error) {
 	// read the content of the file being given convert to bytes to detect file type